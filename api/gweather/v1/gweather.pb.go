@@ -0,0 +1,1237 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.11
+// 	protoc        (unknown)
+// source: api/gweather/v1/gweather.proto
+
+package gweatherv1
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	structpb "google.golang.org/protobuf/types/known/structpb"
+	timestamppb "google.golang.org/protobuf/types/known/timestamppb"
+	reflect "reflect"
+	sync "sync"
+	unsafe "unsafe"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+type Transition_Type int32
+
+const (
+	Transition_TYPE_UNSPECIFIED Transition_Type = 0
+	Transition_TYPE_ISSUED      Transition_Type = 1
+	Transition_TYPE_UPDATED     Transition_Type = 2
+	Transition_TYPE_LIFTED      Transition_Type = 3
+)
+
+// Enum value maps for Transition_Type.
+var (
+	Transition_Type_name = map[int32]string{
+		0: "TYPE_UNSPECIFIED",
+		1: "TYPE_ISSUED",
+		2: "TYPE_UPDATED",
+		3: "TYPE_LIFTED",
+	}
+	Transition_Type_value = map[string]int32{
+		"TYPE_UNSPECIFIED": 0,
+		"TYPE_ISSUED":      1,
+		"TYPE_UPDATED":     2,
+		"TYPE_LIFTED":      3,
+	}
+)
+
+func (x Transition_Type) Enum() *Transition_Type {
+	p := new(Transition_Type)
+	*p = x
+	return p
+}
+
+func (x Transition_Type) String() string {
+	return protoimpl.X.EnumStringOf(x.Descriptor(), protoreflect.EnumNumber(x))
+}
+
+func (Transition_Type) Descriptor() protoreflect.EnumDescriptor {
+	return file_api_gweather_v1_gweather_proto_enumTypes[0].Descriptor()
+}
+
+func (Transition_Type) Type() protoreflect.EnumType {
+	return &file_api_gweather_v1_gweather_proto_enumTypes[0]
+}
+
+func (x Transition_Type) Number() protoreflect.EnumNumber {
+	return protoreflect.EnumNumber(x)
+}
+
+// Deprecated: Use Transition_Type.Descriptor instead.
+func (Transition_Type) EnumDescriptor() ([]byte, []int) {
+	return file_api_gweather_v1_gweather_proto_rawDescGZIP(), []int{4, 0}
+}
+
+// Report is a report of an entry of the feeds.
+type Report struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// key is the key of the report in the store, e.g. 気象特別警報・警報・注意報_盛岡地方気象台.
+	Key string `protobuf:"bytes,1,opt,name=key,proto3" json:"key,omitempty"`
+	// id is the id of the entry, e.g. urn:uuid:b0af90d4-23a8-3628-a489-2d40421838d6.
+	Id      string                 `protobuf:"bytes,2,opt,name=id,proto3" json:"id,omitempty"`
+	Title   string                 `protobuf:"bytes,3,opt,name=title,proto3" json:"title,omitempty"`
+	Office  string                 `protobuf:"bytes,4,opt,name=office,proto3" json:"office,omitempty"`
+	Feed    string                 `protobuf:"bytes,5,opt,name=feed,proto3" json:"feed,omitempty"`
+	Link    string                 `protobuf:"bytes,6,opt,name=link,proto3" json:"link,omitempty"`
+	Updated *timestamppb.Timestamp `protobuf:"bytes,7,opt,name=updated,proto3" json:"updated,omitempty"`
+	Content string                 `protobuf:"bytes,8,opt,name=content,proto3" json:"content,omitempty"`
+	// warnings are the warning kinds of each area in the report.
+	Warnings []*Warning `protobuf:"bytes,9,rep,name=warnings,proto3" json:"warnings,omitempty"`
+	// earthquake is set if the report is of an earthquake.
+	Earthquake *Earthquake `protobuf:"bytes,10,opt,name=earthquake,proto3" json:"earthquake,omitempty"`
+	// body is the body of the report converted from the JMA XML document.
+	Body          *structpb.Value `protobuf:"bytes,11,opt,name=body,proto3" json:"body,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Report) Reset() {
+	*x = Report{}
+	mi := &file_api_gweather_v1_gweather_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Report) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Report) ProtoMessage() {}
+
+func (x *Report) ProtoReflect() protoreflect.Message {
+	mi := &file_api_gweather_v1_gweather_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Report.ProtoReflect.Descriptor instead.
+func (*Report) Descriptor() ([]byte, []int) {
+	return file_api_gweather_v1_gweather_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *Report) GetKey() string {
+	if x != nil {
+		return x.Key
+	}
+	return ""
+}
+
+func (x *Report) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+func (x *Report) GetTitle() string {
+	if x != nil {
+		return x.Title
+	}
+	return ""
+}
+
+func (x *Report) GetOffice() string {
+	if x != nil {
+		return x.Office
+	}
+	return ""
+}
+
+func (x *Report) GetFeed() string {
+	if x != nil {
+		return x.Feed
+	}
+	return ""
+}
+
+func (x *Report) GetLink() string {
+	if x != nil {
+		return x.Link
+	}
+	return ""
+}
+
+func (x *Report) GetUpdated() *timestamppb.Timestamp {
+	if x != nil {
+		return x.Updated
+	}
+	return nil
+}
+
+func (x *Report) GetContent() string {
+	if x != nil {
+		return x.Content
+	}
+	return ""
+}
+
+func (x *Report) GetWarnings() []*Warning {
+	if x != nil {
+		return x.Warnings
+	}
+	return nil
+}
+
+func (x *Report) GetEarthquake() *Earthquake {
+	if x != nil {
+		return x.Earthquake
+	}
+	return nil
+}
+
+func (x *Report) GetBody() *structpb.Value {
+	if x != nil {
+		return x.Body
+	}
+	return nil
+}
+
+// Warning is a warning kind of an area in a report.
+type Warning struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// type is the type of the items, e.g. 気象警報・注意報（一次細分区域等）.
+	Type     string `protobuf:"bytes,1,opt,name=type,proto3" json:"type,omitempty"`
+	Area     string `protobuf:"bytes,2,opt,name=area,proto3" json:"area,omitempty"`
+	AreaName string `protobuf:"bytes,3,opt,name=area_name,json=areaName,proto3" json:"area_name,omitempty"`
+	Code     string `protobuf:"bytes,4,opt,name=code,proto3" json:"code,omitempty"`
+	Name     string `protobuf:"bytes,5,opt,name=name,proto3" json:"name,omitempty"`
+	// status is the status of the warning, e.g. 発表, 継続 or 解除.
+	Status string `protobuf:"bytes,6,opt,name=status,proto3" json:"status,omitempty"`
+	// notes are the notes of the warning, e.g. 突風.
+	Notes         []string `protobuf:"bytes,7,rep,name=notes,proto3" json:"notes,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Warning) Reset() {
+	*x = Warning{}
+	mi := &file_api_gweather_v1_gweather_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Warning) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Warning) ProtoMessage() {}
+
+func (x *Warning) ProtoReflect() protoreflect.Message {
+	mi := &file_api_gweather_v1_gweather_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Warning.ProtoReflect.Descriptor instead.
+func (*Warning) Descriptor() ([]byte, []int) {
+	return file_api_gweather_v1_gweather_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *Warning) GetType() string {
+	if x != nil {
+		return x.Type
+	}
+	return ""
+}
+
+func (x *Warning) GetArea() string {
+	if x != nil {
+		return x.Area
+	}
+	return ""
+}
+
+func (x *Warning) GetAreaName() string {
+	if x != nil {
+		return x.AreaName
+	}
+	return ""
+}
+
+func (x *Warning) GetCode() string {
+	if x != nil {
+		return x.Code
+	}
+	return ""
+}
+
+func (x *Warning) GetName() string {
+	if x != nil {
+		return x.Name
+	}
+	return ""
+}
+
+func (x *Warning) GetStatus() string {
+	if x != nil {
+		return x.Status
+	}
+	return ""
+}
+
+func (x *Warning) GetNotes() []string {
+	if x != nil {
+		return x.Notes
+	}
+	return nil
+}
+
+// AreaWarning is a warning kind currently active in an area.
+type AreaWarning struct {
+	state   protoimpl.MessageState `protogen:"open.v1"`
+	Warning *Warning               `protobuf:"bytes,1,opt,name=warning,proto3" json:"warning,omitempty"`
+	// issued is the time when the report was updated.
+	Issued *timestamppb.Timestamp `protobuf:"bytes,2,opt,name=issued,proto3" json:"issued,omitempty"`
+	// key is the key of the report.
+	Key           string `protobuf:"bytes,3,opt,name=key,proto3" json:"key,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *AreaWarning) Reset() {
+	*x = AreaWarning{}
+	mi := &file_api_gweather_v1_gweather_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *AreaWarning) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*AreaWarning) ProtoMessage() {}
+
+func (x *AreaWarning) ProtoReflect() protoreflect.Message {
+	mi := &file_api_gweather_v1_gweather_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use AreaWarning.ProtoReflect.Descriptor instead.
+func (*AreaWarning) Descriptor() ([]byte, []int) {
+	return file_api_gweather_v1_gweather_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *AreaWarning) GetWarning() *Warning {
+	if x != nil {
+		return x.Warning
+	}
+	return nil
+}
+
+func (x *AreaWarning) GetIssued() *timestamppb.Timestamp {
+	if x != nil {
+		return x.Issued
+	}
+	return nil
+}
+
+func (x *AreaWarning) GetKey() string {
+	if x != nil {
+		return x.Key
+	}
+	return ""
+}
+
+// Earthquake is the hypocenter and the intensity of an earthquake report.
+type Earthquake struct {
+	state       protoimpl.MessageState `protogen:"open.v1"`
+	OriginTime  *timestamppb.Timestamp `protobuf:"bytes,1,opt,name=origin_time,json=originTime,proto3" json:"origin_time,omitempty"`
+	ArrivalTime *timestamppb.Timestamp `protobuf:"bytes,2,opt,name=arrival_time,json=arrivalTime,proto3" json:"arrival_time,omitempty"`
+	// hypocenter is the name of the hypocenter, e.g. 岩手県沖.
+	Hypocenter     string `protobuf:"bytes,3,opt,name=hypocenter,proto3" json:"hypocenter,omitempty"`
+	HypocenterCode string `protobuf:"bytes,4,opt,name=hypocenter_code,json=hypocenterCode,proto3" json:"hypocenter_code,omitempty"`
+	// coordinate is the coordinate of the hypocenter in ISO 6709, e.g. +39.8+142.3-50000/.
+	Coordinate string `protobuf:"bytes,5,opt,name=coordinate,proto3" json:"coordinate,omitempty"`
+	// latitude, longitude and depth (km) are set if the coordinate is known.
+	Latitude  *float64 `protobuf:"fixed64,6,opt,name=latitude,proto3,oneof" json:"latitude,omitempty"`
+	Longitude *float64 `protobuf:"fixed64,7,opt,name=longitude,proto3,oneof" json:"longitude,omitempty"`
+	Depth     *float64 `protobuf:"fixed64,8,opt,name=depth,proto3,oneof" json:"depth,omitempty"`
+	// magnitude is the magnitude, which is NaN when it is unknown.
+	Magnitude string `protobuf:"bytes,9,opt,name=magnitude,proto3" json:"magnitude,omitempty"`
+	// max_intensity is the maximum seismic intensity observed, e.g. 5-.
+	MaxIntensity  string `protobuf:"bytes,10,opt,name=max_intensity,json=maxIntensity,proto3" json:"max_intensity,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Earthquake) Reset() {
+	*x = Earthquake{}
+	mi := &file_api_gweather_v1_gweather_proto_msgTypes[3]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Earthquake) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Earthquake) ProtoMessage() {}
+
+func (x *Earthquake) ProtoReflect() protoreflect.Message {
+	mi := &file_api_gweather_v1_gweather_proto_msgTypes[3]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Earthquake.ProtoReflect.Descriptor instead.
+func (*Earthquake) Descriptor() ([]byte, []int) {
+	return file_api_gweather_v1_gweather_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *Earthquake) GetOriginTime() *timestamppb.Timestamp {
+	if x != nil {
+		return x.OriginTime
+	}
+	return nil
+}
+
+func (x *Earthquake) GetArrivalTime() *timestamppb.Timestamp {
+	if x != nil {
+		return x.ArrivalTime
+	}
+	return nil
+}
+
+func (x *Earthquake) GetHypocenter() string {
+	if x != nil {
+		return x.Hypocenter
+	}
+	return ""
+}
+
+func (x *Earthquake) GetHypocenterCode() string {
+	if x != nil {
+		return x.HypocenterCode
+	}
+	return ""
+}
+
+func (x *Earthquake) GetCoordinate() string {
+	if x != nil {
+		return x.Coordinate
+	}
+	return ""
+}
+
+func (x *Earthquake) GetLatitude() float64 {
+	if x != nil && x.Latitude != nil {
+		return *x.Latitude
+	}
+	return 0
+}
+
+func (x *Earthquake) GetLongitude() float64 {
+	if x != nil && x.Longitude != nil {
+		return *x.Longitude
+	}
+	return 0
+}
+
+func (x *Earthquake) GetDepth() float64 {
+	if x != nil && x.Depth != nil {
+		return *x.Depth
+	}
+	return 0
+}
+
+func (x *Earthquake) GetMagnitude() string {
+	if x != nil {
+		return x.Magnitude
+	}
+	return ""
+}
+
+func (x *Earthquake) GetMaxIntensity() string {
+	if x != nil {
+		return x.MaxIntensity
+	}
+	return ""
+}
+
+// Transition is a change of a warning kind in an area between two reports.
+type Transition struct {
+	state    protoimpl.MessageState `protogen:"open.v1"`
+	Type     Transition_Type        `protobuf:"varint,1,opt,name=type,proto3,enum=gweather.v1.Transition_Type" json:"type,omitempty"`
+	Area     string                 `protobuf:"bytes,2,opt,name=area,proto3" json:"area,omitempty"`
+	AreaName string                 `protobuf:"bytes,3,opt,name=area_name,json=areaName,proto3" json:"area_name,omitempty"`
+	Code     string                 `protobuf:"bytes,4,opt,name=code,proto3" json:"code,omitempty"`
+	Name     string                 `protobuf:"bytes,5,opt,name=name,proto3" json:"name,omitempty"`
+	// from is the status in the previous report, which is empty when the warning is issued.
+	From string `protobuf:"bytes,6,opt,name=from,proto3" json:"from,omitempty"`
+	// to is the status in the current report, which is empty when the warning is no longer in the report.
+	To            string `protobuf:"bytes,7,opt,name=to,proto3" json:"to,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Transition) Reset() {
+	*x = Transition{}
+	mi := &file_api_gweather_v1_gweather_proto_msgTypes[4]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Transition) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Transition) ProtoMessage() {}
+
+func (x *Transition) ProtoReflect() protoreflect.Message {
+	mi := &file_api_gweather_v1_gweather_proto_msgTypes[4]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Transition.ProtoReflect.Descriptor instead.
+func (*Transition) Descriptor() ([]byte, []int) {
+	return file_api_gweather_v1_gweather_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *Transition) GetType() Transition_Type {
+	if x != nil {
+		return x.Type
+	}
+	return Transition_TYPE_UNSPECIFIED
+}
+
+func (x *Transition) GetArea() string {
+	if x != nil {
+		return x.Area
+	}
+	return ""
+}
+
+func (x *Transition) GetAreaName() string {
+	if x != nil {
+		return x.AreaName
+	}
+	return ""
+}
+
+func (x *Transition) GetCode() string {
+	if x != nil {
+		return x.Code
+	}
+	return ""
+}
+
+func (x *Transition) GetName() string {
+	if x != nil {
+		return x.Name
+	}
+	return ""
+}
+
+func (x *Transition) GetFrom() string {
+	if x != nil {
+		return x.From
+	}
+	return ""
+}
+
+func (x *Transition) GetTo() string {
+	if x != nil {
+		return x.To
+	}
+	return ""
+}
+
+// Event is a new report written to the store, or a transition of a warning in it.
+type Event struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// id is the ID of the event, which is shared by the events of a report and ordered by the time of the report.
+	Id     string `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	Key    string `protobuf:"bytes,2,opt,name=key,proto3" json:"key,omitempty"`
+	Title  string `protobuf:"bytes,3,opt,name=title,proto3" json:"title,omitempty"`
+	Office string `protobuf:"bytes,4,opt,name=office,proto3" json:"office,omitempty"`
+	// Types that are valid to be assigned to Payload:
+	//
+	//	*Event_Report
+	//	*Event_Transition
+	Payload       isEvent_Payload `protobuf_oneof:"payload"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Event) Reset() {
+	*x = Event{}
+	mi := &file_api_gweather_v1_gweather_proto_msgTypes[5]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Event) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Event) ProtoMessage() {}
+
+func (x *Event) ProtoReflect() protoreflect.Message {
+	mi := &file_api_gweather_v1_gweather_proto_msgTypes[5]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Event.ProtoReflect.Descriptor instead.
+func (*Event) Descriptor() ([]byte, []int) {
+	return file_api_gweather_v1_gweather_proto_rawDescGZIP(), []int{5}
+}
+
+func (x *Event) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+func (x *Event) GetKey() string {
+	if x != nil {
+		return x.Key
+	}
+	return ""
+}
+
+func (x *Event) GetTitle() string {
+	if x != nil {
+		return x.Title
+	}
+	return ""
+}
+
+func (x *Event) GetOffice() string {
+	if x != nil {
+		return x.Office
+	}
+	return ""
+}
+
+func (x *Event) GetPayload() isEvent_Payload {
+	if x != nil {
+		return x.Payload
+	}
+	return nil
+}
+
+func (x *Event) GetReport() *Report {
+	if x != nil {
+		if x, ok := x.Payload.(*Event_Report); ok {
+			return x.Report
+		}
+	}
+	return nil
+}
+
+func (x *Event) GetTransition() *Transition {
+	if x != nil {
+		if x, ok := x.Payload.(*Event_Transition); ok {
+			return x.Transition
+		}
+	}
+	return nil
+}
+
+type isEvent_Payload interface {
+	isEvent_Payload()
+}
+
+type Event_Report struct {
+	Report *Report `protobuf:"bytes,5,opt,name=report,proto3,oneof"`
+}
+
+type Event_Transition struct {
+	Transition *Transition `protobuf:"bytes,6,opt,name=transition,proto3,oneof"`
+}
+
+func (*Event_Report) isEvent_Payload() {}
+
+func (*Event_Transition) isEvent_Payload() {}
+
+// Filter selects reports and events. An empty field matches every report.
+type Filter struct {
+	state   protoimpl.MessageState `protogen:"open.v1"`
+	Titles  []string               `protobuf:"bytes,1,rep,name=titles,proto3" json:"titles,omitempty"`
+	Offices []string               `protobuf:"bytes,2,rep,name=offices,proto3" json:"offices,omitempty"`
+	// areas are the area codes, e.g. 030010.
+	Areas []string `protobuf:"bytes,3,rep,name=areas,proto3" json:"areas,omitempty"`
+	// kinds are the warning kind codes, e.g. 14.
+	Kinds         []string `protobuf:"bytes,4,rep,name=kinds,proto3" json:"kinds,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Filter) Reset() {
+	*x = Filter{}
+	mi := &file_api_gweather_v1_gweather_proto_msgTypes[6]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Filter) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Filter) ProtoMessage() {}
+
+func (x *Filter) ProtoReflect() protoreflect.Message {
+	mi := &file_api_gweather_v1_gweather_proto_msgTypes[6]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Filter.ProtoReflect.Descriptor instead.
+func (*Filter) Descriptor() ([]byte, []int) {
+	return file_api_gweather_v1_gweather_proto_rawDescGZIP(), []int{6}
+}
+
+func (x *Filter) GetTitles() []string {
+	if x != nil {
+		return x.Titles
+	}
+	return nil
+}
+
+func (x *Filter) GetOffices() []string {
+	if x != nil {
+		return x.Offices
+	}
+	return nil
+}
+
+func (x *Filter) GetAreas() []string {
+	if x != nil {
+		return x.Areas
+	}
+	return nil
+}
+
+func (x *Filter) GetKinds() []string {
+	if x != nil {
+		return x.Kinds
+	}
+	return nil
+}
+
+type GetReportRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Key           string                 `protobuf:"bytes,1,opt,name=key,proto3" json:"key,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GetReportRequest) Reset() {
+	*x = GetReportRequest{}
+	mi := &file_api_gweather_v1_gweather_proto_msgTypes[7]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetReportRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetReportRequest) ProtoMessage() {}
+
+func (x *GetReportRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_api_gweather_v1_gweather_proto_msgTypes[7]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetReportRequest.ProtoReflect.Descriptor instead.
+func (*GetReportRequest) Descriptor() ([]byte, []int) {
+	return file_api_gweather_v1_gweather_proto_rawDescGZIP(), []int{7}
+}
+
+func (x *GetReportRequest) GetKey() string {
+	if x != nil {
+		return x.Key
+	}
+	return ""
+}
+
+type ListReportsRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Filter        *Filter                `protobuf:"bytes,1,opt,name=filter,proto3" json:"filter,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ListReportsRequest) Reset() {
+	*x = ListReportsRequest{}
+	mi := &file_api_gweather_v1_gweather_proto_msgTypes[8]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ListReportsRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListReportsRequest) ProtoMessage() {}
+
+func (x *ListReportsRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_api_gweather_v1_gweather_proto_msgTypes[8]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListReportsRequest.ProtoReflect.Descriptor instead.
+func (*ListReportsRequest) Descriptor() ([]byte, []int) {
+	return file_api_gweather_v1_gweather_proto_rawDescGZIP(), []int{8}
+}
+
+func (x *ListReportsRequest) GetFilter() *Filter {
+	if x != nil {
+		return x.Filter
+	}
+	return nil
+}
+
+type ListReportsResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Reports       []*Report              `protobuf:"bytes,1,rep,name=reports,proto3" json:"reports,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ListReportsResponse) Reset() {
+	*x = ListReportsResponse{}
+	mi := &file_api_gweather_v1_gweather_proto_msgTypes[9]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ListReportsResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListReportsResponse) ProtoMessage() {}
+
+func (x *ListReportsResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_api_gweather_v1_gweather_proto_msgTypes[9]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListReportsResponse.ProtoReflect.Descriptor instead.
+func (*ListReportsResponse) Descriptor() ([]byte, []int) {
+	return file_api_gweather_v1_gweather_proto_rawDescGZIP(), []int{9}
+}
+
+func (x *ListReportsResponse) GetReports() []*Report {
+	if x != nil {
+		return x.Reports
+	}
+	return nil
+}
+
+type ListWarningsRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Area          string                 `protobuf:"bytes,1,opt,name=area,proto3" json:"area,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ListWarningsRequest) Reset() {
+	*x = ListWarningsRequest{}
+	mi := &file_api_gweather_v1_gweather_proto_msgTypes[10]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ListWarningsRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListWarningsRequest) ProtoMessage() {}
+
+func (x *ListWarningsRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_api_gweather_v1_gweather_proto_msgTypes[10]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListWarningsRequest.ProtoReflect.Descriptor instead.
+func (*ListWarningsRequest) Descriptor() ([]byte, []int) {
+	return file_api_gweather_v1_gweather_proto_rawDescGZIP(), []int{10}
+}
+
+func (x *ListWarningsRequest) GetArea() string {
+	if x != nil {
+		return x.Area
+	}
+	return ""
+}
+
+type ListWarningsResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Warnings      []*AreaWarning         `protobuf:"bytes,1,rep,name=warnings,proto3" json:"warnings,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ListWarningsResponse) Reset() {
+	*x = ListWarningsResponse{}
+	mi := &file_api_gweather_v1_gweather_proto_msgTypes[11]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ListWarningsResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListWarningsResponse) ProtoMessage() {}
+
+func (x *ListWarningsResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_api_gweather_v1_gweather_proto_msgTypes[11]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListWarningsResponse.ProtoReflect.Descriptor instead.
+func (*ListWarningsResponse) Descriptor() ([]byte, []int) {
+	return file_api_gweather_v1_gweather_proto_rawDescGZIP(), []int{11}
+}
+
+func (x *ListWarningsResponse) GetWarnings() []*AreaWarning {
+	if x != nil {
+		return x.Warnings
+	}
+	return nil
+}
+
+type SubscribeRequest struct {
+	state  protoimpl.MessageState `protogen:"open.v1"`
+	Filter *Filter                `protobuf:"bytes,1,opt,name=filter,proto3" json:"filter,omitempty"`
+	// last_event_id is the ID of the last event received to resume after it.
+	LastEventId   string `protobuf:"bytes,2,opt,name=last_event_id,json=lastEventId,proto3" json:"last_event_id,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *SubscribeRequest) Reset() {
+	*x = SubscribeRequest{}
+	mi := &file_api_gweather_v1_gweather_proto_msgTypes[12]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *SubscribeRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SubscribeRequest) ProtoMessage() {}
+
+func (x *SubscribeRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_api_gweather_v1_gweather_proto_msgTypes[12]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SubscribeRequest.ProtoReflect.Descriptor instead.
+func (*SubscribeRequest) Descriptor() ([]byte, []int) {
+	return file_api_gweather_v1_gweather_proto_rawDescGZIP(), []int{12}
+}
+
+func (x *SubscribeRequest) GetFilter() *Filter {
+	if x != nil {
+		return x.Filter
+	}
+	return nil
+}
+
+func (x *SubscribeRequest) GetLastEventId() string {
+	if x != nil {
+		return x.LastEventId
+	}
+	return ""
+}
+
+var File_api_gweather_v1_gweather_proto protoreflect.FileDescriptor
+
+const file_api_gweather_v1_gweather_proto_rawDesc = "" +
+	"\n" +
+	"\x1eapi/gweather/v1/gweather.proto\x12\vgweather.v1\x1a\x1cgoogle/protobuf/struct.proto\x1a\x1fgoogle/protobuf/timestamp.proto\"\xe7\x02\n" +
+	"\x06Report\x12\x10\n" +
+	"\x03key\x18\x01 \x01(\tR\x03key\x12\x0e\n" +
+	"\x02id\x18\x02 \x01(\tR\x02id\x12\x14\n" +
+	"\x05title\x18\x03 \x01(\tR\x05title\x12\x16\n" +
+	"\x06office\x18\x04 \x01(\tR\x06office\x12\x12\n" +
+	"\x04feed\x18\x05 \x01(\tR\x04feed\x12\x12\n" +
+	"\x04link\x18\x06 \x01(\tR\x04link\x124\n" +
+	"\aupdated\x18\a \x01(\v2\x1a.google.protobuf.TimestampR\aupdated\x12\x18\n" +
+	"\acontent\x18\b \x01(\tR\acontent\x120\n" +
+	"\bwarnings\x18\t \x03(\v2\x14.gweather.v1.WarningR\bwarnings\x127\n" +
+	"\n" +
+	"earthquake\x18\n" +
+	" \x01(\v2\x17.gweather.v1.EarthquakeR\n" +
+	"earthquake\x12*\n" +
+	"\x04body\x18\v \x01(\v2\x16.google.protobuf.ValueR\x04body\"\xa4\x01\n" +
+	"\aWarning\x12\x12\n" +
+	"\x04type\x18\x01 \x01(\tR\x04type\x12\x12\n" +
+	"\x04area\x18\x02 \x01(\tR\x04area\x12\x1b\n" +
+	"\tarea_name\x18\x03 \x01(\tR\bareaName\x12\x12\n" +
+	"\x04code\x18\x04 \x01(\tR\x04code\x12\x12\n" +
+	"\x04name\x18\x05 \x01(\tR\x04name\x12\x16\n" +
+	"\x06status\x18\x06 \x01(\tR\x06status\x12\x14\n" +
+	"\x05notes\x18\a \x03(\tR\x05notes\"\x83\x01\n" +
+	"\vAreaWarning\x12.\n" +
+	"\awarning\x18\x01 \x01(\v2\x14.gweather.v1.WarningR\awarning\x122\n" +
+	"\x06issued\x18\x02 \x01(\v2\x1a.google.protobuf.TimestampR\x06issued\x12\x10\n" +
+	"\x03key\x18\x03 \x01(\tR\x03key\"\xb8\x03\n" +
+	"\n" +
+	"Earthquake\x12;\n" +
+	"\vorigin_time\x18\x01 \x01(\v2\x1a.google.protobuf.TimestampR\n" +
+	"originTime\x12=\n" +
+	"\farrival_time\x18\x02 \x01(\v2\x1a.google.protobuf.TimestampR\varrivalTime\x12\x1e\n" +
+	"\n" +
+	"hypocenter\x18\x03 \x01(\tR\n" +
+	"hypocenter\x12'\n" +
+	"\x0fhypocenter_code\x18\x04 \x01(\tR\x0ehypocenterCode\x12\x1e\n" +
+	"\n" +
+	"coordinate\x18\x05 \x01(\tR\n" +
+	"coordinate\x12\x1f\n" +
+	"\blatitude\x18\x06 \x01(\x01H\x00R\blatitude\x88\x01\x01\x12!\n" +
+	"\tlongitude\x18\a \x01(\x01H\x01R\tlongitude\x88\x01\x01\x12\x19\n" +
+	"\x05depth\x18\b \x01(\x01H\x02R\x05depth\x88\x01\x01\x12\x1c\n" +
+	"\tmagnitude\x18\t \x01(\tR\tmagnitude\x12#\n" +
+	"\rmax_intensity\x18\n" +
+	" \x01(\tR\fmaxIntensityB\v\n" +
+	"\t_latitudeB\f\n" +
+	"\n" +
+	"_longitudeB\b\n" +
+	"\x06_depth\"\x8d\x02\n" +
+	"\n" +
+	"Transition\x120\n" +
+	"\x04type\x18\x01 \x01(\x0e2\x1c.gweather.v1.Transition.TypeR\x04type\x12\x12\n" +
+	"\x04area\x18\x02 \x01(\tR\x04area\x12\x1b\n" +
+	"\tarea_name\x18\x03 \x01(\tR\bareaName\x12\x12\n" +
+	"\x04code\x18\x04 \x01(\tR\x04code\x12\x12\n" +
+	"\x04name\x18\x05 \x01(\tR\x04name\x12\x12\n" +
+	"\x04from\x18\x06 \x01(\tR\x04from\x12\x0e\n" +
+	"\x02to\x18\a \x01(\tR\x02to\"P\n" +
+	"\x04Type\x12\x14\n" +
+	"\x10TYPE_UNSPECIFIED\x10\x00\x12\x0f\n" +
+	"\vTYPE_ISSUED\x10\x01\x12\x10\n" +
+	"\fTYPE_UPDATED\x10\x02\x12\x0f\n" +
+	"\vTYPE_LIFTED\x10\x03\"\xcc\x01\n" +
+	"\x05Event\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\tR\x02id\x12\x10\n" +
+	"\x03key\x18\x02 \x01(\tR\x03key\x12\x14\n" +
+	"\x05title\x18\x03 \x01(\tR\x05title\x12\x16\n" +
+	"\x06office\x18\x04 \x01(\tR\x06office\x12-\n" +
+	"\x06report\x18\x05 \x01(\v2\x13.gweather.v1.ReportH\x00R\x06report\x129\n" +
+	"\n" +
+	"transition\x18\x06 \x01(\v2\x17.gweather.v1.TransitionH\x00R\n" +
+	"transitionB\t\n" +
+	"\apayload\"f\n" +
+	"\x06Filter\x12\x16\n" +
+	"\x06titles\x18\x01 \x03(\tR\x06titles\x12\x18\n" +
+	"\aoffices\x18\x02 \x03(\tR\aoffices\x12\x14\n" +
+	"\x05areas\x18\x03 \x03(\tR\x05areas\x12\x14\n" +
+	"\x05kinds\x18\x04 \x03(\tR\x05kinds\"$\n" +
+	"\x10GetReportRequest\x12\x10\n" +
+	"\x03key\x18\x01 \x01(\tR\x03key\"A\n" +
+	"\x12ListReportsRequest\x12+\n" +
+	"\x06filter\x18\x01 \x01(\v2\x13.gweather.v1.FilterR\x06filter\"D\n" +
+	"\x13ListReportsResponse\x12-\n" +
+	"\areports\x18\x01 \x03(\v2\x13.gweather.v1.ReportR\areports\")\n" +
+	"\x13ListWarningsRequest\x12\x12\n" +
+	"\x04area\x18\x01 \x01(\tR\x04area\"L\n" +
+	"\x14ListWarningsResponse\x124\n" +
+	"\bwarnings\x18\x01 \x03(\v2\x18.gweather.v1.AreaWarningR\bwarnings\"c\n" +
+	"\x10SubscribeRequest\x12+\n" +
+	"\x06filter\x18\x01 \x01(\v2\x13.gweather.v1.FilterR\x06filter\x12\"\n" +
+	"\rlast_event_id\x18\x02 \x01(\tR\vlastEventId2\xb9\x02\n" +
+	"\rReportService\x12?\n" +
+	"\tGetReport\x12\x1d.gweather.v1.GetReportRequest\x1a\x13.gweather.v1.Report\x12P\n" +
+	"\vListReports\x12\x1f.gweather.v1.ListReportsRequest\x1a .gweather.v1.ListReportsResponse\x12S\n" +
+	"\fListWarnings\x12 .gweather.v1.ListWarningsRequest\x1a!.gweather.v1.ListWarningsResponse\x12@\n" +
+	"\tSubscribe\x12\x1d.gweather.v1.SubscribeRequest\x1a\x12.gweather.v1.Event0\x01B6Z4github.com/hlts2/gweather/api/gweather/v1;gweatherv1b\x06proto3"
+
+var (
+	file_api_gweather_v1_gweather_proto_rawDescOnce sync.Once
+	file_api_gweather_v1_gweather_proto_rawDescData []byte
+)
+
+func file_api_gweather_v1_gweather_proto_rawDescGZIP() []byte {
+	file_api_gweather_v1_gweather_proto_rawDescOnce.Do(func() {
+		file_api_gweather_v1_gweather_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_api_gweather_v1_gweather_proto_rawDesc), len(file_api_gweather_v1_gweather_proto_rawDesc)))
+	})
+	return file_api_gweather_v1_gweather_proto_rawDescData
+}
+
+var file_api_gweather_v1_gweather_proto_enumTypes = make([]protoimpl.EnumInfo, 1)
+var file_api_gweather_v1_gweather_proto_msgTypes = make([]protoimpl.MessageInfo, 13)
+var file_api_gweather_v1_gweather_proto_goTypes = []any{
+	(Transition_Type)(0),          // 0: gweather.v1.Transition.Type
+	(*Report)(nil),                // 1: gweather.v1.Report
+	(*Warning)(nil),               // 2: gweather.v1.Warning
+	(*AreaWarning)(nil),           // 3: gweather.v1.AreaWarning
+	(*Earthquake)(nil),            // 4: gweather.v1.Earthquake
+	(*Transition)(nil),            // 5: gweather.v1.Transition
+	(*Event)(nil),                 // 6: gweather.v1.Event
+	(*Filter)(nil),                // 7: gweather.v1.Filter
+	(*GetReportRequest)(nil),      // 8: gweather.v1.GetReportRequest
+	(*ListReportsRequest)(nil),    // 9: gweather.v1.ListReportsRequest
+	(*ListReportsResponse)(nil),   // 10: gweather.v1.ListReportsResponse
+	(*ListWarningsRequest)(nil),   // 11: gweather.v1.ListWarningsRequest
+	(*ListWarningsResponse)(nil),  // 12: gweather.v1.ListWarningsResponse
+	(*SubscribeRequest)(nil),      // 13: gweather.v1.SubscribeRequest
+	(*timestamppb.Timestamp)(nil), // 14: google.protobuf.Timestamp
+	(*structpb.Value)(nil),        // 15: google.protobuf.Value
+}
+var file_api_gweather_v1_gweather_proto_depIdxs = []int32{
+	14, // 0: gweather.v1.Report.updated:type_name -> google.protobuf.Timestamp
+	2,  // 1: gweather.v1.Report.warnings:type_name -> gweather.v1.Warning
+	4,  // 2: gweather.v1.Report.earthquake:type_name -> gweather.v1.Earthquake
+	15, // 3: gweather.v1.Report.body:type_name -> google.protobuf.Value
+	2,  // 4: gweather.v1.AreaWarning.warning:type_name -> gweather.v1.Warning
+	14, // 5: gweather.v1.AreaWarning.issued:type_name -> google.protobuf.Timestamp
+	14, // 6: gweather.v1.Earthquake.origin_time:type_name -> google.protobuf.Timestamp
+	14, // 7: gweather.v1.Earthquake.arrival_time:type_name -> google.protobuf.Timestamp
+	0,  // 8: gweather.v1.Transition.type:type_name -> gweather.v1.Transition.Type
+	1,  // 9: gweather.v1.Event.report:type_name -> gweather.v1.Report
+	5,  // 10: gweather.v1.Event.transition:type_name -> gweather.v1.Transition
+	7,  // 11: gweather.v1.ListReportsRequest.filter:type_name -> gweather.v1.Filter
+	1,  // 12: gweather.v1.ListReportsResponse.reports:type_name -> gweather.v1.Report
+	3,  // 13: gweather.v1.ListWarningsResponse.warnings:type_name -> gweather.v1.AreaWarning
+	7,  // 14: gweather.v1.SubscribeRequest.filter:type_name -> gweather.v1.Filter
+	8,  // 15: gweather.v1.ReportService.GetReport:input_type -> gweather.v1.GetReportRequest
+	9,  // 16: gweather.v1.ReportService.ListReports:input_type -> gweather.v1.ListReportsRequest
+	11, // 17: gweather.v1.ReportService.ListWarnings:input_type -> gweather.v1.ListWarningsRequest
+	13, // 18: gweather.v1.ReportService.Subscribe:input_type -> gweather.v1.SubscribeRequest
+	1,  // 19: gweather.v1.ReportService.GetReport:output_type -> gweather.v1.Report
+	10, // 20: gweather.v1.ReportService.ListReports:output_type -> gweather.v1.ListReportsResponse
+	12, // 21: gweather.v1.ReportService.ListWarnings:output_type -> gweather.v1.ListWarningsResponse
+	6,  // 22: gweather.v1.ReportService.Subscribe:output_type -> gweather.v1.Event
+	19, // [19:23] is the sub-list for method output_type
+	15, // [15:19] is the sub-list for method input_type
+	15, // [15:15] is the sub-list for extension type_name
+	15, // [15:15] is the sub-list for extension extendee
+	0,  // [0:15] is the sub-list for field type_name
+}
+
+func init() { file_api_gweather_v1_gweather_proto_init() }
+func file_api_gweather_v1_gweather_proto_init() {
+	if File_api_gweather_v1_gweather_proto != nil {
+		return
+	}
+	file_api_gweather_v1_gweather_proto_msgTypes[3].OneofWrappers = []any{}
+	file_api_gweather_v1_gweather_proto_msgTypes[5].OneofWrappers = []any{
+		(*Event_Report)(nil),
+		(*Event_Transition)(nil),
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_api_gweather_v1_gweather_proto_rawDesc), len(file_api_gweather_v1_gweather_proto_rawDesc)),
+			NumEnums:      1,
+			NumMessages:   13,
+			NumExtensions: 0,
+			NumServices:   1,
+		},
+		GoTypes:           file_api_gweather_v1_gweather_proto_goTypes,
+		DependencyIndexes: file_api_gweather_v1_gweather_proto_depIdxs,
+		EnumInfos:         file_api_gweather_v1_gweather_proto_enumTypes,
+		MessageInfos:      file_api_gweather_v1_gweather_proto_msgTypes,
+	}.Build()
+	File_api_gweather_v1_gweather_proto = out.File
+	file_api_gweather_v1_gweather_proto_goTypes = nil
+	file_api_gweather_v1_gweather_proto_depIdxs = nil
+}
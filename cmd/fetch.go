@@ -0,0 +1,109 @@
+package cmd
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+
+	f "github.com/hlts2/gweather/internal/fetcher"
+	"github.com/hlts2/gweather/internal/log"
+	"github.com/hlts2/gweather/internal/printer"
+	"github.com/hlts2/gweather/internal/report"
+)
+
+var fetchCmd = &cobra.Command{
+	Use:   "fetch [URL or file]",
+	Short: "Fetch weather information once and print it to stdout",
+	Args:  cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return errors.WithStack(runFetch(cmd, args))
+	},
+}
+
+func runFetch(cmd *cobra.Command, args []string) error {
+	// stdout is reserved for the results.
+	log.SetOutput(os.Stderr)
+
+	src := WeatherInfoURL
+	if len(args) > 0 {
+		src = args[0]
+	}
+
+	u, err := sourceURL(src)
+	if err != nil {
+		return errors.Wrapf(err, "faild to parse source: %s", src)
+	}
+
+	t := http.DefaultTransport.(*http.Transport).Clone()
+	t.RegisterProtocol("file", http.NewFileTransport(http.Dir("/")))
+
+	tmpl, err := report.NewKeyTemplate(cfg.Redis.KeyTemplate)
+	if err != nil {
+		return err
+	}
+
+	fetcher := f.New(f.WithClient(&http.Client{
+		Transport: t,
+	}), f.WithKeyTemplate(tmpl))
+
+	mm, ferr := fetcher.Fetch(context.Background(), u)
+	if ferr != nil {
+		logger.Named(log.SubsystemFetcher).Errorf("faild to fetch contents: %v", ferr)
+	}
+
+	keys := make([]string, 0, len(mm))
+	for key := range mm {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	reports := make([]printer.Report, 0, len(keys))
+	for _, key := range keys {
+		reports = append(reports, printer.Report{
+			Key:  key,
+			Data: mm[key],
+		})
+	}
+
+	if err := printer.Print(os.Stdout, fetchFormat, reports); err != nil {
+		return errors.Wrap(err, "faild to print reports")
+	}
+
+	// The results are printed even if some reports could not be fetched,
+	// but the command fails when nothing could be fetched.
+	if len(mm) == 0 && ferr != nil {
+		return ferr
+	}
+	return nil
+}
+
+// sourceURL returns URL of src. A local file path is converted into file URL.
+func sourceURL(src string) (string, error) {
+	if u, err := url.Parse(src); err == nil && u.Scheme != "" {
+		return src, nil
+	}
+
+	p, err := filepath.Abs(src)
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+
+	return (&url.URL{
+		Scheme: "file",
+		Path:   filepath.ToSlash(p),
+	}).String(), nil
+}
+
+var fetchFormat string
+
+func init() {
+	fetchCmd.Flags().StringVarP(&fetchFormat, "output", "o", printer.FormatJSON, "Output format (json, ndjson or table)")
+
+	roodCmd.AddCommand(fetchCmd)
+}
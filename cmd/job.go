@@ -0,0 +1,85 @@
+package cmd
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"time"
+
+	"github.com/pkg/errors"
+	"go.uber.org/multierr"
+
+	f "github.com/hlts2/gweather/internal/fetcher"
+	"github.com/hlts2/gweather/internal/health"
+	"github.com/hlts2/gweather/internal/log"
+	"github.com/hlts2/gweather/internal/metrics"
+	"github.com/hlts2/gweather/internal/store"
+)
+
+// job fetches weather information and stores it in redis.
+// It is shared by live mode and replay mode.
+type job struct {
+	fetcher f.WeatherInfomationFetcher
+	store   store.Store
+
+	// health is notified of the results of polls. It is nil in replay mode.
+	health *health.Checker
+}
+
+// jobContext returns a copy of ctx whose logger carries a new job ID.
+// The jobs of the feeds polled in the same tick share the job ID.
+func jobContext(ctx context.Context) context.Context {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return log.NewContext(ctx, log.New(log.SubsystemApp).With("job_id", hex.EncodeToString(b)))
+}
+
+// Do runs the job once for the feed of url, and returns the reports of the feed.
+// It returns an error only when the job can not be continued, e.g. redis is unavailable.
+func (j *job) Do(ctx context.Context, url string) (map[string]map[string]interface{}, error) {
+	return j.run(ctx, url, "Start job to get information", func(ctx context.Context) (map[string]map[string]interface{}, error) {
+		return j.fetcher.Fetch(ctx, url)
+	})
+}
+
+// Push runs the job for the feed document data of url delivered by a WebSub hub, and returns the reports of the entries in it.
+func (j *job) Push(ctx context.Context, url string, data []byte) (map[string]map[string]interface{}, error) {
+	return j.run(ctx, url, "Start job to process pushed feed", func(ctx context.Context) (map[string]map[string]interface{}, error) {
+		return j.fetcher.Push(ctx, url, data)
+	})
+}
+
+func (j *job) run(ctx context.Context, url, msg string, fetch func(context.Context) (map[string]map[string]interface{}, error)) (map[string]map[string]interface{}, error) {
+	l := log.FromContext(ctx, log.SubsystemApp).With("feed", url)
+	ctx = log.NewContext(ctx, l)
+
+	start := time.Now()
+	l.Info(msg)
+
+	mm, ferr := fetch(ctx)
+	if ferr != nil {
+		if mm == nil {
+			l.Named(log.SubsystemFetcher).Errorf("faild to fetch contents: %v", ferr)
+		} else {
+			// The errors of each report have been logged by the fetcher with the fields of the report.
+			l.Named(log.SubsystemFetcher).Warnf("faild to fetch some contents: %d errors", len(multierr.Errors(ferr)))
+		}
+	}
+
+	if err := j.store.Save(ctx, mm); err != nil {
+		return nil, errors.Wrap(err, "faild to save reports")
+	}
+
+	// The poll is successful if the feed could be fetched, even if some reports could not be.
+	if mm != nil {
+		metrics.FeedLastSuccess.WithLabelValues(url).SetToCurrentTime()
+		if j.health != nil {
+			j.health.Success(url)
+		}
+	} else if j.health != nil {
+		j.health.Failure(url, ferr)
+	}
+
+	l.Infof("Finish job. time: %v", time.Since(start))
+	return mm, nil
+}
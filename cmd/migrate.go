@@ -0,0 +1,77 @@
+package cmd
+
+import (
+	"context"
+	"os"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+
+	"github.com/hlts2/gweather/internal/log"
+	"github.com/hlts2/gweather/internal/report"
+	"github.com/hlts2/gweather/internal/store"
+)
+
+var migrateCmd = &cobra.Command{
+	Use:   "migrate",
+	Short: "Rename the reports stored in redis to the keys of the current key template and prefix",
+	Long: "Rename the reports stored in redis with --from-prefix, and their history, to the keys generated by --key-template with --redis-prefix.\n" +
+		"A report is skipped if its new key is already used. Stop gweather while migrating, or reports may be written with the old keys.",
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return errors.WithStack(runMigrate(cmd, args))
+	},
+}
+
+func runMigrate(cmd *cobra.Command, args []string) error {
+	// stdout is reserved for the results.
+	log.SetOutput(os.Stderr)
+
+	tmpl, err := report.NewKeyTemplate(cfg.Redis.KeyTemplate)
+	if err != nil {
+		return err
+	}
+
+	pool, err := newPool(cfg)
+	if err != nil {
+		return errors.Wrap(err, "faild to create redis pool")
+	}
+	defer pool.Close()
+
+	rename := func(key string, m map[string]interface{}) (string, error) {
+		// The reports stored before the feed was recorded are regarded as the reports of the only feed.
+		feed, _ := m["feed"].(string)
+		if feed == "" && len(cfg.Feeds) == 1 {
+			feed = cfg.Feeds[0]
+		}
+
+		// The reports stored by the versions before the key template have neither the feed nor the entry id,
+		// so they are skipped if the key depends on them.
+		f := report.NewKeyFields(feed, m)
+		if err := tmpl.Complete(f); err != nil {
+			return "", err
+		}
+		return tmpl.Key(f)
+	}
+
+	res, err := store.Migrate(context.Background(), pool, migrateFromPrefix, cfg.Redis.Prefix, rename, migrateDryRun)
+	if res != nil {
+		logger.Infof("Finish migration. moved: %d, unchanged: %d, skipped: %d", res.Moved, res.Unchanged, res.Skipped)
+	}
+	if err != nil {
+		return errors.Wrap(err, "faild to migrate reports")
+	}
+	return nil
+}
+
+var (
+	migrateFromPrefix string
+	migrateDryRun     bool
+)
+
+func init() {
+	migrateCmd.Flags().StringVar(&migrateFromPrefix, "from-prefix", "", "Prefix of the keys of the reports to rename")
+	migrateCmd.Flags().BoolVar(&migrateDryRun, "dry-run", false, "Print the keys to rename without renaming them")
+
+	roodCmd.AddCommand(migrateCmd)
+}
@@ -0,0 +1,228 @@
+package cmd
+
+import (
+	"context"
+	"os"
+	"sort"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+
+	"github.com/hlts2/gweather/internal/log"
+	"github.com/hlts2/gweather/internal/printer"
+	"github.com/hlts2/gweather/internal/report"
+)
+
+var getCmd = &cobra.Command{
+	Use:   "get [key]",
+	Short: "Print the latest report of the key stored in redis",
+	Long:  "Print the latest report of the key stored in redis. The key can also be given by --title and --office.",
+	Args:  cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return errors.WithStack(runGet(cmd, args))
+	},
+}
+
+var listCmd = &cobra.Command{
+	Use:   "list",
+	Short: "Print the latest reports stored in redis",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return errors.WithStack(runList(cmd, args))
+	},
+}
+
+var historyCmd = &cobra.Command{
+	Use:   "history [key]",
+	Short: "Print the previous reports of the key stored in redis",
+	Long:  "Print the previous reports of the key stored in redis from newest to oldest. The key can also be given by --title and --office.",
+	Args:  cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return errors.WithStack(runHistory(cmd, args))
+	},
+}
+
+var warningsCmd = &cobra.Command{
+	Use:   "warnings <area code>",
+	Short: "Print the warnings currently active in the area stored in redis",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return errors.WithStack(runWarnings(cmd, args))
+	},
+}
+
+func runGet(cmd *cobra.Command, args []string) error {
+	// stdout is reserved for the results.
+	log.SetOutput(os.Stderr)
+
+	key, err := queryKey(args)
+	if err != nil {
+		return err
+	}
+
+	pool, err := newPool(cfg)
+	if err != nil {
+		return errors.Wrap(err, "faild to create redis pool")
+	}
+	defer pool.Close()
+
+	m, err := newStore(cfg, pool).Get(context.Background(), key)
+	if err != nil {
+		return errors.Wrapf(err, "faild to get report: %s", key)
+	}
+
+	return printReports([]printer.Report{{Key: key, Data: m}})
+}
+
+func runList(cmd *cobra.Command, args []string) error {
+	// stdout is reserved for the results.
+	log.SetOutput(os.Stderr)
+
+	pool, err := newPool(cfg)
+	if err != nil {
+		return errors.Wrap(err, "faild to create redis pool")
+	}
+	defer pool.Close()
+
+	mm, err := newStore(cfg, pool).List(context.Background())
+	if err != nil {
+		return errors.Wrap(err, "faild to list reports")
+	}
+
+	keys := make([]string, 0, len(mm))
+	for key := range mm {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	reports := make([]printer.Report, 0, len(keys))
+	for _, key := range keys {
+		reports = append(reports, printer.Report{
+			Key:  key,
+			Data: mm[key],
+		})
+	}
+
+	return printReports(reports)
+}
+
+func runHistory(cmd *cobra.Command, args []string) error {
+	// stdout is reserved for the results.
+	log.SetOutput(os.Stderr)
+
+	key, err := queryKey(args)
+	if err != nil {
+		return err
+	}
+
+	pool, err := newPool(cfg)
+	if err != nil {
+		return errors.Wrap(err, "faild to create redis pool")
+	}
+	defer pool.Close()
+
+	ms, err := newStore(cfg, pool).History(context.Background(), key, queryLimit)
+	if err != nil {
+		return errors.Wrapf(err, "faild to get history: %s", key)
+	}
+
+	reports := make([]printer.Report, 0, len(ms))
+	for _, m := range ms {
+		reports = append(reports, printer.Report{
+			Key:  key,
+			Data: m,
+		})
+	}
+
+	return printReports(reports)
+}
+
+func runWarnings(cmd *cobra.Command, args []string) error {
+	// stdout is reserved for the results.
+	log.SetOutput(os.Stderr)
+
+	pool, err := newPool(cfg)
+	if err != nil {
+		return errors.Wrap(err, "faild to create redis pool")
+	}
+	defer pool.Close()
+
+	ws, err := newStore(cfg, pool).Warnings(context.Background(), args[0])
+	if err != nil {
+		return errors.Wrapf(err, "faild to get warnings: %s", args[0])
+	}
+
+	return errors.Wrap(printer.PrintWarnings(os.Stdout, queryFormat, ws), "faild to print warnings")
+}
+
+// queryKey returns the key given by the argument or --title and --office.
+func queryKey(args []string) (string, error) {
+	if len(args) > 0 {
+		return args[0], nil
+	}
+
+	if len(queryFilter.Titles) != 1 || len(queryFilter.Offices) != 1 {
+		return "", errors.New("key or exactly one --title and --office are required")
+	}
+
+	tmpl, err := report.NewKeyTemplate(cfg.Redis.KeyTemplate)
+	if err != nil {
+		return "", err
+	}
+
+	// The key can be generated only when the template uses no other fields, e.g. .Feed and .Area.
+	if !tmpl.ByTitleAndOffice() {
+		return "", errors.Errorf("--title and --office are not available with the key template, give the key instead: %s", cfg.Redis.KeyTemplate)
+	}
+
+	// e.g) 気象特別警報・警報・注意報_鳥取地方気象台
+	return tmpl.Key(report.KeyFields{
+		Title:  queryFilter.Titles[0],
+		Office: queryFilter.Offices[0],
+	})
+}
+
+// printReports prints reports matching the filter.
+func printReports(reports []printer.Report) error {
+	filtered := make([]printer.Report, 0, len(reports))
+	for _, r := range reports {
+		areas, kinds := report.BodyCodes(r.Data["body"])
+		title, _ := r.Data["title"].(string)
+		office, _ := r.Data["name"].(string)
+
+		if queryFilter.Match(title, office, areas, kinds) {
+			filtered = append(filtered, r)
+		}
+	}
+
+	return errors.Wrap(printer.Print(os.Stdout, queryFormat, filtered), "faild to print reports")
+}
+
+var (
+	queryFilter report.Filter
+	queryFormat string
+	queryLimit  int
+)
+
+func queryFlags() *pflag.FlagSet {
+	fs := pflag.NewFlagSet("query", pflag.ExitOnError)
+	fs.StringSliceVar(&queryFilter.Titles, "title", nil, "Titles of reports (e.g. 気象特別警報・警報・注意報)")
+	fs.StringSliceVar(&queryFilter.Offices, "office", nil, "Offices of reports (e.g. 盛岡地方気象台)")
+	fs.StringSliceVar(&queryFilter.Areas, "area", nil, "Area codes included in reports (e.g. 030010)")
+	fs.StringSliceVar(&queryFilter.Kinds, "kind", nil, "Warning codes included in reports (e.g. 14)")
+	fs.StringVarP(&queryFormat, "output", "o", printer.FormatTable, "Output format (json, ndjson or table)")
+	return fs
+}
+
+func init() {
+	for _, cmd := range []*cobra.Command{getCmd, listCmd, historyCmd} {
+		cmd.Flags().AddFlagSet(queryFlags())
+		roodCmd.AddCommand(cmd)
+	}
+
+	historyCmd.Flags().IntVar(&queryLimit, "limit", 10, "Maximum number of reports to print")
+
+	warningsCmd.Flags().StringVarP(&queryFormat, "output", "o", printer.FormatTable, "Output format (json, ndjson or table)")
+	roodCmd.AddCommand(warningsCmd)
+}
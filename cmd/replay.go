@@ -0,0 +1,160 @@
+package cmd
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"go.opentelemetry.io/otel/attribute"
+
+	f "github.com/hlts2/gweather/internal/fetcher"
+	"github.com/hlts2/gweather/internal/leader"
+	"github.com/hlts2/gweather/internal/log"
+	"github.com/hlts2/gweather/internal/replay"
+	"github.com/hlts2/gweather/internal/report"
+	"github.com/hlts2/gweather/internal/trace"
+)
+
+var replayCmd = &cobra.Command{
+	Use:   "replay",
+	Short: "Re-ingest archived feeds and reports from a local directory",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return errors.WithStack(runReplay(cmd, args))
+	},
+}
+
+func runReplay(cmd *cobra.Command, args []string) error {
+	logger.Info("Start replay")
+	defer logger.Info("Finish replay")
+
+	src, err := replay.Open(replayDir)
+	if err != nil {
+		return errors.Wrap(err, "faild to open replay directory")
+	}
+
+	stopTrace, err := setupTrace(cfg)
+	if err != nil {
+		return errors.Wrap(err, "faild to set up tracing")
+	}
+	defer stopTrace()
+
+	pool, err := newPool(cfg)
+	if err != nil {
+		return errors.Wrap(err, "faild to create redis pool")
+	}
+	defer pool.Close()
+
+	tmpl, err := report.NewKeyTemplate(cfg.Redis.KeyTemplate)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// The reports are written by the same store as the run loop, fenced by the leader election and appended to the outbox of the sinks.
+	// The sinks are not run by replay, and the events in the outbox are delivered by the leader after replay releases the leadership.
+	var elector *leader.Elector
+	if cfg.Leader.Enabled {
+		elector = leader.New(leader.NewRedisLock(pool, cfg.Redis.Prefix), cfg.Leader.TTL)
+
+		done := make(chan struct{})
+		go func() {
+			elector.Run(ctx)
+			close(done)
+		}()
+
+		// The lock is released before the pool is closed, so that the replicas take over at once.
+		defer func() {
+			cancel()
+			<-done
+		}()
+
+		if err := waitLeader(ctx, elector, cfg.Leader.TTL); err != nil {
+			return err
+		}
+	}
+
+	j := &job{
+		fetcher: f.New(f.WithClient(src.Client()), f.WithKeyTemplate(tmpl)),
+		store:   newWriteStore(cfg, pool, elector),
+	}
+
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, syscall.SIGINT, syscall.SIGTERM)
+	defer signal.Stop(sigCh)
+
+	go func() {
+		select {
+		case sig := <-sigCh:
+			logger.Warnf("Received os signal: %v", sig)
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	var prev time.Time
+	for _, feed := range src.Feeds() {
+		if !prev.IsZero() && replaySpeed > 0 {
+			wait := time.Duration(float64(feed.Updated.Sub(prev)) / replaySpeed)
+
+			select {
+			case <-ctx.Done():
+				return nil
+			case <-time.After(wait):
+			}
+		}
+		prev = feed.Updated
+
+		if err := ctx.Err(); err != nil {
+			return nil
+		}
+
+		jctx, span := trace.Start(jobContext(ctx), "replay", attribute.String("feed.path", feed.Path), attribute.String("feed.url", feed.URL))
+		log.FromContext(jctx, log.SubsystemApp).Infof("Replay feed: %s, updated: %v", feed.Path, feed.Updated)
+
+		src.Select(feed)
+		_, err := j.Do(jctx, feed.URL)
+		trace.End(span, err)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// waitLeader waits for elector to become the leader. A follower takes over within the TTL and a third of it,
+// so it fails if another replica keeps the leadership longer.
+func waitLeader(ctx context.Context, elector *leader.Elector, ttl time.Duration) error {
+	logger.Info("Wait for leadership to replay")
+
+	t := time.NewTimer(ttl + ttl/3)
+	defer t.Stop()
+
+	select {
+	case <-elector.Elected():
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return errors.Errorf("faild to become leader in %v, stop the other replicas to replay", ttl+ttl/3)
+	}
+}
+
+var (
+	replayDir   string
+	replaySpeed float64
+)
+
+func init() {
+	replayCmd.Flags().StringVar(&replayDir, "dir", "", "Directory of archived feed and report XML files")
+	replayCmd.Flags().Float64Var(&replaySpeed, "speed", 0, "Replay speed relative to the original interval of the feeds (0 replays without waiting)")
+	replayCmd.MarkFlagRequired("dir")
+
+	roodCmd.AddCommand(replayCmd)
+}
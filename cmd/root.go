@@ -2,24 +2,60 @@ package cmd
 
 import (
 	"context"
-	"encoding/json"
+	"net"
+	"net/http"
 	"os"
 	"os/signal"
+	"reflect"
 	"syscall"
 	"time"
 
-	"github.com/kpango/glg"
 	"github.com/pkg/errors"
 	"github.com/spf13/cobra"
+	"go.opentelemetry.io/otel/attribute"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/reflection"
 
+	gweatherv1 "github.com/hlts2/gweather/api/gweather/v1"
+
+	"github.com/hlts2/gweather/internal/archive"
+	"github.com/hlts2/gweather/internal/config"
+	"github.com/hlts2/gweather/internal/feed"
 	f "github.com/hlts2/gweather/internal/fetcher"
+	"github.com/hlts2/gweather/internal/health"
+	"github.com/hlts2/gweather/internal/kafka"
+	"github.com/hlts2/gweather/internal/leader"
+	"github.com/hlts2/gweather/internal/log"
+	"github.com/hlts2/gweather/internal/metrics"
+	"github.com/hlts2/gweather/internal/mqtt"
+	"github.com/hlts2/gweather/internal/nats"
 	"github.com/hlts2/gweather/internal/redis"
+	"github.com/hlts2/gweather/internal/report"
+	"github.com/hlts2/gweather/internal/rpc"
+	"github.com/hlts2/gweather/internal/schedule"
+	"github.com/hlts2/gweather/internal/sink"
+	"github.com/hlts2/gweather/internal/store"
+	"github.com/hlts2/gweather/internal/stream"
+	"github.com/hlts2/gweather/internal/tlsconfig"
+	"github.com/hlts2/gweather/internal/trace"
+	"github.com/hlts2/gweather/internal/trace/otlp"
+	"github.com/hlts2/gweather/internal/websub"
 )
 
+// version is the version of the application.
+const version = "v1.0.0"
+
 var roodCmd = &cobra.Command{
 	Use:     "gweater",
 	Short:   "CLI tool for acquiring weather information regularly",
-	Version: "v1.0.0",
+	Version: version,
+	PersistentPreRunE: func(cmd *cobra.Command, args []string) (err error) {
+		cfg, err = loadConfig(cmd)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		return errors.WithStack(log.Setup(logConfig(cfg)))
+	},
 	RunE: func(cmd *cobra.Command, args []string) error {
 		return errors.WithStack(run(cmd, args))
 	},
@@ -29,81 +65,817 @@ var roodCmd = &cobra.Command{
 var WeatherInfoURL = f.URL
 
 func run(cmd *cobra.Command, args []string) (rerr error) {
-	glg.Info("Start cli application")
-	defer glg.Info("Finish cli application")
+	logger.Info("Start cli application")
+	defer logger.Info("Finish cli application")
+
+	stopTrace, err := setupTrace(cfg)
+	if err != nil {
+		return errors.Wrap(err, "faild to set up tracing")
+	}
+	defer stopTrace()
+
+	publisher := feed.NewPublisher(publishFilter(cfg))
+
+	pool, err := newPool(cfg)
+	if err != nil {
+		return errors.Wrap(err, "faild to create redis pool")
+	}
+
+	checker := health.New(pool, healthConfig(cfg))
+
+	// Only the leader polls and writes reports while the leader election is enabled.
+	var (
+		elector *leader.Elector
+		elected <-chan struct{}
+		opts    []store.Option
+	)
+	if cfg.Leader.Enabled {
+		elector = leader.New(leader.NewRedisLock(pool, cfg.Redis.Prefix), cfg.Leader.TTL)
+		elected = elector.Elected()
+		checker.Standby(true)
+	}
+
+	// The events of the reports are appended to the outbox by the replica writing them, and delivered to the sinks by the leader.
+	mq, sinks, err := newSinks(cfg)
+	if err != nil {
+		pool.Close()
+		return errors.Wrap(err, "faild to create sinks")
+	}
+
+	var dispatcher *sink.Dispatcher
+	if len(sinks) > 0 {
+		// Without the leader election, the only replica delivers the events as the leader.
+		var active func() bool
+		if elector != nil {
+			active = elector.IsLeader
+		}
+		dispatcher = sink.NewDispatcher(pool, cfg.Redis.Prefix, sinks, cfg.Sink.BatchSize, cfg.Sink.OutboxSize, active)
+		opts = append(opts, store.WithNotifier(dispatcher))
+	}
+
+	buf, err := store.NewBuffer(newWriteStore(cfg, pool, elector, opts...), bufferConfig(cfg))
+	if err != nil {
+		pool.Close()
+		return errors.Wrap(err, "faild to create buffer")
+	}
 
-	fetcher, pool := f.New(), redis.New(host)
+	j, arch, err := newJob(cfg, pool, buf, publisher, checker)
+	if err != nil {
+		pool.Close()
+		return errors.Wrap(err, "faild to create job")
+	}
+
+	// The feeds delivered by the WebSub hubs are processed in addition to the polls.
+	var (
+		sub       *websub.Subscriber
+		delivered <-chan *websub.Delivery
+	)
+	if cfg.WebSub.Callback != "" {
+		if sub, err = websub.New(feeds(cfg), websubConfig(cfg)); err != nil {
+			pool.Close()
+			return errors.Wrap(err, "faild to create websub subscriber")
+		}
+		delivered = sub.C()
+	}
+
+	// The events written by the leader are streamed by every replica.
+	var (
+		broker  *stream.Broker
+		streams *stream.Handler
+	)
+	if cfg.Stream.Enabled || cfg.GRPC.Addr != "" {
+		broker = stream.NewBroker(pool, cfg.Redis.Prefix)
+	}
+	if cfg.Stream.Enabled {
+		streams = stream.NewHandler(broker, buf, cfg.Stream.Origins)
+	}
 
 	ctx, cancel := context.WithCancel(context.Background())
 	defer func() {
 		cancel()
+		if err := buf.Close(); err != nil {
+			logger.Errorf("faild to close buffer: %v", err)
+		}
 		pool.Close()
 	}()
 
-	sigCh := make(chan os.Signal)
-	signal.Notify(sigCh, syscall.SIGINT, syscall.SIGTERM)
+	go buf.Run(ctx)
+
+	if broker != nil {
+		go broker.Run(ctx)
+	}
+
+	if mq != nil {
+		go mq.Connect(ctx)
+	}
+
+	if dispatcher != nil {
+		done := make(chan struct{})
+		go func() {
+			dispatcher.Run(ctx)
+			close(done)
+		}()
+
+		// The sinks are flushed and closed, e.g. the offline status is published to the MQTT broker, before exiting.
+		defer func() {
+			<-done
+		}()
+	}
+
+	if elector != nil {
+		done := make(chan struct{})
+		go func() {
+			elector.Run(ctx)
+			close(done)
+		}()
+
+		// The lock is released before the pool is closed, so that a follower takes over at once.
+		defer func() {
+			<-done
+		}()
+	}
+
+	if addr := cfg.Server.Addr; addr != "" {
+		mux := http.NewServeMux()
+		mux.Handle("/metrics", metrics.Handler())
+		mux.HandleFunc("/healthz", checker.Healthz)
+		mux.HandleFunc("/readyz", checker.Readyz)
+		if sub != nil {
+			mux.Handle(websub.Path, sub)
+		}
+		if streams != nil {
+			mux.Handle(stream.EventsPath, streams)
+			mux.Handle(stream.WebSocketPath, streams)
+		}
+		mux.Handle("/", publisher)
+
+		srv := &http.Server{
+			Addr:    addr,
+			Handler: mux,
+		}
+		if streams != nil {
+			// The streams never become idle, so they are ended on shutdown.
+			srv.RegisterOnShutdown(streams.Close)
+		}
+
+		go func() {
+			logger.Infof("Start http server: %s", addr)
+			if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				logger.Errorf("faild to listen and serve: %v", err)
+				cancel()
+			}
+		}()
+
+		defer func() {
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			defer cancel()
+
+			if err := srv.Shutdown(ctx); err != nil {
+				logger.Errorf("faild to shutdown http server: %v", err)
+			}
+		}()
+	}
+
+	if addr := cfg.GRPC.Addr; addr != "" {
+		lis, err := net.Listen("tcp", addr)
+		if err != nil {
+			return errors.Wrapf(err, "faild to listen: %s", addr)
+		}
+
+		rpcServer := rpc.NewServer(buf, broker)
+		srv := grpc.NewServer()
+		gweatherv1.RegisterReportServiceServer(srv, rpcServer)
+		reflection.Register(srv)
+
+		go func() {
+			logger.Infof("Start grpc server: %s", addr)
+			if err := srv.Serve(lis); err != nil {
+				logger.Errorf("faild to serve grpc: %v", err)
+				cancel()
+			}
+		}()
+
+		defer func() {
+			// The subscriptions never end by themselves, so they are ended before the graceful stop waits for the calls.
+			rpcServer.Close()
+
+			done := make(chan struct{})
+			go func() {
+				srv.GracefulStop()
+				close(done)
+			}()
+
+			t := time.NewTimer(10 * time.Second)
+			defer t.Stop()
+
+			select {
+			case <-done:
+			case <-t.C:
+				logger.Error("faild to stop grpc server gracefully")
+				srv.Stop()
+			}
+		}()
+	}
+
+	// The subscriber subscribes after the server has started to answer the verification of intent.
+	if sub != nil {
+		go sub.Run(ctx)
+	}
+
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP)
+
+	// Every feed is polled at once on start, and then by its schedule.
+	sched := newScheduler(cfg, true)
+	defer func() {
+		sched.Stop()
+	}()
+
+	// poll polls the feeds of urls, and returns the activities of the polled feeds.
+	// standby returns true if this replica is a follower, which neither polls nor processes deliveries.
+	standby := func() bool {
+		if elector != nil && !elector.IsLeader() {
+			checker.Standby(true)
+			return true
+		}
+		checker.Standby(false)
+		return false
+	}
+
+	poll := func(urls ...string) map[string]schedule.Activity {
+		if standby() {
+			logger.Debug("Not leader, skip polling")
+			return nil
+		}
+
+		acts := make(map[string]schedule.Activity)
+
+		jctx, span := trace.Start(jobContext(ctx), "tick", attribute.Int("feeds", len(urls)))
+		for _, url := range urls {
+			mm, err := j.Do(jctx, url)
+			if err != nil {
+				cancel()
+				rerr = err
+				break
+			}
+			if mm != nil {
+				acts[url] = activity(mm)
+			}
+		}
+
+		if arch != nil {
+			if err := arch.Prune(jctx); err != nil {
+				log.FromContext(jctx, log.SubsystemNotifier).Errorf("faild to prune archive: %v", err)
+			}
+		}
+		trace.End(span, rerr)
+
+		return acts
+	}
+
+	push := func(d *websub.Delivery) {
+		if standby() {
+			logger.Debug("Not leader, skip delivery")
+			return
+		}
 
-	t := time.NewTicker(time.Duration(second) * time.Second)
-	defer t.Stop()
+		jctx, span := trace.Start(jobContext(ctx), "delivery", attribute.String("feed.url", d.Feed))
+		if _, err := j.Push(jctx, d.Feed, d.Data); err != nil {
+			cancel()
+			rerr = err
+		}
+		trace.End(span, rerr)
+	}
 
 	for {
 		select {
 		case sig := <-sigCh:
-			glg.Warnf("Received os signal: %v", sig)
-			cancel()
+			if sig != syscall.SIGHUP {
+				logger.Warnf("Received os signal: %v", sig)
+				cancel()
+				break
+			}
+
+			logger.Info("Received SIGHUP, reload config")
+
+			c, err := loadConfig(cmd)
+			if err != nil {
+				logger.Errorf("faild to reload config, keep the previous config: %v", err)
+				break
+			}
+
+			for _, name := range c.KeepStatic(cfg) {
+				logger.Warnf("%s is not reloaded, restart to change it", name)
+			}
+
+			p := pool
+			if redisChanged(c.Redis, cfg.Redis) {
+				if p, err = newPool(c); err != nil {
+					logger.Errorf("faild to reload config, keep the previous config: %v", err)
+					break
+				}
+			}
+
+			nj, narch, err := newJob(c, p, buf, publisher, checker)
+			if err != nil {
+				if p != pool {
+					p.Close()
+				}
+				logger.Errorf("faild to reload config, keep the previous config: %v", err)
+				break
+			}
+
+			if p != pool {
+				pool.Close()
+				pool = p
+			}
+
+			if scheduleChanged(c, cfg) {
+				sched.Stop()
+				sched = newScheduler(c, false)
+			}
+
+			if err := log.Setup(logConfig(c)); err != nil {
+				logger.Errorf("faild to apply log config: %v", err)
+			}
+			if elector != nil {
+				elector.Reset(leader.NewRedisLock(pool, c.Redis.Prefix))
+			}
+			buf.Reset(newWriteStore(c, pool, elector, opts...), bufferConfig(c))
+			if broker != nil && (redisChanged(c.Redis, cfg.Redis) || c.Redis.Prefix != cfg.Redis.Prefix) {
+				broker.Reset(pool, c.Redis.Prefix)
+			}
+			if dispatcher != nil && (redisChanged(c.Redis, cfg.Redis) || c.Redis.Prefix != cfg.Redis.Prefix) {
+				dispatcher.Reset(pool, c.Redis.Prefix)
+			}
+			publisher.SetFilter(publishFilter(c))
+			checker.Reset(pool, healthConfig(c))
+			j, arch, cfg = nj, narch, c
+
+			logger.Info("Finish reloading config")
 
 		case <-ctx.Done():
 			signal.Stop(sigCh)
 			close(sigCh)
 			return
 
-		case <-t.C:
-			start := time.Now()
-			glg.Info("Start job to get information")
-
-			mm, err := fetcher.Fetch(ctx, WeatherInfoURL)
-			if err != nil {
-				glg.Errorf("faild to fetch contents: %v", err)
+		case tick := <-sched.C():
+			if act, ok := poll(tick.Feed)[tick.Feed]; ok {
+				tick.Observe(act)
 			}
+			tick.Done()
 
-			conn, err := pool.GetContext(ctx)
-			if err != nil {
-				cancel()
-				rerr = errors.Wrap(err, "faild to get redis connection")
-				break
+		case d := <-delivered:
+			push(d)
+
+		case <-elected:
+			// The new leader polls at once not to wait for the next tick after the takeover.
+			poll(feeds(cfg)...)
+		}
+	}
+}
+
+// newJob returns the job saving reports to st and the archive configured by c.
+func newJob(c *config.Config, pool redis.Pool, st store.Store, publisher *feed.Publisher, checker *health.Checker) (*job, archive.Archive, error) {
+	arch, err := newArchive(c, pool)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "faild to create archive")
+	}
+
+	tmpl, err := report.NewKeyTemplate(c.Redis.KeyTemplate)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	opts := []f.Option{f.WithRecorder(publisher), f.WithKeyTemplate(tmpl)}
+	if arch != nil {
+		opts = append(opts, f.WithRecorder(arch))
+	}
+	if c.ReportCache {
+		opts = append(opts, f.WithReportCache())
+	}
+
+	return &job{
+		fetcher: f.New(opts...),
+		store:   st,
+		health:  checker,
+	}, arch, nil
+}
+
+func newArchive(c *config.Config, pool redis.Pool) (archive.Archive, error) {
+	switch c.Archive.Backend {
+	case "":
+		return nil, nil
+	case archive.BackendDir:
+		if c.Archive.Dir == "" {
+			return nil, errors.New("archive directory is required")
+		}
+		return archive.NewDir(c.Archive.Dir, c.Archive.Retention), nil
+	case archive.BackendStore:
+		return archive.NewStore(pool, c.Redis.Prefix, c.Archive.Retention), nil
+	default:
+		return nil, errors.Errorf("unknown archive backend: %s", c.Archive.Backend)
+	}
+}
+
+// newWriteStore returns the store where run and replay write the reports.
+// The writes are fenced by the token of elector if it is not nil, and the events are appended to the outbox when they are replayed or delivered.
+// The outbox is trimmed by the dispatcher of the sinks, or by the store without them.
+func newWriteStore(c *config.Config, pool redis.Pool, elector *leader.Elector, opts ...store.Option) store.Store {
+	if elector != nil {
+		opts = append(opts, store.WithFence(leader.TokenKey, elector.Token))
+	}
+	switch {
+	case c.HasSinks():
+		opts = append(opts, store.WithOutbox(0))
+	case c.HasOutbox():
+		opts = append(opts, store.WithOutbox(c.Sink.OutboxSize))
+	}
+	return newStore(c, pool, opts...)
+}
+
+// newStore returns the store of reports in redis configured by c with opts.
+func newStore(c *config.Config, pool redis.Pool, opts ...store.Option) store.Store {
+	opts = append([]store.Option{store.WithPrefix(c.Redis.Prefix)}, opts...)
+	if c.Redis.TTL > 0 {
+		opts = append(opts, store.WithTTL(c.Redis.TTL))
+	}
+	return store.New(pool, c.Redis.HistorySize, opts...)
+}
+
+// newPool returns the pool of connections to redis configured by c.
+func newPool(c *config.Config) (redis.Pool, error) {
+	p, err := redis.New(c.Redis.Host, redis.Options{
+		MaxIdle:     c.Redis.Pool.MaxIdle,
+		MaxActive:   c.Redis.Pool.MaxActive,
+		IdleTimeout: c.Redis.Pool.IdleTimeout,
+		Wait:        c.Redis.Pool.Wait,
+		Username:    c.Redis.Username,
+		Password:    c.Redis.Password,
+		DB:          c.Redis.DB,
+		TLS: redis.TLSOptions{
+			Enabled:            c.Redis.TLS.Enabled,
+			CAFile:             c.Redis.TLS.CAFile,
+			CertFile:           c.Redis.TLS.CertFile,
+			KeyFile:            c.Redis.TLS.KeyFile,
+			ServerName:         c.Redis.TLS.ServerName,
+			InsecureSkipVerify: c.Redis.TLS.InsecureSkipVerify,
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	return redis.WithTracing(p), nil
+}
+
+// redisChanged reports whether the connections to redis are configured differently.
+func redisChanged(a, b config.Redis) bool {
+	return a.Host != b.Host || a.Username != b.Username || a.Password != b.Password || a.DB != b.DB ||
+		a.TLS != b.TLS || a.Pool != b.Pool
+}
+
+func bufferConfig(c *config.Config) store.BufferConfig {
+	return store.BufferConfig{
+		Size:       c.Buffer.Size,
+		Dir:        c.Buffer.Dir,
+		DirSize:    c.Buffer.DirSize,
+		MinBackoff: c.Redis.MinBackoff,
+		MaxBackoff: c.Redis.MaxBackoff,
+	}
+}
+
+func publishFilter(c *config.Config) *report.Filter {
+	return &report.Filter{
+		Titles: c.Publish.Titles,
+		Areas:  c.Publish.Areas,
+	}
+}
+
+func healthConfig(c *config.Config) health.Config {
+	intervals := make(map[string]time.Duration)
+	for url, s := range schedules(c) {
+		intervals[url] = schedule.Interval(s)
+	}
+
+	return health.Config{
+		Feeds:          feeds(c),
+		Intervals:      intervals,
+		MaxMissedPolls: c.Health.MaxMissedPolls,
+		MaxFailures:    c.Health.MaxFailures,
+	}
+}
+
+func websubConfig(c *config.Config) websub.Config {
+	return websub.Config{
+		Callback: c.WebSub.Callback,
+		Hub:      c.WebSub.Hub,
+		Secret:   c.WebSub.Secret,
+		Lease:    c.WebSub.Lease,
+	}
+}
+
+func mqttConfig(c *config.Config) mqtt.Config {
+	return mqtt.Config{
+		Broker:   c.MQTT.Broker,
+		ClientID: c.MQTT.ClientID,
+		Username: c.MQTT.Username,
+		Password: c.MQTT.Password,
+		Topic:    c.MQTT.Topic,
+		QoS:      byte(c.MQTT.QoS),
+		TLS: tlsconfig.Options{
+			CAFile:             c.MQTT.TLS.CAFile,
+			CertFile:           c.MQTT.TLS.CertFile,
+			KeyFile:            c.MQTT.TLS.KeyFile,
+			ServerName:         c.MQTT.TLS.ServerName,
+			InsecureSkipVerify: c.MQTT.TLS.InsecureSkipVerify,
+		},
+	}
+}
+
+func natsConfig(c *config.Config) nats.Config {
+	return nats.Config{
+		URL:      c.Sink.NATS.URL,
+		Username: c.Sink.NATS.Username,
+		Password: c.Sink.NATS.Password,
+		Subject:  c.Sink.NATS.Subject,
+		Stream:   c.Sink.NATS.Stream,
+		TLS: tlsconfig.Options{
+			CAFile:             c.Sink.NATS.TLS.CAFile,
+			CertFile:           c.Sink.NATS.TLS.CertFile,
+			KeyFile:            c.Sink.NATS.TLS.KeyFile,
+			ServerName:         c.Sink.NATS.TLS.ServerName,
+			InsecureSkipVerify: c.Sink.NATS.TLS.InsecureSkipVerify,
+		},
+	}
+}
+
+func kafkaConfig(c *config.Config) kafka.Config {
+	return kafka.Config{
+		Brokers:       c.Sink.Kafka.Brokers,
+		Topic:         c.Sink.Kafka.Topic,
+		SASLMechanism: c.Sink.Kafka.SASL.Mechanism,
+		Username:      c.Sink.Kafka.SASL.Username,
+		Password:      c.Sink.Kafka.SASL.Password,
+		UseTLS:        c.Sink.Kafka.TLS.Enabled,
+		TLS: tlsconfig.Options{
+			CAFile:             c.Sink.Kafka.TLS.CAFile,
+			CertFile:           c.Sink.Kafka.TLS.CertFile,
+			KeyFile:            c.Sink.Kafka.TLS.KeyFile,
+			ServerName:         c.Sink.Kafka.TLS.ServerName,
+			InsecureSkipVerify: c.Sink.Kafka.TLS.InsecureSkipVerify,
+		},
+	}
+}
+
+// newSinks returns the sinks configured by c, and the MQTT publisher among them which is connected separately.
+func newSinks(c *config.Config) (mq *mqtt.Publisher, sinks []sink.Sink, err error) {
+	defer func() {
+		if err != nil {
+			for _, s := range sinks {
+				s.Close()
 			}
+		}
+	}()
 
-			// e.g) key: 気象特別警報・警報・注意報_鳥取地方気象台
-			for key, val := range mm {
-				b, _ := json.Marshal(val)
-				if err := conn.Send("SET", key, b); err != nil {
-					glg.Errorf("faild to send: %v", err)
-				}
+	if c.MQTT.Broker != "" {
+		if mq, err = mqtt.New(mqttConfig(c)); err != nil {
+			return nil, sinks, errors.Wrap(err, "faild to create mqtt publisher")
+		}
+		sinks = append(sinks, mq)
+	}
+
+	if c.Sink.NATS.URL != "" {
+		n, err := nats.New(natsConfig(c))
+		if err != nil {
+			return nil, sinks, errors.Wrap(err, "faild to create nats publisher")
+		}
+		sinks = append(sinks, n)
+	}
+
+	if len(c.Sink.Kafka.Brokers) > 0 {
+		k, err := kafka.New(kafkaConfig(c), c.Sink.BatchSize)
+		if err != nil {
+			return nil, sinks, errors.Wrap(err, "faild to create kafka writer")
+		}
+		sinks = append(sinks, k)
+	}
+	return mq, sinks, nil
+}
+
+// newScheduler returns the scheduler of the polls configured by c.
+// Every feed is polled at once when immediate is true.
+func newScheduler(c *config.Config, immediate bool) *schedule.Scheduler {
+	return schedule.New(schedule.Config{
+		Schedules: schedules(c),
+		Jitter:    c.Schedule.Jitter,
+		Overlap:   c.Schedule.Overlap,
+		Immediate: immediate,
+	})
+}
+
+// schedules returns the schedules of the feeds to poll.
+// The feeds without a schedule are polled by the adaptive interval if it is enabled, or every second.
+func schedules(c *config.Config) map[string]schedule.Schedule {
+	m := make(map[string]schedule.Schedule)
+	for _, url := range feeds(c) {
+		if spec, ok := c.Schedule.Feeds[url]; ok {
+			// The schedules have been validated with the configuration.
+			if s, err := schedule.Parse(spec); err == nil {
+				m[url] = s
+				continue
 			}
+		}
+
+		if a := c.Schedule.Adaptive; a.Enabled {
+			m[url] = schedule.NewAdaptive(a.Min, a.Max)
+		} else {
+			m[url] = schedule.Every(time.Duration(c.Second) * time.Second)
+		}
+	}
+	return m
+}
 
-			if err := conn.Flush(); err != nil {
-				glg.Errorf("faild to flush: %v", err)
+// activity returns the activity of the feed of the reports mm.
+func activity(mm map[string]map[string]interface{}) schedule.Activity {
+	var act schedule.Activity
+	for _, m := range mm {
+		if id, ok := m["id"].(string); ok {
+			act.Entries = append(act.Entries, id)
+		}
+
+		for _, w := range report.Warnings(m["body"]) {
+			if w.Active() && w.Special() {
+				act.Urgent = true
 			}
+		}
+	}
+	return act
+}
+
+// scheduleChanged reports whether the polls are scheduled differently.
+func scheduleChanged(a, b *config.Config) bool {
+	return a.Second != b.Second || !reflect.DeepEqual(feeds(a), feeds(b)) || !reflect.DeepEqual(a.Schedule, b.Schedule)
+}
 
-			glg.Infof("Finish job. time: %v", time.Since(start))
+// setupTrace sets up the exporter of traces configured by c.
+// The returned function flushes the remaining spans and stops the exporter.
+func setupTrace(c *config.Config) (func(), error) {
+	shutdown, err := otlp.Setup(context.Background(), otlp.Config{
+		Exporter:    c.Trace.Exporter,
+		Endpoint:    c.Trace.Endpoint,
+		Insecure:    c.Trace.Insecure,
+		SampleRatio: c.Trace.SampleRatio,
+		Version:     version,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		if err := shutdown(ctx); err != nil {
+			logger.Errorf("faild to shutdown tracing: %v", err)
 		}
+	}, nil
+}
+
+func logConfig(c *config.Config) log.Config {
+	return log.Config{
+		Format: c.Log.Format,
+		Level:  c.Log.Level,
+		Levels: c.Log.Levels,
+	}
+}
+
+// feeds returns URLs of the feeds to poll. WeatherInfoURL is used when no feed is configured.
+func feeds(c *config.Config) []string {
+	if len(c.Feeds) == 0 {
+		return []string{WeatherInfoURL}
+	}
+	return c.Feeds
+}
+
+// loadConfig loads the configuration from the configuration file, environment variables and the flags of cmd.
+func loadConfig(cmd *cobra.Command) (*config.Config, error) {
+	path := cfgFile
+	if path == "" {
+		path = os.Getenv(config.EnvPrefix + "_CONFIG")
 	}
+	return config.Load(path, cmd.Flags(), flagCfg)
 }
 
 var (
-	second uint
-	host   string
+	cfgFile string
+
+	// flagCfg is the configuration bound to the flags.
+	flagCfg = config.Default()
+
+	// cfg is the configuration loaded before running commands.
+	cfg *config.Config
+
+	logger = log.New(log.SubsystemApp)
 )
 
 func init() {
-	roodCmd.PersistentFlags().UintVarP(&second, "second", "s", 180, "Interval to get weather information")
-	roodCmd.PersistentFlags().StringVar(&host, "host", "redis://127.0.0.1:6379", "Host address for Redis")
+	roodCmd.PersistentFlags().StringVar(&cfgFile, "config", "", "Path to the configuration file (YAML)")
+	roodCmd.PersistentFlags().UintVarP(&flagCfg.Second, "second", "s", flagCfg.Second, "Interval to get weather information of the feeds without --schedule and --adaptive")
+	roodCmd.PersistentFlags().StringSliceVar(&flagCfg.Feeds, "feed", nil, "URLs of feeds to get weather information (default "+f.URL+")")
+	roodCmd.PersistentFlags().BoolVar(&flagCfg.ReportCache, "report-cache", false, "Cache the reports of each feed in memory to download only the reports of the new entries")
+	roodCmd.PersistentFlags().StringToStringVar(&flagCfg.Schedule.Feeds, "schedule", nil, "Schedules of feeds as URL=cron expression or descriptor (e.g. URL=5 * * * *, URL=@every 1m)")
+	roodCmd.PersistentFlags().DurationVar(&flagCfg.Schedule.Jitter, "schedule-jitter", 0, "Maximum random delay added to each scheduled poll")
+	roodCmd.PersistentFlags().StringVar(&flagCfg.Schedule.Overlap, "schedule-overlap", flagCfg.Schedule.Overlap, "Polls due while the previous poll of the feed is running are skipped (skip) or run once after it (queue)")
+	roodCmd.PersistentFlags().BoolVar(&flagCfg.Schedule.Adaptive.Enabled, "adaptive", false, "Adapt the interval of the feeds without --schedule to their activity instead of --second")
+	roodCmd.PersistentFlags().DurationVar(&flagCfg.Schedule.Adaptive.Min, "adaptive-min", flagCfg.Schedule.Adaptive.Min, "Minimum adaptive interval, used while new entries are found or special warnings are active")
+	roodCmd.PersistentFlags().DurationVar(&flagCfg.Schedule.Adaptive.Max, "adaptive-max", flagCfg.Schedule.Adaptive.Max, "Maximum adaptive interval, toward which the interval grows while nothing changes")
+	roodCmd.PersistentFlags().StringVar(&flagCfg.Redis.Host, "host", flagCfg.Redis.Host, "Host address for Redis (redis://, rediss://, redis-sentinel:// or redis-cluster:// URL)")
+	roodCmd.PersistentFlags().IntVar(&flagCfg.Redis.HistorySize, "history-size", flagCfg.Redis.HistorySize, "Number of previous reports kept for each key (0 keeps all)")
+	roodCmd.PersistentFlags().DurationVar(&flagCfg.Redis.TTL, "report-ttl", 0, "Duration after which the reports no longer written are expired and removed from the indexes (default never)")
+	roodCmd.PersistentFlags().StringVar(&flagCfg.Redis.Prefix, "redis-prefix", "", "Prefix of all keys in Redis to share it with other applications")
+	roodCmd.PersistentFlags().StringVar(&flagCfg.Redis.KeyTemplate, "key-template", flagCfg.Redis.KeyTemplate, "Template of the keys of reports (fields: .Feed, .Title, .Office, .UUID, .Area, .Areas, .Kind, .Kinds, functions: ascii, hash, join)")
+	roodCmd.PersistentFlags().StringVar(&flagCfg.Redis.Username, "redis-username", "", "ACL user of Redis (overrides the user of --host)")
+	roodCmd.PersistentFlags().StringVar(&flagCfg.Redis.Password, "redis-password", "", "Password of Redis (overrides the password of --host)")
+	roodCmd.PersistentFlags().IntVar(&flagCfg.Redis.DB, "redis-db", 0, "Database index of Redis (overrides the database of --host)")
+	roodCmd.PersistentFlags().BoolVar(&flagCfg.Redis.TLS.Enabled, "redis-tls", false, "Connect to Redis with TLS (always enabled for rediss://)")
+	roodCmd.PersistentFlags().StringVar(&flagCfg.Redis.TLS.CAFile, "redis-tls-ca", "", "PEM file of the CA to verify Redis (default system CAs)")
+	roodCmd.PersistentFlags().StringVar(&flagCfg.Redis.TLS.CertFile, "redis-tls-cert", "", "PEM file of the client certificate for Redis")
+	roodCmd.PersistentFlags().StringVar(&flagCfg.Redis.TLS.KeyFile, "redis-tls-key", "", "PEM file of the client key for Redis")
+	roodCmd.PersistentFlags().StringVar(&flagCfg.Redis.TLS.ServerName, "redis-tls-server-name", "", "Server name to verify the certificate of Redis (default the host)")
+	roodCmd.PersistentFlags().BoolVar(&flagCfg.Redis.TLS.InsecureSkipVerify, "redis-tls-skip-verify", false, "Skip verifying the certificate of Redis (insecure)")
+	roodCmd.PersistentFlags().IntVar(&flagCfg.Redis.Pool.MaxIdle, "redis-max-idle", flagCfg.Redis.Pool.MaxIdle, "Maximum number of idle connections to Redis")
+	roodCmd.PersistentFlags().IntVar(&flagCfg.Redis.Pool.MaxActive, "redis-max-active", 0, "Maximum number of connections to Redis (default unlimited)")
+	roodCmd.PersistentFlags().DurationVar(&flagCfg.Redis.Pool.IdleTimeout, "redis-idle-timeout", flagCfg.Redis.Pool.IdleTimeout, "Duration after which idle connections to Redis are closed (0 keeps them)")
+	roodCmd.PersistentFlags().BoolVar(&flagCfg.Redis.Pool.Wait, "redis-wait", false, "Wait for a connection to Redis when --redis-max-active connections are in use")
+	roodCmd.PersistentFlags().DurationVar(&flagCfg.Redis.MinBackoff, "retry-min-backoff", flagCfg.Redis.MinBackoff, "Initial interval of retries while Redis is unavailable")
+	roodCmd.PersistentFlags().DurationVar(&flagCfg.Redis.MaxBackoff, "retry-max-backoff", flagCfg.Redis.MaxBackoff, "Maximum interval of retries while Redis is unavailable")
+	roodCmd.PersistentFlags().IntVar(&flagCfg.Buffer.Size, "buffer-size", flagCfg.Buffer.Size, "Number of reports buffered in memory while Redis is unavailable")
+	roodCmd.PersistentFlags().StringVar(&flagCfg.Buffer.Dir, "buffer-dir", "", "Directory to spill buffered reports to when the memory buffer is full (default disabled)")
+	roodCmd.PersistentFlags().IntVar(&flagCfg.Buffer.DirSize, "buffer-dir-size", flagCfg.Buffer.DirSize, "Number of reports spilled to the buffer directory")
+	roodCmd.PersistentFlags().StringVar(&flagCfg.Server.Addr, "addr", "", "Address for HTTP server serving the filtered feed, metrics and health checks (e.g. :8080)")
+	roodCmd.PersistentFlags().StringVar(&flagCfg.WebSub.Callback, "websub-callback", "", "Public URL routed to /websub/ of --addr to subscribe to the feeds at their WebSub hubs (default disabled)")
+	roodCmd.PersistentFlags().StringVar(&flagCfg.WebSub.Hub, "websub-hub", "", "URL of the WebSub hub (default the hub advertised by the feed)")
+	roodCmd.PersistentFlags().StringVar(&flagCfg.WebSub.Secret, "websub-secret", "", "Secret of the signatures of the deliveries (default random)")
+	roodCmd.PersistentFlags().DurationVar(&flagCfg.WebSub.Lease, "websub-lease", 0, "Lease of the subscriptions requested to the hub (default decided by the hub)")
+	roodCmd.PersistentFlags().BoolVar(&flagCfg.Stream.Enabled, "stream", false, "Stream new reports and warning transitions at /events (Server-Sent Events) and /ws (WebSocket) of --addr")
+	roodCmd.PersistentFlags().StringSliceVar(&flagCfg.Stream.Origins, "stream-origin", nil, "Origins of the browsers allowed to connect to the stream, or * for any (default same origin)")
+	roodCmd.PersistentFlags().StringVar(&flagCfg.MQTT.Broker, "mqtt-broker", "", "URL of the MQTT broker to publish new reports and warning transitions (tcp://, ssl://, ws:// or wss://)")
+	roodCmd.PersistentFlags().StringVar(&flagCfg.MQTT.ClientID, "mqtt-client-id", "", "Client ID of the MQTT connection (default assigned by the broker)")
+	roodCmd.PersistentFlags().StringVar(&flagCfg.MQTT.Username, "mqtt-username", "", "Username of the MQTT broker")
+	roodCmd.PersistentFlags().StringVar(&flagCfg.MQTT.Password, "mqtt-password", "", "Password of the MQTT broker")
+	roodCmd.PersistentFlags().StringVar(&flagCfg.MQTT.Topic, "mqtt-topic", flagCfg.MQTT.Topic, "Root of the MQTT topics, e.g. <topic>/warning/<area code>/<warning kind code>")
+	roodCmd.PersistentFlags().IntVar(&flagCfg.MQTT.QoS, "mqtt-qos", flagCfg.MQTT.QoS, "QoS of the MQTT messages (0, 1 or 2)")
+	roodCmd.PersistentFlags().StringVar(&flagCfg.MQTT.TLS.CAFile, "mqtt-tls-ca", "", "PEM file of the CA to verify the MQTT broker (default system CAs)")
+	roodCmd.PersistentFlags().StringVar(&flagCfg.MQTT.TLS.CertFile, "mqtt-tls-cert", "", "PEM file of the client certificate for the MQTT broker")
+	roodCmd.PersistentFlags().StringVar(&flagCfg.MQTT.TLS.KeyFile, "mqtt-tls-key", "", "PEM file of the client key for the MQTT broker")
+	roodCmd.PersistentFlags().StringVar(&flagCfg.MQTT.TLS.ServerName, "mqtt-tls-server-name", "", "Server name to verify the certificate of the MQTT broker (default the host)")
+	roodCmd.PersistentFlags().BoolVar(&flagCfg.MQTT.TLS.InsecureSkipVerify, "mqtt-tls-skip-verify", false, "Skip verifying the certificate of the MQTT broker (insecure)")
+	roodCmd.PersistentFlags().IntVar(&flagCfg.Sink.BatchSize, "sink-batch-size", flagCfg.Sink.BatchSize, "Maximum number of the events written to a sink at once")
+	roodCmd.PersistentFlags().IntVar(&flagCfg.Sink.OutboxSize, "sink-outbox-size", flagCfg.Sink.OutboxSize, "Maximum number of the events kept in the outbox, which are replayed to the live stream and read by the sinks")
+	roodCmd.PersistentFlags().StringVar(&flagCfg.Sink.NATS.URL, "nats-url", "", "Comma separated URLs of the NATS servers to deliver new reports and warning transitions to JetStream")
+	roodCmd.PersistentFlags().StringVar(&flagCfg.Sink.NATS.Username, "nats-username", "", "Username of the NATS servers")
+	roodCmd.PersistentFlags().StringVar(&flagCfg.Sink.NATS.Password, "nats-password", "", "Password of the NATS servers")
+	roodCmd.PersistentFlags().StringVar(&flagCfg.Sink.NATS.Subject, "nats-subject", flagCfg.Sink.NATS.Subject, "Root of the NATS subjects, e.g. <subject>.warning.<area code>.<warning kind code>")
+	roodCmd.PersistentFlags().StringVar(&flagCfg.Sink.NATS.Stream, "nats-stream", "", "Name of the JetStream stream created or updated for the subjects (default not managed)")
+	roodCmd.PersistentFlags().StringVar(&flagCfg.Sink.NATS.TLS.CAFile, "nats-tls-ca", "", "PEM file of the CA to verify the NATS servers (default system CAs)")
+	roodCmd.PersistentFlags().StringVar(&flagCfg.Sink.NATS.TLS.CertFile, "nats-tls-cert", "", "PEM file of the client certificate for the NATS servers")
+	roodCmd.PersistentFlags().StringVar(&flagCfg.Sink.NATS.TLS.KeyFile, "nats-tls-key", "", "PEM file of the client key for the NATS servers")
+	roodCmd.PersistentFlags().StringVar(&flagCfg.Sink.NATS.TLS.ServerName, "nats-tls-server-name", "", "Server name to verify the certificates of the NATS servers (default the host)")
+	roodCmd.PersistentFlags().BoolVar(&flagCfg.Sink.NATS.TLS.InsecureSkipVerify, "nats-tls-skip-verify", false, "Skip verifying the certificates of the NATS servers (insecure)")
+	roodCmd.PersistentFlags().StringSliceVar(&flagCfg.Sink.Kafka.Brokers, "kafka-broker", nil, "Addresses of the Kafka brokers to deliver new reports and warning transitions (e.g. 127.0.0.1:9092)")
+	roodCmd.PersistentFlags().StringVar(&flagCfg.Sink.Kafka.Topic, "kafka-topic", flagCfg.Sink.Kafka.Topic, "Kafka topic of the events, whose keys are the area codes")
+	roodCmd.PersistentFlags().StringVar(&flagCfg.Sink.Kafka.SASL.Mechanism, "kafka-sasl-mechanism", "", "SASL mechanism of the Kafka brokers (plain, scram-sha-256 or scram-sha-512, default no SASL)")
+	roodCmd.PersistentFlags().StringVar(&flagCfg.Sink.Kafka.SASL.Username, "kafka-sasl-username", "", "SASL username of the Kafka brokers")
+	roodCmd.PersistentFlags().StringVar(&flagCfg.Sink.Kafka.SASL.Password, "kafka-sasl-password", "", "SASL password of the Kafka brokers")
+	roodCmd.PersistentFlags().BoolVar(&flagCfg.Sink.Kafka.TLS.Enabled, "kafka-tls", false, "Connect to the Kafka brokers with TLS")
+	roodCmd.PersistentFlags().StringVar(&flagCfg.Sink.Kafka.TLS.CAFile, "kafka-tls-ca", "", "PEM file of the CA to verify the Kafka brokers (default system CAs)")
+	roodCmd.PersistentFlags().StringVar(&flagCfg.Sink.Kafka.TLS.CertFile, "kafka-tls-cert", "", "PEM file of the client certificate for the Kafka brokers")
+	roodCmd.PersistentFlags().StringVar(&flagCfg.Sink.Kafka.TLS.KeyFile, "kafka-tls-key", "", "PEM file of the client key for the Kafka brokers")
+	roodCmd.PersistentFlags().StringVar(&flagCfg.Sink.Kafka.TLS.ServerName, "kafka-tls-server-name", "", "Server name to verify the certificates of the Kafka brokers (default the host)")
+	roodCmd.PersistentFlags().BoolVar(&flagCfg.Sink.Kafka.TLS.InsecureSkipVerify, "kafka-tls-skip-verify", false, "Skip verifying the certificates of the Kafka brokers (insecure)")
+	roodCmd.PersistentFlags().StringVar(&flagCfg.GRPC.Addr, "grpc-addr", "", "Address of the gRPC API serving the reports, the warnings and the subscription of the events (e.g. :9090)")
+	roodCmd.PersistentFlags().IntVar(&flagCfg.Health.MaxMissedPolls, "ready-missed-polls", flagCfg.Health.MaxMissedPolls, "Number of intervals allowed without a successful poll before /readyz fails (0 disables)")
+	roodCmd.PersistentFlags().IntVar(&flagCfg.Health.MaxFailures, "ready-max-failures", flagCfg.Health.MaxFailures, "Number of consecutive failed polls before /readyz fails (0 disables)")
+	roodCmd.PersistentFlags().StringSliceVar(&flagCfg.Publish.Titles, "feed-title", nil, "Titles of entries to republish (default all)")
+	roodCmd.PersistentFlags().StringSliceVar(&flagCfg.Publish.Areas, "feed-area", nil, "Area codes of entries to republish (default all)")
+	roodCmd.PersistentFlags().StringVar(&flagCfg.Archive.Backend, "archive-backend", "", "Backend to archive raw XML documents (dir or store)")
+	roodCmd.PersistentFlags().StringVar(&flagCfg.Archive.Dir, "archive-dir", "", "Directory to archive raw XML documents when the backend is dir")
+	roodCmd.PersistentFlags().DurationVar(&flagCfg.Archive.Retention, "archive-retention", 0, "Retention period of archived documents (default forever)")
+	roodCmd.PersistentFlags().BoolVar(&flagCfg.Leader.Enabled, "leader-election", false, "Elect a leader among the replicas sharing Redis, so that only the leader polls and writes reports")
+	roodCmd.PersistentFlags().DurationVar(&flagCfg.Leader.TTL, "leader-ttl", flagCfg.Leader.TTL, "Lease of the leader lock, within which a follower takes over after the leader dies (must be less than --second)")
+	roodCmd.PersistentFlags().StringVar(&flagCfg.Trace.Exporter, "trace-exporter", "", "Exporter of traces (otlpgrpc or otlphttp, default disabled)")
+	roodCmd.PersistentFlags().StringVar(&flagCfg.Trace.Endpoint, "trace-endpoint", "", "Endpoint of the OTLP collector (e.g. localhost:4317)")
+	roodCmd.PersistentFlags().BoolVar(&flagCfg.Trace.Insecure, "trace-insecure", false, "Connect to the OTLP collector without TLS")
+	roodCmd.PersistentFlags().Float64Var(&flagCfg.Trace.SampleRatio, "trace-sample-ratio", flagCfg.Trace.SampleRatio, "Ratio of the traced ticks")
+	roodCmd.PersistentFlags().StringVar(&flagCfg.Log.Format, "log-format", flagCfg.Log.Format, "Format of logs (text or json)")
+	roodCmd.PersistentFlags().StringVar(&flagCfg.Log.Level, "log-level", flagCfg.Log.Level, "Default level of logs (debug, info, warn or error)")
+	roodCmd.PersistentFlags().StringToStringVar(&flagCfg.Log.Levels, "log-levels", nil, "Levels of logs of each subsystem (e.g. fetcher=debug,store=warn)")
 }
 
 // Execute executes cli application.
 func Execute() {
 	if err := roodCmd.Execute(); err != nil {
-		glg.Error("exit app because an error occurred: %v", err)
+		logger.Errorf("exit app because an error occurred: %v", err)
 		os.Exit(1)
 	}
 }
@@ -0,0 +1,112 @@
+package archive
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"path"
+	"sync"
+
+	"github.com/pkg/errors"
+
+	"github.com/hlts2/gweather/internal/fetcher"
+	"github.com/hlts2/gweather/internal/report"
+)
+
+// Archive represents an interface to archive raw documents downloaded by the fetcher.
+type Archive interface {
+	fetcher.Recorder
+
+	// Prune removes documents older than the retention period.
+	Prune(ctx context.Context) error
+}
+
+const (
+	// BackendDir is a backend which archives documents in a local directory.
+	BackendDir = "dir"
+
+	// BackendStore is a backend which archives documents in redis.
+	BackendStore = "store"
+)
+
+// Name returns the relative name of the document in the archive.
+// A feed is named by the fetched time and the hash of its URL, so that the feeds fetched at the same time don't overwrite each other.
+// e.g) feed/20190325T082801Z-5e4d2c1b.xml, report/4eb2228e-262f-302f-892c-d7726f196984.xml
+func Name(doc *fetcher.Document) string {
+	switch doc.Kind {
+	case fetcher.KindFeed:
+		return path.Join(string(doc.Kind), doc.Fetched.UTC().Format("20060102T150405Z")+"-"+feedID(doc.URL)+".xml")
+	default:
+		return path.Join(string(doc.Kind), report.UUID(doc.ID)+".xml")
+	}
+}
+
+// feedID returns the first 8 hex digits of SHA-1 of the URL of the feed.
+func feedID(url string) string {
+	sum := sha1.Sum([]byte(url))
+	return hex.EncodeToString(sum[:4])
+}
+
+// compress compresses the document with gzip. The URL of the document is kept as the comment of the gzip header,
+// so that a feed is replayed under its original URL.
+func compress(doc *fetcher.Document) ([]byte, error) {
+	buf := new(bytes.Buffer)
+
+	w := gzip.NewWriter(buf)
+	w.Comment = latin1(doc.URL)
+	if _, err := w.Write(doc.Data); err != nil {
+		return nil, errors.Wrap(err, "faild to write gzip")
+	}
+	if err := w.Close(); err != nil {
+		return nil, errors.Wrap(err, "faild to close gzip")
+	}
+
+	return buf.Bytes(), nil
+}
+
+// latin1 returns s if it can be written in the gzip header, which is limited to Latin-1 without NUL.
+// A URL with other characters is not kept.
+func latin1(s string) string {
+	for _, c := range s {
+		if c == 0 || c > 0xff {
+			return ""
+		}
+	}
+	return s
+}
+
+// dedup skips a feed which is identical to the previously archived one of the same URL,
+// because the feed is downloaded on every tick even if it has not been updated.
+type dedup struct {
+	mu   sync.Mutex
+	last map[string][sha256.Size]byte
+}
+
+func (d *dedup) changed(doc *fetcher.Document) bool {
+	if doc.Kind != fetcher.KindFeed {
+		return true
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	last, ok := d.last[doc.URL]
+	return !ok || sha256.Sum256(doc.Data) != last
+}
+
+// archived must be called after the document is archived successfully.
+func (d *dedup) archived(doc *fetcher.Document) {
+	if doc.Kind != fetcher.KindFeed {
+		return
+	}
+
+	d.mu.Lock()
+	if d.last == nil {
+		d.last = make(map[string][sha256.Size]byte)
+	}
+	d.last[doc.URL] = sha256.Sum256(doc.Data)
+	d.mu.Unlock()
+}
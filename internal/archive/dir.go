@@ -0,0 +1,97 @@
+package archive
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/hlts2/gweather/internal/fetcher"
+)
+
+type dirArchive struct {
+	dedup
+	dir       string
+	retention time.Duration
+}
+
+// NewDir returns Archive implementation which stores gzip compressed documents under dir.
+// Documents are kept forever when retention is zero.
+func NewDir(dir string, retention time.Duration) Archive {
+	return &dirArchive{
+		dir:       dir,
+		retention: retention,
+	}
+}
+
+func (d *dirArchive) Record(ctx context.Context, doc *fetcher.Document) error {
+	if !d.changed(doc) {
+		return nil
+	}
+
+	name := filepath.Join(d.dir, filepath.FromSlash(Name(doc))+".gz")
+
+	// Report documents are never updated, so it is not necessary to write them again.
+	if doc.Kind == fetcher.KindReport {
+		if _, err := os.Stat(name); err == nil {
+			return nil
+		}
+	}
+
+	if err := os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+		return errors.Wrapf(err, "faild to create directory: %s", filepath.Dir(name))
+	}
+
+	b, err := compress(doc)
+	if err != nil {
+		return errors.Wrap(err, "faild to compress")
+	}
+
+	// Write to a temporary file first so that readers never see a partial file.
+	tmp := name + ".tmp"
+	if err := ioutil.WriteFile(tmp, b, 0644); err != nil {
+		return errors.Wrapf(err, "faild to write file: %s", tmp)
+	}
+
+	if err := os.Rename(tmp, name); err != nil {
+		os.Remove(tmp)
+		return errors.Wrapf(err, "faild to rename file: %s", tmp)
+	}
+
+	d.archived(doc)
+	return nil
+}
+
+func (d *dirArchive) Prune(ctx context.Context) error {
+	if d.retention <= 0 {
+		return nil
+	}
+
+	deadline := time.Now().Add(-d.retention)
+
+	err := filepath.Walk(d.dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		if info.IsDir() || !info.ModTime().Before(deadline) {
+			return nil
+		}
+
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return errors.Wrapf(err, "faild to remove file: %s", path)
+		}
+		return nil
+	})
+	return errors.Wrapf(err, "faild to prune directory: %s", d.dir)
+}
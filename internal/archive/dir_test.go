@@ -0,0 +1,187 @@
+package archive
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/hlts2/gweather/internal/fetcher"
+)
+
+const (
+	extraURL   = "http://www.data.jma.go.jp/developer/xml/feed/extra.xml"
+	regularURL = "http://www.data.jma.go.jp/developer/xml/feed/regular.xml"
+	reportID   = "urn:uuid:4eb2228e-262f-302f-892c-d7726f196984"
+)
+
+var fetched = time.Date(2019, 3, 25, 8, 28, 1, 0, time.UTC)
+
+// later returns doc fetched d later.
+func later(doc *fetcher.Document, d time.Duration) *fetcher.Document {
+	doc.Fetched = doc.Fetched.Add(d)
+	return doc
+}
+
+func feedDocument(url, data string) *fetcher.Document {
+	return &fetcher.Document{
+		Kind:    fetcher.KindFeed,
+		URL:     url,
+		Data:    []byte(data),
+		Fetched: fetched,
+	}
+}
+
+func reportDocument(data string) *fetcher.Document {
+	return &fetcher.Document{
+		Kind:    fetcher.KindReport,
+		ID:      reportID,
+		URL:     "http://www.data.jma.go.jp/developer/xml/data/4eb2228e-262f-302f-892c-d7726f196984.xml",
+		Data:    []byte(data),
+		Fetched: fetched,
+	}
+}
+
+// decompress returns the data and the comment of the gzip header.
+func decompress(t *testing.T, b []byte) (string, string) {
+	r, err := gzip.NewReader(bytes.NewReader(b))
+	if err != nil {
+		t.Fatalf("faild to create gzip reader: %v", err)
+	}
+	defer r.Close()
+
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		t.Fatalf("faild to read gzip: %v", err)
+	}
+	return string(data), r.Comment
+}
+
+func TestName(t *testing.T) {
+	tests := []struct {
+		doc  *fetcher.Document
+		want string
+	}{
+		{doc: feedDocument(extraURL, ""), want: "feed/20190325T082801Z-" + feedID(extraURL) + ".xml"},
+		{doc: reportDocument(""), want: "report/4eb2228e-262f-302f-892c-d7726f196984.xml"},
+	}
+
+	for _, tt := range tests {
+		if got := Name(tt.doc); got != tt.want {
+			t.Errorf("Name returns %s, want %s", got, tt.want)
+		}
+	}
+
+	if feedID(extraURL) == feedID(regularURL) {
+		t.Error("feeds fetched at the same time have the same name")
+	}
+}
+
+func readDir(t *testing.T, dir string) map[string]string {
+	files := make(map[string]string)
+	err := filepath.Walk(dir, func(p string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+		b, err := ioutil.ReadFile(p)
+		if err != nil {
+			return err
+		}
+		rel, _ := filepath.Rel(dir, p)
+		files[filepath.ToSlash(rel)], _ = decompress(t, b)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("faild to walk directory: %v", err)
+	}
+	return files
+}
+
+func TestDirRecord(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gweather-archive")
+	if err != nil {
+		t.Fatalf("faild to create directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	a := NewDir(dir, 0)
+	record := func(doc *fetcher.Document) {
+		if err := a.Record(context.Background(), doc); err != nil {
+			t.Fatalf("Record returns error: %v", err)
+		}
+	}
+
+	// The feeds fetched in the same second are archived in their own files.
+	record(feedDocument(extraURL, "extra 1"))
+	record(feedDocument(regularURL, "regular 1"))
+
+	// The feeds polled alternately are skipped while each of them is unchanged.
+	record(later(feedDocument(extraURL, "extra 1"), time.Minute))
+	record(later(feedDocument(regularURL, "regular 1"), time.Minute))
+
+	record(later(feedDocument(extraURL, "extra 2"), 2*time.Minute))
+	record(later(feedDocument(regularURL, "regular 1"), 2*time.Minute))
+
+	// A report is never written again.
+	record(reportDocument("report 1"))
+	record(reportDocument("report 2"))
+
+	files := readDir(t, dir)
+	want := map[string]string{
+		"feed/20190325T082801Z-" + feedID(extraURL) + ".xml.gz":   "extra 1",
+		"feed/20190325T082801Z-" + feedID(regularURL) + ".xml.gz": "regular 1",
+		"feed/20190325T083001Z-" + feedID(extraURL) + ".xml.gz":   "extra 2",
+		"report/4eb2228e-262f-302f-892c-d7726f196984.xml.gz":      "report 1",
+	}
+
+	if len(files) != len(want) {
+		t.Errorf("archived files are %v, want %v", files, want)
+	}
+	for name, data := range want {
+		if files[name] != data {
+			t.Errorf("%s is %q, want %q", name, files[name], data)
+		}
+	}
+
+	// The URL of the feed is kept in the gzip header.
+	b, err := ioutil.ReadFile(filepath.Join(dir, "feed", "20190325T082801Z-"+feedID(regularURL)+".xml.gz"))
+	if err != nil {
+		t.Fatalf("faild to read file: %v", err)
+	}
+	if _, comment := decompress(t, b); comment != regularURL {
+		t.Errorf("comment is %s, want %s", comment, regularURL)
+	}
+}
+
+func TestDirPrune(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gweather-archive")
+	if err != nil {
+		t.Fatalf("faild to create directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	a := NewDir(dir, time.Hour)
+	for _, doc := range []*fetcher.Document{feedDocument(extraURL, "extra"), reportDocument("report")} {
+		if err := a.Record(context.Background(), doc); err != nil {
+			t.Fatalf("Record returns error: %v", err)
+		}
+	}
+
+	old := filepath.Join(dir, filepath.FromSlash(Name(feedDocument(extraURL, "")))+".gz")
+	if err := os.Chtimes(old, time.Now().Add(-2*time.Hour), time.Now().Add(-2*time.Hour)); err != nil {
+		t.Fatalf("faild to change time: %v", err)
+	}
+
+	if err := a.Prune(context.Background()); err != nil {
+		t.Fatalf("Prune returns error: %v", err)
+	}
+
+	files := readDir(t, dir)
+	if _, ok := files["report/4eb2228e-262f-302f-892c-d7726f196984.xml.gz"]; len(files) != 1 || !ok {
+		t.Errorf("files after prune are %v, want only the report", files)
+	}
+}
@@ -0,0 +1,73 @@
+package archive
+
+import (
+	"context"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/hlts2/gweather/internal/fetcher"
+	"github.com/hlts2/gweather/internal/redis"
+)
+
+// KeyPrefix is the prefix of keys of the documents archived in redis.
+const KeyPrefix = "gweather:archive:"
+
+type storeArchive struct {
+	dedup
+	pool      redis.Pool
+	prefix    string
+	retention time.Duration
+}
+
+// NewStore returns Archive implementation which stores gzip compressed documents in redis.
+// The keys are prepended by prefix in addition to KeyPrefix.
+// The retention is applied as the expiration of keys, and keys never expire when it is zero.
+func NewStore(pool redis.Pool, prefix string, retention time.Duration) Archive {
+	return &storeArchive{
+		pool:      pool,
+		prefix:    prefix,
+		retention: retention,
+	}
+}
+
+func (s *storeArchive) Record(ctx context.Context, doc *fetcher.Document) error {
+	if !s.changed(doc) {
+		return nil
+	}
+
+	b, err := compress(doc)
+	if err != nil {
+		return errors.Wrap(err, "faild to compress")
+	}
+
+	conn, err := s.pool.GetContext(ctx)
+	if err != nil {
+		return errors.Wrap(err, "faild to get redis connection")
+	}
+	defer conn.Close()
+
+	key := s.prefix + KeyPrefix + Name(doc)
+
+	args := []interface{}{key, b}
+	if s.retention > 0 {
+		args = append(args, "PX", int64(s.retention/time.Millisecond))
+	}
+
+	// Report documents are never updated, so it is not necessary to write them again.
+	if doc.Kind == fetcher.KindReport {
+		args = append(args, "NX")
+	}
+
+	if _, err := conn.Do("SET", args...); err != nil {
+		return errors.Wrapf(err, "faild to set: %s", key)
+	}
+
+	s.archived(doc)
+	return nil
+}
+
+// Prune does nothing because keys are expired by redis.
+func (s *storeArchive) Prune(ctx context.Context) error {
+	return nil
+}
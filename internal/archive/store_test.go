@@ -0,0 +1,86 @@
+package archive
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+
+	"github.com/hlts2/gweather/internal/fetcher"
+	"github.com/hlts2/gweather/internal/redis"
+)
+
+func newTestStore(t *testing.T, retention time.Duration) (Archive, *miniredis.Miniredis) {
+	s := miniredis.RunT(t)
+
+	pool, err := redis.New("redis://"+s.Addr(), redis.Options{})
+	if err != nil {
+		t.Fatalf("faild to create redis pool: %v", err)
+	}
+	t.Cleanup(func() {
+		pool.Close()
+	})
+
+	return NewStore(pool, "test:", retention), s
+}
+
+func TestStoreRecord(t *testing.T) {
+	a, s := newTestStore(t, 0)
+
+	for _, doc := range []*fetcher.Document{
+		feedDocument(extraURL, "extra 1"),
+		feedDocument(regularURL, "regular 1"),
+		later(feedDocument(extraURL, "extra 1"), time.Minute),
+		later(feedDocument(regularURL, "regular 2"), time.Minute),
+		reportDocument("report 1"),
+		reportDocument("report 2"),
+	} {
+		if err := a.Record(context.Background(), doc); err != nil {
+			t.Fatalf("Record returns error: %v", err)
+		}
+	}
+
+	want := map[string]string{
+		"test:" + KeyPrefix + "feed/20190325T082801Z-" + feedID(extraURL) + ".xml":   "extra 1",
+		"test:" + KeyPrefix + "feed/20190325T082801Z-" + feedID(regularURL) + ".xml": "regular 1",
+		"test:" + KeyPrefix + "feed/20190325T082901Z-" + feedID(regularURL) + ".xml": "regular 2",
+		"test:" + KeyPrefix + "report/4eb2228e-262f-302f-892c-d7726f196984.xml":      "report 1",
+	}
+
+	if keys := s.Keys(); len(keys) != len(want) {
+		t.Errorf("archived keys are %v, want %d keys", keys, len(want))
+	}
+	for key, data := range want {
+		v, err := s.Get(key)
+		if err != nil {
+			t.Errorf("faild to get %s: %v", key, err)
+			continue
+		}
+		if got, _ := decompress(t, []byte(v)); got != data {
+			t.Errorf("%s is %q, want %q", key, got, data)
+		}
+		if ttl := s.TTL(key); ttl != 0 {
+			t.Errorf("%s expires in %v without retention", key, ttl)
+		}
+	}
+}
+
+func TestStoreRetention(t *testing.T) {
+	a, s := newTestStore(t, time.Hour)
+
+	doc := reportDocument("report")
+	if err := a.Record(context.Background(), doc); err != nil {
+		t.Fatalf("Record returns error: %v", err)
+	}
+
+	key := "test:" + KeyPrefix + Name(doc)
+	if ttl := s.TTL(key); ttl != time.Hour {
+		t.Errorf("%s expires in %v, want %v", key, ttl, time.Hour)
+	}
+
+	s.FastForward(time.Hour)
+	if s.Exists(key) {
+		t.Errorf("%s is not expired after the retention", key)
+	}
+}
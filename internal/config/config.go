@@ -0,0 +1,649 @@
+package config
+
+import (
+	"io/ioutil"
+	"net/url"
+	"os"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/pflag"
+	yaml "gopkg.in/yaml.v2"
+
+	"github.com/hlts2/gweather/internal/kafka"
+	"github.com/hlts2/gweather/internal/log"
+	"github.com/hlts2/gweather/internal/report"
+	"github.com/hlts2/gweather/internal/schedule"
+)
+
+// EnvPrefix is the prefix of environment variables which override the configuration file.
+// e.g) GWEATHER_REDIS_HOST overrides redis.host.
+const EnvPrefix = "GWEATHER"
+
+// Config represents the configuration of gweather.
+// A field is set from the configuration file by the yaml tag, from the environment variable derived from the yaml tags,
+// and from the command line flag by the flag tag in this order.
+type Config struct {
+	Second uint     `yaml:"second" flag:"second"`
+	Feeds  []string `yaml:"feeds" flag:"feed"`
+
+	// ReportCache caches the reports of each feed in memory, so that a poll downloads only the reports of the new entries.
+	ReportCache bool `yaml:"report_cache" flag:"report-cache"`
+
+	Schedule Schedule `yaml:"schedule"`
+
+	Redis   Redis   `yaml:"redis"`
+	Buffer  Buffer  `yaml:"buffer"`
+	Server  Server  `yaml:"server"`
+	WebSub  WebSub  `yaml:"websub"`
+	Stream  Stream  `yaml:"stream"`
+	GRPC    GRPC    `yaml:"grpc"`
+	MQTT    MQTT    `yaml:"mqtt"`
+	Sink    Sink    `yaml:"sink"`
+	Publish Publish `yaml:"publish"`
+	Archive Archive `yaml:"archive"`
+	Health  Health  `yaml:"health"`
+	Leader  Leader  `yaml:"leader"`
+	Log     Log     `yaml:"log"`
+	Trace   Trace   `yaml:"trace"`
+}
+
+// Schedule represents the schedules of the polls of the feeds.
+type Schedule struct {
+	// Feeds are cron expressions or descriptors (e.g. @every 1m) by feed URL.
+	// The other feeds are polled every Second, or by the adaptive interval if it is enabled.
+	Feeds    map[string]string `yaml:"feeds" flag:"schedule"`
+	Jitter   time.Duration     `yaml:"jitter" flag:"schedule-jitter"`
+	Overlap  string            `yaml:"overlap" flag:"schedule-overlap"`
+	Adaptive Adaptive          `yaml:"adaptive"`
+}
+
+// Adaptive represents the bounds of the adaptive interval of the polls of the feeds without a schedule.
+type Adaptive struct {
+	Enabled bool          `yaml:"enabled" flag:"adaptive"`
+	Min     time.Duration `yaml:"min" flag:"adaptive-min"`
+	Max     time.Duration `yaml:"max" flag:"adaptive-max"`
+}
+
+// Redis represents the configuration of the store.
+type Redis struct {
+	Host        string `yaml:"host" flag:"host"`
+	HistorySize int    `yaml:"history_size" flag:"history-size"`
+
+	// TTL expires the reports which have not been written for the duration, e.g. after they are dropped from the feed. Reports never expire when it is 0.
+	TTL time.Duration `yaml:"ttl" flag:"report-ttl"`
+
+	// Prefix is prepended to all keys so that several applications share redis.
+	Prefix string `yaml:"prefix" flag:"redis-prefix"`
+
+	// KeyTemplate is the template of the keys of reports. See report.KeyTemplate for the fields.
+	KeyTemplate string `yaml:"key_template" flag:"key-template"`
+
+	// Username and Password override the credentials of the host URL. Username is the ACL user.
+	Username string `yaml:"username" flag:"redis-username"`
+	Password string `yaml:"password" flag:"redis-password"`
+
+	// DB overrides the database of the host URL.
+	DB int `yaml:"db" flag:"redis-db"`
+
+	TLS  TLS  `yaml:"tls"`
+	Pool Pool `yaml:"pool"`
+
+	// MinBackoff and MaxBackoff are the range of the interval of retries while redis is unavailable.
+	MinBackoff time.Duration `yaml:"min_backoff" flag:"retry-min-backoff"`
+	MaxBackoff time.Duration `yaml:"max_backoff" flag:"retry-max-backoff"`
+}
+
+// TLS represents the TLS configuration of connections to redis.
+// TLS is always enabled for rediss:// hosts.
+type TLS struct {
+	Enabled            bool   `yaml:"enabled" flag:"redis-tls"`
+	CAFile             string `yaml:"ca_file" flag:"redis-tls-ca"`
+	CertFile           string `yaml:"cert_file" flag:"redis-tls-cert"`
+	KeyFile            string `yaml:"key_file" flag:"redis-tls-key"`
+	ServerName         string `yaml:"server_name" flag:"redis-tls-server-name"`
+	InsecureSkipVerify bool   `yaml:"insecure_skip_verify" flag:"redis-tls-skip-verify"`
+}
+
+// Pool represents the pool of connections to redis.
+type Pool struct {
+	MaxIdle     int           `yaml:"max_idle" flag:"redis-max-idle"`
+	MaxActive   int           `yaml:"max_active" flag:"redis-max-active"`
+	IdleTimeout time.Duration `yaml:"idle_timeout" flag:"redis-idle-timeout"`
+	Wait        bool          `yaml:"wait" flag:"redis-wait"`
+}
+
+// Buffer represents the buffer of reports while redis is unavailable.
+type Buffer struct {
+	Size    int    `yaml:"size" flag:"buffer-size"`
+	Dir     string `yaml:"dir" flag:"buffer-dir"`
+	DirSize int    `yaml:"dir_size" flag:"buffer-dir-size"`
+}
+
+// Server represents the configuration of the HTTP server.
+type Server struct {
+	Addr string `yaml:"addr" flag:"addr"`
+}
+
+// WebSub represents the configuration of the WebSub subscriber.
+type WebSub struct {
+	Callback string        `yaml:"callback" flag:"websub-callback"`
+	Hub      string        `yaml:"hub" flag:"websub-hub"`
+	Secret   string        `yaml:"secret" flag:"websub-secret"`
+	Lease    time.Duration `yaml:"lease" flag:"websub-lease"`
+}
+
+// Stream represents the configuration of the live stream of the events over Server-Sent Events and WebSocket.
+type Stream struct {
+	Enabled bool `yaml:"enabled" flag:"stream"`
+
+	// Origins are the origins of the browsers allowed to connect. "*" allows any origin.
+	Origins []string `yaml:"origins" flag:"stream-origin"`
+}
+
+// GRPC represents the configuration of the gRPC API. The API is served when Addr is not empty.
+type GRPC struct {
+	Addr string `yaml:"addr" flag:"grpc-addr"`
+}
+
+// MQTT represents the configuration of the publisher of the events to an MQTT broker. The events are published when Broker is not empty.
+type MQTT struct {
+	// Broker is the URL of the broker, e.g. tcp://127.0.0.1:1883. TLS is used for ssl://, tls://, mqtts:// and wss:// URLs.
+	Broker   string `yaml:"broker" flag:"mqtt-broker"`
+	ClientID string `yaml:"client_id" flag:"mqtt-client-id"`
+	Username string `yaml:"username" flag:"mqtt-username"`
+	Password string `yaml:"password" flag:"mqtt-password"`
+
+	// Topic is the root of the topics, e.g. gweather/warning/<area code>/<warning kind code>.
+	Topic string `yaml:"topic" flag:"mqtt-topic"`
+	QoS   int    `yaml:"qos" flag:"mqtt-qos"`
+
+	TLS MQTTTLS `yaml:"tls"`
+}
+
+// MQTTTLS represents the TLS configuration of the connection to the MQTT broker.
+type MQTTTLS struct {
+	CAFile             string `yaml:"ca_file" flag:"mqtt-tls-ca"`
+	CertFile           string `yaml:"cert_file" flag:"mqtt-tls-cert"`
+	KeyFile            string `yaml:"key_file" flag:"mqtt-tls-key"`
+	ServerName         string `yaml:"server_name" flag:"mqtt-tls-server-name"`
+	InsecureSkipVerify bool   `yaml:"insecure_skip_verify" flag:"mqtt-tls-skip-verify"`
+}
+
+// Sink represents the configuration of the delivery of the events to the message brokers through the outbox in redis.
+type Sink struct {
+	BatchSize int `yaml:"batch_size" flag:"sink-batch-size"`
+
+	// OutboxSize is the number of the latest events kept in the outbox, which the live stream and the gRPC API also replay.
+	OutboxSize int `yaml:"outbox_size" flag:"sink-outbox-size"`
+
+	NATS  NATS  `yaml:"nats"`
+	Kafka Kafka `yaml:"kafka"`
+}
+
+// NATS represents the configuration of the sink to NATS JetStream. The events are delivered when URL is not empty.
+type NATS struct {
+	// URL is the comma separated URLs of the servers, e.g. nats://127.0.0.1:4222.
+	URL      string `yaml:"url" flag:"nats-url"`
+	Username string `yaml:"username" flag:"nats-username"`
+	Password string `yaml:"password" flag:"nats-password"`
+
+	// Subject is the root of the subjects, e.g. gweather.warning.<area code>.<warning kind code>.
+	Subject string `yaml:"subject" flag:"nats-subject"`
+
+	// Stream is the name of the stream created or updated for the subjects. The stream is not managed when it is empty.
+	Stream string `yaml:"stream" flag:"nats-stream"`
+
+	TLS NATSTLS `yaml:"tls"`
+}
+
+// NATSTLS represents the TLS configuration of the connection to NATS. TLS is used when any of them is set, or the scheme of the URL is tls.
+type NATSTLS struct {
+	CAFile             string `yaml:"ca_file" flag:"nats-tls-ca"`
+	CertFile           string `yaml:"cert_file" flag:"nats-tls-cert"`
+	KeyFile            string `yaml:"key_file" flag:"nats-tls-key"`
+	ServerName         string `yaml:"server_name" flag:"nats-tls-server-name"`
+	InsecureSkipVerify bool   `yaml:"insecure_skip_verify" flag:"nats-tls-skip-verify"`
+}
+
+// Kafka represents the configuration of the sink to Kafka. The events are delivered when Brokers is not empty.
+type Kafka struct {
+	Brokers []string `yaml:"brokers" flag:"kafka-broker"`
+	Topic   string   `yaml:"topic" flag:"kafka-topic"`
+
+	SASL KafkaSASL `yaml:"sasl"`
+	TLS  KafkaTLS  `yaml:"tls"`
+}
+
+// KafkaSASL represents the SASL authentication to Kafka. The mechanism is plain, scram-sha-256 or scram-sha-512.
+type KafkaSASL struct {
+	Mechanism string `yaml:"mechanism" flag:"kafka-sasl-mechanism"`
+	Username  string `yaml:"username" flag:"kafka-sasl-username"`
+	Password  string `yaml:"password" flag:"kafka-sasl-password"`
+}
+
+// KafkaTLS represents the TLS configuration of the connection to Kafka.
+type KafkaTLS struct {
+	Enabled            bool   `yaml:"enabled" flag:"kafka-tls"`
+	CAFile             string `yaml:"ca_file" flag:"kafka-tls-ca"`
+	CertFile           string `yaml:"cert_file" flag:"kafka-tls-cert"`
+	KeyFile            string `yaml:"key_file" flag:"kafka-tls-key"`
+	ServerName         string `yaml:"server_name" flag:"kafka-tls-server-name"`
+	InsecureSkipVerify bool   `yaml:"insecure_skip_verify" flag:"kafka-tls-skip-verify"`
+}
+
+// Publish represents the filter of the republished feed.
+type Publish struct {
+	Titles []string `yaml:"titles" flag:"feed-title"`
+	Areas  []string `yaml:"areas" flag:"feed-area"`
+}
+
+// Archive represents the configuration of the archive of raw XML documents.
+type Archive struct {
+	Backend   string        `yaml:"backend" flag:"archive-backend"`
+	Dir       string        `yaml:"dir" flag:"archive-dir"`
+	Retention time.Duration `yaml:"retention" flag:"archive-retention"`
+}
+
+// Health represents thresholds of the readiness.
+type Health struct {
+	MaxMissedPolls int `yaml:"max_missed_polls" flag:"ready-missed-polls"`
+	MaxFailures    int `yaml:"max_failures" flag:"ready-max-failures"`
+}
+
+// Leader represents the configuration of the leader election among the replicas.
+type Leader struct {
+	Enabled bool          `yaml:"enabled" flag:"leader-election"`
+	TTL     time.Duration `yaml:"ttl" flag:"leader-ttl"`
+}
+
+// Log represents the configuration of logging.
+type Log struct {
+	Format string            `yaml:"format" flag:"log-format"`
+	Level  string            `yaml:"level" flag:"log-level"`
+	Levels map[string]string `yaml:"levels" flag:"log-levels"`
+}
+
+// Trace represents the configuration of the exporter of traces.
+type Trace struct {
+	Exporter    string  `yaml:"exporter" flag:"trace-exporter"`
+	Endpoint    string  `yaml:"endpoint" flag:"trace-endpoint"`
+	Insecure    bool    `yaml:"insecure" flag:"trace-insecure"`
+	SampleRatio float64 `yaml:"sample_ratio" flag:"trace-sample-ratio"`
+}
+
+// Default returns the default configuration.
+func Default() *Config {
+	return &Config{
+		Second: 180,
+		Schedule: Schedule{
+			Overlap: schedule.OverlapSkip,
+			Adaptive: Adaptive{
+				Min: time.Minute,
+				Max: 10 * time.Minute,
+			},
+		},
+		Redis: Redis{
+			Host:        "redis://127.0.0.1:6379",
+			HistorySize: 100,
+			KeyTemplate: report.DefaultKeyTemplate,
+			Pool: Pool{
+				MaxIdle:     3,
+				IdleTimeout: 5 * time.Minute,
+			},
+			MinBackoff: time.Second,
+			MaxBackoff: time.Minute,
+		},
+		Buffer: Buffer{
+			Size:    10000,
+			DirSize: 100000,
+		},
+		Health: Health{
+			MaxMissedPolls: 3,
+			MaxFailures:    3,
+		},
+		Leader: Leader{
+			TTL: 30 * time.Second,
+		},
+		MQTT: MQTT{
+			Topic: "gweather",
+			QoS:   1,
+		},
+		Sink: Sink{
+			BatchSize:  100,
+			OutboxSize: 10000,
+			NATS: NATS{
+				Subject: "gweather",
+			},
+			Kafka: Kafka{
+				Topic: "gweather",
+			},
+		},
+		Log: Log{
+			Format: "text",
+			Level:  "info",
+		},
+		Trace: Trace{
+			SampleRatio: 1,
+		},
+	}
+}
+
+// Load returns the configuration merged from the defaults, the configuration file of path, environment variables and flags.
+// flagCfg is the configuration bound to fs, and only the fields of the changed flags are applied.
+// path is ignored when it is empty.
+func Load(path string, fs *pflag.FlagSet, flagCfg *Config) (*Config, error) {
+	cfg := Default()
+
+	if path != "" {
+		b, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, errors.Wrapf(err, "faild to read config file: %s", path)
+		}
+
+		if err := yaml.UnmarshalStrict(b, cfg); err != nil {
+			return nil, errors.Wrapf(err, "faild to unmarshal config file: %s", path)
+		}
+	}
+
+	if err := applyEnv(cfg, os.LookupEnv); err != nil {
+		return nil, errors.Wrap(err, "faild to apply environment variables")
+	}
+
+	applyFlags(cfg, flagCfg, fs)
+
+	if err := cfg.Validate(); err != nil {
+		return nil, errors.Wrap(err, "invalid config")
+	}
+	return cfg, nil
+}
+
+// Validate returns an error if the configuration is invalid.
+func (c *Config) Validate() error {
+	if c.Second == 0 {
+		return errors.New("second must be greater than 0")
+	}
+
+	for _, feed := range c.Feeds {
+		if u, err := url.Parse(feed); err != nil || u.Scheme == "" {
+			return errors.Errorf("invalid feed url: %s", feed)
+		}
+	}
+
+	for feed, spec := range c.Schedule.Feeds {
+		if _, err := schedule.Parse(spec); err != nil {
+			return errors.Wrapf(err, "invalid schedule of %s", feed)
+		}
+		if len(c.Feeds) > 0 && !contains(c.Feeds, feed) {
+			return errors.Errorf("schedule of the feed which is not polled: %s", feed)
+		}
+	}
+
+	if c.Schedule.Jitter < 0 {
+		return errors.New("schedule.jitter must not be negative")
+	}
+
+	switch c.Schedule.Overlap {
+	case "", schedule.OverlapSkip, schedule.OverlapQueue:
+	default:
+		return errors.Errorf("unknown schedule.overlap: %s", c.Schedule.Overlap)
+	}
+
+	if a := c.Schedule.Adaptive; a.Enabled && (a.Min <= 0 || a.Max < a.Min) {
+		return errors.New("schedule.adaptive.min must be positive and not greater than schedule.adaptive.max")
+	}
+
+	u, err := url.Parse(c.Redis.Host)
+	if err != nil {
+		return errors.Errorf("invalid redis host: %s", c.Redis.Host)
+	}
+
+	switch u.Scheme {
+	case "redis", "rediss", "redis-sentinel", "redis-cluster":
+	default:
+		return errors.Errorf("invalid redis host: %s", c.Redis.Host)
+	}
+
+	if _, err := report.NewKeyTemplate(c.Redis.KeyTemplate); err != nil {
+		return errors.Wrap(err, "invalid redis.key_template")
+	}
+
+	if c.Redis.DB < 0 {
+		return errors.New("redis.db must not be negative")
+	}
+
+	if c.Redis.DB != 0 && u.Scheme == "redis-cluster" {
+		return errors.New("redis.db is not supported by redis-cluster")
+	}
+
+	if t := c.Redis.TLS; (t.CertFile == "") != (t.KeyFile == "") {
+		return errors.New("redis.tls.cert_file and redis.tls.key_file must be set together")
+	}
+
+	if p := c.Redis.Pool; p.MaxIdle < 0 || p.MaxActive < 0 || p.IdleTimeout < 0 {
+		return errors.New("redis.pool must not be negative")
+	}
+
+	if c.Redis.HistorySize < 0 {
+		return errors.New("redis.history_size must not be negative")
+	}
+
+	if c.Redis.TTL < 0 {
+		return errors.New("redis.ttl must not be negative")
+	}
+
+	if c.Redis.MinBackoff <= 0 || c.Redis.MaxBackoff < c.Redis.MinBackoff {
+		return errors.New("redis.min_backoff must be positive and not greater than redis.max_backoff")
+	}
+
+	if cb := c.WebSub.Callback; cb != "" {
+		if u, err := url.Parse(cb); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return errors.Errorf("invalid websub.callback: %s", cb)
+		}
+		if c.Server.Addr == "" {
+			return errors.New("server.addr is required to receive the callbacks of websub")
+		}
+	}
+
+	if len(c.WebSub.Secret) > 200 {
+		return errors.New("websub.secret must not be longer than 200 bytes")
+	}
+
+	if c.WebSub.Lease < 0 {
+		return errors.New("websub.lease must not be negative")
+	}
+
+	if c.Stream.Enabled && c.Server.Addr == "" {
+		return errors.New("server.addr is required to serve the stream")
+	}
+
+	for _, o := range c.Stream.Origins {
+		if o == "*" {
+			continue
+		}
+		if u, err := url.Parse(o); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" || u.Path != "" {
+			return errors.Errorf("invalid stream.origins: %s", o)
+		}
+	}
+
+	if c.GRPC.Addr != "" && c.GRPC.Addr == c.Server.Addr {
+		return errors.New("grpc.addr must differ from server.addr")
+	}
+
+	if c.MQTT.Broker != "" {
+		u, err := url.Parse(c.MQTT.Broker)
+		if err != nil {
+			return errors.Errorf("invalid mqtt.broker: %s", c.MQTT.Broker)
+		}
+
+		switch u.Scheme {
+		case "tcp", "mqtt", "ssl", "tls", "mqtts", "ws", "wss":
+		default:
+			return errors.Errorf("invalid mqtt.broker: %s", c.MQTT.Broker)
+		}
+
+		if c.MQTT.QoS < 0 || c.MQTT.QoS > 2 {
+			return errors.New("mqtt.qos must be 0, 1 or 2")
+		}
+
+		if c.MQTT.Topic == "" || strings.ContainsAny(c.MQTT.Topic, "+#") {
+			return errors.Errorf("invalid mqtt.topic: %s", c.MQTT.Topic)
+		}
+	}
+
+	if c.Sink.BatchSize <= 0 || c.Sink.OutboxSize <= 0 {
+		return errors.New("sink sizes must be positive")
+	}
+
+	if c.Sink.NATS.URL != "" {
+		for _, s := range strings.Split(c.Sink.NATS.URL, ",") {
+			u, err := url.Parse(strings.TrimSpace(s))
+			if err != nil || u.Host == "" {
+				return errors.Errorf("invalid sink.nats.url: %s", c.Sink.NATS.URL)
+			}
+
+			switch u.Scheme {
+			case "nats", "tls", "ws", "wss":
+			default:
+				return errors.Errorf("invalid sink.nats.url: %s", c.Sink.NATS.URL)
+			}
+		}
+
+		if c.Sink.NATS.Subject == "" || strings.ContainsAny(c.Sink.NATS.Subject, "*> \t") {
+			return errors.Errorf("invalid sink.nats.subject: %s", c.Sink.NATS.Subject)
+		}
+	}
+
+	if len(c.Sink.Kafka.Brokers) > 0 {
+		if c.Sink.Kafka.Topic == "" {
+			return errors.New("sink.kafka.topic is required")
+		}
+
+		switch c.Sink.Kafka.SASL.Mechanism {
+		case "", kafka.SASLPlain, kafka.SASLSCRAMSHA256, kafka.SASLSCRAMSHA512:
+		default:
+			return errors.Errorf("invalid sink.kafka.sasl.mechanism: %s", c.Sink.Kafka.SASL.Mechanism)
+		}
+	}
+
+	if c.Buffer.Size < 0 || c.Buffer.DirSize < 0 {
+		return errors.New("buffer sizes must not be negative")
+	}
+
+	switch c.Archive.Backend {
+	case "", "store":
+	case "dir":
+		if c.Archive.Dir == "" {
+			return errors.New("archive.dir is required when archive.backend is dir")
+		}
+	default:
+		return errors.Errorf("unknown archive backend: %s", c.Archive.Backend)
+	}
+
+	if c.Archive.Retention < 0 {
+		return errors.New("archive.retention must not be negative")
+	}
+
+	if c.Health.MaxMissedPolls < 0 || c.Health.MaxFailures < 0 {
+		return errors.New("health thresholds must not be negative")
+	}
+
+	interval := time.Duration(c.Second) * time.Second
+	if c.Schedule.Adaptive.Enabled {
+		interval = c.Schedule.Adaptive.Min
+	}
+	if c.Leader.Enabled && (c.Leader.TTL <= 0 || c.Leader.TTL >= interval) {
+		return errors.New("leader.ttl must be positive and less than the interval, so that a follower takes over within an interval")
+	}
+
+	switch c.Trace.Exporter {
+	case "", "otlpgrpc", "otlphttp":
+	default:
+		return errors.Errorf("unknown trace exporter: %s", c.Trace.Exporter)
+	}
+
+	if c.Trace.SampleRatio < 0 || c.Trace.SampleRatio > 1 {
+		return errors.New("trace.sample_ratio must be between 0 and 1")
+	}
+
+	switch c.Log.Format {
+	case "", log.FormatText, log.FormatJSON:
+	default:
+		return errors.Errorf("unknown log format: %s", c.Log.Format)
+	}
+
+	if _, err := log.ParseLevel(c.Log.Level); err != nil {
+		return errors.Wrap(err, "invalid log.level")
+	}
+	for sub, level := range c.Log.Levels {
+		if _, err := log.ParseLevel(level); err != nil {
+			return errors.Wrapf(err, "invalid log.levels of %s", sub)
+		}
+	}
+	return nil
+}
+
+// HasSinks returns true if the events are delivered to MQTT or the sinks.
+func (c *Config) HasSinks() bool {
+	return c.MQTT.Broker != "" || c.Sink.NATS.URL != "" || len(c.Sink.Kafka.Brokers) > 0
+}
+
+// HasOutbox returns true if the events are written to the outbox, which the live stream and the gRPC API replay and the sinks read.
+func (c *Config) HasOutbox() bool {
+	return c.Stream.Enabled || c.GRPC.Addr != "" || c.HasSinks()
+}
+
+// KeepStatic restores the fields which are not reloaded on SIGHUP from prev, since they are bound on start,
+// and returns the names of them which are changed in c.
+func (c *Config) KeepStatic(prev *Config) []string {
+	var kept []string
+
+	if c.Server.Addr != prev.Server.Addr {
+		kept = append(kept, "server.addr")
+		c.Server.Addr = prev.Server.Addr
+	}
+	if c.Buffer.Dir != prev.Buffer.Dir {
+		kept = append(kept, "buffer.dir")
+		c.Buffer.Dir = prev.Buffer.Dir
+	}
+	if c.Trace != prev.Trace {
+		kept = append(kept, "trace")
+		c.Trace = prev.Trace
+	}
+	if c.Leader != prev.Leader {
+		kept = append(kept, "leader")
+		c.Leader = prev.Leader
+	}
+	if c.WebSub != prev.WebSub {
+		kept = append(kept, "websub")
+		c.WebSub = prev.WebSub
+	}
+	if !reflect.DeepEqual(c.Stream, prev.Stream) {
+		kept = append(kept, "stream")
+		c.Stream = prev.Stream
+	}
+	if c.GRPC != prev.GRPC {
+		kept = append(kept, "grpc")
+		c.GRPC = prev.GRPC
+	}
+	if c.MQTT != prev.MQTT {
+		kept = append(kept, "mqtt")
+		c.MQTT = prev.MQTT
+	}
+	if !reflect.DeepEqual(c.Sink, prev.Sink) {
+		kept = append(kept, "sink")
+		c.Sink = prev.Sink
+	}
+	return kept
+}
+
+func contains(ss []string, s string) bool {
+	for _, v := range ss {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
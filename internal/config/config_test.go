@@ -0,0 +1,198 @@
+package config
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/spf13/pflag"
+)
+
+const testConfig = `second: 100
+redis:
+  host: redis://file:6379
+  history_size: 10
+log:
+  level: debug
+`
+
+func setenv(t *testing.T, key, value string) {
+	if err := os.Setenv(key, value); err != nil {
+		t.Fatalf("faild to set %s: %v", key, err)
+	}
+	t.Cleanup(func() {
+		os.Unsetenv(key)
+	})
+}
+
+func TestLoadPrecedence(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gweather-config")
+	if err != nil {
+		t.Fatalf("faild to create directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "gweather.yaml")
+	if err := ioutil.WriteFile(path, []byte(testConfig), 0644); err != nil {
+		t.Fatalf("faild to write file: %v", err)
+	}
+
+	setenv(t, EnvPrefix+"_SECOND", "200")
+	setenv(t, EnvPrefix+"_REDIS_HOST", "redis://env:6379")
+
+	flagCfg := Default()
+	fs := pflag.NewFlagSet("test", pflag.ContinueOnError)
+	fs.UintVar(&flagCfg.Second, "second", flagCfg.Second, "")
+	fs.StringVar(&flagCfg.Redis.Host, "host", flagCfg.Redis.Host, "")
+	fs.IntVar(&flagCfg.Redis.HistorySize, "history-size", flagCfg.Redis.HistorySize, "")
+	if err := fs.Parse([]string{"--second", "300"}); err != nil {
+		t.Fatalf("faild to parse flags: %v", err)
+	}
+
+	cfg, err := Load(path, fs, flagCfg)
+	if err != nil {
+		t.Fatalf("Load returns error: %v", err)
+	}
+
+	// The flags take precedence over the environment variables, and the environment variables over the file.
+	// The defaults of the flags which are not given do not override the others.
+	if cfg.Second != 300 {
+		t.Errorf("second is %d, want 300 of the flag", cfg.Second)
+	}
+	if cfg.Redis.Host != "redis://env:6379" {
+		t.Errorf("redis.host is %s, want the environment variable", cfg.Redis.Host)
+	}
+	if cfg.Redis.HistorySize != 10 {
+		t.Errorf("redis.history_size is %d, want 10 of the file", cfg.Redis.HistorySize)
+	}
+	if cfg.Log.Level != "debug" {
+		t.Errorf("log.level is %s, want debug of the file", cfg.Log.Level)
+	}
+	if cfg.Buffer.Size != Default().Buffer.Size {
+		t.Errorf("buffer.size is %d, want the default", cfg.Buffer.Size)
+	}
+}
+
+func TestLoadInvalid(t *testing.T) {
+	setenv(t, EnvPrefix+"_SECOND", "0")
+
+	if _, err := Load("", nil, nil); err == nil {
+		t.Error("Load returns no error of the invalid config")
+	}
+}
+
+func TestApplyEnv(t *testing.T) {
+	const regular = "http://www.data.jma.go.jp/developer/xml/feed/regular.xml"
+	const extra = "http://www.data.jma.go.jp/developer/xml/feed/extra.xml"
+
+	tests := []struct {
+		name    string
+		env     map[string]string
+		want    func(*Config) interface{}
+		value   interface{}
+		wantErr bool
+	}{
+		{
+			name:  "list",
+			env:   map[string]string{"GWEATHER_FEEDS": extra + ", " + regular},
+			want:  func(c *Config) interface{} { return c.Feeds },
+			value: []string{extra, regular},
+		},
+		{
+			name:  "list of JSON",
+			env:   map[string]string{"GWEATHER_FEEDS": `["` + extra + `","` + regular + `"]`},
+			want:  func(c *Config) interface{} { return c.Feeds },
+			value: []string{extra, regular},
+		},
+		{
+			name:  "map",
+			env:   map[string]string{"GWEATHER_LOG_LEVELS": "fetcher=debug,store=warn"},
+			want:  func(c *Config) interface{} { return c.Log.Levels },
+			value: map[string]string{"fetcher": "debug", "store": "warn"},
+		},
+		{
+			name:  "map with quoted cron expressions",
+			env:   map[string]string{"GWEATHER_SCHEDULE_FEEDS": `"` + regular + `=0,30 * * * *", ` + extra + `=@every 1m`},
+			want:  func(c *Config) interface{} { return c.Schedule.Feeds },
+			value: map[string]string{regular: "0,30 * * * *", extra: "@every 1m"},
+		},
+		{
+			name:  "map of JSON",
+			env:   map[string]string{"GWEATHER_SCHEDULE_FEEDS": `{"` + regular + `": "0,30 * * * *"}`},
+			want:  func(c *Config) interface{} { return c.Schedule.Feeds },
+			value: map[string]string{regular: "0,30 * * * *"},
+		},
+		{
+			name:  "duration",
+			env:   map[string]string{"GWEATHER_SCHEDULE_JITTER": "10s"},
+			want:  func(c *Config) interface{} { return c.Schedule.Jitter },
+			value: 10 * time.Second,
+		},
+		{
+			name:    "unquoted cron expression",
+			env:     map[string]string{"GWEATHER_SCHEDULE_FEEDS": regular + "=0,30 * * * *"},
+			wantErr: true,
+		},
+		{
+			name:    "invalid number",
+			env:     map[string]string{"GWEATHER_SECOND": "a"},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		cfg := Default()
+		err := applyEnv(cfg, func(key string) (string, bool) {
+			v, ok := tt.env[key]
+			return v, ok
+		})
+
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: applyEnv returns error %v, want error %v", tt.name, err, tt.wantErr)
+			continue
+		}
+		if tt.wantErr {
+			continue
+		}
+		if got := tt.want(cfg); !reflect.DeepEqual(got, tt.value) {
+			t.Errorf("%s: value is %v, want %v", tt.name, got, tt.value)
+		}
+	}
+}
+
+func TestKeepStatic(t *testing.T) {
+	prev := Default()
+
+	c := Default()
+	c.Second = 300
+	c.Redis.Host = "redis://127.0.0.1:6380"
+	c.Schedule.Jitter = time.Second
+	c.Log.Level = "debug"
+	c.Server.Addr = ":8080"
+	c.Buffer.Dir = "/var/lib/gweather"
+	c.Leader.Enabled = true
+	c.Stream.Origins = []string{"*"}
+	c.Sink.Kafka.Brokers = []string{"127.0.0.1:9092"}
+
+	kept := c.KeepStatic(prev)
+
+	// The fields bound on start are restored, and the others are reloaded.
+	want := []string{"server.addr", "buffer.dir", "leader", "stream", "sink"}
+	if !reflect.DeepEqual(kept, want) {
+		t.Errorf("kept fields are %v, want %v", kept, want)
+	}
+	if c.Server.Addr != prev.Server.Addr || c.Buffer.Dir != prev.Buffer.Dir || c.Leader != prev.Leader ||
+		!reflect.DeepEqual(c.Stream, prev.Stream) || !reflect.DeepEqual(c.Sink, prev.Sink) {
+		t.Error("fields which are not reloaded are changed")
+	}
+	if c.Second != 300 || c.Redis.Host != "redis://127.0.0.1:6380" || c.Schedule.Jitter != time.Second || c.Log.Level != "debug" {
+		t.Error("reloaded fields are restored")
+	}
+
+	if kept := c.KeepStatic(prev); len(kept) != 0 {
+		t.Errorf("kept fields are %v without changes", kept)
+	}
+}
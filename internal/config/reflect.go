@@ -0,0 +1,191 @@
+package config
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/pflag"
+)
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// applyEnv sets the fields from the environment variables.
+// The name of the variable is EnvPrefix and the yaml tags joined with underscore in upper case.
+// A slice is given as comma separated values, and a map as comma separated key=value pairs,
+// where a value containing commas is quoted as CSV. Both are also given as JSON, e.g. {"key": "value"}.
+func applyEnv(cfg *Config, lookup func(string) (string, bool)) error {
+	v := reflect.ValueOf(cfg).Elem()
+
+	return walk(v.Type(), EnvPrefix, nil, func(name string, field reflect.StructField, index []int) error {
+		s, ok := lookup(name)
+		if !ok {
+			return nil
+		}
+		return errors.Wrapf(set(v.FieldByIndex(index), s), "invalid value of %s", name)
+	})
+}
+
+// applyFlags copies the fields bound to the changed flags from flagCfg to cfg.
+func applyFlags(cfg, flagCfg *Config, fs *pflag.FlagSet) {
+	if fs == nil || flagCfg == nil {
+		return
+	}
+
+	dst, src := reflect.ValueOf(cfg).Elem(), reflect.ValueOf(flagCfg).Elem()
+
+	walk(dst.Type(), "", nil, func(name string, field reflect.StructField, index []int) error {
+		if flag := field.Tag.Get("flag"); flag != "" && fs.Changed(flag) {
+			dst.FieldByIndex(index).Set(src.FieldByIndex(index))
+		}
+		return nil
+	})
+}
+
+// walk calls fn with the name and the index sequence of every leaf field of t.
+func walk(t reflect.Type, prefix string, parent []int, fn func(name string, field reflect.StructField, index []int) error) error {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+
+		tag := strings.Split(field.Tag.Get("yaml"), ",")[0]
+		if tag == "" || tag == "-" {
+			continue
+		}
+
+		name := strings.ToUpper(tag)
+		if prefix != "" {
+			name = prefix + "_" + name
+		}
+
+		index := append(append([]int{}, parent...), i)
+
+		if field.Type.Kind() == reflect.Struct && field.Type != durationType {
+			if err := walk(field.Type, name, index, fn); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if err := fn(name, field, index); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func set(v reflect.Value, s string) error {
+	if v.Type() == durationType {
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return err
+		}
+		v.SetInt(int64(d))
+		return nil
+	}
+
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(s)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return err
+		}
+		v.SetBool(b)
+	case reflect.Int, reflect.Int64:
+		n, err := strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			return err
+		}
+		v.SetInt(n)
+	case reflect.Uint, reflect.Uint64:
+		n, err := strconv.ParseUint(s, 10, 64)
+		if err != nil {
+			return err
+		}
+		v.SetUint(n)
+	case reflect.Float64:
+		n, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return err
+		}
+		v.SetFloat(n)
+	case reflect.Slice:
+		if v.Type().Elem().Kind() != reflect.String {
+			return errors.Errorf("unsupported type: %s", v.Type())
+		}
+
+		if strings.HasPrefix(strings.TrimSpace(s), "[") {
+			var vs []string
+			if err := json.Unmarshal([]byte(s), &vs); err != nil {
+				return err
+			}
+			v.Set(reflect.ValueOf(vs))
+			return nil
+		}
+
+		es, err := splitValues(s)
+		if err != nil {
+			return err
+		}
+
+		var vs []string
+		for _, e := range es {
+			if e = strings.TrimSpace(e); e != "" {
+				vs = append(vs, e)
+			}
+		}
+		v.Set(reflect.ValueOf(vs))
+	case reflect.Map:
+		if v.Type().Key().Kind() != reflect.String || v.Type().Elem().Kind() != reflect.String {
+			return errors.Errorf("unsupported type: %s", v.Type())
+		}
+
+		if strings.HasPrefix(strings.TrimSpace(s), "{") {
+			m := make(map[string]string)
+			if err := json.Unmarshal([]byte(s), &m); err != nil {
+				return err
+			}
+			v.Set(reflect.ValueOf(m))
+			return nil
+		}
+
+		es, err := splitValues(s)
+		if err != nil {
+			return err
+		}
+
+		m := make(map[string]string)
+		for _, e := range es {
+			if e = strings.TrimSpace(e); e == "" {
+				continue
+			}
+
+			kv := strings.SplitN(e, "=", 2)
+			if len(kv) != 2 {
+				return errors.Errorf("invalid key=value pair: %s", e)
+			}
+			m[strings.TrimSpace(kv[0])] = strings.TrimSpace(kv[1])
+		}
+		v.Set(reflect.ValueOf(m))
+	default:
+		return errors.Errorf("unsupported type: %s", v.Type())
+	}
+	return nil
+}
+
+// splitValues splits s as a line of CSV in the same way as the slice and map flags,
+// so that a value containing commas (e.g. a cron expression) is given in double quotes.
+func splitValues(s string) ([]string, error) {
+	if strings.TrimSpace(s) == "" {
+		return nil, nil
+	}
+
+	r := csv.NewReader(strings.NewReader(s))
+	r.TrimLeadingSpace = true
+	return r.Read()
+}
@@ -0,0 +1,45 @@
+package feed
+
+import "encoding/xml"
+
+// Feed represents an Atom feed published by JMA.
+// see: http://xml.kishou.go.jp/xmlpull.html
+type Feed struct {
+	XMLName  xml.Name `xml:"http://www.w3.org/2005/Atom feed"`
+	Lang     string   `xml:"http://www.w3.org/XML/1998/namespace lang,attr,omitempty"`
+	Title    string   `xml:"title"`
+	Subtitle string   `xml:"subtitle,omitempty"`
+	Updated  string   `xml:"updated"`
+	ID       string   `xml:"id"`
+	Links    []Link   `xml:"link"`
+	Rights   *Text    `xml:"rights,omitempty"`
+	Entries  []Entry  `xml:"entry"`
+}
+
+// Entry represents an entry of the Atom feed.
+type Entry struct {
+	Title   string `xml:"title"`
+	ID      string `xml:"id"`
+	Updated string `xml:"updated"`
+	Author  Author `xml:"author"`
+	Links   []Link `xml:"link"`
+	Content *Text  `xml:"content,omitempty"`
+}
+
+// Author represents an author of the entry.
+type Author struct {
+	Name string `xml:"name"`
+}
+
+// Link represents a link of the feed or the entry.
+type Link struct {
+	Rel  string `xml:"rel,attr,omitempty"`
+	Type string `xml:"type,attr,omitempty"`
+	Href string `xml:"href,attr"`
+}
+
+// Text represents a text construct such as content and rights.
+type Text struct {
+	Type string `xml:"type,attr,omitempty"`
+	Body string `xml:",chardata"`
+}
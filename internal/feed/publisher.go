@@ -0,0 +1,193 @@
+package feed
+
+import (
+	"context"
+	"encoding/xml"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+
+	"github.com/hlts2/gweather/internal/fetcher"
+	"github.com/hlts2/gweather/internal/report"
+)
+
+const (
+	// DataPath is the path prefix of the cached report documents. It is the same as JMA's path.
+	DataPath = "/developer/xml/data/"
+)
+
+type document struct {
+	data  []byte
+	areas []string
+	kinds []string
+}
+
+// Publisher republishes the feeds filtered by the filter and the report documents linked from them.
+// Each feed is published at the same path as the original URL (e.g. /developer/xml/feed/extra.xml).
+// It records documents downloaded by the fetcher, so it implements fetcher.Recorder.
+type Publisher struct {
+	mu     sync.RWMutex
+	filter *report.Filter
+	feeds  map[string]*Feed
+	docs   map[string]*document
+}
+
+// NewPublisher returns Publisher which publishes entries matching f.
+func NewPublisher(f *report.Filter) *Publisher {
+	return &Publisher{
+		filter: f,
+		feeds:  make(map[string]*Feed),
+		docs:   make(map[string]*document),
+	}
+}
+
+// SetFilter replaces the filter of the entries.
+func (p *Publisher) SetFilter(f *report.Filter) {
+	p.mu.Lock()
+	p.filter = f
+	p.mu.Unlock()
+}
+
+// Record records the latest feeds and the report documents referenced by them.
+func (p *Publisher) Record(ctx context.Context, doc *fetcher.Document) error {
+	switch doc.Kind {
+	case fetcher.KindFeed:
+		u, err := url.Parse(doc.URL)
+		if err != nil {
+			return errors.Wrapf(err, "faild to parse url: %s", doc.URL)
+		}
+
+		f := new(Feed)
+		if err := xml.Unmarshal(doc.Data, f); err != nil {
+			return errors.Wrap(err, "faild to unmarshal feed")
+		}
+
+		p.mu.Lock()
+		p.feeds[u.Path] = f
+
+		ids := make(map[string]bool)
+		for _, f := range p.feeds {
+			for _, e := range f.Entries {
+				ids[report.UUID(e.ID)] = true
+			}
+		}
+
+		for id := range p.docs {
+			if !ids[id] {
+				delete(p.docs, id)
+			}
+		}
+		p.mu.Unlock()
+
+	case fetcher.KindReport:
+		areas, kinds, err := report.Codes(doc.Data)
+		if err != nil {
+			return errors.Wrap(err, "faild to get codes")
+		}
+
+		p.mu.Lock()
+		p.docs[report.UUID(doc.ID)] = &document{
+			data:  doc.Data,
+			areas: areas,
+			kinds: kinds,
+		}
+		p.mu.Unlock()
+	}
+	return nil
+}
+
+// Feed returns the filtered feed of the path whose links point to baseURL.
+// It returns nil if the feed has not been recorded yet.
+func (p *Publisher) Feed(path, baseURL string) *Feed {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	orig, ok := p.feeds[path]
+	if !ok {
+		return nil
+	}
+
+	f := *orig
+	f.Links = nil
+	for _, l := range orig.Links {
+		switch l.Rel {
+		case "self":
+			l.Href = baseURL + path
+		case "hub":
+			// gweather does not notify the hub, so the link is dropped.
+			continue
+		}
+		f.Links = append(f.Links, l)
+	}
+
+	f.Entries = nil
+	for _, e := range orig.Entries {
+		id := report.UUID(e.ID)
+
+		doc, ok := p.docs[id]
+		if !ok || !p.filter.Match(e.Title, e.Author.Name, doc.areas, doc.kinds) {
+			continue
+		}
+
+		links := make([]Link, 0, len(e.Links))
+		for _, l := range e.Links {
+			l.Href = baseURL + DataPath + id + ".xml"
+			links = append(links, l)
+		}
+		e.Links = links
+
+		f.Entries = append(f.Entries, e)
+	}
+
+	return &f
+}
+
+// ServeHTTP serves the filtered feeds and the cached report documents.
+func (p *Publisher) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if strings.HasPrefix(r.URL.Path, DataPath) {
+		id := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, DataPath), ".xml")
+
+		p.mu.RLock()
+		doc, ok := p.docs[id]
+		p.mu.RUnlock()
+
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/xml; charset=utf-8")
+		w.Write(doc.data)
+		return
+	}
+
+	f := p.Feed(r.URL.Path, baseURL(r))
+	if f == nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	b, err := xml.Marshal(f)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/atom+xml; charset=utf-8")
+	w.Write([]byte(xml.Header))
+	w.Write(b)
+}
+
+func baseURL(r *http.Request) string {
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	if proto := r.Header.Get("X-Forwarded-Proto"); proto != "" {
+		scheme = proto
+	}
+	return scheme + "://" + r.Host
+}
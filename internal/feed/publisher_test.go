@@ -0,0 +1,222 @@
+package feed
+
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/hlts2/gweather/internal/fetcher"
+	"github.com/hlts2/gweather/internal/report"
+)
+
+const (
+	testFeedURL = "http://www.data.jma.go.jp/developer/xml/feed/extra.xml"
+	testBaseURL = "http://gweather.example.com"
+
+	morioka = "urn:uuid:c1af90d4-23a8-3628-a489-2d40421838d7"
+	tottori = "urn:uuid:4eb2228e-262f-302f-892c-d7726f196984"
+)
+
+const testFeed = `<?xml version="1.0" encoding="utf-8"?>
+<feed xmlns="http://www.w3.org/2005/Atom" xml:lang="ja">
+<title>高頻度（随時）</title>
+<updated>2019-03-25T17:28:01+09:00</updated>
+<id>urn:uuid:f3a8b3e6-12db-390b-b0a6-77e6b5c41cdc</id>
+<link rel="related" href="http://www.jma.go.jp/" />
+<link rel="self" href="http://www.data.jma.go.jp/developer/xml/feed/extra.xml" />
+<link rel="hub" href="http://alert-hub.appspot.com/" />
+%s
+</feed>`
+
+const testEntry = `<entry>
+<title>気象特別警報・警報・注意報</title>
+<id>%s</id>
+<updated>2019-03-25T09:00:00Z</updated>
+<author><name>%s</name></author>
+<link type="application/xml" href="http://www.data.jma.go.jp/developer/xml/data/%s.xml" />
+</entry>`
+
+const testReport = `<?xml version="1.0" encoding="UTF-8"?>
+<Report xmlns="http://xml.kishou.go.jp/jmaxml1/">
+<Body>
+<Warning>
+<Item>
+<Kind><Name>雷注意報</Name><Code>14</Code></Kind>
+<Area><Name>%s</Name><Code>%s</Code></Area>
+</Item>
+</Warning>
+</Body>
+</Report>`
+
+func feedDocument(entries ...string) *fetcher.Document {
+	var s string
+	for _, e := range entries {
+		s += e
+	}
+	return &fetcher.Document{
+		Kind: fetcher.KindFeed,
+		URL:  testFeedURL,
+		Data: []byte(fmt.Sprintf(testFeed, s)),
+	}
+}
+
+func entry(id, office string) string {
+	return fmt.Sprintf(testEntry, id, office, report.UUID(id))
+}
+
+func reportDocument(id, areaName, area string) *fetcher.Document {
+	return &fetcher.Document{
+		Kind: fetcher.KindReport,
+		ID:   id,
+		URL:  "http://www.data.jma.go.jp/developer/xml/data/" + report.UUID(id) + ".xml",
+		Data: []byte(fmt.Sprintf(testReport, areaName, area)),
+	}
+}
+
+func record(t *testing.T, p *Publisher, docs ...*fetcher.Document) {
+	for _, doc := range docs {
+		if err := p.Record(context.Background(), doc); err != nil {
+			t.Fatalf("Record returns error: %v", err)
+		}
+	}
+}
+
+func TestPublisherFeed(t *testing.T) {
+	p := NewPublisher(&report.Filter{Areas: []string{"030010"}})
+
+	if f := p.Feed("/developer/xml/feed/extra.xml", testBaseURL); f != nil {
+		t.Fatal("feed is published before it is recorded")
+	}
+
+	record(t, p,
+		feedDocument(entry(morioka, "盛岡地方気象台"), entry(tottori, "鳥取地方気象台")),
+		reportDocument(morioka, "内陸", "030010"),
+		reportDocument(tottori, "東部", "310010"),
+	)
+
+	f := p.Feed("/developer/xml/feed/extra.xml", testBaseURL)
+	if f == nil {
+		t.Fatal("feed is not published")
+	}
+
+	// The self link points to gweather, and the hub is dropped.
+	wantLinks := []Link{
+		{Rel: "related", Href: "http://www.jma.go.jp/"},
+		{Rel: "self", Href: testBaseURL + "/developer/xml/feed/extra.xml"},
+	}
+	if fmt.Sprint(f.Links) != fmt.Sprint(wantLinks) {
+		t.Errorf("links are %v, want %v", f.Links, wantLinks)
+	}
+
+	// Only the entry in the area of the filter is published, and it links to the cached document.
+	if len(f.Entries) != 1 || f.Entries[0].ID != morioka {
+		t.Fatalf("entries are %v, want %s", f.Entries, morioka)
+	}
+	want := testBaseURL + DataPath + report.UUID(morioka) + ".xml"
+	if links := f.Entries[0].Links; len(links) != 1 || links[0].Href != want {
+		t.Errorf("links of entry are %v, want %s", links, want)
+	}
+
+	// The filter is replaced on reload.
+	p.SetFilter(&report.Filter{Offices: []string{"鳥取地方気象台"}})
+	if f := p.Feed("/developer/xml/feed/extra.xml", testBaseURL); len(f.Entries) != 1 || f.Entries[0].ID != tottori {
+		t.Errorf("entries are %v after reload, want %s", f.Entries, tottori)
+	}
+}
+
+func TestPublisherFeedWithoutDocument(t *testing.T) {
+	p := NewPublisher(new(report.Filter))
+
+	// The entry whose document has not been recorded is not published, since its link would be broken.
+	record(t, p,
+		feedDocument(entry(morioka, "盛岡地方気象台"), entry(tottori, "鳥取地方気象台")),
+		reportDocument(morioka, "内陸", "030010"),
+	)
+
+	f := p.Feed("/developer/xml/feed/extra.xml", testBaseURL)
+	if len(f.Entries) != 1 || f.Entries[0].ID != morioka {
+		t.Errorf("entries are %v, want %s", f.Entries, morioka)
+	}
+}
+
+func TestPublisherServeHTTP(t *testing.T) {
+	p := NewPublisher(new(report.Filter))
+
+	record(t, p,
+		feedDocument(entry(morioka, "盛岡地方気象台"), entry(tottori, "鳥取地方気象台")),
+		reportDocument(morioka, "内陸", "030010"),
+		reportDocument(tottori, "東部", "310010"),
+	)
+
+	tests := []struct {
+		name        string
+		path        string
+		status      int
+		contentType string
+	}{
+		{name: "feed", path: "/developer/xml/feed/extra.xml", status: http.StatusOK, contentType: "application/atom+xml; charset=utf-8"},
+		{name: "document", path: DataPath + report.UUID(morioka) + ".xml", status: http.StatusOK, contentType: "application/xml; charset=utf-8"},
+		{name: "unknown feed", path: "/developer/xml/feed/regular.xml", status: http.StatusNotFound},
+		{name: "unknown document", path: DataPath + "00000000-0000-0000-0000-000000000000.xml", status: http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodGet, tt.path, nil)
+		r.Host = "gweather.example.com"
+		r.Header.Set("X-Forwarded-Proto", "https")
+		p.ServeHTTP(w, r)
+
+		if w.Code != tt.status {
+			t.Errorf("%s: status code is %d, want %d", tt.name, w.Code, tt.status)
+			continue
+		}
+		if tt.status != http.StatusOK {
+			continue
+		}
+		if got := w.Header().Get("Content-Type"); got != tt.contentType {
+			t.Errorf("%s: content type is %s, want %s", tt.name, got, tt.contentType)
+		}
+	}
+
+	// The published feed is parsed as the feed of JMA, with the links to gweather.
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodGet, "/developer/xml/feed/extra.xml", nil)
+	r.Host = "gweather.example.com"
+	r.Header.Set("X-Forwarded-Proto", "https")
+	p.ServeHTTP(w, r)
+
+	f := new(Feed)
+	if err := xml.Unmarshal(w.Body.Bytes(), f); err != nil {
+		t.Fatalf("faild to unmarshal published feed: %v", err)
+	}
+	want := "https://gweather.example.com" + DataPath + report.UUID(tottori) + ".xml"
+	if len(f.Entries) != 2 || f.Entries[1].Links[0].Href != want {
+		t.Errorf("entries are %v, want the second linking to %s", f.Entries, want)
+	}
+}
+
+func TestPublisherPrunesDocuments(t *testing.T) {
+	p := NewPublisher(new(report.Filter))
+
+	record(t, p,
+		feedDocument(entry(morioka, "盛岡地方気象台"), entry(tottori, "鳥取地方気象台")),
+		reportDocument(morioka, "内陸", "030010"),
+		reportDocument(tottori, "東部", "310010"),
+	)
+
+	// The document of the entry which is no longer in the feed is removed.
+	record(t, p, feedDocument(entry(tottori, "鳥取地方気象台")))
+
+	p.mu.RLock()
+	_, ok := p.docs[report.UUID(morioka)]
+	n := len(p.docs)
+	p.mu.RUnlock()
+
+	if ok || n != 1 {
+		t.Errorf("documents are not pruned: %d documents", n)
+	}
+}
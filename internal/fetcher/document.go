@@ -0,0 +1,31 @@
+package fetcher
+
+import (
+	"context"
+	"time"
+)
+
+// Kind represents a kind of document.
+type Kind string
+
+const (
+	// KindFeed is a kind of Atom feed document.
+	KindFeed Kind = "feed"
+
+	// KindReport is a kind of report document linked from feed entry.
+	KindReport Kind = "report"
+)
+
+// Document represents a raw XML document downloaded by the fetcher.
+type Document struct {
+	Kind    Kind
+	ID      string
+	URL     string
+	Data    []byte
+	Fetched time.Time
+}
+
+// Recorder represents an interface to record raw documents downloaded by the fetcher.
+type Recorder interface {
+	Record(ctx context.Context, doc *Document) error
+}
@@ -1,15 +1,25 @@
 package fetcher
 
 import (
+	"bytes"
 	"context"
+	"io/ioutil"
 	"net/http"
+	"strconv"
 	"sync"
+	"time"
 
+	"go.opentelemetry.io/otel/attribute"
 	"go.uber.org/multierr"
 
 	xj "github.com/basgys/goxml2json"
 	"github.com/hlts2/gson"
 	"github.com/pkg/errors"
+
+	"github.com/hlts2/gweather/internal/log"
+	"github.com/hlts2/gweather/internal/metrics"
+	"github.com/hlts2/gweather/internal/report"
+	"github.com/hlts2/gweather/internal/trace"
 )
 
 const (
@@ -21,24 +31,108 @@ const (
 // WeatherInfomationFetcher represents an interface to fetch weather implementation.
 type WeatherInfomationFetcher interface {
 	Fetch(ctx context.Context, url string) (map[string]map[string]interface{}, error)
+
+	// Push returns the reports of the entries in the feed document data of url delivered by a WebSub hub.
+	// A delivery may contain only new entries, so the cached reports of the other entries are kept with WithReportCache.
+	Push(ctx context.Context, url string, data []byte) (map[string]map[string]interface{}, error)
 }
 
 type wetherInfomationFetcherImpl struct {
-	mu sync.Mutex
+	mu        sync.Mutex
+	client    *http.Client
+	recorders []Recorder
+	keys      *report.KeyTemplate
+
+	// reports caches reports of each feed by entry id if cache is true.
+	// A report is never updated once it is published, so the cached one is used instead of downloading it again.
+	cache   bool
+	reports map[string]map[string]map[string]interface{}
+}
+
+// Option configures the fetcher.
+type Option func(*wetherInfomationFetcherImpl)
+
+// WithRecorder returns an option that passes every downloaded document to r.
+// With WithReportCache, the cached reports are not downloaded, so they are passed only when they are downloaded first.
+func WithRecorder(r Recorder) Option {
+	return func(w *wetherInfomationFetcherImpl) {
+		w.recorders = append(w.recorders, r)
+	}
+}
+
+// WithClient returns an option that downloads documents with c instead of http.DefaultClient.
+func WithClient(c *http.Client) Option {
+	return func(w *wetherInfomationFetcherImpl) {
+		w.client = c
+	}
+}
+
+// WithReportCache returns an option that caches the reports of each feed in memory by entry id,
+// so that a poll downloads only the reports of the new entries.
+func WithReportCache() Option {
+	return func(w *wetherInfomationFetcherImpl) {
+		w.cache = true
+	}
+}
+
+// WithKeyTemplate returns an option that generates the keys of reports by t instead of report.DefaultKeyTemplate.
+func WithKeyTemplate(t *report.KeyTemplate) Option {
+	return func(w *wetherInfomationFetcherImpl) {
+		w.keys = t
+	}
 }
 
 // New returns WetherInfomationFetcher implementation(*wetherInfomationFetcherImpl).
-func New() WeatherInfomationFetcher {
-	return new(wetherInfomationFetcherImpl)
+func New(opts ...Option) WeatherInfomationFetcher {
+	w := &wetherInfomationFetcherImpl{
+		client:  http.DefaultClient,
+		reports: make(map[string]map[string]map[string]interface{}),
+	}
+	for _, opt := range opts {
+		opt(w)
+	}
+
+	if w.keys == nil {
+		w.keys, _ = report.NewKeyTemplate(report.DefaultKeyTemplate)
+	}
+	return w
 }
 
-func createGsonFromURL(url string) (*gson.Gson, error) {
-	resp, err := http.Get(url)
+// download returns the body and the status code of the response. The status code is zero when no response is received.
+func (w *wetherInfomationFetcherImpl) download(ctx context.Context, url string) (data []byte, code int, err error) {
+	ctx, span := trace.Start(ctx, "fetcher.download", attribute.String("url.full", url))
+	defer func() {
+		if code != 0 {
+			span.SetAttributes(attribute.Int("http.response.status_code", code))
+		}
+		span.SetAttributes(attribute.Int("http.response.body.size", len(data)))
+		trace.End(span, err)
+	}()
+
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return nil, 0, errors.Wrapf(err, "faild to create request, URL: %s", url)
+	}
+
+	resp, err := w.client.Do(req.WithContext(ctx))
 	if err != nil {
-		return nil, errors.Wrapf(err, "faild to get response, URL: %s", url)
+		return nil, 0, errors.Wrapf(err, "faild to get response, URL: %s", url)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, resp.StatusCode, errors.Errorf("unexpected status code: %d, URL: %s", resp.StatusCode, url)
 	}
 
-	buf, err := xj.Convert(resp.Body)
+	data, err = ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, resp.StatusCode, errors.Wrapf(err, "faild to read response body, URL: %s", url)
+	}
+	return data, resp.StatusCode, nil
+}
+
+func createGsonFromBytes(data []byte) (*gson.Gson, error) {
+	buf, err := xj.Convert(bytes.NewReader(data))
 	if err != nil {
 		return nil, errors.Wrap(err, "faild to convert")
 	}
@@ -51,23 +145,103 @@ func createGsonFromURL(url string) (*gson.Gson, error) {
 	return g, nil
 }
 
+func (w *wetherInfomationFetcherImpl) record(ctx context.Context, doc *Document) (rerr error) {
+	for _, r := range w.recorders {
+		if err := r.Record(ctx, doc); err != nil {
+			err = errors.Wrapf(err, "faild to record document: %s", doc.URL)
+			log.FromContext(ctx, log.SubsystemNotifier).With("kind", doc.Kind).Error(err)
+			rerr = multierr.Append(rerr, err)
+		}
+	}
+	return
+}
+
 func (w *wetherInfomationFetcherImpl) Fetch(ctx context.Context, url string) (map[string]map[string]interface{}, error) {
-	g, err := createGsonFromURL(url)
+	ctx, span := trace.Start(ctx, "fetcher.Fetch", attribute.String("feed.url", url))
+
+	mm, err := w.fetch(ctx, url)
+	span.SetAttributes(attribute.Int("reports", len(mm)))
+	trace.End(span, err)
+
+	return mm, err
+}
+
+func (w *wetherInfomationFetcherImpl) fetch(ctx context.Context, url string) (map[string]map[string]interface{}, error) {
+	start := time.Now()
+	data, code, err := w.download(ctx, url)
+	metrics.FeedFetchDuration.WithLabelValues(url).Observe(time.Since(start).Seconds())
+
+	if code == 0 {
+		metrics.FeedFetchStatus.WithLabelValues(url, "error").Inc()
+	} else {
+		metrics.FeedFetchStatus.WithLabelValues(url, strconv.Itoa(code)).Inc()
+	}
+
 	if err != nil {
-		return nil, errors.Wrapf(err, "faild to create gson from url: %v", url)
+		return nil, errors.Wrapf(err, "faild to download feed: %v", url)
+	}
+
+	return w.parse(ctx, url, data, false)
+}
+
+func (w *wetherInfomationFetcherImpl) Push(ctx context.Context, url string, data []byte) (map[string]map[string]interface{}, error) {
+	ctx, span := trace.Start(ctx, "fetcher.Push", attribute.String("feed.url", url))
+
+	mm, err := w.parse(ctx, url, data, true)
+	span.SetAttributes(attribute.Int("reports", len(mm)))
+	trace.End(span, err)
+
+	return mm, err
+}
+
+// parse returns the reports of the entries in the feed document data of url.
+// The cache of the feed is replaced by the reports, or they are added to it if partial is true, when the cache is enabled.
+// A partial document is not recorded, since it may not contain all entries of the feed.
+func (w *wetherInfomationFetcherImpl) parse(ctx context.Context, url string, data []byte, partial bool) (map[string]map[string]interface{}, error) {
+	_, decodeSpan := trace.Start(ctx, "fetcher.decode", attribute.String("url.full", url))
+
+	g, err := createGsonFromBytes(data)
+	if err != nil {
+		err = errors.Wrapf(err, "faild to create gson from url: %v", url)
+		trace.End(decodeSpan, err)
+		return nil, err
 	}
 
 	r, err := g.GetByKeys("feed", "entry")
 	if err != nil {
-		return nil, errors.Wrapf(err, "faild to get by keys: %v", []string{"feed", "entry"})
+		err = errors.Wrapf(err, "faild to get by keys: %v", []string{"feed", "entry"})
+		trace.End(decodeSpan, err)
+		return nil, err
+	}
+	trace.End(decodeSpan, nil)
+
+	var merr error
+	if !partial {
+		var feedID string
+		if id, err := g.GetByKeys("feed", "id"); err == nil {
+			feedID = id.String()
+		}
+
+		merr = w.record(ctx, &Document{
+			Kind:    KindFeed,
+			ID:      feedID,
+			URL:     url,
+			Data:    data,
+			Fetched: time.Now(),
+		})
 	}
 
 	mm := make(map[string]map[string]interface{})
 
+	w.mu.Lock()
+	cached := w.reports[url]
+	w.mu.Unlock()
+	reports := make(map[string]map[string]interface{})
+
 	errCh := make(chan error)
 
 	var wg sync.WaitGroup
-	for _, v := range r.Slice() {
+	for _, v := range entries(r) {
 		wg.Add(1)
 		go func(v *gson.Result) {
 			defer wg.Done()
@@ -76,28 +250,100 @@ func (w *wetherInfomationFetcherImpl) Fetch(ctx context.Context, url string) (ma
 			m := make(map[string]interface{})
 
 			title, name := rm["title"].String(), rm["author"].Map()["name"].String()
+			id, link := rm["id"].String(), rm["link"].Map()["-href"].String()
 
+			l := log.FromContext(ctx, log.SubsystemFetcher).With(
+				"entry_uuid", report.UUID(id),
+				"office", name,
+				"title", title,
+				"url", link,
+			)
+			ctx, span := trace.Start(log.NewContext(ctx, l), "fetcher.report",
+				attribute.String("entry.uuid", report.UUID(id)),
+				attribute.String("entry.office", name),
+				attribute.String("entry.title", title),
+				attribute.String("url.full", link),
+			)
+
+			var rerr error
+			defer func() {
+				trace.End(span, rerr)
+			}()
+
+			fail := func(err error) {
+				l.Error(err)
+				rerr = multierr.Append(rerr, err)
+				errCh <- err
+			}
+
+			m["feed"] = url
+			m["id"] = id
 			m["title"] = title
 			m["name"] = name
+			m["link"] = link
 			m["updated"] = rm["updated"].String()
 			m["content"] = rm["content"].Map()["#content"].String()
 
-			g, err = createGsonFromURL(rm["link"].Map()["-href"].String())
+			if c, ok := cached[id]; ok {
+				metrics.EntriesSkipped.WithLabelValues(url).Inc()
+				span.SetAttributes(attribute.Bool("cached", true))
+				l.Debug("Skip downloading cached report")
+
+				key, err := w.keys.Key(report.NewKeyFields(url, c))
+				if err != nil {
+					fail(errors.Wrapf(err, "faild to generate key: %s", link))
+					return
+				}
+
+				w.mu.Lock()
+				put(mm, key, c)
+				reports[id] = c
+				w.mu.Unlock()
+				return
+			}
+
+			metrics.ReportsInFlight.Inc()
+			data, _, err := w.download(ctx, link)
+			metrics.ReportsInFlight.Dec()
+
 			if err != nil {
+				metrics.Reports.WithLabelValues(title, metrics.ResultFailed).Inc()
+				fail(err)
+				return
+			}
+			metrics.Reports.WithLabelValues(title, metrics.ResultDownloaded).Inc()
+			l.Debug("Downloaded report")
+
+			if err := w.record(ctx, &Document{
+				Kind:    KindReport,
+				ID:      id,
+				URL:     link,
+				Data:    data,
+				Fetched: time.Now(),
+			}); err != nil {
+				rerr = multierr.Append(rerr, err)
 				errCh <- err
+			}
+
+			body, err := decodeReport(ctx, link, data)
+			if err != nil {
+				metrics.Reports.WithLabelValues(title, metrics.ResultFailed).Inc()
+				fail(err)
 				return
 			}
+			m["body"] = body
+			metrics.Reports.WithLabelValues(title, metrics.ResultDecoded).Inc()
 
-			r, err = g.GetByKeys("Report", "Body", "Warning")
+			// e.g) 気象特別警報・警報・注意報_鳥取地方気象台
+			key, err := w.keys.Key(report.NewKeyFields(url, m))
 			if err != nil {
-				errCh <- err
+				fail(errors.Wrapf(err, "faild to generate key: %s", link))
 				return
 			}
-			m["body"] = r.Interface()
 
 			w.mu.Lock()
-			// e.g) 気象特別警報・警報・注意報_鳥取地方気象台
-			mm[title+"_"+name] = m
+			put(mm, key, m)
+			reports[id] = m
 			w.mu.Unlock()
 		}(v)
 	}
@@ -107,9 +353,81 @@ func (w *wetherInfomationFetcherImpl) Fetch(ctx context.Context, url string) (ma
 		close(errCh)
 	}()
 
-	var merr error
 	for err := range errCh {
 		merr = multierr.Append(merr, err)
 	}
+
+	if !w.cache {
+		return mm, merr
+	}
+
+	// Only the reports of the entries in the current feed are kept, while those of a partial document are added.
+	w.mu.Lock()
+	if partial && w.reports[url] != nil {
+		for id, m := range reports {
+			w.reports[url][id] = m
+		}
+	} else {
+		w.reports[url] = reports
+	}
+	w.mu.Unlock()
+
 	return mm, merr
 }
+
+// put sets m to mm by key unless the report already set by key is newer.
+// The entries sharing a key (e.g. of the same title and office by the default template) are fetched concurrently,
+// so the report of the entry updated last, or of the greater entry id at the same time, is kept regardless of the order.
+func put(mm map[string]map[string]interface{}, key string, m map[string]interface{}) {
+	if prev, ok := mm[key]; ok && !newer(m, prev) {
+		return
+	}
+	mm[key] = m
+}
+
+// newer returns true if the report a is updated after b, or has the greater entry id at the same time.
+func newer(a, b map[string]interface{}) bool {
+	ta, tb := updated(a), updated(b)
+	if !ta.Equal(tb) {
+		return ta.After(tb)
+	}
+
+	ida, _ := a["id"].(string)
+	idb, _ := b["id"].(string)
+	return ida > idb
+}
+
+// updated returns the updated time of the entry of the report, or zero time if it can't be parsed.
+func updated(m map[string]interface{}) time.Time {
+	s, _ := m["updated"].(string)
+	t, _ := time.Parse(time.RFC3339, s)
+	return t
+}
+
+// decodeReport returns the warnings in the body of the report document.
+func decodeReport(ctx context.Context, url string, data []byte) (body interface{}, err error) {
+	_, span := trace.Start(ctx, "fetcher.decode", attribute.String("url.full", url))
+	defer func() {
+		trace.End(span, err)
+	}()
+
+	g, err := createGsonFromBytes(data)
+	if err != nil {
+		return nil, errors.Wrapf(err, "faild to create gson from url: %v", url)
+	}
+
+	r, err := g.GetByKeys("Report", "Body", "Warning")
+	if err != nil {
+		return nil, err
+	}
+	return r.Interface(), nil
+}
+
+// entries returns entries of the feed as a slice.
+// goxml2json converts a feed with only one entry into an object instead of an array.
+func entries(r *gson.Result) []*gson.Result {
+	if s, err := r.SliceE(); err == nil {
+		return s
+	}
+	return []*gson.Result{r}
+}
@@ -0,0 +1,315 @@
+package fetcher
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+const testFeed = `<?xml version="1.0" encoding="utf-8"?>
+<feed xmlns="http://www.w3.org/2005/Atom" xml:lang="ja">
+<title>高頻度（随時）</title>
+<id>urn:uuid:f3a8b3e6-12db-390b-b0a6-77e6b5c41cdc</id>
+<entry>
+<title>気象特別警報・警報・注意報</title>
+<id>urn:uuid:c1af90d4-23a8-3628-a489-2d40421838d7</id>
+<updated>2019-03-25T09:00:00Z</updated>
+<author><name>盛岡地方気象台</name></author>
+<link type="application/xml" href="%s/report.xml" />
+<content type="text">内陸では、２５日夜のはじめ頃まで落雷に注意してください。</content>
+</entry></feed>`
+
+const testReport = `<?xml version="1.0" encoding="UTF-8"?>
+<Report xmlns="http://xml.kishou.go.jp/jmaxml1/">
+<Body xmlns="http://xml.kishou.go.jp/jmaxml1/body/meteorology1/">
+<Warning type="気象警報・注意報（一次細分区域等）">
+<Item>
+<Kind><Name>雷注意報</Name><Code>14</Code></Kind>
+<Area><Name>内陸</Name><Code>030010</Code></Area>
+</Item>
+</Warning>
+</Body>
+</Report>`
+
+// recordSpans records the spans ended by the global tracer provider during the test.
+func recordSpans(t *testing.T) *tracetest.SpanRecorder {
+	sr := tracetest.NewSpanRecorder()
+	prev := otel.GetTracerProvider()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(sr)))
+	t.Cleanup(func() {
+		otel.SetTracerProvider(prev)
+	})
+	return sr
+}
+
+func newTestServer(reportStatus int) *httptest.Server {
+	var srv *httptest.Server
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/feed.xml":
+			fmt.Fprintf(w, testFeed, srv.URL)
+		case "/report.xml":
+			w.WriteHeader(reportStatus)
+			if reportStatus == http.StatusOK {
+				fmt.Fprint(w, testReport)
+			}
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	return srv
+}
+
+// spanTree returns the ended spans by name, and the names of their parents.
+func spanTree(sr *tracetest.SpanRecorder) (map[string][]sdktrace.ReadOnlySpan, map[sdktrace.ReadOnlySpan]string) {
+	byID := make(map[string]sdktrace.ReadOnlySpan)
+	for _, s := range sr.Ended() {
+		byID[s.SpanContext().SpanID().String()] = s
+	}
+
+	spans := make(map[string][]sdktrace.ReadOnlySpan)
+	parents := make(map[sdktrace.ReadOnlySpan]string)
+	for _, s := range sr.Ended() {
+		spans[s.Name()] = append(spans[s.Name()], s)
+		if p, ok := byID[s.Parent().SpanID().String()]; ok {
+			parents[s] = p.Name()
+		}
+	}
+	return spans, parents
+}
+
+func TestFetchTracesDownloadAndDecode(t *testing.T) {
+	sr := recordSpans(t)
+	srv := newTestServer(http.StatusOK)
+	defer srv.Close()
+
+	mm, err := New().Fetch(context.Background(), srv.URL+"/feed.xml")
+	if err != nil {
+		t.Fatalf("Fetch returns error: %v", err)
+	}
+	if _, ok := mm["気象特別警報・警報・注意報_盛岡地方気象台"]; !ok {
+		t.Fatalf("report is not fetched: %v", mm)
+	}
+
+	spans, parents := spanTree(sr)
+
+	tests := []struct {
+		name   string
+		count  int
+		parent []string
+	}{
+		{name: "fetcher.Fetch", count: 1},
+		// The feed and the report are downloaded and decoded in the spans of the feed and of the report.
+		{name: "fetcher.download", count: 2, parent: []string{"fetcher.Fetch", "fetcher.report"}},
+		{name: "fetcher.decode", count: 2, parent: []string{"fetcher.Fetch", "fetcher.report"}},
+		{name: "fetcher.report", count: 1, parent: []string{"fetcher.Fetch"}},
+	}
+
+	for _, tt := range tests {
+		if got := len(spans[tt.name]); got != tt.count {
+			t.Errorf("number of %s spans is %d, want %d", tt.name, got, tt.count)
+			continue
+		}
+
+		want := make(map[string]bool)
+		for _, p := range tt.parent {
+			want[p] = true
+		}
+		for _, s := range spans[tt.name] {
+			if len(want) > 0 && !want[parents[s]] {
+				t.Errorf("parent of %s span is %q, want one of %v", tt.name, parents[s], tt.parent)
+			}
+			if len(want) == 0 && s.Parent().IsValid() {
+				t.Errorf("%s span has parent %q, want root", tt.name, parents[s])
+			}
+			if s.Status().Code == codes.Error {
+				t.Errorf("%s span has error status: %s", tt.name, s.Status().Description)
+			}
+		}
+	}
+}
+
+func TestFetchTracesError(t *testing.T) {
+	sr := recordSpans(t)
+	srv := newTestServer(http.StatusInternalServerError)
+	defer srv.Close()
+
+	if _, err := New().Fetch(context.Background(), srv.URL+"/feed.xml"); err == nil {
+		t.Fatal("Fetch returns no error while the report is not available")
+	}
+
+	spans, _ := spanTree(sr)
+
+	// The error of the report is recorded in its spans and in the span of the feed.
+	for _, name := range []string{"fetcher.Fetch", "fetcher.report"} {
+		for _, s := range spans[name] {
+			if s.Status().Code != codes.Error {
+				t.Errorf("%s span has status %v, want error", name, s.Status().Code)
+			}
+		}
+	}
+
+	var failed int
+	for _, s := range spans["fetcher.download"] {
+		if s.Status().Code != codes.Error {
+			continue
+		}
+		failed++
+
+		var code int64
+		for _, a := range s.Attributes() {
+			if a.Key == "http.response.status_code" {
+				code = a.Value.AsInt64()
+			}
+		}
+		if code != http.StatusInternalServerError {
+			t.Errorf("status code of failed download is %d, want %d", code, http.StatusInternalServerError)
+		}
+		if len(s.Events()) == 0 {
+			t.Error("error of failed download is not recorded")
+		}
+	}
+	if failed != 1 {
+		t.Errorf("number of failed downloads is %d, want 1", failed)
+	}
+}
+
+// countRecorder counts the recorded documents by kind.
+type countRecorder struct {
+	mu    sync.Mutex
+	kinds map[Kind]int
+}
+
+func (r *countRecorder) Record(ctx context.Context, doc *Document) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.kinds[doc.Kind]++
+	return nil
+}
+
+func TestFetchReportCache(t *testing.T) {
+	tests := []struct {
+		name      string
+		opts      []Option
+		downloads int32
+	}{
+		{name: "disabled", downloads: 3},
+		{name: "enabled", opts: []Option{WithReportCache()}, downloads: 1},
+	}
+
+	for _, tt := range tests {
+		var downloads int32
+		var srv *httptest.Server
+		srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			switch r.URL.Path {
+			case "/feed.xml":
+				fmt.Fprintf(w, testFeed, srv.URL)
+			case "/report.xml":
+				atomic.AddInt32(&downloads, 1)
+				fmt.Fprint(w, testReport)
+			}
+		}))
+
+		rec := &countRecorder{kinds: make(map[Kind]int)}
+		w := New(append(tt.opts, WithRecorder(rec))...)
+
+		// The report of the entry is downloaded by every poll and delivery, unless it is cached.
+		for i := 0; i < 2; i++ {
+			mm, err := w.Fetch(context.Background(), srv.URL+"/feed.xml")
+			if err != nil {
+				t.Fatalf("%s: Fetch returns error: %v", tt.name, err)
+			}
+			if m, ok := mm["気象特別警報・警報・注意報_盛岡地方気象台"]; !ok || m["body"] == nil {
+				t.Fatalf("%s: report of poll %d is not fetched: %v", tt.name, i, mm)
+			}
+		}
+
+		mm, err := w.Push(context.Background(), srv.URL+"/feed.xml", []byte(fmt.Sprintf(testFeed, srv.URL)))
+		if err != nil {
+			t.Fatalf("%s: Push returns error: %v", tt.name, err)
+		}
+		if len(mm) != 1 {
+			t.Errorf("%s: reports of delivery are %v, want 1 report", tt.name, mm)
+		}
+		srv.Close()
+
+		if n := atomic.LoadInt32(&downloads); n != tt.downloads {
+			t.Errorf("%s: report is downloaded %d times, want %d", tt.name, n, tt.downloads)
+		}
+		if rec.kinds[KindReport] != int(tt.downloads) {
+			t.Errorf("%s: report is recorded %d times, want %d", tt.name, rec.kinds[KindReport], tt.downloads)
+		}
+	}
+}
+
+const collisionFeed = `<?xml version="1.0" encoding="utf-8"?>
+<feed xmlns="http://www.w3.org/2005/Atom" xml:lang="ja">
+<title>高頻度（随時）</title>
+<id>urn:uuid:f3a8b3e6-12db-390b-b0a6-77e6b5c41cdc</id>
+<entry>
+<title>気象特別警報・警報・注意報</title>
+<id>urn:uuid:00000000-0000-0000-0000-000000000001</id>
+<updated>%s</updated>
+<author><name>盛岡地方気象台</name></author>
+<link type="application/xml" href="%s/report.xml" />
+<content type="text">1</content>
+</entry>
+<entry>
+<title>気象特別警報・警報・注意報</title>
+<id>urn:uuid:00000000-0000-0000-0000-000000000002</id>
+<updated>%s</updated>
+<author><name>盛岡地方気象台</name></author>
+<link type="application/xml" href="%s/report.xml" />
+<content type="text">2</content>
+</entry></feed>`
+
+func TestFetchKeyCollision(t *testing.T) {
+	tests := []struct {
+		name     string
+		updated1 string
+		updated2 string
+		want     string
+	}{
+		{name: "first is newer", updated1: "2019-03-25T09:00:00Z", updated2: "2019-03-25T08:00:00Z", want: "urn:uuid:00000000-0000-0000-0000-000000000001"},
+		{name: "second is newer", updated1: "2019-03-25T08:00:00Z", updated2: "2019-03-25T09:00:00Z", want: "urn:uuid:00000000-0000-0000-0000-000000000002"},
+		{name: "newer in other zone", updated1: "2019-03-25T17:30:00+09:00", updated2: "2019-03-25T08:00:00Z", want: "urn:uuid:00000000-0000-0000-0000-000000000001"},
+		{name: "same time", updated1: "2019-03-25T09:00:00Z", updated2: "2019-03-25T09:00:00Z", want: "urn:uuid:00000000-0000-0000-0000-000000000002"},
+	}
+
+	for _, tt := range tests {
+		var srv *httptest.Server
+		srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			switch r.URL.Path {
+			case "/feed.xml":
+				fmt.Fprintf(w, collisionFeed, tt.updated1, srv.URL, tt.updated2, srv.URL)
+			case "/report.xml":
+				fmt.Fprint(w, testReport)
+			}
+		}))
+
+		// The entries sharing the key are fetched concurrently, so the kept report must not depend on the order.
+		for i := 0; i < 10; i++ {
+			mm, err := New().Fetch(context.Background(), srv.URL+"/feed.xml")
+			if err != nil {
+				t.Fatalf("%s: Fetch returns error: %v", tt.name, err)
+			}
+			if len(mm) != 1 {
+				t.Fatalf("%s: reports are %v, want 1 report", tt.name, mm)
+			}
+			if m := mm["気象特別警報・警報・注意報_盛岡地方気象台"]; m["id"] != tt.want {
+				t.Errorf("%s: report of entry %v is kept, want %s", tt.name, m["id"], tt.want)
+				break
+			}
+		}
+		srv.Close()
+	}
+}
@@ -0,0 +1,240 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/hlts2/gweather/internal/redis"
+)
+
+const (
+	// StatusOK is the status when the component is healthy.
+	StatusOK = "ok"
+
+	// StatusUnavailable is the status when the component is unhealthy.
+	StatusUnavailable = "unavailable"
+)
+
+// pingTimeout is the timeout of checking the store.
+const pingTimeout = 3 * time.Second
+
+// Config represents thresholds of the readiness.
+type Config struct {
+	// Feeds is URLs of the feeds to poll.
+	Feeds []string
+
+	// Intervals are the longest intervals of polls by feed.
+	Intervals map[string]time.Duration
+
+	// MaxMissedPolls is the number of intervals allowed without a successful poll.
+	MaxMissedPolls int
+
+	// MaxFailures is the number of consecutive failures of polls allowed.
+	MaxFailures int
+}
+
+type feedState struct {
+	lastSuccess time.Time
+	failures    int
+	lastError   string
+}
+
+// Checker tracks the state of polls and the store, and serves /healthz and /readyz.
+type Checker struct {
+	mu      sync.RWMutex
+	pool    redis.Pool
+	cfg     Config
+	started time.Time
+	standby bool
+	feeds   map[string]*feedState
+}
+
+// New returns Checker which checks the store by pool.
+func New(pool redis.Pool, cfg Config) *Checker {
+	return &Checker{
+		pool:    pool,
+		cfg:     cfg,
+		started: time.Now(),
+		feeds:   make(map[string]*feedState),
+	}
+}
+
+// Reset replaces the pool and the thresholds when the configuration is reloaded.
+func (c *Checker) Reset(pool redis.Pool, cfg Config) {
+	c.mu.Lock()
+	c.pool, c.cfg = pool, cfg
+	c.mu.Unlock()
+}
+
+// Standby records whether this replica stands by as a follower of the leader election.
+// The feeds are not checked while standing by, and the deadline of the polls restarts when it becomes the leader.
+func (c *Checker) Standby(standby bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.standby && !standby {
+		c.started = time.Now()
+	}
+	c.standby = standby
+}
+
+// Success records a successful poll of the feed.
+func (c *Checker) Success(feed string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	s := c.state(feed)
+	s.lastSuccess = time.Now()
+	s.failures = 0
+	s.lastError = ""
+}
+
+// Failure records a failed poll of the feed.
+func (c *Checker) Failure(feed string, err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	s := c.state(feed)
+	s.failures++
+	s.lastError = err.Error()
+}
+
+func (c *Checker) state(feed string) *feedState {
+	s, ok := c.feeds[feed]
+	if !ok {
+		s = new(feedState)
+		c.feeds[feed] = s
+	}
+	return s
+}
+
+// StoreStatus represents the state of the store.
+type StoreStatus struct {
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+// FeedStatus represents the state of polls of the feed.
+type FeedStatus struct {
+	Status              string     `json:"status"`
+	LastSuccess         *time.Time `json:"last_success,omitempty"`
+	ConsecutiveFailures int        `json:"consecutive_failures"`
+	LastError           string     `json:"last_error,omitempty"`
+}
+
+// Status represents the readiness of gweather.
+type Status struct {
+	Status  string                 `json:"status"`
+	Store   StoreStatus            `json:"store"`
+	Standby bool                   `json:"standby,omitempty"`
+	Feeds   map[string]*FeedStatus `json:"feeds"`
+}
+
+// Ready returns the readiness.
+// gweather is ready when the store is reachable, and every feed has been polled successfully within
+// MaxMissedPolls intervals without MaxFailures consecutive failures. The feeds are not checked while standing by.
+func (c *Checker) Ready(ctx context.Context) *Status {
+	c.mu.RLock()
+	pool, cfg := c.pool, c.cfg
+	c.mu.RUnlock()
+
+	st := &Status{
+		Status: StatusOK,
+		Store:  StoreStatus{Status: StatusOK},
+		Feeds:  make(map[string]*FeedStatus),
+	}
+
+	if err := ping(ctx, pool); err != nil {
+		st.Status = StatusUnavailable
+		st.Store = StoreStatus{
+			Status: StatusUnavailable,
+			Error:  err.Error(),
+		}
+	}
+
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	if c.standby {
+		st.Standby = true
+		return st
+	}
+
+	now := time.Now()
+
+	for _, feed := range cfg.Feeds {
+		deadline := cfg.Intervals[feed] * time.Duration(cfg.MaxMissedPolls)
+
+		s, ok := c.feeds[feed]
+		if !ok {
+			s = new(feedState)
+		}
+
+		fs := &FeedStatus{
+			Status:              StatusOK,
+			ConsecutiveFailures: s.failures,
+			LastError:           s.lastError,
+		}
+
+		// A feed which has not been polled yet is allowed until the deadline since the start or the takeover.
+		last := c.started
+		if !s.lastSuccess.IsZero() {
+			t := s.lastSuccess
+			fs.LastSuccess = &t
+			if t.After(last) {
+				last = t
+			}
+		}
+
+		if (deadline > 0 && now.Sub(last) > deadline) || (cfg.MaxFailures > 0 && s.failures >= cfg.MaxFailures) {
+			fs.Status = StatusUnavailable
+			st.Status = StatusUnavailable
+		}
+		st.Feeds[feed] = fs
+	}
+
+	return st
+}
+
+func ping(ctx context.Context, pool redis.Pool) error {
+	ctx, cancel := context.WithTimeout(ctx, pingTimeout)
+	defer cancel()
+
+	conn, err := pool.GetContext(ctx)
+	if err != nil {
+		return errors.Wrap(err, "faild to get redis connection")
+	}
+	defer conn.Close()
+
+	if _, err := conn.Do("PING"); err != nil {
+		return errors.Wrap(err, "faild to write command: PING")
+	}
+	return nil
+}
+
+// Healthz responds that the process is alive.
+func (c *Checker) Healthz(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]string{"status": StatusOK})
+}
+
+// Readyz responds the readiness with the detail.
+func (c *Checker) Readyz(w http.ResponseWriter, r *http.Request) {
+	st := c.Ready(r.Context())
+
+	code := http.StatusOK
+	if st.Status != StatusOK {
+		code = http.StatusServiceUnavailable
+	}
+	writeJSON(w, code, st)
+}
+
+func writeJSON(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,140 @@
+package kafka
+
+import (
+	"context"
+	"time"
+
+	"github.com/pkg/errors"
+	kafkago "github.com/segmentio/kafka-go"
+	"github.com/segmentio/kafka-go/sasl"
+	"github.com/segmentio/kafka-go/sasl/plain"
+	"github.com/segmentio/kafka-go/sasl/scram"
+
+	"github.com/hlts2/gweather/internal/sink"
+	"github.com/hlts2/gweather/internal/tlsconfig"
+)
+
+const (
+	// batchTimeout is the time to wait for more messages to fill a batch, which is short since the messages are written by batch already.
+	batchTimeout = 10 * time.Millisecond
+
+	// writeTimeout is the timeout of writing a batch of messages.
+	writeTimeout = 10 * time.Second
+)
+
+const (
+	// SASLPlain, SASLSCRAMSHA256 and SASLSCRAMSHA512 are the mechanisms of the SASL authentication.
+	SASLPlain       = "plain"
+	SASLSCRAMSHA256 = "scram-sha-256"
+	SASLSCRAMSHA512 = "scram-sha-512"
+)
+
+// Config represents the configuration of Writer.
+type Config struct {
+	// Brokers are the addresses of the bootstrap brokers, e.g. 127.0.0.1:9092.
+	Brokers []string
+	Topic   string
+
+	// SASLMechanism is the mechanism of the SASL authentication. SASL is not used when it is empty.
+	SASLMechanism string
+	Username      string
+	Password      string
+
+	// TLS is used when UseTLS is true.
+	UseTLS bool
+	TLS    tlsconfig.Options
+}
+
+// Writer writes the events of the reports written by the store to a Kafka topic.
+// It implements sink.Sink, and the key of a message is the area code of the event,
+// so that the messages of an area are written to the same partition and consumed in order.
+//
+// The headers of a message are the type and the ID of the event, and the ID of the entry in the outbox,
+// by which the consumers can drop the duplicates written again.
+type Writer struct {
+	w *kafkago.Writer
+}
+
+// New returns Writer configured by cfg. batchSize is the maximum number of the messages written to a partition at once.
+func New(cfg Config, batchSize int) (*Writer, error) {
+	t := &kafkago.Transport{
+		ClientID: "gweather",
+	}
+
+	if cfg.UseTLS {
+		tc, err := cfg.TLS.Config()
+		if err != nil {
+			return nil, err
+		}
+		t.TLS = tc
+	}
+
+	if cfg.SASLMechanism != "" {
+		m, err := mechanism(cfg.SASLMechanism, cfg.Username, cfg.Password)
+		if err != nil {
+			return nil, err
+		}
+		t.SASL = m
+	}
+
+	return &Writer{
+		w: &kafkago.Writer{
+			Addr:  kafkago.TCP(cfg.Brokers...),
+			Topic: cfg.Topic,
+
+			// The partitions of the keys are the same as the default partitioner of the Java client.
+			Balancer:     &kafkago.Murmur2Balancer{},
+			RequiredAcks: kafkago.RequireAll,
+			BatchSize:    batchSize,
+			BatchTimeout: batchTimeout,
+			WriteTimeout: writeTimeout,
+			Transport:    t,
+		},
+	}, nil
+}
+
+// Name returns the name of the sink.
+func (w *Writer) Name() string {
+	return "kafka"
+}
+
+// Write writes the messages, and waits for the acknowledgements by all the in-sync replicas.
+func (w *Writer) Write(ctx context.Context, msgs []*sink.Message) error {
+	kms := make([]kafkago.Message, len(msgs))
+	for i, m := range msgs {
+		kms[i] = kafkago.Message{
+			Key:   []byte(m.Key),
+			Value: m.Value,
+			Headers: []kafkago.Header{
+				{Key: "gweather-event-type", Value: []byte(m.Event.Type)},
+				{Key: "gweather-event-id", Value: []byte(m.Event.ID)},
+				{Key: "gweather-outbox-id", Value: []byte(m.ID)},
+			},
+		}
+	}
+
+	if err := w.w.WriteMessages(ctx, kms...); err != nil {
+		return errors.Wrapf(err, "faild to write events to kafka: %s", w.w.Topic)
+	}
+	return nil
+}
+
+// Close flushes the messages and closes the connections.
+func (w *Writer) Close() error {
+	return errors.Wrap(w.w.Close(), "faild to close kafka writer")
+}
+
+func mechanism(name, username, password string) (sasl.Mechanism, error) {
+	switch name {
+	case SASLPlain:
+		return plain.Mechanism{Username: username, Password: password}, nil
+	case SASLSCRAMSHA256:
+		m, err := scram.Mechanism(scram.SHA256, username, password)
+		return m, errors.Wrap(err, "faild to create SASL mechanism")
+	case SASLSCRAMSHA512:
+		m, err := scram.Mechanism(scram.SHA512, username, password)
+		return m, errors.Wrap(err, "faild to create SASL mechanism")
+	default:
+		return nil, errors.Errorf("unknown SASL mechanism: %s", name)
+	}
+}
@@ -0,0 +1,158 @@
+package leader
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/hlts2/gweather/internal/log"
+	"github.com/hlts2/gweather/internal/metrics"
+)
+
+// Lock represents a lock with a lease shared by the replicas.
+type Lock interface {
+	// Acquire acquires the lock for ttl, or renews the lease if the lock is held by token.
+	// token is 0 when the lock is not held. It returns the fencing token of the lock,
+	// which increases every time the lock is acquired, or 0 if the lock is held by another replica.
+	Acquire(ctx context.Context, token int64, ttl time.Duration) (int64, error)
+
+	// Release releases the lock if it is held by token.
+	Release(ctx context.Context, token int64) error
+}
+
+// Elector campaigns for the leader among the replicas with Lock.
+// The leader renews the lease at a third of the TTL, and steps down when the lease expires without renewal.
+// A follower takes over within the TTL and a third of it after the leader dies.
+type Elector struct {
+	mu      sync.Mutex
+	lock    Lock
+	ttl     time.Duration
+	token   int64
+	expires time.Time
+	elected chan struct{}
+}
+
+// New returns Elector which holds lock with the lease of ttl.
+func New(lock Lock, ttl time.Duration) *Elector {
+	metrics.Leader.Set(0)
+
+	return &Elector{
+		lock:    lock,
+		ttl:     ttl,
+		elected: make(chan struct{}, 1),
+	}
+}
+
+// Reset replaces the lock when the configuration is reloaded.
+// The fencing token is kept, so the leader keeps the lock if the new one refers to the same lock.
+func (e *Elector) Reset(lock Lock) {
+	e.mu.Lock()
+	e.lock = lock
+	e.mu.Unlock()
+}
+
+// Token returns the fencing token of the lock held by this replica, or 0 if it is not the leader.
+func (e *Elector) Token() int64 {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.token == 0 || !time.Now().Before(e.expires) {
+		return 0
+	}
+	return e.token
+}
+
+// IsLeader returns true if this replica holds the lock.
+func (e *Elector) IsLeader() bool {
+	return e.Token() != 0
+}
+
+// Elected returns the channel which receives a value when this replica becomes the leader.
+func (e *Elector) Elected() <-chan struct{} {
+	return e.elected
+}
+
+// Run campaigns until ctx is canceled, and releases the lock if it is held.
+func (e *Elector) Run(ctx context.Context) {
+	t := time.NewTicker(e.ttl / 3)
+	defer t.Stop()
+
+	for {
+		e.campaign(ctx)
+
+		select {
+		case <-ctx.Done():
+			e.release()
+			return
+		case <-t.C:
+		}
+	}
+}
+
+func (e *Elector) campaign(ctx context.Context) {
+	l := log.New(log.SubsystemApp)
+
+	e.mu.Lock()
+	lock, token := e.lock, e.token
+	e.mu.Unlock()
+
+	start := time.Now()
+	next, err := lock.Acquire(ctx, token, e.ttl)
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if err != nil {
+		l.Warnf("faild to acquire leader lock: %v", err)
+
+		// The leader steps down once the lease may have expired, since another replica may take over.
+		if e.token != 0 && !time.Now().Before(e.expires) {
+			l.With("token", e.token).Warn("Lost leadership because the lease has expired")
+			e.token = 0
+			metrics.Leader.Set(0)
+		}
+		return
+	}
+
+	switch {
+	case next == 0 && e.token != 0:
+		l.With("token", e.token).Warn("Lost leadership because the lock is held by another replica")
+		metrics.Leader.Set(0)
+	case next != 0 && next != e.token:
+		l.With("token", next).Info("Became leader")
+		metrics.Leader.Set(1)
+
+		select {
+		case e.elected <- struct{}{}:
+		default:
+		}
+	}
+
+	e.token = next
+	if next != 0 {
+		// The lease is measured from the time before the request, so that it never outlives the lock in redis.
+		e.expires = start.Add(e.ttl)
+	}
+}
+
+func (e *Elector) release() {
+	e.mu.Lock()
+	lock, token := e.lock, e.token
+	e.token = 0
+	e.mu.Unlock()
+
+	if token == 0 {
+		return
+	}
+	metrics.Leader.Set(0)
+
+	// The lock is released so that a follower takes over without waiting for the lease to expire.
+	ctx, cancel := context.WithTimeout(context.Background(), e.ttl/3)
+	defer cancel()
+
+	if err := lock.Release(ctx, token); err != nil {
+		log.New(log.SubsystemApp).Warnf("faild to release leader lock: %v", err)
+		return
+	}
+	log.New(log.SubsystemApp).With("token", token).Info("Released leader lock")
+}
@@ -0,0 +1,152 @@
+package leader
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+// memLock is Lock in memory shared by the electors of a test.
+type memLock struct {
+	mu      sync.Mutex
+	holder  int64
+	expires time.Time
+	tokens  int64
+	err     error
+}
+
+func (m *memLock) Acquire(ctx context.Context, token int64, ttl time.Duration) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.err != nil {
+		return 0, m.err
+	}
+
+	if m.holder != 0 && time.Now().Before(m.expires) {
+		if m.holder != token {
+			return 0, nil
+		}
+		m.expires = time.Now().Add(ttl)
+		return token, nil
+	}
+
+	m.tokens++
+	m.holder, m.expires = m.tokens, time.Now().Add(ttl)
+	return m.holder, nil
+}
+
+func (m *memLock) Release(ctx context.Context, token int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.holder == token {
+		m.holder = 0
+	}
+	return nil
+}
+
+// expire expires the lease of the holder as if it has died.
+func (m *memLock) expire() {
+	m.mu.Lock()
+	m.expires = time.Now()
+	m.mu.Unlock()
+}
+
+func elected(e *Elector) bool {
+	select {
+	case <-e.Elected():
+		return true
+	default:
+		return false
+	}
+}
+
+func TestElectorTakeoverOnRelease(t *testing.T) {
+	lock := new(memLock)
+	a, b := New(lock, time.Minute), New(lock, time.Minute)
+
+	a.campaign(context.Background())
+	b.campaign(context.Background())
+
+	if !a.IsLeader() || !elected(a) {
+		t.Fatal("a is not elected")
+	}
+	if b.IsLeader() || elected(b) {
+		t.Fatal("b is elected while a holds the lock")
+	}
+
+	// The lease is renewed with the same token.
+	token := a.Token()
+	a.campaign(context.Background())
+	if got := a.Token(); got != token {
+		t.Fatalf("token is changed by renewal: %d, want %d", got, token)
+	}
+	if elected(a) {
+		t.Fatal("a is elected again by renewal")
+	}
+
+	a.release()
+	b.campaign(context.Background())
+
+	if a.IsLeader() {
+		t.Fatal("a is leader after release")
+	}
+	if !b.IsLeader() || !elected(b) {
+		t.Fatal("b does not take over after release")
+	}
+	if b.Token() <= token {
+		t.Fatalf("token of the new leader is not greater: %d, previous %d", b.Token(), token)
+	}
+}
+
+func TestElectorTakeoverOnExpiry(t *testing.T) {
+	lock := new(memLock)
+	a, b := New(lock, time.Minute), New(lock, time.Minute)
+
+	a.campaign(context.Background())
+	token := a.Token()
+
+	// a is paused past its lease, and b takes over.
+	lock.expire()
+	b.campaign(context.Background())
+
+	if !b.IsLeader() || b.Token() <= token {
+		t.Fatalf("b does not take over with a greater token: %d, previous %d", b.Token(), token)
+	}
+
+	// a steps down once it finds the lock held by b.
+	a.campaign(context.Background())
+	if a.IsLeader() {
+		t.Fatal("a is still leader after b has taken over")
+	}
+}
+
+func TestElectorStepsDownWhenLeaseExpires(t *testing.T) {
+	lock := new(memLock)
+	e := New(lock, 30*time.Millisecond)
+
+	e.campaign(context.Background())
+	if !e.IsLeader() {
+		t.Fatal("not elected")
+	}
+
+	// The leader keeps the leadership while the lease is valid, even if the renewal fails.
+	lock.err = errors.New("unavailable")
+	e.campaign(context.Background())
+	if !e.IsLeader() {
+		t.Fatal("stepped down before the lease expires")
+	}
+
+	time.Sleep(40 * time.Millisecond)
+	if e.IsLeader() {
+		t.Fatal("token is returned after the lease has expired")
+	}
+
+	e.campaign(context.Background())
+	if e.token != 0 {
+		t.Fatal("still holds the token after the lease has expired")
+	}
+}
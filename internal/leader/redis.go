@@ -0,0 +1,86 @@
+package leader
+
+import (
+	"context"
+	"time"
+
+	redigo "github.com/gomodule/redigo/redis"
+	"github.com/pkg/errors"
+
+	"github.com/hlts2/gweather/internal/redis"
+)
+
+const (
+	// LockKey is the key of the lock whose value is the fencing token of the leader.
+	// The hash tag puts the lock and TokenKey in the same slot of Redis Cluster.
+	LockKey = "gweather:{leader}"
+
+	// TokenKey is the key of the counter of the fencing tokens. Its value is the token of the current leader,
+	// since it is incremented only when a replica acquires the lock, and not by the renewals. The writes of the leader are fenced by it.
+	TokenKey = "gweather:{leader}:token"
+)
+
+// acquireScript renews the lease if the lock is held by ARGV[1], or acquires the lock by SET NX PX with a new fencing token.
+var acquireScript = redigo.NewScript(2, `
+local cur = redis.call('GET', KEYS[1])
+if cur then
+	if cur == ARGV[1] then
+		redis.call('PEXPIRE', KEYS[1], ARGV[2])
+		return tonumber(cur)
+	end
+	return 0
+end
+local token = redis.call('INCR', KEYS[2])
+if redis.call('SET', KEYS[1], token, 'NX', 'PX', ARGV[2]) then
+	return token
+end
+return 0
+`)
+
+// releaseScript deletes the lock if it is held by ARGV[1].
+var releaseScript = redigo.NewScript(1, `
+if redis.call('GET', KEYS[1]) == ARGV[1] then
+	return redis.call('DEL', KEYS[1])
+end
+return 0
+`)
+
+type redisLock struct {
+	pool   redis.Pool
+	prefix string
+}
+
+// NewRedisLock returns Lock implementation which holds the lock in redis. The keys are prepended by prefix.
+func NewRedisLock(pool redis.Pool, prefix string) Lock {
+	return &redisLock{
+		pool:   pool,
+		prefix: prefix,
+	}
+}
+
+func (r *redisLock) Acquire(ctx context.Context, token int64, ttl time.Duration) (int64, error) {
+	conn, err := r.pool.GetContext(ctx)
+	if err != nil {
+		return 0, errors.Wrap(err, "faild to get redis connection")
+	}
+	defer conn.Close()
+
+	next, err := redigo.Int64(acquireScript.Do(conn, r.prefix+LockKey, r.prefix+TokenKey, token, int64(ttl/time.Millisecond)))
+	if err != nil {
+		return 0, errors.Wrapf(err, "faild to acquire lock: %s", r.prefix+LockKey)
+	}
+	return next, nil
+}
+
+func (r *redisLock) Release(ctx context.Context, token int64) error {
+	conn, err := r.pool.GetContext(ctx)
+	if err != nil {
+		return errors.Wrap(err, "faild to get redis connection")
+	}
+	defer conn.Close()
+
+	if _, err := releaseScript.Do(conn, r.prefix+LockKey, token); err != nil {
+		return errors.Wrapf(err, "faild to release lock: %s", r.prefix+LockKey)
+	}
+	return nil
+}
@@ -0,0 +1,298 @@
+package log
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/kpango/glg"
+	"github.com/pkg/errors"
+)
+
+const (
+	// FormatText writes logs as plain text by glg.
+	FormatText = "text"
+
+	// FormatJSON writes logs as JSON lines.
+	FormatJSON = "json"
+)
+
+const (
+	// SubsystemApp is the subsystem of the application lifecycle.
+	SubsystemApp = "app"
+
+	// SubsystemFetcher is the subsystem of downloading and decoding documents.
+	SubsystemFetcher = "fetcher"
+
+	// SubsystemStore is the subsystem of writing reports to redis.
+	SubsystemStore = "store"
+
+	// SubsystemNotifier is the subsystem of delivering reports, e.g. the republished feed and the archive.
+	SubsystemNotifier = "notifier"
+)
+
+// Level represents a logging level.
+type Level int
+
+const (
+	// LevelDebug is the level for debugging.
+	LevelDebug Level = iota
+
+	// LevelInfo is the level for informational messages.
+	LevelInfo
+
+	// LevelWarn is the level for warnings.
+	LevelWarn
+
+	// LevelError is the level for errors.
+	LevelError
+)
+
+func (l Level) String() string {
+	switch l {
+	case LevelDebug:
+		return "debug"
+	case LevelInfo:
+		return "info"
+	case LevelWarn:
+		return "warn"
+	default:
+		return "error"
+	}
+}
+
+// ParseLevel returns Level of s.
+func ParseLevel(s string) (Level, error) {
+	switch strings.ToLower(s) {
+	case "debug":
+		return LevelDebug, nil
+	case "info", "":
+		return LevelInfo, nil
+	case "warn", "warning":
+		return LevelWarn, nil
+	case "error":
+		return LevelError, nil
+	default:
+		return LevelInfo, errors.Errorf("unknown log level: %s", s)
+	}
+}
+
+// Config represents the configuration of logging.
+type Config struct {
+	Format string
+
+	// Level is the default level of subsystems.
+	Level string
+
+	// Levels is the level of each subsystem, e.g. {"fetcher": "debug"}.
+	Levels map[string]string
+}
+
+type setting struct {
+	mu     sync.RWMutex
+	format string
+	level  Level
+	levels map[string]Level
+	out    io.Writer
+}
+
+var std = &setting{
+	format: FormatText,
+	level:  LevelInfo,
+	levels: make(map[string]Level),
+	out:    os.Stderr,
+}
+
+// Setup applies the configuration to all loggers.
+func Setup(cfg Config) error {
+	switch cfg.Format {
+	case "", FormatText, FormatJSON:
+	default:
+		return errors.Errorf("unknown log format: %s", cfg.Format)
+	}
+
+	level, err := ParseLevel(cfg.Level)
+	if err != nil {
+		return err
+	}
+
+	levels := make(map[string]Level, len(cfg.Levels))
+	for sub, s := range cfg.Levels {
+		l, err := ParseLevel(s)
+		if err != nil {
+			return errors.Wrapf(err, "invalid level of %s", sub)
+		}
+		levels[sub] = l
+	}
+
+	std.mu.Lock()
+	defer std.mu.Unlock()
+
+	std.format = cfg.Format
+	if std.format == "" {
+		std.format = FormatText
+	}
+	std.level, std.levels = level, levels
+	return nil
+}
+
+// SetOutput sets the writer of all levels, e.g. to keep stdout for the results of commands.
+func SetOutput(w io.Writer) {
+	std.mu.Lock()
+	std.out = w
+	std.mu.Unlock()
+
+	glg.Get().SetMode(glg.WRITER).SetWriter(w)
+}
+
+// Logger writes logs of a subsystem with fields.
+type Logger struct {
+	subsystem string
+	fields    []interface{}
+}
+
+// New returns Logger of the subsystem.
+func New(subsystem string) *Logger {
+	return &Logger{
+		subsystem: subsystem,
+	}
+}
+
+// Named returns a copy of the logger for another subsystem with the same fields.
+func (l *Logger) Named(subsystem string) *Logger {
+	return &Logger{
+		subsystem: subsystem,
+		fields:    l.fields,
+	}
+}
+
+// With returns a copy of the logger with key and value pairs added to the fields.
+func (l *Logger) With(kv ...interface{}) *Logger {
+	fields := make([]interface{}, 0, len(l.fields)+len(kv))
+	fields = append(fields, l.fields...)
+	fields = append(fields, kv...)
+
+	return &Logger{
+		subsystem: l.subsystem,
+		fields:    fields,
+	}
+}
+
+type ctxKey struct{}
+
+// NewContext returns a copy of ctx which carries l.
+func NewContext(ctx context.Context, l *Logger) context.Context {
+	return context.WithValue(ctx, ctxKey{}, l)
+}
+
+// FromContext returns the logger carried by ctx for the subsystem.
+// It returns a logger without fields if ctx carries no logger.
+func FromContext(ctx context.Context, subsystem string) *Logger {
+	if l, ok := ctx.Value(ctxKey{}).(*Logger); ok {
+		return l.Named(subsystem)
+	}
+	return New(subsystem)
+}
+
+// Debug writes a log of debug level.
+func (l *Logger) Debug(val ...interface{}) { l.out(LevelDebug, fmt.Sprint(val...)) }
+
+// Debugf writes a formatted log of debug level.
+func (l *Logger) Debugf(format string, val ...interface{}) {
+	l.out(LevelDebug, fmt.Sprintf(format, val...))
+}
+
+// Info writes a log of info level.
+func (l *Logger) Info(val ...interface{}) { l.out(LevelInfo, fmt.Sprint(val...)) }
+
+// Infof writes a formatted log of info level.
+func (l *Logger) Infof(format string, val ...interface{}) {
+	l.out(LevelInfo, fmt.Sprintf(format, val...))
+}
+
+// Warn writes a log of warn level.
+func (l *Logger) Warn(val ...interface{}) { l.out(LevelWarn, fmt.Sprint(val...)) }
+
+// Warnf writes a formatted log of warn level.
+func (l *Logger) Warnf(format string, val ...interface{}) {
+	l.out(LevelWarn, fmt.Sprintf(format, val...))
+}
+
+// Error writes a log of error level.
+func (l *Logger) Error(val ...interface{}) { l.out(LevelError, fmt.Sprint(val...)) }
+
+// Errorf writes a formatted log of error level.
+func (l *Logger) Errorf(format string, val ...interface{}) {
+	l.out(LevelError, fmt.Sprintf(format, val...))
+}
+
+func (l *Logger) out(level Level, msg string) {
+	std.mu.RLock()
+	min, ok := std.levels[l.subsystem]
+	if !ok {
+		min = std.level
+	}
+	format, out := std.format, std.out
+	std.mu.RUnlock()
+
+	if level < min {
+		return
+	}
+
+	if format == FormatJSON {
+		l.json(out, level, msg)
+		return
+	}
+
+	for i := 0; i+1 < len(l.fields); i += 2 {
+		msg += fmt.Sprintf(" %v=%v", l.fields[i], l.fields[i+1])
+	}
+
+	switch level {
+	case LevelDebug:
+		glg.Debug(msg)
+	case LevelInfo:
+		glg.Info(msg)
+	case LevelWarn:
+		glg.Warn(msg)
+	default:
+		glg.Error(msg)
+	}
+}
+
+var jsonMu sync.Mutex
+
+func (l *Logger) json(out io.Writer, level Level, msg string) {
+	m := make(map[string]interface{}, len(l.fields)/2+4)
+	for i := 0; i+1 < len(l.fields); i += 2 {
+		v := l.fields[i+1]
+		if err, ok := v.(error); ok {
+			v = err.Error()
+		}
+		m[fmt.Sprint(l.fields[i])] = v
+	}
+	m["time"] = time.Now().Format(time.RFC3339Nano)
+	m["level"] = level.String()
+	m["subsystem"] = l.subsystem
+	m["msg"] = msg
+
+	b, err := json.Marshal(m)
+	if err != nil {
+		b, _ = json.Marshal(map[string]interface{}{
+			"time":      m["time"],
+			"level":     m["level"],
+			"subsystem": l.subsystem,
+			"msg":       msg,
+			"error":     err.Error(),
+		})
+	}
+
+	jsonMu.Lock()
+	out.Write(append(b, '\n'))
+	jsonMu.Unlock()
+}
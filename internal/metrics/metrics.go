@@ -0,0 +1,265 @@
+package metrics
+
+import (
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "gweather"
+
+var (
+	// FeedFetchDuration is the latency of downloading feeds.
+	FeedFetchDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "feed_fetch_duration_seconds",
+		Help:      "Latency of downloading feeds.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"feed"})
+
+	// FeedFetchStatus counts responses of feeds by status code. The code is "error" when no response is received.
+	FeedFetchStatus = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "feed_fetch_status_total",
+		Help:      "Number of responses of feeds by status code.",
+	}, []string{"feed", "code"})
+
+	// FeedLastSuccess is the unix time of the last successful poll of feeds.
+	FeedLastSuccess = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "feed_last_success_timestamp_seconds",
+		Help:      "Unix time of the last successful poll of feeds.",
+	}, []string{"feed"})
+
+	// Reports counts reports by title and result (downloaded, decoded or failed).
+	Reports = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "reports_total",
+		Help:      "Number of reports by title and result.",
+	}, []string{"title", "result"})
+
+	// EntriesSkipped counts entries whose reports are not downloaded because they are cached by the fetcher.
+	EntriesSkipped = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "entries_skipped_total",
+		Help:      "Number of entries skipped because their reports have been already fetched.",
+	}, []string{"feed"})
+
+	// ReportsInFlight is the number of reports being downloaded.
+	ReportsInFlight = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "reports_in_flight",
+		Help:      "Number of reports being downloaded.",
+	})
+
+	// StoreWriteDuration is the latency of writing reports to redis.
+	StoreWriteDuration = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "store_write_duration_seconds",
+		Help:      "Latency of writing reports to redis.",
+		Buckets:   prometheus.DefBuckets,
+	})
+
+	// StoreErrors counts errors of redis by operation.
+	StoreErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "store_errors_total",
+		Help:      "Number of errors of redis by operation.",
+	}, []string{"op"})
+
+	// StoreGeneration is the generation of the reports written last.
+	StoreGeneration = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "store_generation",
+		Help:      "Generation of the reports written last.",
+	})
+
+	// ScheduleSkipped is the number of the runs skipped because the previous run of the feed was running by feed.
+	ScheduleSkipped = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "schedule_skipped_total",
+		Help:      "Number of runs skipped because the previous run of the feed was running.",
+	}, []string{"feed"})
+
+	// ScheduleInterval is the current interval of the adaptive polls by feed.
+	ScheduleInterval = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "schedule_interval_seconds",
+		Help:      "Current interval of the adaptive polls of the feed.",
+	}, []string{"feed"})
+
+	// WebSubSubscribed is 1 while the subscription to the hub is verified by feed.
+	WebSubSubscribed = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "websub_subscribed",
+		Help:      "1 while the subscription of the feed to the hub is verified.",
+	}, []string{"feed"})
+
+	// WebSubDeliveries is the number of the deliveries from the hub by feed and result (accepted, invalid or dropped).
+	WebSubDeliveries = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "websub_deliveries_total",
+		Help:      "Number of the deliveries from the hub by result.",
+	}, []string{"feed", "result"})
+
+	// StreamClients is the number of the clients connected to the live stream by protocol (sse, websocket or grpc).
+	StreamClients = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "stream_clients",
+		Help:      "Number of the clients connected to the live stream by protocol.",
+	}, []string{"protocol"})
+
+	// StreamDropped counts the clients disconnected because they could not keep up with the live stream.
+	StreamDropped = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "stream_dropped_total",
+		Help:      "Number of the clients disconnected because they could not keep up with the live stream.",
+	})
+
+	// SinkMessages counts the events delivered to the sinks by sink and result (delivered, failed, trimmed or dropped).
+	SinkMessages = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "sink_messages_total",
+		Help:      "Number of the events delivered to the sinks by sink and result.",
+	}, []string{"sink", "result"})
+
+	// SinkLastDelivery is the unix time of the last delivery to the sinks.
+	SinkLastDelivery = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "sink_last_delivery_timestamp_seconds",
+		Help:      "Unix time of the last delivery to the sinks.",
+	}, []string{"sink"})
+
+	// MQTTMessages counts the messages to the MQTT broker by type (report or warning) and result (published or failed).
+	// Deprecated: it is kept for a release as the alias of SinkMessages of the mqtt sink, which also counts the trimmed and dropped events.
+	MQTTMessages = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "mqtt_messages_total",
+		Help:      "Number of the messages to the MQTT broker by type and result. Deprecated by gweather_sink_messages_total.",
+	}, []string{"type", "result"})
+
+	// MQTTConnected is 1 while the publisher is connected to the MQTT broker.
+	MQTTConnected = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "mqtt_connected",
+		Help:      "1 while the publisher is connected to the MQTT broker, 0 otherwise.",
+	})
+
+	// Leader is 1 while this replica is the leader.
+	Leader = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "leader",
+		Help:      "1 while this replica is the leader, 0 otherwise.",
+	})
+
+	// StoreBuffered is the number of reports buffered while redis is unavailable by location (memory or disk).
+	StoreBuffered = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "store_buffered_reports",
+		Help:      "Number of reports buffered while redis is unavailable by location.",
+	}, []string{"location"})
+
+	// StoreBufferDropped counts buffered reports dropped because the buffer is full or redis rejected them.
+	StoreBufferDropped = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "store_buffer_dropped_total",
+		Help:      "Number of buffered reports dropped because the buffer is full or redis rejected them.",
+	})
+
+	// StoreBufferFlushed counts buffered reports written to redis after it became available.
+	StoreBufferFlushed = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "store_buffer_flushed_total",
+		Help:      "Number of buffered reports written to redis after it became available.",
+	})
+
+	// StoreAvailable is 1 if the last write to redis succeeded, and 0 otherwise.
+	StoreAvailable = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "store_available",
+		Help:      "Whether the last write to redis succeeded.",
+	})
+)
+
+const (
+	// ResultDownloaded is the result of the report which is downloaded.
+	ResultDownloaded = "downloaded"
+
+	// ResultDecoded is the result of the report which is decoded.
+	ResultDecoded = "decoded"
+
+	// ResultFailed is the result of the report which could not be downloaded or decoded.
+	ResultFailed = "failed"
+
+	// ResultAccepted is the result of the delivery which is accepted.
+	ResultAccepted = "accepted"
+
+	// ResultInvalid is the result of the delivery which is ignored because of an invalid signature.
+	ResultInvalid = "invalid"
+
+	// ResultDropped is the result of the delivery which is dropped because too many deliveries are waiting.
+	ResultDropped = "dropped"
+
+	// ResultDelivered is the result of the event which is acknowledged by the sink.
+	ResultDelivered = "delivered"
+
+	// ResultTrimmed is the result of the event which is trimmed from the outbox before it is delivered to the sink.
+	ResultTrimmed = "trimmed"
+
+	// ResultPublished is the result of the message which is acknowledged by the MQTT broker.
+	ResultPublished = "published"
+)
+
+const (
+	// ProtocolSSE is the protocol of the clients of Server-Sent Events.
+	ProtocolSSE = "sse"
+
+	// ProtocolWebSocket is the protocol of the clients of WebSocket.
+	ProtocolWebSocket = "websocket"
+
+	// ProtocolGRPC is the protocol of the clients of the Subscribe call of the gRPC API.
+	ProtocolGRPC = "grpc"
+)
+
+const (
+	// LocationMemory is the location of the reports buffered in memory.
+	LocationMemory = "memory"
+
+	// LocationDisk is the location of the reports spilled to disk.
+	LocationDisk = "disk"
+)
+
+func init() {
+	prometheus.MustRegister(
+		FeedFetchDuration,
+		FeedFetchStatus,
+		FeedLastSuccess,
+		Reports,
+		EntriesSkipped,
+		ReportsInFlight,
+		StoreWriteDuration,
+		StoreErrors,
+		StoreGeneration,
+		StoreBuffered,
+		StoreBufferDropped,
+		StoreBufferFlushed,
+		StoreAvailable,
+		ScheduleSkipped,
+		ScheduleInterval,
+		WebSubSubscribed,
+		WebSubDeliveries,
+		StreamClients,
+		StreamDropped,
+		SinkMessages,
+		SinkLastDelivery,
+		MQTTMessages,
+		MQTTConnected,
+		Leader,
+	)
+}
+
+// Handler returns http.Handler which exposes the metrics.
+func Handler() http.Handler {
+	return promhttp.Handler()
+}
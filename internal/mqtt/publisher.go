@@ -0,0 +1,217 @@
+package mqtt
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	paho "github.com/eclipse/paho.mqtt.golang"
+	"github.com/pkg/errors"
+
+	"github.com/hlts2/gweather/internal/log"
+	"github.com/hlts2/gweather/internal/metrics"
+	"github.com/hlts2/gweather/internal/report"
+	"github.com/hlts2/gweather/internal/sink"
+	"github.com/hlts2/gweather/internal/store"
+	"github.com/hlts2/gweather/internal/tlsconfig"
+)
+
+const (
+	// publishTimeout is the timeout of the acknowledgement of a message by the broker.
+	publishTimeout = 10 * time.Second
+
+	// quiesce is the time in milliseconds to wait for the messages in flight on disconnecting.
+	quiesce = 1000
+
+	minRetry = time.Second
+	maxRetry = 30 * time.Second
+
+	// StatusOnline and StatusOffline are the retained messages of the status topic.
+	// StatusOffline is also the will of the connection, published by the broker when the connection is lost.
+	StatusOnline  = "online"
+	StatusOffline = "offline"
+)
+
+// Config represents the configuration of Publisher.
+type Config struct {
+	// Broker is the URL of the broker, e.g. tcp://127.0.0.1:1883. TLS is used for ssl://, tls://, mqtts:// and wss:// URLs.
+	Broker string
+
+	// ClientID is the client identifier, which is generated by the broker when it is empty.
+	ClientID string
+
+	Username string
+	Password string
+
+	// Topic is the root of the topics.
+	Topic string
+	QoS   byte
+
+	TLS tlsconfig.Options
+}
+
+// Publisher publishes the events of the reports written by the store to an MQTT broker.
+// It implements sink.Sink, and connects to the broker by Connect.
+//
+// The messages are retained, so that a client receives the current state on subscribing:
+//
+//	<topic>/report/<key>                           the latest report of the key
+//	<topic>/warning/<area code>/<warning kind code> the latest transition of the warning in the area while it is active
+//	<topic>/status                                 online, or offline when the publisher is disconnected
+//
+// A lifted warning is published without retaining, followed by an empty retained message which clears the retained transition.
+type Publisher struct {
+	client paho.Client
+	broker string
+	topic  string
+	qos    byte
+}
+
+// New returns Publisher configured by cfg. It connects to the broker by Connect.
+func New(cfg Config) (*Publisher, error) {
+	tc, err := cfg.TLS.Config()
+	if err != nil {
+		return nil, err
+	}
+
+	p := &Publisher{
+		broker: cfg.Broker,
+		topic:  strings.TrimSuffix(cfg.Topic, "/"),
+		qos:    cfg.QoS,
+	}
+
+	l := log.New(log.SubsystemNotifier).With("broker", p.broker)
+
+	opts := paho.NewClientOptions().
+		AddBroker(cfg.Broker).
+		SetClientID(cfg.ClientID).
+		SetUsername(cfg.Username).
+		SetPassword(cfg.Password).
+		SetTLSConfig(tc).
+		SetWill(p.topic+"/status", StatusOffline, cfg.QoS, true).
+		SetAutoReconnect(true).
+		SetMaxReconnectInterval(maxRetry).
+		SetOnConnectHandler(func(c paho.Client) {
+			metrics.MQTTConnected.Set(1)
+			l.Info("Connected to MQTT broker")
+			c.Publish(p.topic+"/status", p.qos, true, StatusOnline)
+		}).
+		SetConnectionLostHandler(func(_ paho.Client, err error) {
+			metrics.MQTTConnected.Set(0)
+			l.Warnf("Lost connection to MQTT broker, reconnecting: %v", err)
+		})
+
+	p.client = paho.NewClient(opts)
+	return p, nil
+}
+
+// Name returns the name of the sink.
+func (p *Publisher) Name() string {
+	return "mqtt"
+}
+
+// Connect connects to the broker until it succeeds or ctx is canceled. The client reconnects by itself afterwards,
+// and the messages of QoS 1 and 2 in flight are sent on reconnecting.
+func (p *Publisher) Connect(ctx context.Context) {
+	l := log.New(log.SubsystemNotifier).With("broker", p.broker)
+	retry := minRetry
+
+	for {
+		t := p.client.Connect()
+		select {
+		case <-t.Done():
+		case <-ctx.Done():
+			return
+		}
+		err := t.Error()
+		if err == nil {
+			return
+		}
+		l.Warnf("faild to connect to MQTT broker, retry in %v: %v", retry, err)
+
+		select {
+		case <-time.After(retry):
+		case <-ctx.Done():
+			return
+		}
+
+		if retry *= 2; retry > maxRetry {
+			retry = maxRetry
+		}
+	}
+}
+
+// Write publishes the messages in order, and waits for the acknowledgements by the broker.
+// It fails while the publisher is disconnected, so that the messages are written again after reconnecting.
+func (p *Publisher) Write(ctx context.Context, msgs []*sink.Message) error {
+	if !p.client.IsConnectionOpen() {
+		return errors.Errorf("not connected to MQTT broker: %s", p.broker)
+	}
+
+	topics := make([]string, 0, len(msgs))
+	ts := make([]paho.Token, 0, len(msgs))
+	for _, m := range msgs {
+		topic := p.eventTopic(m.Event)
+		if w := m.Event.Warning; w != nil && w.Transition == report.TransitionLifted {
+			topics = append(topics, topic)
+			ts = append(ts, p.client.Publish(topic, p.qos, false, m.Value))
+
+			// The empty retained message deletes the retained transition, so that the new subscribers don't receive the lifted warning.
+			topics = append(topics, topic)
+			ts = append(ts, p.client.Publish(topic, p.qos, true, []byte{}))
+			continue
+		}
+
+		topics = append(topics, topic)
+		ts = append(ts, p.client.Publish(topic, p.qos, true, m.Value))
+	}
+	for i, t := range ts {
+		if err := wait(t); err != nil {
+			count(msgs, metrics.ResultFailed)
+			return errors.Wrapf(err, "faild to publish event to MQTT broker: %s", topics[i])
+		}
+	}
+	count(msgs, metrics.ResultPublished)
+	return nil
+}
+
+// count counts the messages by the type of the event in the deprecated metric of the messages.
+func count(msgs []*sink.Message, result string) {
+	for _, m := range msgs {
+		metrics.MQTTMessages.WithLabelValues(m.Event.Type, result).Inc()
+	}
+}
+
+// Close publishes the offline status and disconnects from the broker.
+func (p *Publisher) Close() error {
+	// The will is published by the broker only when the connection is lost, so the status is published on closing it.
+	if p.client.IsConnectionOpen() {
+		if err := wait(p.client.Publish(p.topic+"/status", p.qos, true, StatusOffline)); err != nil {
+			log.New(log.SubsystemNotifier).Warnf("faild to publish offline status to MQTT broker: %v", err)
+		}
+	}
+	p.client.Disconnect(quiesce)
+	metrics.MQTTConnected.Set(0)
+	return nil
+}
+
+// eventTopic returns the topic of the event.
+func (p *Publisher) eventTopic(ev *store.Event) string {
+	if w := ev.Warning; w != nil {
+		return p.topic + "/warning/" + level(w.Area) + "/" + level(w.Code)
+	}
+	return p.topic + "/report/" + level(ev.Key)
+}
+
+// wait waits for the acknowledgement of the message. A message which is not acknowledged in time may be sent later by the client.
+func wait(t paho.Token) error {
+	if !t.WaitTimeout(publishTimeout) {
+		return errors.New("timeout waiting for acknowledgement")
+	}
+	return t.Error()
+}
+
+// level returns s as a level of a topic, replacing the separator and the wildcards.
+func level(s string) string {
+	return strings.NewReplacer("/", "_", "+", "_", "#", "_").Replace(s)
+}
@@ -0,0 +1,106 @@
+package mqtt
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	paho "github.com/eclipse/paho.mqtt.golang"
+
+	"github.com/hlts2/gweather/internal/report"
+	"github.com/hlts2/gweather/internal/sink"
+	"github.com/hlts2/gweather/internal/store"
+)
+
+// doneToken is paho.Token which has completed.
+type doneToken struct{}
+
+func (doneToken) Wait() bool                     { return true }
+func (doneToken) WaitTimeout(time.Duration) bool { return true }
+func (doneToken) Error() error                   { return nil }
+
+func (doneToken) Done() <-chan struct{} {
+	c := make(chan struct{})
+	close(c)
+	return c
+}
+
+type message struct {
+	topic    string
+	retained bool
+	payload  string
+}
+
+// fakeClient is paho.Client which records the published messages.
+type fakeClient struct {
+	paho.Client
+	msgs []message
+}
+
+func (c *fakeClient) IsConnectionOpen() bool { return true }
+
+func (c *fakeClient) Publish(topic string, qos byte, retained bool, payload interface{}) paho.Token {
+	var s string
+	switch p := payload.(type) {
+	case string:
+		s = p
+	case []byte:
+		s = string(p)
+	}
+	c.msgs = append(c.msgs, message{topic: topic, retained: retained, payload: s})
+	return doneToken{}
+}
+
+func warningMessage(transition string) *sink.Message {
+	return &sink.Message{
+		Key: "030010",
+		Event: &store.Event{
+			Type: store.EventWarning,
+			Key:  "気象特別警報・警報・注意報_盛岡地方気象台",
+			Warning: &report.Transition{
+				Transition: transition,
+				Area:       "030010",
+				Code:       "14",
+			},
+		},
+		Value: []byte(transition),
+	}
+}
+
+func TestWrite(t *testing.T) {
+	c := new(fakeClient)
+	p := &Publisher{client: c, topic: "gweather"}
+
+	err := p.Write(context.Background(), []*sink.Message{
+		{
+			Key: "030010",
+			Event: &store.Event{
+				Type: store.EventReport,
+				Key:  "気象特別警報・警報・注意報/盛岡地方気象台",
+			},
+			Value: []byte("report"),
+		},
+		warningMessage(report.TransitionIssued),
+		warningMessage(report.TransitionLifted),
+	})
+	if err != nil {
+		t.Fatalf("Write returns error: %v", err)
+	}
+
+	want := []message{
+		{topic: "gweather/report/気象特別警報・警報・注意報_盛岡地方気象台", retained: true, payload: "report"},
+		{topic: "gweather/warning/030010/14", retained: true, payload: report.TransitionIssued},
+		// The lifted warning is not retained, and the retained transition is cleared by the empty message.
+		{topic: "gweather/warning/030010/14", payload: report.TransitionLifted},
+		{topic: "gweather/warning/030010/14", retained: true},
+	}
+
+	if len(c.msgs) != len(want) {
+		t.Fatalf("published messages are %v, want %v", c.msgs, want)
+	}
+	for i, m := range c.msgs {
+		if m != want[i] {
+			t.Errorf("message %d is %v, want %v", i, m, want[i])
+		}
+	}
+}
@@ -0,0 +1,189 @@
+package nats
+
+import (
+	"context"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	natsgo "github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+	"github.com/pkg/errors"
+
+	"github.com/hlts2/gweather/internal/log"
+	"github.com/hlts2/gweather/internal/sink"
+	"github.com/hlts2/gweather/internal/store"
+	"github.com/hlts2/gweather/internal/tlsconfig"
+)
+
+// publishTimeout is the timeout of the acknowledgements of a batch of messages by JetStream.
+const publishTimeout = 10 * time.Second
+
+// Config represents the configuration of Publisher.
+type Config struct {
+	// URL is the comma separated URLs of the servers, e.g. nats://127.0.0.1:4222.
+	URL string
+
+	Username string
+	Password string
+
+	// Subject is the root of the subjects.
+	Subject string
+
+	// Stream is the name of the JetStream stream which is created or updated to store the subjects. The stream is not managed when it is empty.
+	Stream string
+
+	TLS tlsconfig.Options
+}
+
+// Publisher publishes the events of the reports written by the store to NATS JetStream.
+// It implements sink.Sink, and the messages of an area are published to the subjects of the area:
+//
+//	<subject>.report.<area code>                           a new report of the first area of the report
+//	<subject>.warning.<area code>.<warning kind code>      a transition of the warning in the area
+//
+// The ID of the entry in the outbox is set to Nats-Msg-Id, so that JetStream drops the duplicates written again.
+type Publisher struct {
+	conn    *natsgo.Conn
+	js      jetstream.JetStream
+	subject string
+	stream  string
+
+	mu sync.Mutex
+
+	// ensured is true when the stream has been created or updated.
+	ensured bool
+}
+
+// New returns Publisher configured by cfg. The connection is retried in background while the servers are unavailable.
+func New(cfg Config) (*Publisher, error) {
+	l := log.New(log.SubsystemNotifier).With("url", cfg.URL)
+
+	opts := []natsgo.Option{
+		natsgo.Name("gweather"),
+		natsgo.MaxReconnects(-1),
+		natsgo.RetryOnFailedConnect(true),
+		natsgo.ConnectHandler(func(*natsgo.Conn) {
+			l.Info("Connected to NATS")
+		}),
+		natsgo.ReconnectHandler(func(*natsgo.Conn) {
+			l.Info("Reconnected to NATS")
+		}),
+		natsgo.DisconnectErrHandler(func(_ *natsgo.Conn, err error) {
+			if err != nil {
+				l.Warnf("Lost connection to NATS, reconnecting: %v", err)
+			}
+		}),
+	}
+	if cfg.Username != "" {
+		opts = append(opts, natsgo.UserInfo(cfg.Username, cfg.Password))
+	}
+	if u, err := url.Parse(strings.Split(cfg.URL, ",")[0]); (err == nil && u.Scheme == "tls") || cfg.TLS != (tlsconfig.Options{}) {
+		tc, err := cfg.TLS.Config()
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, natsgo.Secure(tc))
+	}
+
+	conn, err := natsgo.Connect(cfg.URL, opts...)
+	if err != nil {
+		return nil, errors.Wrapf(err, "faild to connect to NATS: %s", cfg.URL)
+	}
+
+	js, err := jetstream.New(conn)
+	if err != nil {
+		conn.Close()
+		return nil, errors.Wrap(err, "faild to create JetStream context")
+	}
+
+	return &Publisher{
+		conn:    conn,
+		js:      js,
+		subject: strings.TrimSuffix(cfg.Subject, "."),
+		stream:  cfg.Stream,
+	}, nil
+}
+
+// Name returns the name of the sink.
+func (p *Publisher) Name() string {
+	return "nats"
+}
+
+// Write publishes the messages in order, and waits for the acknowledgements by JetStream.
+func (p *Publisher) Write(ctx context.Context, msgs []*sink.Message) error {
+	if err := p.ensureStream(ctx); err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, publishTimeout)
+	defer cancel()
+
+	fs := make([]jetstream.PubAckFuture, len(msgs))
+	for i, m := range msgs {
+		msg := natsgo.NewMsg(p.eventSubject(m))
+		msg.Data = m.Value
+		msg.Header.Set("Gweather-Event-Type", m.Event.Type)
+		msg.Header.Set("Gweather-Event-Id", m.Event.ID)
+
+		f, err := p.js.PublishMsgAsync(msg, jetstream.WithMsgID(m.ID))
+		if err != nil {
+			return errors.Wrapf(err, "faild to publish event to NATS: %s", msg.Subject)
+		}
+		fs[i] = f
+	}
+
+	for _, f := range fs {
+		select {
+		case <-f.Ok():
+		case err := <-f.Err():
+			return errors.Wrapf(err, "faild to publish event to NATS: %s", f.Msg().Subject)
+		case <-ctx.Done():
+			return errors.Wrap(ctx.Err(), "timeout waiting for acknowledgement")
+		}
+	}
+	return nil
+}
+
+// Close flushes the messages and closes the connection.
+func (p *Publisher) Close() error {
+	return errors.Wrap(p.conn.Drain(), "faild to drain NATS connection")
+}
+
+// ensureStream creates or updates the stream of the subjects once if it is configured.
+func (p *Publisher) ensureStream(ctx context.Context) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.stream == "" || p.ensured {
+		return nil
+	}
+
+	_, err := p.js.CreateOrUpdateStream(ctx, jetstream.StreamConfig{
+		Name:     p.stream,
+		Subjects: []string{p.subject + ".>"},
+	})
+	if err != nil {
+		return errors.Wrapf(err, "faild to create or update stream: %s", p.stream)
+	}
+
+	p.ensured = true
+	return nil
+}
+
+// eventSubject returns the subject of the message.
+func (p *Publisher) eventSubject(m *sink.Message) string {
+	if w := m.Event.Warning; w != nil {
+		return p.subject + "." + store.EventWarning + "." + token(w.Area) + "." + token(w.Code)
+	}
+	return p.subject + "." + store.EventReport + "." + token(m.Key)
+}
+
+// token returns s as a token of a subject, replacing the separator, the wildcards and the whitespaces.
+func token(s string) string {
+	if s == "" {
+		return "_"
+	}
+	return strings.NewReplacer(".", "_", "*", "_", ">", "_", " ", "_", "\t", "_").Replace(s)
+}
@@ -0,0 +1,103 @@
+package printer
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/pkg/errors"
+
+	"github.com/hlts2/gweather/internal/report"
+	"github.com/hlts2/gweather/internal/store"
+)
+
+const (
+	// FormatJSON prints reports as a JSON array.
+	FormatJSON = "json"
+
+	// FormatNDJSON prints reports as newline delimited JSON.
+	FormatNDJSON = "ndjson"
+
+	// FormatTable prints reports as a human-readable table.
+	FormatTable = "table"
+)
+
+// Report represents a report to print with its key.
+type Report struct {
+	Key  string                 `json:"key"`
+	Data map[string]interface{} `json:"data"`
+}
+
+// Print writes reports to w in the format.
+func Print(w io.Writer, format string, reports []Report) error {
+	switch format {
+	case FormatJSON:
+		if reports == nil {
+			reports = []Report{}
+		}
+
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "    ")
+		return errors.Wrap(enc.Encode(reports), "faild to encode json")
+
+	case FormatNDJSON:
+		enc := json.NewEncoder(w)
+		for _, r := range reports {
+			if err := enc.Encode(r); err != nil {
+				return errors.Wrap(err, "faild to encode json")
+			}
+		}
+		return nil
+
+	case FormatTable:
+		tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(tw, "TITLE\tOFFICE\tUPDATED\tAREAS\tKINDS")
+		for _, r := range reports {
+			areas, kinds := report.BodyCodes(r.Data["body"])
+			fmt.Fprintf(tw, "%v\t%v\t%v\t%s\t%s\n",
+				r.Data["title"], r.Data["name"], r.Data["updated"],
+				strings.Join(areas, ","), strings.Join(kinds, ","))
+		}
+		return errors.Wrap(tw.Flush(), "faild to flush table")
+
+	default:
+		return errors.Errorf("unknown format: %s", format)
+	}
+}
+
+// PrintWarnings writes the warnings active in an area to w in the format.
+func PrintWarnings(w io.Writer, format string, ws []*store.AreaWarning) error {
+	switch format {
+	case FormatJSON:
+		if ws == nil {
+			ws = []*store.AreaWarning{}
+		}
+
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "    ")
+		return errors.Wrap(enc.Encode(ws), "faild to encode json")
+
+	case FormatNDJSON:
+		enc := json.NewEncoder(w)
+		for _, aw := range ws {
+			if err := enc.Encode(aw); err != nil {
+				return errors.Wrap(err, "faild to encode json")
+			}
+		}
+		return nil
+
+	case FormatTable:
+		tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(tw, "AREA\tAREA NAME\tCODE\tNAME\tSTATUS\tISSUED\tNOTES")
+		for _, aw := range ws {
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+				aw.Area, aw.AreaName, aw.Code, aw.Name, aw.Status, aw.Issued, strings.Join(aw.Notes, ","))
+		}
+		return errors.Wrap(tw.Flush(), "faild to flush table")
+
+	default:
+		return errors.Errorf("unknown format: %s", format)
+	}
+}
@@ -0,0 +1,611 @@
+package redis
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/gomodule/redigo/redis"
+	"github.com/pkg/errors"
+	"go.uber.org/multierr"
+)
+
+// slots is the number of hash slots of Redis Cluster.
+const slots = 16384
+
+// cluster is Pool of the nodes of Redis Cluster.
+// Commands are routed to the node which serves the slot of their key.
+type cluster struct {
+	mu     sync.Mutex
+	seeds  []string
+	opts   Options
+	dialer *dialer
+	nodes  map[string]*redis.Pool
+	slots  [slots]string
+	loaded bool
+	stale  bool
+}
+
+func newCluster(u *url.URL, d *dialer, opts Options) (Pool, error) {
+	seeds, err := addrs(u)
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid nodes: %s", u.Host)
+	}
+
+	if d.db != 0 {
+		return nil, errors.New("database is not supported by cluster")
+	}
+
+	return &cluster{
+		seeds:  seeds,
+		opts:   opts,
+		dialer: d,
+		nodes:  make(map[string]*redis.Pool),
+	}, nil
+}
+
+// IsCluster reports whether p is the pool of Redis Cluster, whose transactions can't contain keys of different slots.
+func IsCluster(p Pool) bool {
+	switch p := p.(type) {
+	case *cluster:
+		return true
+	case *tracedPool:
+		return IsCluster(p.Pool)
+	}
+	return false
+}
+
+func (c *cluster) GetContext(ctx context.Context) (redis.Conn, error) {
+	c.mu.Lock()
+	refresh := !c.loaded || c.stale
+	c.mu.Unlock()
+
+	if refresh {
+		if err := c.refresh(ctx); err != nil {
+			return nil, err
+		}
+	}
+
+	return &clusterConn{
+		ctx:     ctx,
+		cluster: c,
+		conns:   make(map[string]redis.Conn),
+	}, nil
+}
+
+func (c *cluster) Close() (err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, p := range c.nodes {
+		err = multierr.Append(err, p.Close())
+	}
+	c.nodes = make(map[string]*redis.Pool)
+	return
+}
+
+// dedicated returns a connection to the node serving the slot of key.
+func (c *cluster) dedicated(ctx context.Context, key string) (redis.Conn, error) {
+	c.mu.Lock()
+	refresh := !c.loaded || c.stale
+	c.mu.Unlock()
+
+	if refresh {
+		if err := c.refresh(ctx); err != nil {
+			return nil, err
+		}
+	}
+	return c.node(c.addr(Slot(key))).GetContext(ctx)
+}
+
+// node returns the pool of the node of addr.
+func (c *cluster) node(addr string) *redis.Pool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	p, ok := c.nodes[addr]
+	if !ok {
+		p = newPool(c.opts, func() (redis.Conn, error) {
+			return c.dialer.dial(addr)
+		})
+		c.nodes[addr] = p
+	}
+	return p
+}
+
+// addr returns the address of the node serving the slot.
+func (c *cluster) addr(slot int) string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if addr := c.slots[slot]; addr != "" {
+		return addr
+	}
+	return c.seeds[0]
+}
+
+// moved updates the node of the slot by the redirection, and marks the slots to be reloaded.
+func (c *cluster) moved(slot int, addr string) {
+	c.mu.Lock()
+	c.slots[slot] = addr
+	c.stale = true
+	c.mu.Unlock()
+}
+
+// refresh loads the slots from the first node which answers CLUSTER SLOTS.
+func (c *cluster) refresh(ctx context.Context) error {
+	c.mu.Lock()
+	candidates := append([]string{}, c.seeds...)
+	for addr := range c.nodes {
+		candidates = append(candidates, addr)
+	}
+	c.mu.Unlock()
+
+	var lastErr error
+	for _, addr := range candidates {
+		table, err := c.querySlots(ctx, addr)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+
+		c.mu.Lock()
+		c.slots = table
+		c.loaded, c.stale = true, false
+		c.mu.Unlock()
+		return nil
+	}
+	return errors.Wrap(lastErr, "faild to load slots of cluster")
+}
+
+func (c *cluster) querySlots(ctx context.Context, addr string) (table [slots]string, err error) {
+	conn, err := c.node(addr).GetContext(ctx)
+	if err != nil {
+		return table, err
+	}
+	defer conn.Close()
+
+	ranges, err := redis.Values(conn.Do("CLUSTER", "SLOTS"))
+	if err != nil {
+		return table, errors.Wrap(err, "faild to write command: CLUSTER SLOTS")
+	}
+
+	host, _, _ := net.SplitHostPort(addr)
+
+	for _, r := range ranges {
+		vs, err := redis.Values(r, nil)
+		if err != nil || len(vs) < 3 {
+			return table, errors.Errorf("unexpected reply of CLUSTER SLOTS: %v", r)
+		}
+
+		start, err1 := redis.Int(vs[0], nil)
+		end, err2 := redis.Int(vs[1], nil)
+		master, err3 := redis.Values(vs[2], nil)
+		if err := multierr.Combine(err1, err2, err3); err != nil || len(master) < 2 || start < 0 || end >= slots {
+			return table, errors.Errorf("unexpected reply of CLUSTER SLOTS: %v", r)
+		}
+
+		ip, _ := redis.String(master[0], nil)
+		port, _ := redis.Int(master[1], nil)
+		if ip == "" {
+			// An empty address means the node which answered.
+			ip = host
+		}
+
+		for slot := start; slot <= end; slot++ {
+			table[slot] = net.JoinHostPort(ip, strconv.Itoa(port))
+		}
+	}
+	return table, nil
+}
+
+// clusterConn is redis.Conn which routes commands to the nodes of the cluster.
+// Replies of pipelined commands are received in the order of Send across the nodes.
+// A transaction (MULTI ... EXEC) is sent to the node of its first key, so its keys must share a hash tag (e.g. {user1000}.following),
+// and a command of a key in another slot is rejected.
+type clusterConn struct {
+	ctx     context.Context
+	cluster *cluster
+	conns   map[string]redis.Conn
+	pending []string
+	err     error
+
+	// multi is the index of MULTI in pending while the node of the transaction is not determined yet.
+	multi   int
+	inMulti bool
+	txNode  string
+
+	// txKey is the first key of the transaction, whose slot the other keys must belong to.
+	txKey string
+}
+
+func (c *clusterConn) conn(addr string) (redis.Conn, error) {
+	if conn, ok := c.conns[addr]; ok {
+		return conn, nil
+	}
+
+	conn, err := c.cluster.node(addr).GetContext(c.ctx)
+	if err != nil {
+		return nil, err
+	}
+	c.conns[addr] = conn
+	return conn, nil
+}
+
+func (c *clusterConn) Close() (err error) {
+	for _, conn := range c.conns {
+		err = multierr.Append(err, conn.Close())
+	}
+	c.conns = nil
+	return
+}
+
+func (c *clusterConn) Err() error {
+	if c.err != nil {
+		return c.err
+	}
+	for _, conn := range c.conns {
+		if err := conn.Err(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *clusterConn) Send(cmd string, args ...interface{}) error {
+	if c.inMulti {
+		if err := c.checkSlot(cmd, args); err != nil {
+			return err
+		}
+	}
+
+	addr, err := c.route(cmd, args)
+	if err != nil {
+		return err
+	}
+
+	switch strings.ToUpper(cmd) {
+	case "MULTI":
+		// MULTI is sent with the first command of the transaction whose key determines the node.
+		c.inMulti, c.txNode, c.txKey, c.multi = true, "", "", len(c.pending)
+		c.pending = append(c.pending, "")
+		return nil
+	case "EXEC", "DISCARD":
+		c.inMulti = false
+	}
+
+	if err := c.beginMulti(addr); err != nil {
+		return err
+	}
+
+	conn, err := c.conn(addr)
+	if err != nil {
+		return err
+	}
+
+	if err := conn.Send(cmd, args...); err != nil {
+		c.err = err
+		return err
+	}
+	c.pending = append(c.pending, addr)
+	return nil
+}
+
+// checkSlot returns an error if a key of the command belongs to a slot other than the first key of the transaction.
+func (c *clusterConn) checkSlot(cmd string, args []interface{}) error {
+	for _, key := range commandKeys(cmd, args) {
+		if c.txKey == "" {
+			c.txKey = key
+			continue
+		}
+		if Slot(key) != Slot(c.txKey) {
+			return errors.Errorf("keys of a transaction must share a hash tag in cluster: %s and %s", c.txKey, key)
+		}
+	}
+	return nil
+}
+
+// beginMulti sends MULTI to the node of addr if a transaction has been started but not sent yet.
+func (c *clusterConn) beginMulti(addr string) error {
+	if c.txNode != "" || c.multi >= len(c.pending) || c.pending[c.multi] != "" {
+		return nil
+	}
+
+	conn, err := c.conn(addr)
+	if err != nil {
+		return err
+	}
+
+	if err := conn.Send("MULTI"); err != nil {
+		c.err = err
+		return err
+	}
+	c.pending[c.multi], c.txNode = addr, addr
+	return nil
+}
+
+// route returns the address of the node for the command.
+func (c *clusterConn) route(cmd string, args []interface{}) (string, error) {
+	if c.txNode != "" && (c.inMulti || strings.EqualFold(cmd, "EXEC") || strings.EqualFold(cmd, "DISCARD")) {
+		return c.txNode, nil
+	}
+
+	keys := commandKeys(cmd, args)
+	if len(keys) == 0 {
+		return c.cluster.addr(0), nil
+	}
+	return c.cluster.addr(Slot(keys[0])), nil
+}
+
+func (c *clusterConn) Flush() error {
+	for _, conn := range c.conns {
+		if err := conn.Flush(); err != nil {
+			c.err = err
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *clusterConn) Receive() (interface{}, error) {
+	if len(c.pending) == 0 {
+		return nil, errors.New("no pending reply")
+	}
+
+	addr := c.pending[0]
+	c.pending = c.pending[1:]
+	if c.multi > 0 {
+		c.multi--
+	}
+	if addr == "" {
+		// MULTI of a transaction without commands is never sent.
+		return "OK", nil
+	}
+
+	conn, err := c.conn(addr)
+	if err != nil {
+		return nil, err
+	}
+
+	reply, err := conn.Receive()
+	c.redirected(reply, err)
+	return reply, err
+}
+
+func (c *clusterConn) Do(cmd string, args ...interface{}) (interface{}, error) {
+	if len(c.pending) > 0 {
+		if err := c.Flush(); err != nil {
+			return nil, err
+		}
+
+		replies := make([]interface{}, 0, len(c.pending))
+		var rerr error
+		for len(c.pending) > 0 {
+			reply, err := c.Receive()
+			if err != nil {
+				if _, ok := err.(redis.Error); !ok {
+					return nil, err
+				}
+				if rerr == nil {
+					rerr = err
+				}
+			}
+			replies = append(replies, reply)
+		}
+
+		if cmd == "" {
+			return replies, nil
+		}
+		if rerr != nil {
+			return nil, rerr
+		}
+	}
+
+	if cmd == "" {
+		return nil, nil
+	}
+
+	if strings.EqualFold(cmd, "MGET") && len(args) > 1 {
+		return c.mget(args)
+	}
+
+	addr, err := c.route(cmd, args)
+	if err != nil {
+		return nil, err
+	}
+
+	return c.do(addr, cmd, args, true)
+}
+
+// do sends the command to the node of addr, and follows a redirection once.
+func (c *clusterConn) do(addr, cmd string, args []interface{}, follow bool) (interface{}, error) {
+	conn, err := c.conn(addr)
+	if err != nil {
+		return nil, err
+	}
+
+	reply, err := conn.Do(cmd, args...)
+
+	to, ask := c.redirected(reply, err)
+	if to == "" || !follow {
+		return reply, err
+	}
+
+	if ask {
+		conn, err := c.conn(to)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := conn.Do("ASKING"); err != nil {
+			return nil, err
+		}
+	}
+	return c.do(to, cmd, args, false)
+}
+
+// redirected returns the address of the node of MOVED or ASK error, and records the node of the slot.
+func (c *clusterConn) redirected(reply interface{}, err error) (addr string, ask bool) {
+	rerr, ok := err.(redis.Error)
+	if !ok {
+		return "", false
+	}
+
+	fields := strings.Fields(string(rerr))
+	if len(fields) != 3 || (fields[0] != "MOVED" && fields[0] != "ASK") {
+		return "", false
+	}
+
+	if fields[0] == "MOVED" {
+		if slot, err := strconv.Atoi(fields[1]); err == nil && slot >= 0 && slot < slots {
+			c.cluster.moved(slot, fields[2])
+		}
+	}
+	return fields[2], fields[0] == "ASK"
+}
+
+// mget gets the keys by MGET of each slot in a pipeline, and returns the values in the order of the keys.
+func (c *clusterConn) mget(keys []interface{}) (interface{}, error) {
+	type group struct {
+		addr string
+		idx  []int
+		args []interface{}
+	}
+
+	var groups []*group
+	bySlot := make(map[int]*group)
+	for i, key := range keys {
+		slot := Slot(toString(key))
+
+		g, ok := bySlot[slot]
+		if !ok {
+			g = &group{
+				addr: c.cluster.addr(slot),
+			}
+			bySlot[slot] = g
+			groups = append(groups, g)
+		}
+		g.idx = append(g.idx, i)
+		g.args = append(g.args, key)
+	}
+
+	for _, g := range groups {
+		if err := c.Send("MGET", g.args...); err != nil {
+			return nil, err
+		}
+	}
+
+	replies, err := redis.Values(c.Do(""))
+	if err != nil {
+		return nil, err
+	}
+
+	values := make([]interface{}, len(keys))
+	for i, g := range groups {
+		vs, err := redis.Values(replies[i], nil)
+		if err != nil {
+			// The slot has been moved, so the keys are got from the new node.
+			if vs, err = redis.Values(c.do(g.addr, "MGET", g.args, true)); err != nil {
+				return nil, err
+			}
+		}
+
+		for j, k := range g.idx {
+			if j < len(vs) {
+				values[k] = vs[j]
+			}
+		}
+	}
+	return values, nil
+}
+
+// commandKeys returns the keys of the command.
+func commandKeys(cmd string, args []interface{}) []string {
+	var keys []interface{}
+
+	switch strings.ToUpper(cmd) {
+	case "", "PING", "INFO", "ROLE", "MULTI", "EXEC", "DISCARD", "CLUSTER", "SCRIPT", "ASKING", "TIME", "ECHO":
+		return nil
+	case "MGET", "DEL", "EXISTS", "UNLINK", "TOUCH", "WATCH":
+		keys = args
+	case "MSET", "MSETNX":
+		for i := 0; i < len(args); i += 2 {
+			keys = append(keys, args[i])
+		}
+	case "XGROUP":
+		// e.g. XGROUP CREATE key group id
+		if len(args) > 1 {
+			keys = args[1:2]
+		}
+	case "XREAD", "XREADGROUP":
+		// The keys are followed by their IDs after STREAMS.
+		for i, arg := range args {
+			if strings.ToUpper(toString(arg)) == "STREAMS" {
+				rest := args[i+1:]
+				keys = rest[:len(rest)/2]
+				break
+			}
+		}
+	case "EVAL", "EVALSHA":
+		if len(args) > 1 {
+			if n, err := strconv.Atoi(toString(args[1])); err == nil && n > 0 && len(args) >= 2+n {
+				keys = args[2 : 2+n]
+			}
+		}
+	default:
+		if len(args) > 0 {
+			keys = args[:1]
+		}
+	}
+
+	ks := make([]string, 0, len(keys))
+	for _, k := range keys {
+		ks = append(ks, toString(k))
+	}
+	return ks
+}
+
+func toString(v interface{}) string {
+	switch v := v.(type) {
+	case string:
+		return v
+	case []byte:
+		return string(v)
+	default:
+		// e.g. the number of keys of EVAL given as int.
+		if s, err := redis.String(v, nil); err == nil {
+			return s
+		}
+		return fmt.Sprint(v)
+	}
+}
+
+// Slot returns the hash slot of the key in Redis Cluster.
+// Only the hash tag between the first { and the following } is hashed if it is not empty.
+func Slot(key string) int {
+	if s := strings.IndexByte(key, '{'); s >= 0 {
+		if e := strings.IndexByte(key[s+1:], '}'); e > 0 {
+			key = key[s+1 : s+1+e]
+		}
+	}
+	return int(crc16(key)) % slots
+}
+
+// crc16 returns CRC16-XMODEM of s used by Redis Cluster.
+func crc16(s string) uint16 {
+	var crc uint16
+	for i := 0; i < len(s); i++ {
+		crc ^= uint16(s[i]) << 8
+		for j := 0; j < 8; j++ {
+			if crc&0x8000 != 0 {
+				crc = crc<<1 ^ 0x1021
+			} else {
+				crc <<= 1
+			}
+		}
+	}
+	return crc
+}
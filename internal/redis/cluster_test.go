@@ -0,0 +1,151 @@
+package redis
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/gomodule/redigo/redis"
+)
+
+func TestSlot(t *testing.T) {
+	tests := []struct {
+		key  string
+		want int
+	}{
+		{key: "123456789", want: 12739},
+		{key: "foo", want: 12182},
+		{key: "{foo}.bar", want: 12182},
+		{key: "bar{foo}", want: 12182},
+		{key: "{foo}{bar}", want: 12182},
+		// An empty hash tag is not a hash tag, so the whole key is hashed.
+		{key: "{}foo", want: int(crc16("{}foo")) % slots},
+		{key: "foo{", want: int(crc16("foo{")) % slots},
+	}
+
+	for _, tt := range tests {
+		if got := Slot(tt.key); got != tt.want {
+			t.Errorf("Slot(%q) is %d, want %d", tt.key, got, tt.want)
+		}
+	}
+
+	// The keys sharing a hash tag belong to the same slot.
+	if Slot("{user1000}.following") != Slot("{user1000}.followers") {
+		t.Error("keys sharing hash tag belong to different slots")
+	}
+	if Slot("user1000.following") == Slot("user1000.followers") {
+		t.Error("keys without hash tag belong to the same slot")
+	}
+}
+
+func TestCommandKeys(t *testing.T) {
+	tests := []struct {
+		cmd  string
+		args []interface{}
+		want []string
+	}{
+		{cmd: "GET", args: []interface{}{"a"}, want: []string{"a"}},
+		{cmd: "set", args: []interface{}{[]byte("a"), "1"}, want: []string{"a"}},
+		{cmd: "PING", want: nil},
+		{cmd: "MULTI", want: nil},
+		{cmd: "DEL", args: []interface{}{"a", "b"}, want: []string{"a", "b"}},
+		{cmd: "MGET", args: []interface{}{"a", "b"}, want: []string{"a", "b"}},
+		{cmd: "MSET", args: []interface{}{"a", "1", "b", "2"}, want: []string{"a", "b"}},
+		{cmd: "XGROUP", args: []interface{}{"CREATE", "s", "g", "$"}, want: []string{"s"}},
+		{cmd: "XREADGROUP", args: []interface{}{"GROUP", "g", "c", "COUNT", 10, "STREAMS", "s1", "s2", ">", ">"}, want: []string{"s1", "s2"}},
+		{cmd: "XREAD", args: []interface{}{"BLOCK", 0, "STREAMS", "s", "$"}, want: []string{"s"}},
+		{cmd: "EVALSHA", args: []interface{}{"sha", 2, "a", "b", "arg"}, want: []string{"a", "b"}},
+		{cmd: "EVAL", args: []interface{}{"return 1", 0, "arg"}, want: []string{}},
+	}
+
+	for _, tt := range tests {
+		got := commandKeys(tt.cmd, tt.args)
+		if len(got) == 0 && len(tt.want) == 0 {
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("keys of %s %v are %v, want %v", tt.cmd, tt.args, got, tt.want)
+		}
+	}
+}
+
+func TestClusterTransaction(t *testing.T) {
+	// miniredis answers CLUSTER SLOTS as a cluster of a node serving all slots.
+	s := miniredis.RunT(t)
+
+	pool, err := New("redis-cluster://"+s.Addr(), Options{})
+	if err != nil {
+		t.Fatalf("New returns error: %v", err)
+	}
+	defer pool.Close()
+
+	if !IsCluster(pool) {
+		t.Fatal("pool is not cluster")
+	}
+
+	tests := []struct {
+		name    string
+		keys    []string
+		wantErr bool
+	}{
+		{name: "hash tag", keys: []string{"{user1000}.following", "{user1000}.followers"}},
+		{name: "same key", keys: []string{"a", "a"}},
+		{name: "different slots", keys: []string{"user1000.following", "user1000.followers"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		conn, err := pool.GetContext(context.Background())
+		if err != nil {
+			t.Fatalf("faild to get connection: %v", err)
+		}
+
+		err = conn.Send("MULTI")
+		for _, key := range tt.keys {
+			if err == nil {
+				err = conn.Send("SET", key, tt.name)
+			}
+		}
+
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("%s: transaction is not rejected", tt.name)
+			}
+			conn.Close()
+			continue
+		}
+		if err != nil {
+			t.Fatalf("%s: Send returns error: %v", tt.name, err)
+		}
+
+		if err := conn.Send("EXEC"); err != nil {
+			t.Fatalf("%s: Send returns error: %v", tt.name, err)
+		}
+		if _, err := conn.Do(""); err != nil {
+			t.Errorf("%s: transaction returns error: %v", tt.name, err)
+		}
+		conn.Close()
+
+		for _, key := range tt.keys {
+			if v, _ := s.Get(key); v != tt.name {
+				t.Errorf("%s: %s is %q, want %q", tt.name, key, v, tt.name)
+			}
+		}
+	}
+
+	// The keys of the rejected transaction are not written.
+	if s.Exists("user1000.following") || s.Exists("user1000.followers") {
+		t.Error("keys of rejected transaction are written")
+	}
+
+	// A connection is reusable after the rejected transaction.
+	conn, err := pool.GetContext(context.Background())
+	if err != nil {
+		t.Fatalf("faild to get connection: %v", err)
+	}
+	defer conn.Close()
+
+	if v, err := redis.String(conn.Do("GET", "a")); err != nil || v != "same key" {
+		t.Errorf("GET returns %q, %v after rejected transaction", v, err)
+	}
+}
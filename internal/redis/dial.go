@@ -0,0 +1,181 @@
+package redis
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	stderrors "errors"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+	"github.com/pkg/errors"
+
+	"github.com/hlts2/gweather/internal/tlsconfig"
+)
+
+// dialTimeout is the timeout of connecting to a server.
+const dialTimeout = 10 * time.Second
+
+// TLSOptions represents the options of TLS connections.
+type TLSOptions struct {
+	// Enabled enables TLS for redis-sentinel:// and redis-cluster:// URLs. TLS is always used for rediss:// URLs.
+	Enabled bool
+
+	// CAFile is the PEM file of the certificate authorities to verify the server. The system pool is used when it is empty.
+	CAFile string
+
+	// CertFile and KeyFile are the PEM files of the client certificate.
+	CertFile string
+	KeyFile  string
+
+	ServerName         string
+	InsecureSkipVerify bool
+}
+
+// config returns tls.Config of the options.
+func (o TLSOptions) config() (*tls.Config, error) {
+	return tlsconfig.Options{
+		CAFile:             o.CAFile,
+		CertFile:           o.CertFile,
+		KeyFile:            o.KeyFile,
+		ServerName:         o.ServerName,
+		InsecureSkipVerify: o.InsecureSkipVerify,
+	}.Config()
+}
+
+// dialer connects to servers with the credentials, the database and the TLS configuration.
+type dialer struct {
+	username string
+	password string
+	db       int
+	tls      *tls.Config
+}
+
+// newDialer returns dialer configured by u and opts. opts take precedence over u.
+func newDialer(u *url.URL, opts Options) (*dialer, error) {
+	d := new(dialer)
+
+	if u.User != nil {
+		d.username = u.User.Username()
+		d.password, _ = u.User.Password()
+	}
+	if opts.Username != "" {
+		d.username = opts.Username
+	}
+	if opts.Password != "" {
+		d.password = opts.Password
+	}
+
+	db, err := urlDB(u)
+	if err != nil {
+		return nil, err
+	}
+	d.db = db
+	if opts.DB != 0 {
+		d.db = opts.DB
+	}
+
+	if u.Scheme == "rediss" || opts.TLS.Enabled {
+		if d.tls, err = opts.TLS.config(); err != nil {
+			return nil, err
+		}
+	}
+
+	return d, nil
+}
+
+// urlDB returns the database of the path (e.g. redis://host/1) or the db parameter (e.g. ?db=1) of u.
+func urlDB(u *url.URL) (int, error) {
+	s := u.Query().Get("db")
+	if s == "" && (u.Scheme == "redis" || u.Scheme == "rediss") {
+		s = strings.Trim(u.Path, "/")
+	}
+	if s == "" {
+		return 0, nil
+	}
+
+	db, err := strconv.Atoi(s)
+	if err != nil || db < 0 {
+		return 0, errors.Errorf("invalid database: %s", s)
+	}
+	return db, nil
+}
+
+// dial connects to the server of addr, authenticates and selects the database.
+// Each step reports its own error so that the cause of a failure is clear.
+func (d *dialer) dial(addr string) (redis.Conn, error) {
+	opts := []redis.DialOption{
+		redis.DialConnectTimeout(dialTimeout),
+	}
+	if d.tls != nil {
+		// The host of addr is verified unless the server name is configured.
+		opts = append(opts, redis.DialUseTLS(true), redis.DialTLSConfig(d.tls))
+	}
+
+	c, err := redis.Dial("tcp", addr, opts...)
+	if err != nil {
+		return nil, connectError(err, addr, d.tls != nil)
+	}
+
+	if d.password != "" {
+		args := []interface{}{d.password}
+		if d.username != "" {
+			args = []interface{}{d.username, d.password}
+		}
+
+		if _, err := c.Do("AUTH", args...); err != nil {
+			c.Close()
+
+			user := d.username
+			if user == "" {
+				user = "default"
+			}
+			return nil, errors.Wrapf(err, "faild to authenticate to %s as user %s", addr, user)
+		}
+	}
+
+	if d.db != 0 {
+		if _, err := c.Do("SELECT", d.db); err != nil {
+			c.Close()
+			return nil, errors.Wrapf(err, "faild to select database %d on %s", d.db, addr)
+		}
+	}
+
+	if _, err := c.Do("PING"); err != nil {
+		c.Close()
+
+		if rerr, ok := err.(redis.Error); ok && strings.HasPrefix(string(rerr), "NOAUTH") {
+			return nil, errors.Wrapf(err, "authentication is required by %s, set the password", addr)
+		}
+		return nil, errors.Wrapf(err, "faild to write command to %s: PING", addr)
+	}
+	return c, nil
+}
+
+// connectError returns the error of connecting to addr describing the cause.
+// The causes are found by errors.As of the standard library, since github.com/pkg/errors 0.8 doesn't have it.
+func connectError(err error, addr string, useTLS bool) error {
+	var (
+		unknownAuthority x509.UnknownAuthorityError
+		hostname         x509.HostnameError
+		invalid          x509.CertificateInvalidError
+		recordHeader     tls.RecordHeaderError
+	)
+
+	switch {
+	case stderrors.As(err, &unknownAuthority):
+		return errors.Wrapf(err, "faild to verify TLS certificate of %s, the CA file may be missing", addr)
+	case stderrors.As(err, &hostname):
+		return errors.Wrapf(err, "faild to verify TLS certificate of %s, the server name does not match", addr)
+	case stderrors.As(err, &invalid):
+		return errors.Wrapf(err, "faild to verify TLS certificate of %s", addr)
+	case stderrors.As(err, &recordHeader):
+		return errors.Wrapf(err, "faild to handshake TLS with %s, the server may not accept TLS", addr)
+	case useTLS:
+		return errors.Wrapf(err, "faild to connect to %s with TLS", addr)
+	default:
+		return errors.Wrapf(err, "faild to connect to %s", addr)
+	}
+}
@@ -2,31 +2,120 @@ package redis
 
 import (
 	"context"
+	"net"
+	"net/url"
+	"strings"
+	"time"
 
 	"github.com/gomodule/redigo/redis"
 	"github.com/pkg/errors"
 )
 
+const (
+	// SchemeSentinel is the URL scheme of the master managed by Redis Sentinel.
+	// e.g) redis-sentinel://:password@127.0.0.1:26379,127.0.0.1:26380/mymaster?db=0
+	SchemeSentinel = "redis-sentinel"
+
+	// SchemeCluster is the URL scheme of Redis Cluster.
+	// e.g) redis-cluster://:password@127.0.0.1:7000,127.0.0.1:7001
+	SchemeCluster = "redis-cluster"
+)
+
 // Pool manages a pool of connections of redis.
 type Pool interface {
 	GetContext(context.Context) (redis.Conn, error)
 	Close() error
 }
 
-// New returns Pool implementation.
-func New(url string) Pool {
+// Options represents the options of the pool.
+// See redis.Pool of redigo for the details of the pool sizes. The zero value leaves them at the defaults of redigo.
+type Options struct {
+	MaxIdle     int
+	MaxActive   int
+	IdleTimeout time.Duration
+	Wait        bool
+
+	// Username and Password override the credentials of the URL when they are not empty.
+	Username string
+	Password string
+
+	// DB overrides the database of the URL when it is not zero.
+	DB int
+
+	TLS TLSOptions
+}
+
+// New returns Pool implementation connecting to the URL.
+// The URL is a redis:// or rediss:// URL of a server, a redis-sentinel:// URL of the master managed by the sentinels,
+// or a redis-cluster:// URL of the nodes of the cluster.
+func New(rawurl string, opts Options) (Pool, error) {
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		return nil, errors.Wrapf(err, "faild to parse url: %v", rawurl)
+	}
+
+	d, err := newDialer(u, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	switch u.Scheme {
+	case SchemeSentinel:
+		return newSentinel(u, d, opts)
+	case SchemeCluster:
+		return newCluster(u, d, opts)
+	case "redis", "rediss":
+	default:
+		return nil, errors.Errorf("unsupported scheme: %s", u.Scheme)
+	}
+
+	addr := u.Host
+	if _, _, err := net.SplitHostPort(addr); err != nil {
+		addr = net.JoinHostPort(addr, "6379")
+	}
+
+	return newPool(opts, func() (redis.Conn, error) {
+		return d.dial(addr)
+	}), nil
+}
+
+// Dedicated returns a connection to a single server, whose replies are not paired with the commands, e.g. for SUBSCRIBE.
+// The connection of Redis Cluster is connected to the node serving the slot of key. The commands are not traced.
+func Dedicated(ctx context.Context, p Pool, key string) (redis.Conn, error) {
+	switch p := p.(type) {
+	case *cluster:
+		return p.dedicated(ctx, key)
+	case *tracedPool:
+		return Dedicated(ctx, p.Pool, key)
+	}
+	return p.GetContext(ctx)
+}
+
+func newPool(opts Options, dial func() (redis.Conn, error)) *redis.Pool {
 	return &redis.Pool{
-		Dial: func() (redis.Conn, error) {
-			c, err := redis.DialURL(url)
-			if err != nil {
-				return nil, errors.Wrapf(err, "faild to dial url: %v", url)
-			}
-
-			if _, err := c.Do("PING"); err != nil {
-				c.Close()
-				return nil, errors.Wrap(err, "faild to write command: PING")
-			}
-			return c, nil
-		},
+		Dial:        dial,
+		MaxIdle:     opts.MaxIdle,
+		MaxActive:   opts.MaxActive,
+		IdleTimeout: opts.IdleTimeout,
+		Wait:        opts.Wait,
+	}
+}
+
+// addrs returns the addresses of the comma separated hosts in u.
+func addrs(u *url.URL) ([]string, error) {
+	var as []string
+	for _, addr := range strings.Split(u.Host, ",") {
+		if addr = strings.TrimSpace(addr); addr == "" {
+			continue
+		}
+		if !strings.Contains(addr, ":") {
+			return nil, errors.Errorf("port is required: %s", addr)
+		}
+		as = append(as, addr)
+	}
+
+	if len(as) == 0 {
+		return nil, errors.New("no address")
 	}
+	return as, nil
 }
@@ -0,0 +1,140 @@
+package redis
+
+import (
+	"net"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+	"github.com/pkg/errors"
+)
+
+// roleCheckInterval is the interval of checking that an idle connection is still connected to the master.
+const roleCheckInterval = time.Second
+
+type sentinel struct {
+	mu        sync.Mutex
+	sentinels []string
+	master    string
+	dialer    *dialer
+}
+
+func newSentinel(u *url.URL, d *dialer, opts Options) (Pool, error) {
+	sentinels, err := addrs(u)
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid sentinels: %s", u.Host)
+	}
+
+	master := strings.Trim(u.Path, "/")
+	if master == "" {
+		return nil, errors.New("master name is required")
+	}
+
+	s := &sentinel{
+		sentinels: sentinels,
+		master:    master,
+		dialer:    d,
+	}
+
+	p := newPool(opts, func() (redis.Conn, error) {
+		addr, err := s.masterAddr()
+		if err != nil {
+			return nil, err
+		}
+
+		c, err := d.dial(addr)
+		if err != nil {
+			return nil, errors.Wrapf(err, "faild to dial master: %s", s.master)
+		}
+
+		// The sentinels may return the old master during a failover.
+		if err := checkRole(c); err != nil {
+			c.Close()
+			return nil, err
+		}
+		return c, nil
+	})
+
+	// A connection to the old master is closed after a failover, so the next one is dialed to the new master.
+	p.TestOnBorrow = func(c redis.Conn, t time.Time) error {
+		if time.Since(t) < roleCheckInterval {
+			return nil
+		}
+		return checkRole(c)
+	}
+
+	return p, nil
+}
+
+// masterAddr asks the sentinels for the address of the master.
+// The sentinel which answered is moved to the head so that it is asked first next time.
+func (s *sentinel) masterAddr() (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var lastErr error
+	for i, sentinel := range s.sentinels {
+		addr, err := s.queryMaster(sentinel)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+
+		copy(s.sentinels[1:i+1], s.sentinels[:i])
+		s.sentinels[0] = sentinel
+		return addr, nil
+	}
+	return "", errors.Wrapf(lastErr, "faild to get master from sentinels: %s", s.master)
+}
+
+// queryMaster asks the sentinel for the address of the master.
+// The sentinel is connected with TLS if it is enabled, but without the credentials of the master.
+func (s *sentinel) queryMaster(sentinel string) (string, error) {
+	opts := []redis.DialOption{
+		redis.DialConnectTimeout(time.Second),
+		redis.DialReadTimeout(time.Second),
+		redis.DialWriteTimeout(time.Second),
+	}
+	if s.dialer.tls != nil {
+		opts = append(opts, redis.DialUseTLS(true), redis.DialTLSConfig(s.dialer.tls))
+	}
+
+	c, err := redis.Dial("tcp", sentinel, opts...)
+	if err != nil {
+		return "", connectError(err, sentinel, s.dialer.tls != nil)
+	}
+	defer c.Close()
+
+	master := s.master
+
+	res, err := redis.Strings(c.Do("SENTINEL", "get-master-addr-by-name", master))
+	if err != nil {
+		return "", errors.Wrapf(err, "faild to write command: SENTINEL get-master-addr-by-name %s", master)
+	}
+	if len(res) != 2 {
+		return "", errors.Errorf("unexpected reply of sentinel: %v", res)
+	}
+	return net.JoinHostPort(res[0], res[1]), nil
+}
+
+func checkRole(c redis.Conn) error {
+	res, err := redis.Values(c.Do("ROLE"))
+	if err != nil {
+		return errors.Wrap(err, "faild to write command: ROLE")
+	}
+
+	if len(res) == 0 {
+		return errors.New("unexpected reply of ROLE")
+	}
+
+	role, err := redis.String(res[0], nil)
+	if err != nil {
+		return errors.Wrap(err, "unexpected reply of ROLE")
+	}
+	if role != "master" {
+		return errors.Errorf("not master: %s", role)
+	}
+	return nil
+}
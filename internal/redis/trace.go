@@ -0,0 +1,80 @@
+package redis
+
+import (
+	"context"
+	"strings"
+
+	"github.com/gomodule/redigo/redis"
+	"go.opentelemetry.io/otel/attribute"
+
+	"github.com/hlts2/gweather/internal/trace"
+)
+
+type tracedPool struct {
+	Pool
+}
+
+// WithTracing returns Pool whose connections trace every command and pipeline as a child of the span in the context.
+func WithTracing(p Pool) Pool {
+	return &tracedPool{
+		Pool: p,
+	}
+}
+
+func (p *tracedPool) GetContext(ctx context.Context) (redis.Conn, error) {
+	conn, err := p.Pool.GetContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &tracedConn{
+		Conn: conn,
+		ctx:  ctx,
+	}, nil
+}
+
+// tracedConn traces a command sent by Do as a span, and commands sent by Send as a span of the pipeline ended by Flush.
+type tracedConn struct {
+	redis.Conn
+	ctx     context.Context
+	pending []string
+}
+
+func (c *tracedConn) Do(cmd string, args ...interface{}) (interface{}, error) {
+	if cmd == "" {
+		// Do with no command flushes the pipeline and receives all pending replies.
+		_, span := c.start("pipeline", c.pending)
+		c.pending = nil
+
+		reply, err := c.Conn.Do(cmd, args...)
+		trace.End(span, err)
+		return reply, err
+	}
+
+	_, span := c.start(cmd, []string{cmd})
+	reply, err := c.Conn.Do(cmd, args...)
+	trace.End(span, err)
+	return reply, err
+}
+
+func (c *tracedConn) Send(cmd string, args ...interface{}) error {
+	c.pending = append(c.pending, cmd)
+	return c.Conn.Send(cmd, args...)
+}
+
+func (c *tracedConn) Flush() error {
+	_, span := c.start("pipeline", c.pending)
+	c.pending = nil
+
+	err := c.Conn.Flush()
+	trace.End(span, err)
+	return err
+}
+
+func (c *tracedConn) start(op string, cmds []string) (context.Context, trace.Span) {
+	return trace.Start(c.ctx, "redis "+op,
+		attribute.String("db.system", "redis"),
+		attribute.String("db.operation.name", op),
+		attribute.Int("db.operation.batch.size", len(cmds)),
+		attribute.String("db.query.text", strings.Join(cmds, " ")),
+	)
+}
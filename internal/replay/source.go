@@ -0,0 +1,205 @@
+package replay
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/xml"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/hlts2/gweather/internal/feed"
+)
+
+// Feed represents an archived feed file.
+type Feed struct {
+	// URL is the original URL of the feed, which is kept in the gzip header by the dir archive, or the self link of the feed.
+	// It is the file URL of the path if the feed has neither of them.
+	URL string
+
+	Path    string
+	Updated time.Time
+}
+
+// Source represents feed and report files archived in a local directory.
+// Both plain XML files (e.g. _tests/e2e/test_datas) and gzip compressed files
+// written by the dir archive are supported.
+type Source struct {
+	feeds []*Feed
+
+	// files maps the base name of documents to their path.
+	// e.g) 4eb2228e-262f-302f-892c-d7726f196984.xml => report/4eb2228e-262f-302f-892c-d7726f196984.xml.gz
+	files map[string]string
+
+	mu sync.Mutex
+
+	// selected maps the URLs of the feeds to the files selected to be replayed.
+	selected map[string]string
+}
+
+// Open reads all documents under dir and returns Source.
+func Open(dir string) (*Source, error) {
+	s := &Source{
+		files:    make(map[string]string),
+		selected: make(map[string]string),
+	}
+
+	err := filepath.Walk(dir, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		name := strings.TrimSuffix(info.Name(), ".gz")
+		if info.IsDir() || path.Ext(name) != ".xml" {
+			return nil
+		}
+		s.files[name] = p
+
+		data, orig, err := readFile(p)
+		if err != nil {
+			return err
+		}
+
+		f := new(feed.Feed)
+		if err := xml.Unmarshal(data, f); err != nil {
+			// It is not a feed but a report.
+			return nil
+		}
+
+		updated, err := time.Parse(time.RFC3339, f.Updated)
+		if err != nil {
+			updated = info.ModTime()
+		}
+
+		if orig == "" {
+			orig, err = feedURL(f, p)
+			if err != nil {
+				return err
+			}
+		}
+
+		s.feeds = append(s.feeds, &Feed{
+			URL:     orig,
+			Path:    p,
+			Updated: updated,
+		})
+		return nil
+	})
+	if err != nil {
+		return nil, errors.Wrapf(err, "faild to walk directory: %s", dir)
+	}
+
+	sort.SliceStable(s.feeds, func(i, j int) bool {
+		return s.feeds[i].Updated.Before(s.feeds[j].Updated)
+	})
+
+	return s, nil
+}
+
+// feedURL returns the self link of the feed, or the file URL of the absolute path p.
+func feedURL(f *feed.Feed, p string) (string, error) {
+	for _, l := range f.Links {
+		if l.Rel == "self" && l.Href != "" {
+			return l.Href, nil
+		}
+	}
+
+	abs, err := filepath.Abs(p)
+	if err != nil {
+		return "", errors.Wrapf(err, "faild to get absolute path: %s", p)
+	}
+	return (&url.URL{Scheme: "file", Path: filepath.ToSlash(abs)}).String(), nil
+}
+
+// Feeds returns the feeds in order of their updated time.
+func (s *Source) Feeds() []*Feed {
+	return s.feeds
+}
+
+// Select makes the client read f for the URL of the feed, until another feed of the URL is selected.
+// The archived feeds of a URL are replayed under the URL, so that they are processed as the same feed as in live mode.
+func (s *Source) Select(f *Feed) {
+	s.mu.Lock()
+	s.selected[f.URL] = f.Path
+	s.mu.Unlock()
+}
+
+// Client returns http.Client which reads documents from the source instead of the network.
+// A feed is resolved to the selected file of its URL, and the other documents are resolved by the base name of the requested URL,
+// so links to JMA in the archived feeds are resolved to the archived reports.
+func (s *Source) Client() *http.Client {
+	return &http.Client{
+		Transport: s,
+	}
+}
+
+// RoundTrip implements http.RoundTripper.
+func (s *Source) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp := &http.Response{
+		Proto:      "HTTP/1.0",
+		ProtoMajor: 1,
+		Header:     make(http.Header),
+		Request:    req,
+	}
+
+	s.mu.Lock()
+	p, ok := s.selected[req.URL.String()]
+	s.mu.Unlock()
+
+	if !ok {
+		p, ok = s.files[strings.TrimSuffix(path.Base(req.URL.Path), ".gz")]
+	}
+	if !ok {
+		resp.StatusCode = http.StatusNotFound
+		resp.Status = http.StatusText(http.StatusNotFound)
+		resp.Body = ioutil.NopCloser(strings.NewReader(""))
+		return resp, nil
+	}
+
+	data, _, err := readFile(p)
+	if err != nil {
+		return nil, err
+	}
+
+	resp.StatusCode = http.StatusOK
+	resp.Status = http.StatusText(http.StatusOK)
+	resp.ContentLength = int64(len(data))
+	resp.Header.Set("Content-Type", "application/xml")
+	resp.Body = ioutil.NopCloser(bytes.NewReader(data))
+	return resp, nil
+}
+
+// readFile returns the data of the file, and the original URL kept in the gzip header if it is compressed by the archive.
+func readFile(p string) (data []byte, orig string, err error) {
+	f, err := os.Open(p)
+	if err != nil {
+		return nil, "", errors.Wrapf(err, "faild to open file: %s", p)
+	}
+	defer f.Close()
+
+	var r io.Reader = f
+	if strings.HasSuffix(p, ".gz") {
+		gr, err := gzip.NewReader(f)
+		if err != nil {
+			return nil, "", errors.Wrapf(err, "faild to create gzip reader: %s", p)
+		}
+		defer gr.Close()
+		r, orig = gr, gr.Comment
+	}
+
+	data, err = ioutil.ReadAll(r)
+	if err != nil {
+		return nil, "", errors.Wrapf(err, "faild to read file: %s", p)
+	}
+	return data, orig, nil
+}
@@ -0,0 +1,182 @@
+package replay
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/hlts2/gweather/internal/archive"
+	"github.com/hlts2/gweather/internal/fetcher"
+	"github.com/hlts2/gweather/internal/report"
+)
+
+const (
+	extraURL   = "http://www.data.jma.go.jp/developer/xml/feed/extra.xml"
+	regularURL = "http://www.data.jma.go.jp/developer/xml/feed/regular.xml"
+)
+
+const testFeed = `<?xml version="1.0" encoding="utf-8"?>
+<feed xmlns="http://www.w3.org/2005/Atom" xml:lang="ja">
+<title>%s</title>
+<updated>%s</updated>
+<id>urn:uuid:f3a8b3e6-12db-390b-b0a6-77e6b5c41cdc</id>
+%s
+<entry>
+<title>気象特別警報・警報・注意報</title>
+<id>urn:uuid:%s</id>
+<updated>%s</updated>
+<author><name>盛岡地方気象台</name></author>
+<link type="application/xml" href="http://www.data.jma.go.jp/developer/xml/data/%s.xml" />
+<content type="text">内陸では、落雷に注意してください。</content>
+</entry></feed>`
+
+const testReport = `<?xml version="1.0" encoding="UTF-8"?>
+<Report xmlns="http://xml.kishou.go.jp/jmaxml1/">
+<Body>
+<Warning>
+<Item>
+<Kind><Name>雷注意報</Name><Code>14</Code></Kind>
+<Area><Name>内陸</Name><Code>030010</Code></Area>
+</Item>
+</Warning>
+</Body>
+</Report>`
+
+// feedData returns a feed with an entry of the report id. The self link is omitted if self is empty.
+func feedData(title, self, id string, updated time.Time) []byte {
+	var link string
+	if self != "" {
+		link = fmt.Sprintf(`<link rel="self" href="%s" />`, self)
+	}
+	u := updated.UTC().Format(time.RFC3339)
+	return []byte(fmt.Sprintf(testFeed, title, u, link, id, u, id))
+}
+
+// writeArchive writes the feeds fetched from extraURL and regularURL in the same second, and their reports, by the dir archive.
+func writeArchive(t *testing.T, dir string, at time.Time) {
+	a := archive.NewDir(dir, 0)
+
+	docs := []*fetcher.Document{
+		{Kind: fetcher.KindFeed, URL: extraURL, Data: feedData("extra", "", "00000000-0000-0000-0000-000000000001", at), Fetched: at},
+		{Kind: fetcher.KindFeed, URL: regularURL, Data: feedData("regular", "", "00000000-0000-0000-0000-000000000002", at.Add(time.Second)), Fetched: at},
+		{Kind: fetcher.KindReport, ID: "urn:uuid:00000000-0000-0000-0000-000000000001", Data: []byte(testReport), Fetched: at},
+		{Kind: fetcher.KindReport, ID: "urn:uuid:00000000-0000-0000-0000-000000000002", Data: []byte(testReport), Fetched: at},
+	}
+	for _, doc := range docs {
+		if err := a.Record(context.Background(), doc); err != nil {
+			t.Fatalf("faild to archive document: %v", err)
+		}
+	}
+}
+
+func tempDir(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "gweather-replay")
+	if err != nil {
+		t.Fatalf("faild to create directory: %v", err)
+	}
+	t.Cleanup(func() {
+		os.RemoveAll(dir)
+	})
+	return dir
+}
+
+func TestOpenArchive(t *testing.T) {
+	dir := tempDir(t)
+	at := time.Date(2019, 3, 25, 8, 28, 1, 0, time.UTC)
+	writeArchive(t, dir, at)
+
+	// A plain feed file is replayed under its self link.
+	plain := feedData("extra", extraURL, "00000000-0000-0000-0000-000000000003", at.Add(time.Hour))
+	if err := ioutil.WriteFile(filepath.Join(dir, "test_1.xml"), plain, 0644); err != nil {
+		t.Fatalf("faild to write file: %v", err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "00000000-0000-0000-0000-000000000003.xml"), []byte(testReport), 0644); err != nil {
+		t.Fatalf("faild to write file: %v", err)
+	}
+
+	src, err := Open(dir)
+	if err != nil {
+		t.Fatalf("Open returns error: %v", err)
+	}
+
+	feeds := src.Feeds()
+	want := []string{extraURL, regularURL, extraURL}
+	if len(feeds) != len(want) {
+		t.Fatalf("number of feeds is %d, want %d", len(feeds), len(want))
+	}
+	for i, f := range feeds {
+		if f.URL != want[i] {
+			t.Errorf("URL of feed %d (%s) is %s, want %s", i, f.Path, f.URL, want[i])
+		}
+	}
+
+	// The fetcher processes the archived feeds as the live feeds of the original URLs.
+	client := src.Client()
+	w := fetcher.New(fetcher.WithClient(client))
+	for i, f := range feeds {
+		src.Select(f)
+
+		mm, err := w.Fetch(context.Background(), f.URL)
+		if err != nil {
+			t.Fatalf("Fetch of feed %d returns error: %v", i, err)
+		}
+
+		m, ok := mm["気象特別警報・警報・注意報_盛岡地方気象台"]
+		if !ok {
+			t.Fatalf("report of feed %d is not fetched: %v", i, mm)
+		}
+		if m["feed"] != want[i] || report.FeedName(m["feed"].(string)) != report.FeedName(want[i]) {
+			t.Errorf("feed of report %d is %v, want %s", i, m["feed"], want[i])
+		}
+	}
+}
+
+func TestOpenRelativeDirectory(t *testing.T) {
+	dir := tempDir(t)
+	at := time.Date(2019, 3, 25, 8, 28, 1, 0, time.UTC)
+
+	// The feed without the self link is replayed under the file URL, which must be resolved from a relative directory.
+	if err := os.MkdirAll(filepath.Join(dir, "feed"), 0755); err != nil {
+		t.Fatalf("faild to create directory: %v", err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "feed", "x.xml"), feedData("extra", "", "00000000-0000-0000-0000-000000000001", at), 0644); err != nil {
+		t.Fatalf("faild to write file: %v", err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "00000000-0000-0000-0000-000000000001.xml"), []byte(testReport), 0644); err != nil {
+		t.Fatalf("faild to write file: %v", err)
+	}
+
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("faild to get working directory: %v", err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatalf("faild to change directory: %v", err)
+	}
+	defer os.Chdir(wd)
+
+	src, err := Open(".")
+	if err != nil {
+		t.Fatalf("Open returns error: %v", err)
+	}
+	if len(src.Feeds()) != 1 {
+		t.Fatalf("number of feeds is %d, want 1", len(src.Feeds()))
+	}
+
+	f := src.Feeds()[0]
+	src.Select(f)
+
+	resp, err := src.Client().Get(f.URL)
+	if err != nil {
+		t.Fatalf("faild to get %s: %v", f.URL, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 200 {
+		t.Errorf("status code of %s is %d, want 200", f.URL, resp.StatusCode)
+	}
+}
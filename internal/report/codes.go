@@ -0,0 +1,99 @@
+package report
+
+import (
+	"bytes"
+	"encoding/xml"
+	"io"
+	"sort"
+
+	"github.com/pkg/errors"
+)
+
+// Codes returns area codes and warning kind codes which appear in the JMA XML report.
+// e.g) <Area><Name>内陸</Name><Code>030010</Code></Area> => 030010
+func Codes(data []byte) (areas, kinds []string, err error) {
+	dec := xml.NewDecoder(bytes.NewReader(data))
+
+	var stack []string
+	seenArea, seenKind := make(map[string]bool), make(map[string]bool)
+
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, nil, errors.Wrap(err, "faild to decode xml")
+		}
+
+		switch t := tok.(type) {
+		case xml.StartElement:
+			stack = append(stack, t.Name.Local)
+		case xml.EndElement:
+			stack = stack[:len(stack)-1]
+		case xml.CharData:
+			if len(stack) < 2 || stack[len(stack)-1] != "Code" {
+				continue
+			}
+
+			code := string(bytes.TrimSpace(t))
+			switch stack[len(stack)-2] {
+			case "Area":
+				if !seenArea[code] {
+					seenArea[code] = true
+					areas = append(areas, code)
+				}
+			case "Kind":
+				if !seenKind[code] {
+					seenKind[code] = true
+					kinds = append(kinds, code)
+				}
+			}
+		}
+	}
+
+	return areas, kinds, nil
+}
+
+// BodyCodes returns area codes and warning kind codes which appear in the body converted from the JMA XML report.
+// e.g) {"Area": {"Code": "030010", "Name": "内陸"}} => 030010
+func BodyCodes(body interface{}) (areas, kinds []string) {
+	seenArea, seenKind := make(map[string]bool), make(map[string]bool)
+
+	var walk func(v interface{}, parent string)
+	walk = func(v interface{}, parent string) {
+		switch t := v.(type) {
+		case map[string]interface{}:
+			for k, child := range t {
+				code, ok := child.(string)
+				if k != "Code" || !ok {
+					walk(child, k)
+					continue
+				}
+
+				switch parent {
+				case "Area":
+					if !seenArea[code] {
+						seenArea[code] = true
+						areas = append(areas, code)
+					}
+				case "Kind":
+					if !seenKind[code] {
+						seenKind[code] = true
+						kinds = append(kinds, code)
+					}
+				}
+			}
+		case []interface{}:
+			for _, child := range t {
+				walk(child, parent)
+			}
+		}
+	}
+	walk(body, "")
+
+	sort.Strings(areas)
+	sort.Strings(kinds)
+
+	return areas, kinds
+}
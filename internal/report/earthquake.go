@@ -0,0 +1,89 @@
+package report
+
+import (
+	"regexp"
+	"strconv"
+)
+
+// coordinate matches a coordinate in ISO 6709, e.g. +39.8+142.3-50000/.
+var coordinate = regexp.MustCompile(`^([+-]\d+(?:\.\d+)?)([+-]\d+(?:\.\d+)?)([+-]\d+)?/$`)
+
+// Earthquake represents the hypocenter and the intensity in the body of an earthquake report converted from the JMA XML report.
+// e.g) {"Earthquake": {"Hypocenter": {"Area": {"Name": "岩手県沖", "Code": {"-type": "震央地名", "#content": "288"}}}}}
+type Earthquake struct {
+	OriginTime  string
+	ArrivalTime string
+
+	Hypocenter     string
+	HypocenterCode string
+
+	// Coordinate is the coordinate of the hypocenter in ISO 6709, e.g. +39.8+142.3-50000/.
+	Coordinate string
+
+	// Magnitude is the magnitude, which is NaN when it is unknown.
+	Magnitude string
+
+	// MaxIntensity is the maximum seismic intensity observed, e.g. 5-. It is empty before the intensity is observed.
+	MaxIntensity string
+}
+
+// NewEarthquake returns Earthquake of the body converted from the JMA XML report.
+// It returns nil if the body is not of an earthquake report.
+func NewEarthquake(body interface{}) *Earthquake {
+	b, ok := body.(map[string]interface{})
+	if !ok {
+		return nil
+	}
+
+	eq, ok := b["Earthquake"].(map[string]interface{})
+	if !ok {
+		return nil
+	}
+
+	e := &Earthquake{
+		OriginTime:  str(eq["OriginTime"]),
+		ArrivalTime: str(eq["ArrivalTime"]),
+		Magnitude:   text(eq["Magnitude"]),
+	}
+
+	if h, ok := eq["Hypocenter"].(map[string]interface{}); ok {
+		if area, ok := h["Area"].(map[string]interface{}); ok {
+			e.Hypocenter = str(area["Name"])
+			e.HypocenterCode = text(area["Code"])
+			e.Coordinate = text(area["Coordinate"])
+		}
+	}
+
+	if in, ok := b["Intensity"].(map[string]interface{}); ok {
+		if obs, ok := in["Observation"].(map[string]interface{}); ok {
+			e.MaxIntensity = str(obs["MaxInt"])
+		}
+	}
+	return e
+}
+
+// Location returns the latitude, the longitude and the depth in km of the hypocenter.
+// It returns false if the coordinate is unknown.
+func (e *Earthquake) Location() (lat, lon, depth float64, ok bool) {
+	m := coordinate.FindStringSubmatch(e.Coordinate)
+	if m == nil {
+		return 0, 0, 0, false
+	}
+
+	lat, _ = strconv.ParseFloat(m[1], 64)
+	lon, _ = strconv.ParseFloat(m[2], 64)
+	if m[3] != "" {
+		// The depth is the altitude in meters, e.g. -50000 for 50km.
+		alt, _ := strconv.ParseFloat(m[3], 64)
+		depth = -alt / 1000
+	}
+	return lat, lon, depth, true
+}
+
+// text returns the text of the element, which is an object of #content when the element has attributes.
+func text(v interface{}) string {
+	if m, ok := v.(map[string]interface{}); ok {
+		return str(m["#content"])
+	}
+	return str(v)
+}
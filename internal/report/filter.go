@@ -0,0 +1,37 @@
+package report
+
+// Filter represents conditions to select reports.
+// An empty field matches every report.
+type Filter struct {
+	Titles  []string
+	Offices []string
+	Areas   []string
+	Kinds   []string
+}
+
+// Match returns true if the report matches all conditions of the filter.
+func (f *Filter) Match(title, office string, areas, kinds []string) bool {
+	return matchOne(f.Titles, title) &&
+		matchOne(f.Offices, office) &&
+		matchAny(f.Areas, areas) &&
+		matchAny(f.Kinds, kinds)
+}
+
+func matchOne(conds []string, v string) bool {
+	return matchAny(conds, []string{v})
+}
+
+func matchAny(conds, vs []string) bool {
+	if len(conds) == 0 {
+		return true
+	}
+
+	for _, c := range conds {
+		for _, v := range vs {
+			if c == v {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,204 @@
+package report
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"net/url"
+	"path"
+	"strings"
+	"text/template"
+
+	"github.com/pkg/errors"
+)
+
+// DefaultKeyTemplate is the template of the keys of reports used by default.
+// e.g) 気象特別警報・警報・注意報_鳥取地方気象台
+const DefaultKeyTemplate = "{{.Title}}_{{.Office}}"
+
+// KeyFields represents the fields of a report available in the key template.
+type KeyFields struct {
+	// Feed is the name of the feed, e.g. extra for http://www.data.jma.go.jp/developer/xml/feed/extra.xml.
+	Feed string
+
+	Title  string
+	Office string
+
+	// UUID is the UUID of the entry id.
+	UUID string
+
+	// Area and Kind are the first area code and warning kind code of the report. Areas and Kinds are all of them.
+	Area  string
+	Areas []string
+	Kind  string
+	Kinds []string
+}
+
+// NewKeyFields returns KeyFields of the report stored by the fetcher.
+func NewKeyFields(feed string, m map[string]interface{}) KeyFields {
+	title, _ := m["title"].(string)
+	office, _ := m["name"].(string)
+	id, _ := m["id"].(string)
+
+	f := KeyFields{
+		Feed:   FeedName(feed),
+		Title:  title,
+		Office: office,
+		UUID:   UUID(id),
+	}
+
+	f.Areas, f.Kinds = BodyCodes(m["body"])
+	if len(f.Areas) > 0 {
+		f.Area = f.Areas[0]
+	}
+	if len(f.Kinds) > 0 {
+		f.Kind = f.Kinds[0]
+	}
+	return f
+}
+
+// FeedName returns the name of the feed of the URL.
+// e.g) http://www.data.jma.go.jp/developer/xml/feed/extra.xml => extra
+func FeedName(feed string) string {
+	p := feed
+	if u, err := url.Parse(feed); err == nil {
+		p = u.Path
+	}
+	name := path.Base(p)
+	return strings.TrimSuffix(name, path.Ext(name))
+}
+
+// KeyTemplate generates the keys of reports by a template of text/template.
+// In addition to the fields of KeyFields, the following functions are available in the template.
+//
+//	ascii: percent-encodes the characters other than printable ASCII, e.g. {{ascii .Office}}
+//	hash:  returns the first 8 hex digits of SHA-1 of the value, e.g. {{hash .Title}}
+//	join:  joins the values with the separator, e.g. {{join .Areas ","}}
+type KeyTemplate struct {
+	tmpl *template.Template
+}
+
+var keyFuncs = template.FuncMap{
+	"ascii": ascii,
+	"hash":  hash,
+	"join":  strings.Join,
+}
+
+// NewKeyTemplate parses text as the key template.
+func NewKeyTemplate(text string) (*KeyTemplate, error) {
+	if text == "" {
+		text = DefaultKeyTemplate
+	}
+
+	tmpl, err := template.New("key").Funcs(keyFuncs).Parse(text)
+	if err != nil {
+		return nil, errors.Wrapf(err, "faild to parse key template: %s", text)
+	}
+
+	t := &KeyTemplate{
+		tmpl: tmpl,
+	}
+
+	// The template is checked with an example so that errors are reported at startup.
+	if _, err := t.Key(KeyFields{
+		Feed:   "extra",
+		Title:  "気象特別警報・警報・注意報",
+		Office: "盛岡地方気象台",
+		UUID:   "4eb2228e-262f-302f-892c-d7726f196984",
+		Area:   "030010",
+		Areas:  []string{"030010"},
+		Kind:   "10",
+		Kinds:  []string{"10"},
+	}); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// Key returns the key of the report of f.
+func (t *KeyTemplate) Key(f KeyFields) (string, error) {
+	var buf bytes.Buffer
+	if err := t.tmpl.Execute(&buf, f); err != nil {
+		return "", errors.Wrap(err, "faild to execute key template")
+	}
+
+	key := buf.String()
+	if key == "" {
+		return "", errors.New("key is empty")
+	}
+	return key, nil
+}
+
+// ByTitleAndOffice returns true if the keys are generated only from the title and the office,
+// so that the key of a report can be given by them without the other fields.
+func (t *KeyTemplate) ByTitleAndOffice() bool {
+	return t.Complete(KeyFields{
+		Title:  "気象特別警報・警報・注意報",
+		Office: "盛岡地方気象台",
+	}) == nil
+}
+
+// Complete returns an error if the key of f depends on the fields which are empty in f,
+// e.g. the feed and the UUID of a report stored by an older version without them.
+func (t *KeyTemplate) Complete(f KeyFields) error {
+	a, b := f, f
+	var missing []string
+
+	if f.Feed == "" {
+		a.Feed, b.Feed = "extra", "regular"
+		missing = append(missing, "Feed")
+	}
+	if f.Title == "" {
+		a.Title, b.Title = "気象特別警報・警報・注意報", "気象警報・注意報"
+		missing = append(missing, "Title")
+	}
+	if f.Office == "" {
+		a.Office, b.Office = "盛岡地方気象台", "鳥取地方気象台"
+		missing = append(missing, "Office")
+	}
+	if f.UUID == "" {
+		a.UUID, b.UUID = "4eb2228e-262f-302f-892c-d7726f196984", "c1af90d4-23a8-3628-a489-2d40421838d7"
+		missing = append(missing, "UUID")
+	}
+	if len(f.Areas) == 0 {
+		a.Area, a.Areas = "030010", []string{"030010"}
+		b.Area, b.Areas = "310010", []string{"310010"}
+		missing = append(missing, "Area")
+	}
+	if len(f.Kinds) == 0 {
+		a.Kind, a.Kinds = "10", []string{"10"}
+		b.Kind, b.Kinds = "14", []string{"14"}
+		missing = append(missing, "Kind")
+	}
+
+	k1, err := t.Key(a)
+	if err != nil {
+		return err
+	}
+	k2, err := t.Key(b)
+	if err != nil {
+		return err
+	}
+	if k1 != k2 {
+		return errors.Errorf("key depends on the fields missing in the report: %s", strings.Join(missing, ", "))
+	}
+	return nil
+}
+
+func ascii(s string) string {
+	var b strings.Builder
+	for _, c := range []byte(s) {
+		if c > ' ' && c < 0x7f && c != '%' {
+			b.WriteByte(c)
+			continue
+		}
+		fmt.Fprintf(&b, "%%%02X", c)
+	}
+	return b.String()
+}
+
+func hash(s string) string {
+	sum := sha1.Sum([]byte(s))
+	return hex.EncodeToString(sum[:4])
+}
@@ -0,0 +1,144 @@
+package report
+
+import (
+	"testing"
+)
+
+const (
+	morioka = "urn:uuid:c1af90d4-23a8-3628-a489-2d40421838d7"
+	extra   = "http://www.data.jma.go.jp/developer/xml/feed/extra.xml"
+)
+
+// testReport returns a report stored by the fetcher.
+func testReport(id, area, kind string) map[string]interface{} {
+	return map[string]interface{}{
+		"feed":  extra,
+		"id":    id,
+		"title": "気象特別警報・警報・注意報",
+		"name":  "盛岡地方気象台",
+		"body": map[string]interface{}{
+			"Item": map[string]interface{}{
+				"Kind": map[string]interface{}{"Name": "雷注意報", "Code": kind},
+				"Area": map[string]interface{}{"Name": "内陸", "Code": area},
+			},
+		},
+	}
+}
+
+func TestKeyTemplate(t *testing.T) {
+	tests := []struct {
+		text string
+		want string
+	}{
+		{text: "", want: "気象特別警報・警報・注意報_盛岡地方気象台"},
+		{text: DefaultKeyTemplate, want: "気象特別警報・警報・注意報_盛岡地方気象台"},
+		{text: "jma:{{.Feed}}:{{.UUID}}", want: "jma:extra:c1af90d4-23a8-3628-a489-2d40421838d7"},
+		{text: "{{.Area}}/{{.Kind}}", want: "030010/14"},
+		{text: "{{ascii .Office}}", want: "%E7%9B%9B%E5%B2%A1%E5%9C%B0%E6%96%B9%E6%B0%97%E8%B1%A1%E5%8F%B0"},
+		{text: "{{hash .Title}}_{{join .Areas \",\"}}", want: hash("気象特別警報・警報・注意報") + "_030010"},
+	}
+
+	for _, tt := range tests {
+		tmpl, err := NewKeyTemplate(tt.text)
+		if err != nil {
+			t.Errorf("NewKeyTemplate(%q) returns error: %v", tt.text, err)
+			continue
+		}
+
+		got, err := tmpl.Key(NewKeyFields(extra, testReport(morioka, "030010", "14")))
+		if err != nil {
+			t.Errorf("Key of %q returns error: %v", tt.text, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("Key of %q is %s, want %s", tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestNewKeyTemplateInvalid(t *testing.T) {
+	// The errors of the template are reported on parsing, not on the first report.
+	for _, text := range []string{"{{.Title", "{{.Unknown}}", "{{unknown .Title}}", "{{if false}}x{{end}}"} {
+		if _, err := NewKeyTemplate(text); err == nil {
+			t.Errorf("NewKeyTemplate(%q) returns no error", text)
+		}
+	}
+}
+
+func TestKeyTemplateCollision(t *testing.T) {
+	// The reports of the same title and office collide by the default template, but not by the template with the UUID.
+	a := NewKeyFields(extra, testReport(morioka, "030010", "14"))
+	b := NewKeyFields(extra, testReport("urn:uuid:4eb2228e-262f-302f-892c-d7726f196984", "030020", "14"))
+
+	tests := []struct {
+		text    string
+		collide bool
+	}{
+		{text: DefaultKeyTemplate, collide: true},
+		{text: "{{.Title}}_{{.Office}}_{{.UUID}}"},
+		{text: "{{.Title}}_{{.Office}}_{{.Area}}"},
+	}
+
+	for _, tt := range tests {
+		tmpl, err := NewKeyTemplate(tt.text)
+		if err != nil {
+			t.Fatalf("NewKeyTemplate(%q) returns error: %v", tt.text, err)
+		}
+
+		ka, _ := tmpl.Key(a)
+		kb, _ := tmpl.Key(b)
+		if (ka == kb) != tt.collide {
+			t.Errorf("keys of %q are %s and %s, want collision %v", tt.text, ka, kb, tt.collide)
+		}
+	}
+}
+
+func TestKeyTemplateByTitleAndOffice(t *testing.T) {
+	// query rejects --title and --office unless the keys are generated only from them.
+	tests := []struct {
+		text string
+		want bool
+	}{
+		{text: DefaultKeyTemplate, want: true},
+		{text: "jma:{{ascii .Office}}:{{hash .Title}}", want: true},
+		{text: "{{.Title}}_{{.Office}}_{{.UUID}}"},
+		{text: "{{.Feed}}:{{.Title}}_{{.Office}}"},
+		{text: "{{.Title}}_{{.Office}}_{{join .Kinds \"-\"}}"},
+	}
+
+	for _, tt := range tests {
+		tmpl, err := NewKeyTemplate(tt.text)
+		if err != nil {
+			t.Fatalf("NewKeyTemplate(%q) returns error: %v", tt.text, err)
+		}
+		if got := tmpl.ByTitleAndOffice(); got != tt.want {
+			t.Errorf("ByTitleAndOffice of %q is %v, want %v", tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestKeyTemplateComplete(t *testing.T) {
+	// A report stored by the versions before the key template has neither the feed nor the entry id.
+	legacy := testReport("", "030010", "14")
+	delete(legacy, "feed")
+
+	tests := []struct {
+		text    string
+		wantErr bool
+	}{
+		{text: DefaultKeyTemplate},
+		{text: "{{.Title}}_{{.Office}}_{{.Area}}"},
+		{text: "{{.Feed}}:{{.Title}}_{{.Office}}", wantErr: true},
+		{text: "{{.UUID}}", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		tmpl, err := NewKeyTemplate(tt.text)
+		if err != nil {
+			t.Fatalf("NewKeyTemplate(%q) returns error: %v", tt.text, err)
+		}
+		if err := tmpl.Complete(NewKeyFields("", legacy)); (err != nil) != tt.wantErr {
+			t.Errorf("Complete of %q returns error %v, want error %v", tt.text, err, tt.wantErr)
+		}
+	}
+}
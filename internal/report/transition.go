@@ -0,0 +1,106 @@
+package report
+
+import "sort"
+
+const (
+	// TransitionIssued is the transition of the warning which has become active.
+	TransitionIssued = "issued"
+
+	// TransitionUpdated is the transition of the active warning whose status has changed, e.g. 警報から注意報.
+	TransitionUpdated = "updated"
+
+	// TransitionLifted is the transition of the warning which is no longer active.
+	TransitionLifted = "lifted"
+
+	// statusContinued is the status of the warning which continues from the previous report.
+	statusContinued = "継続"
+)
+
+// Transition represents a change of a warning kind in an area between two reports.
+type Transition struct {
+	Transition string `json:"transition"`
+
+	Area     string `json:"area"`
+	AreaName string `json:"area_name"`
+	Code     string `json:"code"`
+	Name     string `json:"name"`
+
+	// From is the status in the previous report, which is empty when the warning is issued.
+	From string `json:"from,omitempty"`
+
+	// To is the status in the current report, which is empty when the warning is no longer in the report.
+	To string `json:"to,omitempty"`
+}
+
+// Transitions returns the changes of the warnings from the body of the previous report to the body of the current one.
+// The warnings which continue without a change are not returned.
+func Transitions(prev, cur interface{}) []*Transition {
+	type kind struct {
+		area, code string
+	}
+
+	olds := make(map[kind]*Warning)
+	for _, w := range Warnings(prev) {
+		if w.Active() && w.Area != "" {
+			olds[kind{w.Area, w.Code}] = w
+		}
+	}
+
+	var ts []*Transition
+	for _, w := range Warnings(cur) {
+		if w.Area == "" {
+			continue
+		}
+
+		k := kind{w.Area, w.Code}
+		old, ok := olds[k]
+		delete(olds, k)
+
+		t := &Transition{
+			Area:     w.Area,
+			AreaName: w.AreaName,
+			Code:     w.Code,
+			Name:     w.Name,
+			To:       w.Status,
+		}
+		if ok {
+			t.From = old.Status
+		}
+
+		switch {
+		case w.Active() && !ok:
+			t.Transition = TransitionIssued
+		case w.Active() && w.Status != statusContinued && w.Status != old.Status:
+			t.Transition = TransitionUpdated
+		case !w.Active() && ok:
+			t.Transition = TransitionLifted
+		default:
+			continue
+		}
+		ts = append(ts, t)
+	}
+
+	// The warnings which disappeared from the report are lifted.
+	lifted := make([]*Warning, 0, len(olds))
+	for _, old := range olds {
+		lifted = append(lifted, old)
+	}
+	sort.Slice(lifted, func(i, j int) bool {
+		if lifted[i].Area != lifted[j].Area {
+			return lifted[i].Area < lifted[j].Area
+		}
+		return lifted[i].Code < lifted[j].Code
+	})
+
+	for _, old := range lifted {
+		ts = append(ts, &Transition{
+			Transition: TransitionLifted,
+			Area:       old.Area,
+			AreaName:   old.AreaName,
+			Code:       old.Code,
+			Name:       old.Name,
+			From:       old.Status,
+		})
+	}
+	return ts
+}
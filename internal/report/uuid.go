@@ -0,0 +1,9 @@
+package report
+
+import "strings"
+
+// UUID returns UUID of the entry id.
+// e.g) urn:uuid:4eb2228e-262f-302f-892c-d7726f196984 => 4eb2228e-262f-302f-892c-d7726f196984
+func UUID(id string) string {
+	return strings.TrimPrefix(id, "urn:uuid:")
+}
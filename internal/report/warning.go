@@ -0,0 +1,111 @@
+package report
+
+import "strings"
+
+const (
+	// SpecialWarning is the suffix of the names of the special warnings, e.g. 大雨特別警報.
+	SpecialWarning = "特別警報"
+
+	// StatusLifted is the status of the warning which is lifted.
+	StatusLifted = "解除"
+
+	// StatusNone is the status of the area where no warning is issued.
+	StatusNone = "発表警報・注意報はなし"
+)
+
+// Warning represents a warning kind of an area in the body converted from the JMA XML report.
+// e.g) {"Area": {"Code": "030010", "Name": "内陸"}, "Kind": {"Code": "14", "Name": "雷注意報", "Status": "発表"}}
+type Warning struct {
+	// Type is the type of the items, e.g. 気象警報・注意報（一次細分区域等）.
+	Type string
+
+	Area     string
+	AreaName string
+
+	Code   string
+	Name   string
+	Status string
+
+	// Notes are the notes of Addition, e.g. 突風.
+	Notes []string
+}
+
+// Active returns true if the warning is not lifted.
+func (w *Warning) Active() bool {
+	return w.Code != "" && w.Status != StatusLifted && w.Status != StatusNone
+}
+
+// Special returns true if the warning is a special warning.
+func (w *Warning) Special() bool {
+	return strings.HasSuffix(w.Name, SpecialWarning)
+}
+
+// Warnings returns the warning kinds of each area in the body converted from the JMA XML report.
+func Warnings(body interface{}) []*Warning {
+	var ws []*Warning
+
+	for _, v := range list(body) {
+		warning, ok := v.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		typ, _ := warning["-type"].(string)
+
+		for _, v := range list(warning["Item"]) {
+			item, ok := v.(map[string]interface{})
+			if !ok {
+				continue
+			}
+
+			for _, v := range list(item["Area"]) {
+				area, ok := v.(map[string]interface{})
+				if !ok {
+					continue
+				}
+
+				for _, v := range list(item["Kind"]) {
+					kind, ok := v.(map[string]interface{})
+					if !ok {
+						continue
+					}
+
+					w := &Warning{
+						Type:     typ,
+						Area:     str(area["Code"]),
+						AreaName: str(area["Name"]),
+						Code:     str(kind["Code"]),
+						Name:     str(kind["Name"]),
+						Status:   str(kind["Status"]),
+					}
+					if addition, ok := kind["Addition"].(map[string]interface{}); ok {
+						for _, note := range list(addition["Note"]) {
+							if s := str(note); s != "" {
+								w.Notes = append(w.Notes, s)
+							}
+						}
+					}
+					ws = append(ws, w)
+				}
+			}
+		}
+	}
+
+	return ws
+}
+
+// list returns v as a slice. goxml2json converts an element which appears once into an object instead of an array.
+func list(v interface{}) []interface{} {
+	switch t := v.(type) {
+	case nil:
+		return nil
+	case []interface{}:
+		return t
+	default:
+		return []interface{}{t}
+	}
+}
+
+func str(v interface{}) string {
+	s, _ := v.(string)
+	return s
+}
@@ -0,0 +1,143 @@
+package rpc
+
+import (
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/structpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	gweatherv1 "github.com/hlts2/gweather/api/gweather/v1"
+	"github.com/hlts2/gweather/internal/report"
+	"github.com/hlts2/gweather/internal/store"
+)
+
+// transitions are the types of the transitions of the warnings.
+var transitions = map[string]gweatherv1.Transition_Type{
+	report.TransitionIssued:  gweatherv1.Transition_TYPE_ISSUED,
+	report.TransitionUpdated: gweatherv1.Transition_TYPE_UPDATED,
+	report.TransitionLifted:  gweatherv1.Transition_TYPE_LIFTED,
+}
+
+// newReport returns the message of the report of key.
+func newReport(key string, m map[string]interface{}) (*gweatherv1.Report, error) {
+	body, err := structpb.NewValue(m["body"])
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "faild to convert body: %s: %v", key, err)
+	}
+
+	r := &gweatherv1.Report{
+		Key:     key,
+		Id:      str(m["id"]),
+		Title:   str(m["title"]),
+		Office:  str(m["name"]),
+		Feed:    str(m["feed"]),
+		Link:    str(m["link"]),
+		Updated: timestamp(str(m["updated"])),
+		Content: str(m["content"]),
+		Body:    body,
+	}
+
+	for _, w := range report.Warnings(m["body"]) {
+		r.Warnings = append(r.Warnings, newWarning(w))
+	}
+
+	if e := report.NewEarthquake(m["body"]); e != nil {
+		r.Earthquake = newEarthquake(e)
+	}
+	return r, nil
+}
+
+func newWarning(w *report.Warning) *gweatherv1.Warning {
+	return &gweatherv1.Warning{
+		Type:     w.Type,
+		Area:     w.Area,
+		AreaName: w.AreaName,
+		Code:     w.Code,
+		Name:     w.Name,
+		Status:   w.Status,
+		Notes:    w.Notes,
+	}
+}
+
+func newAreaWarning(w *store.AreaWarning) *gweatherv1.AreaWarning {
+	return &gweatherv1.AreaWarning{
+		Warning: &gweatherv1.Warning{
+			Type:     w.Type,
+			Area:     w.Area,
+			AreaName: w.AreaName,
+			Code:     w.Code,
+			Name:     w.Name,
+			Status:   w.Status,
+			Notes:    w.Notes,
+		},
+		Issued: timestamp(w.Issued),
+		Key:    w.Key,
+	}
+}
+
+func newEarthquake(e *report.Earthquake) *gweatherv1.Earthquake {
+	eq := &gweatherv1.Earthquake{
+		OriginTime:     timestamp(e.OriginTime),
+		ArrivalTime:    timestamp(e.ArrivalTime),
+		Hypocenter:     e.Hypocenter,
+		HypocenterCode: e.HypocenterCode,
+		Coordinate:     e.Coordinate,
+		Magnitude:      e.Magnitude,
+		MaxIntensity:   e.MaxIntensity,
+	}
+
+	if lat, lon, depth, ok := e.Location(); ok {
+		eq.Latitude, eq.Longitude, eq.Depth = &lat, &lon, &depth
+	}
+	return eq
+}
+
+func newEvent(ev *store.Event) (*gweatherv1.Event, error) {
+	e := &gweatherv1.Event{
+		Id:     ev.ID,
+		Key:    ev.Key,
+		Title:  ev.Title,
+		Office: ev.Office,
+	}
+
+	switch {
+	case ev.Warning != nil:
+		t := ev.Warning
+		e.Payload = &gweatherv1.Event_Transition{
+			Transition: &gweatherv1.Transition{
+				Type:     transitions[t.Transition],
+				Area:     t.Area,
+				AreaName: t.AreaName,
+				Code:     t.Code,
+				Name:     t.Name,
+				From:     t.From,
+				To:       t.To,
+			},
+		}
+	case ev.Report != nil:
+		r, err := newReport(ev.Key, ev.Report)
+		if err != nil {
+			return nil, err
+		}
+		e.Payload = &gweatherv1.Event_Report{
+			Report: r,
+		}
+	}
+	return e, nil
+}
+
+// timestamp returns the timestamp of the RFC 3339 time, or nil if s is not a time.
+func timestamp(s string) *timestamppb.Timestamp {
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		return nil
+	}
+	return timestamppb.New(t)
+}
+
+func str(v interface{}) string {
+	s, _ := v.(string)
+	return s
+}
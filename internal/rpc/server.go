@@ -0,0 +1,175 @@
+package rpc
+
+import (
+	"context"
+	"sort"
+	"sync"
+
+	"github.com/pkg/errors"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	gweatherv1 "github.com/hlts2/gweather/api/gweather/v1"
+	"github.com/hlts2/gweather/internal/log"
+	"github.com/hlts2/gweather/internal/metrics"
+	"github.com/hlts2/gweather/internal/report"
+	"github.com/hlts2/gweather/internal/store"
+	"github.com/hlts2/gweather/internal/stream"
+)
+
+// Server implements ReportService of the gRPC API with the store and the broker of the events.
+type Server struct {
+	gweatherv1.UnimplementedReportServiceServer
+
+	store  store.Store
+	broker *stream.Broker
+
+	once sync.Once
+	done chan struct{}
+}
+
+// NewServer returns Server which reads the reports from st and streams the events of broker.
+func NewServer(st store.Store, broker *stream.Broker) *Server {
+	return &Server{
+		store:  st,
+		broker: broker,
+		done:   make(chan struct{}),
+	}
+}
+
+// Close ends the subscriptions with UNAVAILABLE, since the graceful stop of the gRPC server waits for them.
+func (s *Server) Close() {
+	s.once.Do(func() {
+		close(s.done)
+	})
+}
+
+func (s *Server) GetReport(ctx context.Context, req *gweatherv1.GetReportRequest) (*gweatherv1.Report, error) {
+	if req.GetKey() == "" {
+		return nil, status.Error(codes.InvalidArgument, "key is required")
+	}
+
+	m, err := s.store.Get(ctx, req.GetKey())
+	if err == store.ErrNotFound {
+		return nil, status.Errorf(codes.NotFound, "report not found: %s", req.GetKey())
+	}
+	if err != nil {
+		return nil, unavailable(err)
+	}
+	return newReport(req.GetKey(), m)
+}
+
+func (s *Server) ListReports(ctx context.Context, req *gweatherv1.ListReportsRequest) (*gweatherv1.ListReportsResponse, error) {
+	mm, err := s.store.List(ctx)
+	if err != nil {
+		return nil, unavailable(err)
+	}
+
+	keys := make([]string, 0, len(mm))
+	for key := range mm {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	f := newFilter(req.GetFilter())
+	resp := new(gweatherv1.ListReportsResponse)
+	for _, key := range keys {
+		m := mm[key]
+		title, _ := m["title"].(string)
+		office, _ := m["name"].(string)
+		areas, kinds := report.BodyCodes(m["body"])
+		if !f.Match(title, office, areas, kinds) {
+			continue
+		}
+
+		r, err := newReport(key, m)
+		if err != nil {
+			return nil, err
+		}
+		resp.Reports = append(resp.Reports, r)
+	}
+	return resp, nil
+}
+
+func (s *Server) ListWarnings(ctx context.Context, req *gweatherv1.ListWarningsRequest) (*gweatherv1.ListWarningsResponse, error) {
+	if req.GetArea() == "" {
+		return nil, status.Error(codes.InvalidArgument, "area is required")
+	}
+
+	ws, err := s.store.Warnings(ctx, req.GetArea())
+	if err != nil {
+		return nil, unavailable(err)
+	}
+
+	resp := &gweatherv1.ListWarningsResponse{
+		Warnings: make([]*gweatherv1.AreaWarning, len(ws)),
+	}
+	for i, w := range ws {
+		resp.Warnings[i] = newAreaWarning(w)
+	}
+	return resp, nil
+}
+
+func (s *Server) Subscribe(req *gweatherv1.SubscribeRequest, srv grpc.ServerStreamingServer[gweatherv1.Event]) error {
+	sub, replay, err := s.broker.Resume(srv.Context(), s.store, newFilter(req.GetFilter()), req.GetLastEventId())
+	if errors.Cause(err) == store.ErrInvalidEventID {
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+	if err != nil {
+		return unavailable(err)
+	}
+	defer sub.Close()
+
+	metrics.StreamClients.WithLabelValues(metrics.ProtocolGRPC).Inc()
+	defer metrics.StreamClients.WithLabelValues(metrics.ProtocolGRPC).Dec()
+
+	ctx, cancel := context.WithCancel(srv.Context())
+	defer cancel()
+	go func() {
+		select {
+		case <-s.done:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	send := func(ev *store.Event) error {
+		e, err := newEvent(ev)
+		if err != nil {
+			return err
+		}
+		return srv.Send(e)
+	}
+
+	// The keepalive of HTTP/2 keeps the idle streams open instead of the heartbeats.
+	err = sub.Send(ctx, replay, send, nil)
+	switch {
+	case err == stream.ErrDropped:
+		return status.Error(codes.ResourceExhausted, err.Error())
+	case err != nil:
+		return err
+	}
+
+	select {
+	case <-s.done:
+		return status.Error(codes.Unavailable, "server is shutting down")
+	default:
+		return nil
+	}
+}
+
+// unavailable returns the error of the store as UNAVAILABLE, since it is usually caused by redis.
+func unavailable(err error) error {
+	log.New(log.SubsystemNotifier).Errorf("faild to read store: %v", err)
+	return status.Error(codes.Unavailable, err.Error())
+}
+
+func newFilter(f *gweatherv1.Filter) *report.Filter {
+	return &report.Filter{
+		Titles:  f.GetTitles(),
+		Offices: f.GetOffices(),
+		Areas:   f.GetAreas(),
+		Kinds:   f.GetKinds(),
+	}
+}
@@ -0,0 +1,82 @@
+package schedule
+
+import (
+	"sync"
+	"time"
+)
+
+// Activity represents the result of a poll of a feed, which adapts the interval of Adaptive.
+type Activity struct {
+	// Entries are the IDs of the entries in the feed.
+	Entries []string
+
+	// Urgent is true when special warnings are active in the reports of the feed.
+	Urgent bool
+}
+
+// Adaptive is Schedule whose interval adapts to the activity of the feed between Min and Max.
+// The interval is reset to Min while special warnings are active, halved when the poll found new entries,
+// and doubled toward Max when nothing has changed.
+type Adaptive struct {
+	Min time.Duration
+	Max time.Duration
+
+	mu       sync.Mutex
+	interval time.Duration
+	entries  map[string]bool
+}
+
+// NewAdaptive returns Adaptive which starts at min.
+func NewAdaptive(min, max time.Duration) *Adaptive {
+	return &Adaptive{
+		Min:      min,
+		Max:      max,
+		interval: min,
+	}
+}
+
+// Next returns the time after the current interval.
+func (a *Adaptive) Next(t time.Time) time.Time {
+	return t.Add(a.Current())
+}
+
+// Current returns the current interval.
+func (a *Adaptive) Current() time.Duration {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	return a.interval
+}
+
+// Observe adapts the interval to the activity of a poll.
+// The entries of the first poll are not new, since they may have been polled before the start.
+func (a *Adaptive) Observe(act Activity) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	changed := false
+	entries := make(map[string]bool, len(act.Entries))
+	for _, id := range act.Entries {
+		entries[id] = true
+		if a.entries != nil && !a.entries[id] {
+			changed = true
+		}
+	}
+	a.entries = entries
+
+	switch {
+	case act.Urgent:
+		a.interval = a.Min
+	case changed:
+		a.interval /= 2
+	default:
+		a.interval *= 2
+	}
+
+	if a.interval < a.Min {
+		a.interval = a.Min
+	}
+	if a.interval > a.Max {
+		a.interval = a.Max
+	}
+}
@@ -0,0 +1,123 @@
+package schedule
+
+import (
+	"testing"
+	"time"
+)
+
+func TestAdaptiveObserve(t *testing.T) {
+	const (
+		min = time.Minute
+		max = 16 * time.Minute
+	)
+
+	tests := []struct {
+		name     string
+		interval time.Duration
+		act      Activity
+		want     time.Duration
+	}{
+		{name: "no change", interval: 2 * time.Minute, act: Activity{Entries: []string{"a", "b"}}, want: 4 * time.Minute},
+		{name: "no change at max", interval: max, act: Activity{Entries: []string{"a", "b"}}, want: max},
+		{name: "no change toward max", interval: 10 * time.Minute, act: Activity{Entries: []string{"a"}}, want: max},
+		{name: "new entry", interval: 8 * time.Minute, act: Activity{Entries: []string{"a", "b", "c"}}, want: 4 * time.Minute},
+		{name: "new entry at min", interval: min, act: Activity{Entries: []string{"c"}}, want: min},
+		{name: "new entry toward min", interval: 90 * time.Second, act: Activity{Entries: []string{"c"}}, want: min},
+		{name: "dropped entry", interval: 2 * time.Minute, act: Activity{Entries: []string{"a"}}, want: 4 * time.Minute},
+		{name: "urgent", interval: max, act: Activity{Entries: []string{"a", "b"}, Urgent: true}, want: min},
+		{name: "urgent with new entry", interval: 8 * time.Minute, act: Activity{Entries: []string{"c"}, Urgent: true}, want: min},
+	}
+
+	for _, tt := range tests {
+		a := NewAdaptive(min, max)
+
+		// The entries of the previous poll are a and b.
+		a.Observe(Activity{Entries: []string{"a", "b"}})
+		a.interval = tt.interval
+
+		a.Observe(tt.act)
+		if got := a.Current(); got != tt.want {
+			t.Errorf("%s: interval is %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestAdaptiveFirstPoll(t *testing.T) {
+	a := NewAdaptive(time.Minute, 16*time.Minute)
+	if got := a.Current(); got != time.Minute {
+		t.Fatalf("initial interval is %v, want %v", got, time.Minute)
+	}
+
+	// The entries of the first poll are not new, so the interval is doubled.
+	a.Observe(Activity{Entries: []string{"a", "b"}})
+	if got := a.Current(); got != 2*time.Minute {
+		t.Errorf("interval after first poll is %v, want %v", got, 2*time.Minute)
+	}
+
+	from := time.Date(2019, 3, 25, 8, 0, 0, 0, time.UTC)
+	if got := a.Next(from); !got.Equal(from.Add(2 * time.Minute)) {
+		t.Errorf("next is %v, want %v", got, from.Add(2*time.Minute))
+	}
+}
+
+func TestAdaptiveSequence(t *testing.T) {
+	a := NewAdaptive(time.Minute, 8*time.Minute)
+
+	// The interval backs off while the feed is quiet, and comes back as the feed becomes active.
+	acts := []struct {
+		act  Activity
+		want time.Duration
+	}{
+		{act: Activity{Entries: []string{"a"}}, want: 2 * time.Minute},
+		{act: Activity{Entries: []string{"a"}}, want: 4 * time.Minute},
+		{act: Activity{Entries: []string{"a"}}, want: 8 * time.Minute},
+		{act: Activity{Entries: []string{"a"}}, want: 8 * time.Minute},
+		{act: Activity{Entries: []string{"a", "b"}}, want: 4 * time.Minute},
+		{act: Activity{Entries: []string{"a", "b"}, Urgent: true}, want: time.Minute},
+		{act: Activity{Entries: []string{"a", "b"}, Urgent: true}, want: time.Minute},
+		{act: Activity{Entries: []string{"a", "b"}}, want: 2 * time.Minute},
+	}
+
+	for i, tt := range acts {
+		a.Observe(tt.act)
+		if got := a.Current(); got != tt.want {
+			t.Errorf("poll %d: interval is %v, want %v", i, got, tt.want)
+		}
+	}
+}
+
+func TestSchedulerAdaptive(t *testing.T) {
+	const min = 50 * time.Millisecond
+
+	a := NewAdaptive(min, 8*min)
+	s := New(Config{
+		Schedules: map[string]Schedule{"feed": a},
+		Immediate: true,
+	})
+	defer s.Stop()
+
+	// The activity observed by the run adapts the schedule of the feed before the next run.
+	for i, want := range []time.Duration{2 * min, 4 * min} {
+		tick := receive(s, time.Second)
+		if tick == nil {
+			t.Fatalf("run %d is not sent", i)
+		}
+		tick.Observe(Activity{Entries: []string{"a"}})
+		done := time.Now()
+		tick.Done()
+
+		next := receive(s, time.Second)
+		if next == nil {
+			t.Fatalf("run %d is not sent", i+1)
+		}
+		if d := next.Time.Sub(done); d < want-min/2 || d > want+min {
+			t.Errorf("run %d is %v after the previous one, want about %v", i+1, d, want)
+		}
+		if got := a.Current(); got != want {
+			t.Errorf("interval after run %d is %v, want %v", i, got, want)
+		}
+
+		// A run without the activity keeps the interval.
+		next.Done()
+	}
+}
@@ -0,0 +1,212 @@
+package schedule
+
+import (
+	"context"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/robfig/cron/v3"
+
+	"github.com/hlts2/gweather/internal/log"
+	"github.com/hlts2/gweather/internal/metrics"
+)
+
+const (
+	// OverlapSkip skips the runs which are due while the previous run of the feed is running.
+	OverlapSkip = "skip"
+
+	// OverlapQueue runs the feed once right after the previous run when runs are due while it is running.
+	OverlapQueue = "queue"
+)
+
+// Schedule returns the next time to run after the given time.
+type Schedule interface {
+	Next(time.Time) time.Time
+}
+
+// Parse returns Schedule of spec, which is a cron expression (e.g. 5 * * * *) or a descriptor (e.g. @hourly, @every 3m).
+func Parse(spec string) (Schedule, error) {
+	s, err := cron.ParseStandard(spec)
+	if err != nil {
+		return nil, errors.Wrapf(err, "faild to parse schedule: %s", spec)
+	}
+	return s, nil
+}
+
+// Every returns Schedule which runs every d.
+func Every(d time.Duration) Schedule {
+	return cron.Every(d)
+}
+
+// Interval returns the longest interval between the runs of s, which is used as the deadline of the polls.
+func Interval(s Schedule) time.Duration {
+	switch t := s.(type) {
+	case cron.ConstantDelaySchedule:
+		return t.Delay
+	case *Adaptive:
+		return t.Max
+	}
+
+	var max time.Duration
+	t := s.Next(time.Now())
+	for i := 0; i < 24; i++ {
+		next := s.Next(t)
+		if d := next.Sub(t); d > max {
+			max = d
+		}
+		t = next
+	}
+	return max
+}
+
+// Config represents the configuration of Scheduler.
+type Config struct {
+	// Schedules are the schedules of the feeds.
+	Schedules map[string]Schedule
+
+	// Jitter is the maximum random delay added to each scheduled run.
+	Jitter time.Duration
+
+	// Overlap is OverlapSkip or OverlapQueue.
+	Overlap string
+
+	// Immediate runs every feed at once on start.
+	Immediate bool
+}
+
+// Tick represents a run of the feed.
+type Tick struct {
+	Feed string
+
+	// Time is the time when the run was sent.
+	Time time.Time
+
+	done     chan struct{}
+	activity *Activity
+}
+
+// Observe records the activity of the run, which adapts the schedule of the feed if it is Adaptive.
+// It must be called before Done.
+func (t *Tick) Observe(act Activity) {
+	t.activity = &act
+}
+
+// Done notifies the scheduler that the run has finished. The next run of the feed is never sent before it.
+func (t *Tick) Done() {
+	close(t.done)
+}
+
+// Scheduler sends the runs of the feeds by their schedules.
+// The runs of a feed never overlap, and the runs of the feeds which are due while the previous run
+// is running are skipped or queued by Overlap.
+type Scheduler struct {
+	c      chan *Tick
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// New returns Scheduler which starts sending the runs of cfg.
+func New(cfg Config) *Scheduler {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	s := &Scheduler{
+		c:      make(chan *Tick),
+		cancel: cancel,
+	}
+
+	for feed, sched := range cfg.Schedules {
+		s.wg.Add(1)
+		go func(feed string, sched Schedule) {
+			defer s.wg.Done()
+			s.run(ctx, cfg, feed, sched)
+		}(feed, sched)
+	}
+	return s
+}
+
+// C returns the channel which receives the runs.
+// The receiver must call Done of the tick when the run has finished.
+func (s *Scheduler) C() <-chan *Tick {
+	return s.c
+}
+
+// Stop stops sending the runs. The running tick must be done before stopping.
+func (s *Scheduler) Stop() {
+	s.cancel()
+	s.wg.Wait()
+}
+
+func (s *Scheduler) run(ctx context.Context, cfg Config, feed string, sched Schedule) {
+	l := log.New(log.SubsystemApp).With("feed", feed)
+
+	next, immediate := time.Now(), cfg.Immediate
+	if !immediate {
+		next = sched.Next(next)
+	}
+
+	for {
+		delay := time.Until(next)
+		if cfg.Jitter > 0 && !immediate {
+			delay += time.Duration(rand.Int63n(int64(cfg.Jitter)))
+		}
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+
+		t := &Tick{
+			Feed: feed,
+			Time: time.Now(),
+			done: make(chan struct{}),
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case s.c <- t:
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.done:
+		}
+
+		if a, ok := sched.(*Adaptive); ok && t.activity != nil {
+			prev := a.Current()
+			a.Observe(*t.activity)
+
+			if cur := a.Current(); cur != prev {
+				l.With("urgent", t.activity.Urgent).Infof("Adapt poll interval: %v -> %v", prev, cur)
+			}
+			metrics.ScheduleInterval.WithLabelValues(feed).Set(a.Current().Seconds())
+		}
+
+		now := time.Now()
+		next, immediate = sched.Next(now), false
+
+		skipped := skips(sched, t.Time, now)
+		if skipped > 0 && cfg.Overlap == OverlapQueue {
+			// One of the runs due while running is run at once.
+			next, immediate, skipped = now, true, skipped-1
+		}
+		if skipped > 0 {
+			l.Warnf("Previous run took longer than the schedule, skip runs: %d", skipped)
+			metrics.ScheduleSkipped.WithLabelValues(feed).Add(float64(skipped))
+		}
+	}
+}
+
+// skips returns the number of the runs of sched between from and to.
+func skips(sched Schedule, from, to time.Time) int {
+	n := 0
+	for t := sched.Next(from); t.Before(to) && n < 1000; t = sched.Next(t) {
+		n++
+	}
+	return n
+}
@@ -0,0 +1,220 @@
+package schedule
+
+import (
+	"testing"
+	"time"
+)
+
+// interval is Schedule which runs every duration without rounding it to seconds unlike Every.
+type interval time.Duration
+
+func (d interval) Next(t time.Time) time.Time {
+	return t.Add(time.Duration(d))
+}
+
+func TestParse(t *testing.T) {
+	from := time.Date(2019, 3, 25, 8, 10, 0, 0, time.Local)
+
+	tests := []struct {
+		spec    string
+		want    time.Time
+		wantErr bool
+	}{
+		{spec: "5 * * * *", want: time.Date(2019, 3, 25, 9, 5, 0, 0, time.Local)},
+		{spec: "0,30 * * * *", want: time.Date(2019, 3, 25, 8, 30, 0, 0, time.Local)},
+		{spec: "0 9,18 * * *", want: time.Date(2019, 3, 25, 9, 0, 0, 0, time.Local)},
+		{spec: "@hourly", want: time.Date(2019, 3, 25, 9, 0, 0, 0, time.Local)},
+		{spec: "@every 3m", want: time.Date(2019, 3, 25, 8, 13, 0, 0, time.Local)},
+		{spec: "", wantErr: true},
+		{spec: "61 * * * *", wantErr: true},
+		{spec: "@every", wantErr: true},
+		{spec: "0,30 * * *", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		s, err := Parse(tt.spec)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("Parse(%q) returns error %v, want error %v", tt.spec, err, tt.wantErr)
+			continue
+		}
+		if tt.wantErr {
+			continue
+		}
+		if got := s.Next(from); !got.Equal(tt.want) {
+			t.Errorf("next of %q is %v, want %v", tt.spec, got, tt.want)
+		}
+	}
+}
+
+func TestInterval(t *testing.T) {
+	parse := func(spec string) Schedule {
+		s, err := Parse(spec)
+		if err != nil {
+			t.Fatalf("Parse(%q) returns error: %v", spec, err)
+		}
+		return s
+	}
+
+	tests := []struct {
+		name  string
+		sched Schedule
+		want  time.Duration
+	}{
+		{name: "every", sched: Every(3 * time.Minute), want: 3 * time.Minute},
+		{name: "descriptor", sched: parse("@every 90s"), want: 90 * time.Second},
+		{name: "cron", sched: parse("*/15 * * * *"), want: 15 * time.Minute},
+		// The longest interval of the runs at 9:00 and 18:00 is from 18:00 to 9:00.
+		{name: "uneven cron", sched: parse("0 9,18 * * *"), want: 15 * time.Hour},
+		{name: "adaptive", sched: NewAdaptive(time.Minute, 10*time.Minute), want: 10 * time.Minute},
+	}
+
+	for _, tt := range tests {
+		if got := Interval(tt.sched); got != tt.want {
+			t.Errorf("%s: interval is %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestSkips(t *testing.T) {
+	from := time.Date(2019, 3, 25, 8, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name string
+		to   time.Time
+		want int
+	}{
+		{name: "in time", to: from.Add(30 * time.Second), want: 0},
+		{name: "just at the next run", to: from.Add(time.Minute), want: 0},
+		{name: "one run", to: from.Add(90 * time.Second), want: 1},
+		{name: "several runs", to: from.Add(5*time.Minute + time.Second), want: 5},
+	}
+
+	for _, tt := range tests {
+		if got := skips(interval(time.Minute), from, tt.to); got != tt.want {
+			t.Errorf("%s: skips are %d, want %d", tt.name, got, tt.want)
+		}
+	}
+}
+
+// receive returns the next tick of s, or nil if no tick is sent within timeout.
+func receive(s *Scheduler, timeout time.Duration) *Tick {
+	select {
+	case t := <-s.C():
+		return t
+	case <-time.After(timeout):
+		return nil
+	}
+}
+
+func TestSchedulerOverlap(t *testing.T) {
+	const period = 100 * time.Millisecond
+
+	tests := []struct {
+		overlap string
+
+		// min and max are the bounds of the delay of the next run after the long run is done.
+		min, max time.Duration
+	}{
+		// The runs due while running are skipped, and the next one is run by the schedule.
+		{overlap: OverlapSkip, min: period / 2, max: 3 * period},
+		// One of the runs due while running is run at once.
+		{overlap: OverlapQueue, min: 0, max: period / 2},
+	}
+
+	for _, tt := range tests {
+		s := New(Config{
+			Schedules: map[string]Schedule{"feed": interval(period)},
+			Overlap:   tt.overlap,
+			Immediate: true,
+		})
+
+		first := receive(s, period)
+		if first == nil {
+			s.Stop()
+			t.Fatalf("%s: feed is not run at once", tt.overlap)
+		}
+
+		// The next run is never sent before the running one is done, even if several runs are due.
+		if tick := receive(s, 3*period+period/2); tick != nil {
+			tick.Done()
+			first.Done()
+			s.Stop()
+			t.Fatalf("%s: run overlaps the previous run", tt.overlap)
+		}
+
+		done := time.Now()
+		first.Done()
+
+		next := receive(s, 5*period)
+		if next == nil {
+			s.Stop()
+			t.Fatalf("%s: feed is not run after the long run", tt.overlap)
+		}
+		next.Done()
+		s.Stop()
+
+		if d := next.Time.Sub(done); d < tt.min || d > tt.max {
+			t.Errorf("%s: next run is %v after the long run, want between %v and %v", tt.overlap, d, tt.min, tt.max)
+		}
+	}
+}
+
+func TestSchedulerJitter(t *testing.T) {
+	const (
+		period = 50 * time.Millisecond
+		jitter = 100 * time.Millisecond
+	)
+
+	s := New(Config{
+		Schedules: map[string]Schedule{"feed": interval(period)},
+		Jitter:    jitter,
+		Immediate: true,
+	})
+	defer s.Stop()
+
+	// The immediate run on start is not delayed by the jitter.
+	start := time.Now()
+	tick := receive(s, period)
+	if tick == nil {
+		t.Fatal("feed is not run at once")
+	}
+	if d := tick.Time.Sub(start); d >= period {
+		t.Errorf("immediate run is delayed by %v", d)
+	}
+
+	// The scheduled runs are delayed by the jitter at most.
+	for i := 0; i < 5; i++ {
+		done := time.Now()
+		tick.Done()
+
+		if tick = receive(s, period+jitter+period); tick == nil {
+			t.Fatalf("run %d is not sent within the jitter", i)
+		}
+		if d := tick.Time.Sub(done); d < period || d > period+jitter+period/2 {
+			t.Errorf("run %d is %v after the previous one, want between %v and %v", i, d, period, period+jitter)
+		}
+	}
+	tick.Done()
+}
+
+func TestSchedulerFeeds(t *testing.T) {
+	s := New(Config{
+		Schedules: map[string]Schedule{
+			"a": interval(50 * time.Millisecond),
+			"b": interval(time.Hour),
+		},
+	})
+	defer s.Stop()
+
+	// Each feed runs by its own schedule, and the runs of a feed don't wait for the others.
+	for i := 0; i < 3; i++ {
+		tick := receive(s, time.Second)
+		if tick == nil {
+			t.Fatalf("run %d is not sent", i)
+		}
+		if tick.Feed != "a" {
+			t.Errorf("run %d is of %s, want a", i, tick.Feed)
+		}
+		tick.Done()
+	}
+}
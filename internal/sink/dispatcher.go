@@ -0,0 +1,496 @@
+package sink
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	redigo "github.com/gomodule/redigo/redis"
+	"github.com/pkg/errors"
+
+	"github.com/hlts2/gweather/internal/log"
+	"github.com/hlts2/gweather/internal/metrics"
+	"github.com/hlts2/gweather/internal/redis"
+	"github.com/hlts2/gweather/internal/store"
+)
+
+const (
+	// consumer is the name of the consumer in the group of each sink. There is a single consumer, so that the events are delivered in order.
+	consumer = "gweather"
+
+	// pollInterval is the interval of reading the outbox without notification, e.g. the events written by the previous leader.
+	// The outbox is also trimmed at the interval.
+	pollInterval = 5 * time.Second
+
+	// trimBatchSize is the maximum number of the entries deleted from the outbox at once.
+	trimBatchSize = 1000
+
+	minRetry = time.Second
+	maxRetry = 30 * time.Second
+)
+
+// Dispatcher delivers the events in the outbox of the store to the sinks.
+// Each sink reads the outbox as a consumer group named by the sink, and the entries are acknowledged after the sink has written them,
+// so that the events are delivered at least once even if the sink or this replica fails.
+//
+// The outbox keeps the latest size entries, which are also replayed by store.Store.Events after they are delivered.
+// The older ones are trimmed even if they have not been delivered, e.g. while a sink is failing, which are counted by the sinks as trimmed.
+//
+// Dispatcher implements store.Notifier to read the outbox as soon as the events are written.
+type Dispatcher struct {
+	mu        sync.Mutex
+	pool      redis.Pool
+	key       string
+	sinks     []Sink
+	batchSize int
+	size      int
+	active    func() bool
+	wake      []chan struct{}
+}
+
+// NewDispatcher returns Dispatcher which delivers the events in the outbox of the store with prefix by pool to sinks.
+// At most batchSize events are written to a sink at once, and at most size events are kept in the outbox.
+// The events are delivered only while active returns true, e.g. by the leader, and always if active is nil.
+func NewDispatcher(pool redis.Pool, prefix string, sinks []Sink, batchSize, size int, active func() bool) *Dispatcher {
+	if active == nil {
+		active = func() bool { return true }
+	}
+
+	d := &Dispatcher{
+		pool:      pool,
+		key:       prefix + store.OutboxKey,
+		sinks:     sinks,
+		batchSize: batchSize,
+		size:      size,
+		active:    active,
+		wake:      make([]chan struct{}, len(sinks)),
+	}
+	for i := range d.wake {
+		d.wake[i] = make(chan struct{}, 1)
+	}
+	return d
+}
+
+// Reset replaces the pool and the prefix when the configuration is reloaded.
+func (d *Dispatcher) Reset(pool redis.Pool, prefix string) {
+	d.mu.Lock()
+	d.pool, d.key = pool, prefix+store.OutboxKey
+	d.mu.Unlock()
+
+	d.Notify(context.Background(), nil)
+}
+
+// Notify wakes the sinks up to read the outbox. The events themselves are read from the outbox.
+func (d *Dispatcher) Notify(ctx context.Context, evs []*store.Event) {
+	for _, c := range d.wake {
+		select {
+		case c <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// Run delivers the events to the sinks until ctx is canceled, and then closes the sinks.
+func (d *Dispatcher) Run(ctx context.Context) {
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		d.runTrim(ctx)
+	}()
+
+	for i, s := range d.sinks {
+		wg.Add(1)
+		go func(s Sink, wake <-chan struct{}) {
+			defer wg.Done()
+			d.run(ctx, s, wake)
+		}(s, d.wake[i])
+	}
+	wg.Wait()
+
+	for _, s := range d.sinks {
+		if err := s.Close(); err != nil {
+			log.New(log.SubsystemNotifier).With("sink", s.Name()).Errorf("faild to close sink: %v", err)
+		}
+	}
+}
+
+// run delivers the events to s until ctx is canceled. The delivery is retried with backoff while it fails.
+func (d *Dispatcher) run(ctx context.Context, s Sink, wake <-chan struct{}) {
+	l := log.New(log.SubsystemNotifier).With("sink", s.Name())
+	retry := minRetry
+
+	for {
+		var err error
+		if d.active() {
+			err = d.drain(ctx, s)
+		}
+		if ctx.Err() != nil {
+			return
+		}
+
+		interval, woken := pollInterval, wake
+		if err != nil {
+			l.Warnf("faild to deliver events, retry in %v: %v", retry, err)
+
+			// The notifications don't shorten the backoff.
+			interval, woken = retry, nil
+			if retry *= 2; retry > maxRetry {
+				retry = maxRetry
+			}
+		} else {
+			retry = minRetry
+		}
+
+		t := time.NewTimer(interval)
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return
+		case <-woken:
+			t.Stop()
+		case <-t.C:
+		}
+	}
+}
+
+// drain delivers the events in the outbox to s until no event is left.
+// The pending entries, which were read but not acknowledged before, are delivered again first.
+func (d *Dispatcher) drain(ctx context.Context, s Sink) error {
+	d.mu.Lock()
+	pool, key := d.pool, d.key
+	d.mu.Unlock()
+
+	conn, err := pool.GetContext(ctx)
+	if err != nil {
+		return errors.Wrap(err, "faild to get redis connection")
+	}
+	defer conn.Close()
+
+	group := s.Name()
+	if _, err := conn.Do("XGROUP", "CREATE", key, group, "0", "MKSTREAM"); err != nil && !strings.HasPrefix(err.Error(), "BUSYGROUP") {
+		return errors.Wrapf(err, "faild to create consumer group: %s", key)
+	}
+
+	id := "0"
+	for ctx.Err() == nil && d.active() {
+		entries, err := readGroup(conn, key, group, id, d.batchSize)
+		if err != nil {
+			return err
+		}
+		if len(entries) == 0 {
+			if id == "0" {
+				// No entry is pending, so the new entries are read.
+				id = ">"
+				continue
+			}
+			return nil
+		}
+
+		if err := d.deliver(ctx, conn, key, s, entries); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// deliver writes the events of the entries to s, and acknowledges the entries.
+func (d *Dispatcher) deliver(ctx context.Context, conn redigo.Conn, key string, s Sink, entries []entry) error {
+	l := log.New(log.SubsystemNotifier).With("sink", s.Name())
+
+	msgs := make([]*Message, 0, len(entries))
+	ids := make([]interface{}, 0, len(entries))
+	for _, e := range entries {
+		ids = append(ids, e.id)
+
+		// The value of a pending entry is nil if it has been trimmed from the outbox.
+		if e.value == nil {
+			l.With("entry_id", e.id).Warn("Drop event trimmed from outbox")
+			metrics.SinkMessages.WithLabelValues(s.Name(), metrics.ResultTrimmed).Inc()
+			continue
+		}
+
+		m, err := NewMessage(e.id, e.value)
+		if err != nil {
+			l.Warnf("Drop invalid event: %v", err)
+			metrics.SinkMessages.WithLabelValues(s.Name(), metrics.ResultDropped).Inc()
+			continue
+		}
+		msgs = append(msgs, m)
+	}
+
+	if len(msgs) > 0 {
+		if err := s.Write(ctx, msgs); err != nil {
+			metrics.SinkMessages.WithLabelValues(s.Name(), metrics.ResultFailed).Add(float64(len(msgs)))
+			return errors.Wrap(err, "faild to write events")
+		}
+	}
+
+	args := append([]interface{}{key, s.Name()}, ids...)
+	if _, err := conn.Do("XACK", args...); err != nil {
+		return errors.Wrapf(err, "faild to acknowledge events: %s", key)
+	}
+
+	if len(msgs) > 0 {
+		metrics.SinkMessages.WithLabelValues(s.Name(), metrics.ResultDelivered).Add(float64(len(msgs)))
+		metrics.SinkLastDelivery.WithLabelValues(s.Name()).SetToCurrentTime()
+		l.Debugf("Delivered events: %d", len(msgs))
+	}
+	return nil
+}
+
+// runTrim trims the outbox at the interval of the polls until ctx is canceled.
+func (d *Dispatcher) runTrim(ctx context.Context) {
+	l := log.New(log.SubsystemNotifier)
+
+	t := time.NewTicker(pollInterval)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+
+		if !d.active() {
+			continue
+		}
+		if err := d.trim(ctx); err != nil {
+			l.Warnf("faild to trim outbox: %v", err)
+		}
+	}
+}
+
+// trim deletes the oldest entries of the outbox exceeding the size, even if they have not been delivered.
+// The pending entries trimmed are counted when they are read again, and the others are counted here.
+func (d *Dispatcher) trim(ctx context.Context) error {
+	d.mu.Lock()
+	pool, key := d.pool, d.key
+	d.mu.Unlock()
+
+	conn, err := pool.GetContext(ctx)
+	if err != nil {
+		return errors.Wrap(err, "faild to get redis connection")
+	}
+	defer conn.Close()
+
+	groups, err := readGroups(conn, key)
+	if err != nil {
+		return err
+	}
+
+	// oldest is the oldest entry which has not been acknowledged by a sink. The entries before it are not counted when they are deleted.
+	var oldest string
+	for _, s := range d.sinks {
+		g, ok := groups[s.Name()]
+		if !ok {
+			// The group reads the outbox from the first entry once it is created.
+			return nil
+		}
+
+		next := g.lastDelivered
+		if g.pending > 0 {
+			// The summary of the pending entries is the number, the smallest and the greatest IDs, and the consumers.
+			reply, err := redigo.Values(conn.Do("XPENDING", key, s.Name()))
+			if err != nil {
+				return errors.Wrapf(err, "faild to get pending entries: %s", key)
+			}
+			if len(reply) < 2 {
+				return errors.Errorf("unexpected reply of pending entries: %s", key)
+			}
+			if next, err = redigo.String(reply[1], nil); err != nil {
+				return errors.Wrapf(err, "unexpected reply of pending entries: %s", key)
+			}
+		}
+
+		if oldest == "" || compareID(next, oldest) < 0 {
+			oldest = next
+		}
+	}
+	if oldest == "" {
+		return nil
+	}
+
+	n, err := redigo.Int(conn.Do("XLEN", key))
+	if err != nil {
+		return errors.Wrapf(err, "faild to get length of stream: %s", key)
+	}
+	if n <= d.size {
+		return nil
+	}
+
+	// The oldest entries are deleted by XDEL, which is available in all versions of redis unlike XTRIM MINID.
+	head, err := redigo.Values(conn.Do("XRANGE", key, "-", "+", "COUNT", trimBatchSize))
+	if err != nil {
+		return errors.Wrapf(err, "faild to read stream: %s", key)
+	}
+
+	ids := make([]interface{}, 0, len(head))
+	unread := make(map[string]int)
+	for _, v := range head {
+		id, err := entryID(v)
+		if err != nil {
+			return errors.Wrapf(err, "unexpected reply of stream: %s", key)
+		}
+
+		// The entries exceeding the size are deleted even if they have not been delivered,
+		// and the ones after the last delivered entry of each sink are counted.
+		if n-len(ids) <= d.size {
+			break
+		}
+		if compareID(id, oldest) >= 0 {
+			for _, s := range d.sinks {
+				if compareID(id, groups[s.Name()].lastDelivered) > 0 {
+					unread[s.Name()]++
+				}
+			}
+		}
+		ids = append(ids, id)
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+
+	if _, err := conn.Do("XDEL", append([]interface{}{key}, ids...)...); err != nil {
+		return errors.Wrapf(err, "faild to trim stream: %s", key)
+	}
+
+	for name, c := range unread {
+		log.New(log.SubsystemNotifier).With("sink", name).Warnf("Outbox is full, drop events not delivered: %d", c)
+		metrics.SinkMessages.WithLabelValues(name, metrics.ResultTrimmed).Add(float64(c))
+	}
+	return nil
+}
+
+// group represents the state of a consumer group of the outbox.
+type group struct {
+	pending       int64
+	lastDelivered string
+}
+
+// readGroups returns the consumer groups of the stream key by name.
+func readGroups(conn redigo.Conn, key string) (map[string]group, error) {
+	reply, err := redigo.Values(conn.Do("XINFO", "GROUPS", key))
+	if err != nil {
+		if strings.Contains(err.Error(), "no such key") {
+			return nil, nil
+		}
+		return nil, errors.Wrapf(err, "faild to get consumer groups: %s", key)
+	}
+
+	groups := make(map[string]group, len(reply))
+	for _, r := range reply {
+		// Each group is a list of the pairs of a field and its value.
+		fields, err := redigo.Values(r, nil)
+		if err != nil {
+			return nil, errors.Wrapf(err, "unexpected reply of consumer groups: %s", key)
+		}
+
+		var (
+			name string
+			g    group
+		)
+		for i := 0; i+1 < len(fields); i += 2 {
+			field, _ := redigo.String(fields[i], nil)
+			switch field {
+			case "name":
+				name, _ = redigo.String(fields[i+1], nil)
+			case "pending":
+				g.pending, _ = redigo.Int64(fields[i+1], nil)
+			case "last-delivered-id":
+				g.lastDelivered, _ = redigo.String(fields[i+1], nil)
+			}
+		}
+		groups[name] = g
+	}
+	return groups, nil
+}
+
+// entryID returns the ID of an entry of the reply of XRANGE.
+func entryID(v interface{}) (string, error) {
+	e, err := redigo.Values(v, nil)
+	if err != nil || len(e) == 0 {
+		return "", errors.New("unexpected entry")
+	}
+	return redigo.String(e[0], nil)
+}
+
+// compareID returns -1, 0 or +1 when the entry ID a is before, the same as or after b.
+func compareID(a, b string) int {
+	ams, aseq := splitID(a)
+	bms, bseq := splitID(b)
+
+	switch {
+	case ams < bms || (ams == bms && aseq < bseq):
+		return -1
+	case ams == bms && aseq == bseq:
+		return 0
+	default:
+		return 1
+	}
+}
+
+// splitID returns the milliseconds and the sequence number of the entry ID, e.g. 1553502456000-0.
+func splitID(id string) (uint64, uint64) {
+	ms, seq := id, ""
+	if i := strings.IndexByte(id, '-'); i >= 0 {
+		ms, seq = id[:i], id[i+1:]
+	}
+	m, _ := strconv.ParseUint(ms, 10, 64)
+	s, _ := strconv.ParseUint(seq, 10, 64)
+	return m, s
+}
+
+// entry is an entry of the outbox.
+type entry struct {
+	id    string
+	value []byte
+}
+
+// readGroup reads at most count entries of the stream key after id as the consumer of group.
+func readGroup(conn redigo.Conn, key, group, id string, count int) ([]entry, error) {
+	streams, err := redigo.Values(conn.Do("XREADGROUP", "GROUP", group, consumer, "COUNT", count, "STREAMS", key, id))
+	if err == redigo.ErrNil {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "faild to read stream: %s", key)
+	}
+
+	var entries []entry
+	for _, st := range streams {
+		// Each stream is a pair of the key and the entries.
+		kv, err := redigo.Values(st, nil)
+		if err != nil || len(kv) != 2 {
+			return nil, errors.Errorf("unexpected reply of stream: %s", key)
+		}
+		es, err := redigo.Values(kv[1], nil)
+		if err != nil {
+			return nil, errors.Wrapf(err, "unexpected reply of stream: %s", key)
+		}
+
+		for _, e := range es {
+			// Each entry is a pair of the ID and the fields.
+			ev, err := redigo.Values(e, nil)
+			if err != nil || len(ev) != 2 {
+				return nil, errors.Errorf("unexpected reply of stream: %s", key)
+			}
+			id, err := redigo.String(ev[0], nil)
+			if err != nil {
+				return nil, errors.Wrapf(err, "unexpected reply of stream: %s", key)
+			}
+
+			ent := entry{id: id}
+			if fields, err := redigo.StringMap(ev[1], nil); err == nil {
+				if v, ok := fields[store.OutboxField]; ok {
+					ent.value = []byte(v)
+				}
+			}
+			entries = append(entries, ent)
+		}
+	}
+	return entries, nil
+}
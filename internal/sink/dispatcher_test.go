@@ -0,0 +1,391 @@
+package sink
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+
+	"github.com/hlts2/gweather/internal/redis"
+	"github.com/hlts2/gweather/internal/store"
+)
+
+// fakeSink records the keys of the events written to it. write is called before they are recorded, and the write fails if it returns error.
+type fakeSink struct {
+	mu      sync.Mutex
+	name    string
+	batches [][]string
+	write   func(n int, msgs []*Message) error
+	calls   int
+	closed  bool
+}
+
+func (s *fakeSink) Name() string {
+	return s.name
+}
+
+func (s *fakeSink) Write(ctx context.Context, msgs []*Message) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.calls++
+	if s.write != nil {
+		if err := s.write(s.calls, msgs); err != nil {
+			return err
+		}
+	}
+
+	keys := make([]string, 0, len(msgs))
+	for _, m := range msgs {
+		keys = append(keys, m.Event.Key)
+	}
+	s.batches = append(s.batches, keys)
+	return nil
+}
+
+func (s *fakeSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.closed = true
+	return nil
+}
+
+// written returns the keys of the events written to the sink in order.
+func (s *fakeSink) written() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var keys []string
+	for _, b := range s.batches {
+		keys = append(keys, b...)
+	}
+	return keys
+}
+
+func newTestPool(t *testing.T) (redis.Pool, *miniredis.Miniredis) {
+	s := miniredis.RunT(t)
+
+	pool, err := redis.New("redis://"+s.Addr(), redis.Options{})
+	if err != nil {
+		t.Fatalf("faild to create redis pool: %v", err)
+	}
+	t.Cleanup(func() {
+		pool.Close()
+	})
+	return pool, s
+}
+
+// addEvents appends the report events of the keys from to to the outbox, and returns the keys.
+func addEvents(t *testing.T, s *miniredis.Miniredis, from, to int) []string {
+	var keys []string
+	for i := from; i <= to; i++ {
+		key := fmt.Sprintf("key%d", i)
+		b, _ := json.Marshal(&store.Event{
+			ID:   fmt.Sprintf("%d-%d", 1553502456+i, i),
+			Type: store.EventReport,
+			Key:  key,
+		})
+		if _, err := s.XAdd(store.OutboxKey, "*", []string{store.OutboxField, string(b)}); err != nil {
+			t.Fatalf("faild to add event: %v", err)
+		}
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+func length(t *testing.T, s *miniredis.Miniredis) int {
+	entries, err := s.Stream(store.OutboxKey)
+	if err != nil {
+		t.Fatalf("faild to read outbox: %v", err)
+	}
+	return len(entries)
+}
+
+func TestDispatcherDrain(t *testing.T) {
+	pool, s := newTestPool(t)
+	sk := &fakeSink{name: "fake"}
+	d := NewDispatcher(pool, "", []Sink{sk}, 2, 100, nil)
+
+	want := addEvents(t, s, 1, 5)
+	if err := d.drain(context.Background(), sk); err != nil {
+		t.Fatalf("drain returns error: %v", err)
+	}
+
+	// The events are written in order in batches of the batch size.
+	if got := sk.written(); !reflect.DeepEqual(got, want) {
+		t.Errorf("written events are %v, want %v", got, want)
+	}
+	if len(sk.batches) != 3 {
+		t.Errorf("number of batches is %d, want 3", len(sk.batches))
+	}
+
+	// The events written later are delivered by the next drain without the delivered ones.
+	more := addEvents(t, s, 6, 6)
+	if err := d.drain(context.Background(), sk); err != nil {
+		t.Fatalf("drain returns error: %v", err)
+	}
+	if got := sk.written(); !reflect.DeepEqual(got, append(want, more...)) {
+		t.Errorf("written events are %v, want %v", got, append(want, more...))
+	}
+}
+
+func TestDispatcherRedelivery(t *testing.T) {
+	pool, s := newTestPool(t)
+
+	// The first write fails after the broker may have received the messages.
+	sk := &fakeSink{
+		name: "fake",
+		write: func(n int, msgs []*Message) error {
+			if n == 1 {
+				return errors.New("broker is unavailable")
+			}
+			return nil
+		},
+	}
+	d := NewDispatcher(pool, "", []Sink{sk}, 2, 100, nil)
+
+	want := addEvents(t, s, 1, 3)
+	if err := d.drain(context.Background(), sk); err == nil {
+		t.Fatal("drain returns no error of the failed write")
+	}
+	if got := sk.written(); len(got) != 0 {
+		t.Fatalf("written events are %v after the failed write", got)
+	}
+
+	// The pending entries are written again first, and then the new ones in order.
+	if err := d.drain(context.Background(), sk); err != nil {
+		t.Fatalf("drain returns error: %v", err)
+	}
+	if got := sk.written(); !reflect.DeepEqual(got, want) {
+		t.Errorf("written events are %v, want %v", got, want)
+	}
+}
+
+func TestDispatcherLeaderLoss(t *testing.T) {
+	pool, s := newTestPool(t)
+
+	var (
+		mu     sync.Mutex
+		leader = true
+	)
+	active := func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return leader
+	}
+
+	// The leadership is lost while the first batch is written, and the write fails.
+	old := &fakeSink{
+		name: "fake",
+		write: func(n int, msgs []*Message) error {
+			mu.Lock()
+			leader = false
+			mu.Unlock()
+			return errors.New("connection is lost")
+		},
+	}
+	want := addEvents(t, s, 1, 5)
+
+	if err := NewDispatcher(pool, "", []Sink{old}, 2, 100, active).drain(context.Background(), old); err == nil {
+		t.Fatal("drain returns no error of the failed write")
+	}
+	if old.calls != 1 {
+		t.Errorf("sink is written %d times after losing the leadership, want 1", old.calls)
+	}
+
+	// The follower doesn't read the outbox.
+	if err := NewDispatcher(pool, "", []Sink{old}, 2, 100, active).drain(context.Background(), old); err != nil {
+		t.Fatalf("drain returns error: %v", err)
+	}
+	if old.calls != 1 {
+		t.Errorf("sink is written %d times by the follower, want 1", old.calls)
+	}
+
+	// The new leader delivers the batch left pending by the previous one first, so the order is kept.
+	cur := &fakeSink{name: "fake"}
+	if err := NewDispatcher(pool, "", []Sink{cur}, 2, 100, nil).drain(context.Background(), cur); err != nil {
+		t.Fatalf("drain returns error: %v", err)
+	}
+	if got := cur.written(); !reflect.DeepEqual(got, want) {
+		t.Errorf("written events are %v, want %v", got, want)
+	}
+}
+
+func TestDispatcherLeaderLossAfterWrite(t *testing.T) {
+	pool, s := newTestPool(t)
+
+	var (
+		mu     sync.Mutex
+		leader = true
+	)
+	active := func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return leader
+	}
+
+	// The leadership is lost after the first batch is written, so the batch is acknowledged and the rest is left.
+	old := &fakeSink{
+		name: "fake",
+		write: func(n int, msgs []*Message) error {
+			mu.Lock()
+			leader = false
+			mu.Unlock()
+			return nil
+		},
+	}
+	want := addEvents(t, s, 1, 5)
+
+	if err := NewDispatcher(pool, "", []Sink{old}, 2, 100, active).drain(context.Background(), old); err != nil {
+		t.Fatalf("drain returns error: %v", err)
+	}
+	if got := old.written(); !reflect.DeepEqual(got, want[:2]) {
+		t.Errorf("written events of the previous leader are %v, want %v", got, want[:2])
+	}
+
+	cur := &fakeSink{name: "fake"}
+	if err := NewDispatcher(pool, "", []Sink{cur}, 2, 100, nil).drain(context.Background(), cur); err != nil {
+		t.Fatalf("drain returns error: %v", err)
+	}
+	if got := cur.written(); !reflect.DeepEqual(got, want[2:]) {
+		t.Errorf("written events of the new leader are %v, want %v", got, want[2:])
+	}
+}
+
+func TestDispatcherTrim(t *testing.T) {
+	tests := []struct {
+		name string
+
+		// delivered is true if the events are delivered to the second sink before trimming.
+		delivered bool
+		events    int
+		size      int
+		want      int
+	}{
+		{name: "delivered", delivered: true, events: 5, size: 2, want: 2},
+		{name: "within size", delivered: true, events: 5, size: 10, want: 5},
+		// The events exceeding the size are trimmed even if they have not been delivered to the second sink.
+		{name: "undelivered", events: 5, size: 3, want: 3},
+	}
+
+	for _, tt := range tests {
+		pool, s := newTestPool(t)
+		first, second := &fakeSink{name: "first"}, &fakeSink{name: "second"}
+		d := NewDispatcher(pool, "", []Sink{first, second}, 100, tt.size, nil)
+
+		keys := addEvents(t, s, 1, tt.events)
+		if err := d.drain(context.Background(), first); err != nil {
+			t.Fatalf("%s: drain returns error: %v", tt.name, err)
+		}
+
+		// The outbox is not trimmed until the groups of all the sinks are created.
+		if err := d.trim(context.Background()); err != nil {
+			t.Fatalf("%s: trim returns error: %v", tt.name, err)
+		}
+		if n := length(t, s); n != tt.events {
+			t.Errorf("%s: length of outbox is %d before the group of the second sink is created, want %d", tt.name, n, tt.events)
+		}
+
+		if tt.delivered {
+			if err := d.drain(context.Background(), second); err != nil {
+				t.Fatalf("%s: drain returns error: %v", tt.name, err)
+			}
+		} else {
+			conn, err := pool.GetContext(context.Background())
+			if err != nil {
+				t.Fatalf("%s: faild to get connection: %v", tt.name, err)
+			}
+			if _, err := conn.Do("XGROUP", "CREATE", store.OutboxKey, second.Name(), "0"); err != nil {
+				t.Fatalf("%s: faild to create group: %v", tt.name, err)
+			}
+			conn.Close()
+		}
+
+		if err := d.trim(context.Background()); err != nil {
+			t.Fatalf("%s: trim returns error: %v", tt.name, err)
+		}
+		if n := length(t, s); n != tt.want {
+			t.Errorf("%s: length of outbox is %d, want %d", tt.name, n, tt.want)
+		}
+
+		if !tt.delivered {
+			// Only the events left in the outbox are delivered.
+			if err := d.drain(context.Background(), second); err != nil {
+				t.Fatalf("%s: drain returns error: %v", tt.name, err)
+			}
+			if got := second.written(); !reflect.DeepEqual(got, keys[len(keys)-tt.want:]) {
+				t.Errorf("%s: written events are %v, want %v", tt.name, got, keys[len(keys)-tt.want:])
+			}
+		}
+	}
+}
+
+func TestDispatcherTrimPending(t *testing.T) {
+	pool, s := newTestPool(t)
+
+	// The first batch is left pending by the failed write, and trimmed before it is written again.
+	sk := &fakeSink{
+		name: "fake",
+		write: func(n int, msgs []*Message) error {
+			if n == 1 {
+				return errors.New("broker is unavailable")
+			}
+			return nil
+		},
+	}
+	d := NewDispatcher(pool, "", []Sink{sk}, 2, 3, nil)
+
+	keys := addEvents(t, s, 1, 5)
+	if err := d.drain(context.Background(), sk); err == nil {
+		t.Fatal("drain returns no error of the failed write")
+	}
+	if err := d.trim(context.Background()); err != nil {
+		t.Fatalf("trim returns error: %v", err)
+	}
+
+	// The trimmed pending entries are acknowledged without writing them.
+	if err := d.drain(context.Background(), sk); err != nil {
+		t.Fatalf("drain returns error: %v", err)
+	}
+	if got := sk.written(); !reflect.DeepEqual(got, keys[2:]) {
+		t.Errorf("written events are %v, want %v", got, keys[2:])
+	}
+}
+
+func TestDispatcherRun(t *testing.T) {
+	pool, s := newTestPool(t)
+	sk := &fakeSink{name: "fake"}
+	d := NewDispatcher(pool, "", []Sink{sk}, 100, 100, nil)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		d.Run(ctx)
+	}()
+
+	// The events are delivered as soon as the store notifies them, before the poll interval.
+	want := addEvents(t, s, 1, 3)
+	d.Notify(context.Background(), nil)
+
+	deadline := time.Now().Add(pollInterval / 2)
+	for len(sk.written()) < len(want) && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	cancel()
+	<-done
+
+	if got := sk.written(); !reflect.DeepEqual(got, want) {
+		t.Errorf("written events are %v, want %v", got, want)
+	}
+	if !sk.closed {
+		t.Error("sink is not closed after Run")
+	}
+}
@@ -0,0 +1,65 @@
+package sink
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/pkg/errors"
+
+	"github.com/hlts2/gweather/internal/report"
+	"github.com/hlts2/gweather/internal/store"
+)
+
+// Sink delivers the events to a message broker.
+type Sink interface {
+	// Name returns the name of the sink, which identifies the progress of the delivery in the outbox.
+	Name() string
+
+	// Write delivers the messages in order. It returns nil only when all of them are acknowledged by the broker,
+	// and the messages are written again when it fails, so the broker may receive some of them twice.
+	Write(ctx context.Context, msgs []*Message) error
+
+	// Close closes the connection to the broker.
+	Close() error
+}
+
+// Message represents an event delivered to the sinks.
+type Message struct {
+	// ID is the ID of the entry in the outbox, which is unique for each message unlike the ID of the event.
+	ID string
+
+	// Key is the area code of the event, so that the transitions of the warnings of an area are delivered in order.
+	// It is the area of the warning for a transition, and the first area code of the report for a report, or the key of the report without areas.
+	// A report is delivered once with its first area, so it is not ordered with the transitions of its other areas.
+	Key string
+
+	Event *store.Event
+
+	// Value is JSON of the event.
+	Value []byte
+}
+
+// NewMessage returns Message of the entry of the outbox whose value is JSON of the event.
+func NewMessage(id string, value []byte) (*Message, error) {
+	ev := new(store.Event)
+	if err := json.Unmarshal(value, ev); err != nil {
+		return nil, errors.Wrapf(err, "faild to unmarshal event: %s", id)
+	}
+
+	m := &Message{
+		ID:    id,
+		Key:   ev.Key,
+		Event: ev,
+		Value: value,
+	}
+
+	switch {
+	case ev.Warning != nil:
+		m.Key = ev.Warning.Area
+	case ev.Report != nil:
+		if areas, _ := report.BodyCodes(ev.Report["body"]); len(areas) > 0 {
+			m.Key = areas[0]
+		}
+	}
+	return m, nil
+}
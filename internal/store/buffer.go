@@ -0,0 +1,486 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/hlts2/gweather/internal/log"
+	"github.com/hlts2/gweather/internal/metrics"
+)
+
+// BufferConfig represents the configuration of Buffer.
+type BufferConfig struct {
+	// Size is the maximum number of reports buffered in memory.
+	Size int
+
+	// Dir is the directory to spill reports to when the memory is full. Reports are not spilled when it is empty.
+	Dir string
+
+	// DirSize is the maximum number of reports spilled to Dir.
+	DirSize int
+
+	// MinBackoff and MaxBackoff are the range of the interval of retries while the store is unavailable.
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+}
+
+type batch struct {
+	// at is the time when the batch is buffered, in unix nanoseconds. It orders the batches spilled to disk.
+	at int64
+
+	// reports is nil when the batch is spilled to disk.
+	reports map[string]map[string]interface{}
+	path    string
+	n       int
+
+	// buffered is true if the batch has waited for the store to be available, and is counted as flushed once it is written.
+	buffered bool
+}
+
+// Buffer is Store which buffers reports while the underlying store is unavailable,
+// and writes them in order once the store is back. Get, List, History, Warnings and Events are passed to the underlying store.
+type Buffer struct {
+	mu    sync.Mutex
+	store Store
+
+	cfg BufferConfig
+
+	mem, disk         []*batch
+	memSize, diskSize int
+
+	backoff time.Duration
+	retryAt time.Time
+	wake    chan struct{}
+}
+
+// NewBuffer returns Buffer which writes reports to s.
+// Reports spilled to cfg.Dir by the previous process are loaded, and written once Run is called.
+func NewBuffer(s Store, cfg BufferConfig) (*Buffer, error) {
+	b := &Buffer{
+		store: s,
+		cfg:   cfg,
+		wake:  make(chan struct{}, 1),
+	}
+
+	if cfg.Dir != "" {
+		if err := b.load(); err != nil {
+			return nil, errors.Wrapf(err, "faild to load buffered reports: %s", cfg.Dir)
+		}
+	}
+
+	b.updateMetrics()
+	metrics.StoreAvailable.Set(1)
+
+	return b, nil
+}
+
+// Reset replaces the underlying store and the configuration.
+// Buffered reports are kept, and written to the new store.
+func (b *Buffer) Reset(s Store, cfg BufferConfig) {
+	b.mu.Lock()
+	b.store = s
+	b.cfg.Size, b.cfg.DirSize = cfg.Size, cfg.DirSize
+	b.cfg.MinBackoff, b.cfg.MaxBackoff = cfg.MinBackoff, cfg.MaxBackoff
+	if b.backoff > 0 {
+		b.retryAt = time.Now()
+	}
+	b.mu.Unlock()
+
+	b.notify()
+}
+
+// Save buffers reports, which are written to the underlying store by Run after the buffered ones.
+// The store is not written by the caller, so that the polls are not blocked by a slow or unavailable store. It never returns an error.
+func (b *Buffer) Save(ctx context.Context, mm map[string]map[string]interface{}) error {
+	if len(mm) == 0 {
+		return nil
+	}
+
+	b.mu.Lock()
+	unavailable := time.Now().Before(b.retryAt)
+	b.push(ctx, &batch{
+		at:       time.Now().UnixNano(),
+		reports:  mm,
+		n:        len(mm),
+		buffered: unavailable,
+	})
+	b.mu.Unlock()
+
+	if unavailable {
+		log.FromContext(ctx, log.SubsystemStore).Debugf("Store is unavailable, buffered reports: %d", len(mm))
+	}
+
+	b.notify()
+	return nil
+}
+
+func (b *Buffer) Get(ctx context.Context, key string) (map[string]interface{}, error) {
+	return b.current().Get(ctx, key)
+}
+
+func (b *Buffer) List(ctx context.Context) (map[string]map[string]interface{}, error) {
+	return b.current().List(ctx)
+}
+
+func (b *Buffer) History(ctx context.Context, key string, limit int) ([]map[string]interface{}, error) {
+	return b.current().History(ctx, key, limit)
+}
+
+func (b *Buffer) Warnings(ctx context.Context, area string) ([]*AreaWarning, error) {
+	return b.current().Warnings(ctx, area)
+}
+
+func (b *Buffer) Events(ctx context.Context, after string, limit int) ([]*Event, error) {
+	return b.current().Events(ctx, after, limit)
+}
+
+func (b *Buffer) current() Store {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.store
+}
+
+// Run writes the buffered reports in order, and retries them with backoff while the store is unavailable, until ctx is canceled.
+func (b *Buffer) Run(ctx context.Context) {
+	for {
+		b.mu.Lock()
+		pending := len(b.mem)+len(b.disk) > 0
+		at := b.retryAt
+		b.mu.Unlock()
+
+		if pending && !time.Now().Before(at) {
+			b.flush(ctx)
+			if ctx.Err() != nil {
+				return
+			}
+			continue
+		}
+
+		var (
+			t     *time.Timer
+			retry <-chan time.Time
+		)
+		if pending {
+			t = time.NewTimer(time.Until(at))
+			retry = t.C
+		}
+
+		select {
+		case <-ctx.Done():
+		case <-b.wake:
+		case <-retry:
+		}
+
+		if t != nil {
+			t.Stop()
+		}
+
+		if ctx.Err() != nil {
+			return
+		}
+	}
+}
+
+// Close spills the reports buffered in memory to disk so that they are written by the next process.
+// The reports in memory are lost if the directory is not configured.
+func (b *Buffer) Close() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.cfg.Dir == "" || len(b.mem) == 0 {
+		return nil
+	}
+
+	for _, bt := range b.mem {
+		if err := b.spill(bt); err != nil {
+			return errors.Wrap(err, "faild to spill buffered reports")
+		}
+	}
+	b.mem, b.memSize = nil, 0
+
+	b.updateMetrics()
+	return nil
+}
+
+// push appends bt to the buffer. The oldest reports are dropped when the buffer is full.
+// Once reports have been spilled to disk, the following ones are also spilled to keep the order.
+func (b *Buffer) push(ctx context.Context, bt *batch) {
+	l := log.FromContext(ctx, log.SubsystemStore)
+	defer b.updateMetrics()
+
+	if len(b.disk) == 0 && (b.memSize+bt.n <= b.cfg.Size || len(b.mem) == 0) {
+		b.mem = append(b.mem, bt)
+		b.memSize += bt.n
+		return
+	}
+
+	if b.cfg.Dir != "" {
+		err := b.spill(bt)
+		if err == nil {
+			for b.diskSize > b.cfg.DirSize && len(b.disk) > 1 {
+				l.Warnf("Buffer is full, drop reports: %d", b.disk[0].n)
+				b.drop(b.disk[0])
+				b.disk = b.disk[1:]
+			}
+			return
+		}
+		l.Errorf("faild to spill reports, buffer them in memory: %v", err)
+	}
+
+	b.mem = append(b.mem, bt)
+	b.memSize += bt.n
+	for b.memSize > b.cfg.Size && len(b.mem) > 1 {
+		l.Warnf("Buffer is full, drop reports: %d", b.mem[0].n)
+		b.drop(b.mem[0])
+		b.mem = b.mem[1:]
+	}
+}
+
+// flush writes the buffered reports in order. It stops at the first failure and schedules the next retry.
+// It is called only by Run, and the lock is not held while writing to the store, so that the reads and the polls are not blocked by a slow store.
+func (b *Buffer) flush(ctx context.Context) {
+	l := log.FromContext(ctx, log.SubsystemStore)
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	defer b.updateMetrics()
+
+	for len(b.mem) > 0 || len(b.disk) > 0 {
+		bt, fromDisk := b.next()
+		st := b.store
+
+		mm := bt.reports
+		if fromDisk {
+			var err error
+			if mm, err = readBatch(bt.path); err != nil {
+				l.Errorf("faild to read spilled reports, drop them: %v", err)
+				if b.remove(bt) {
+					b.drop(bt)
+				}
+				continue
+			}
+		}
+
+		b.mu.Unlock()
+		err := st.Save(ctx, mm)
+		b.mu.Lock()
+
+		if err != nil {
+			werr, rejected := errors.Cause(err).(*WriteError)
+			switch {
+			case ctx.Err() != nil:
+				// The batch is kept, and spilled by Close.
+				return
+			case errors.Cause(err) == ErrNotLeader:
+				// The reports are polled and written by the new leader.
+				l.Warnf("Not leader, drop reports: %d", bt.n)
+			case rejected && !werr.Temporary():
+				// Retrying the writes rejected by redis (e.g. WRONGTYPE) never succeeds, so they are dropped not to block the others.
+				l.Errorf("faild to write reports, drop them: %v", err)
+			default:
+				b.fail(ctx, err)
+				return
+			}
+
+			// The batch may have been dropped by push while it was written.
+			if b.remove(bt) {
+				b.drop(bt)
+			}
+			continue
+		}
+
+		if !b.remove(bt) {
+			continue
+		}
+		if bt.buffered {
+			metrics.StoreBufferFlushed.Add(float64(bt.n))
+		}
+		if fromDisk {
+			os.Remove(bt.path)
+			b.diskSize -= bt.n
+		} else {
+			b.memSize -= bt.n
+		}
+	}
+
+	if b.backoff > 0 {
+		l.Info("Store is available again, flushed buffered reports")
+	}
+	b.backoff, b.retryAt = 0, time.Time{}
+	metrics.StoreAvailable.Set(1)
+}
+
+// next returns the oldest batch, and true if it is on disk.
+// The batches in memory may be newer than the ones on disk when spilling has failed.
+func (b *Buffer) next() (*batch, bool) {
+	switch {
+	case len(b.disk) == 0:
+		return b.mem[0], false
+	case len(b.mem) == 0 || b.disk[0].at < b.mem[0].at:
+		return b.disk[0], true
+	default:
+		return b.mem[0], false
+	}
+}
+
+// remove removes bt from the buffer without updating the sizes, and returns false if it is not buffered.
+func (b *Buffer) remove(bt *batch) bool {
+	for _, bs := range []*[]*batch{&b.mem, &b.disk} {
+		for i, x := range *bs {
+			if x == bt {
+				*bs = append((*bs)[:i:i], (*bs)[i+1:]...)
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (b *Buffer) fail(ctx context.Context, err error) {
+	for _, bs := range [][]*batch{b.mem, b.disk} {
+		for _, bt := range bs {
+			bt.buffered = true
+		}
+	}
+
+	b.backoff *= 2
+	if b.backoff < b.cfg.MinBackoff {
+		b.backoff = b.cfg.MinBackoff
+	}
+	if b.cfg.MaxBackoff > 0 && b.backoff > b.cfg.MaxBackoff {
+		b.backoff = b.cfg.MaxBackoff
+	}
+	if b.backoff <= 0 {
+		b.backoff = time.Second
+	}
+	b.retryAt = time.Now().Add(b.backoff)
+	metrics.StoreAvailable.Set(0)
+
+	log.FromContext(ctx, log.SubsystemStore).Warnf("Store is unavailable, retry in %v: %v", b.backoff, err)
+}
+
+func (b *Buffer) notify() {
+	select {
+	case b.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (b *Buffer) drop(bt *batch) {
+	if bt.reports == nil {
+		os.Remove(bt.path)
+		b.diskSize -= bt.n
+	} else {
+		b.memSize -= bt.n
+	}
+	metrics.StoreBufferDropped.Add(float64(bt.n))
+}
+
+func (b *Buffer) updateMetrics() {
+	metrics.StoreBuffered.WithLabelValues(metrics.LocationMemory).Set(float64(b.memSize))
+	metrics.StoreBuffered.WithLabelValues(metrics.LocationDisk).Set(float64(b.diskSize))
+}
+
+// spill writes bt to the directory, and appends it to the batches on disk.
+func (b *Buffer) spill(bt *batch) error {
+	if err := os.MkdirAll(b.cfg.Dir, 0755); err != nil {
+		return errors.Wrapf(err, "faild to create directory: %s", b.cfg.Dir)
+	}
+
+	data, err := json.Marshal(bt.reports)
+	if err != nil {
+		return errors.Wrap(err, "faild to marshal reports")
+	}
+
+	name := filepath.Join(b.cfg.Dir, fmt.Sprintf("%020d.json", bt.at))
+
+	// Write to a temporary file first so that a partial file is never loaded.
+	tmp := name + ".tmp"
+	if err := ioutil.WriteFile(tmp, data, 0644); err != nil {
+		return errors.Wrapf(err, "faild to write file: %s", tmp)
+	}
+
+	if err := os.Rename(tmp, name); err != nil {
+		os.Remove(tmp)
+		return errors.Wrapf(err, "faild to rename file: %s", tmp)
+	}
+
+	spilled := &batch{
+		at:       bt.at,
+		path:     name,
+		n:        bt.n,
+		buffered: true,
+	}
+
+	// The batches in memory are older than the ones on disk, so they are inserted in order of the time.
+	i := sort.Search(len(b.disk), func(i int) bool { return b.disk[i].at > bt.at })
+	b.disk = append(b.disk, nil)
+	copy(b.disk[i+1:], b.disk[i:])
+	b.disk[i] = spilled
+	b.diskSize += bt.n
+
+	return nil
+}
+
+// load loads the batches spilled to the directory.
+func (b *Buffer) load() error {
+	files, err := ioutil.ReadDir(b.cfg.Dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+
+	for _, fi := range files {
+		if fi.IsDir() || !strings.HasSuffix(fi.Name(), ".json") {
+			continue
+		}
+
+		var at int64
+		if _, err := fmt.Sscanf(fi.Name(), "%d.json", &at); err != nil {
+			continue
+		}
+
+		path := filepath.Join(b.cfg.Dir, fi.Name())
+
+		mm, err := readBatch(path)
+		if err != nil {
+			return err
+		}
+
+		b.disk = append(b.disk, &batch{
+			at:       at,
+			path:     path,
+			n:        len(mm),
+			buffered: true,
+		})
+		b.diskSize += len(mm)
+	}
+
+	sort.Slice(b.disk, func(i, j int) bool { return b.disk[i].at < b.disk[j].at })
+	return nil
+}
+
+func readBatch(path string) (map[string]map[string]interface{}, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "faild to read file: %s", path)
+	}
+
+	var mm map[string]map[string]interface{}
+	if err := json.Unmarshal(data, &mm); err != nil {
+		return nil, errors.Wrapf(err, "faild to unmarshal file: %s", path)
+	}
+	return mm, nil
+}
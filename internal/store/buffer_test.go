@@ -0,0 +1,302 @@
+package store
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	redigo "github.com/gomodule/redigo/redis"
+	"github.com/pkg/errors"
+)
+
+// fakeStore is Store which records the keys of the saved reports, and fails while errs are left.
+type fakeStore struct {
+	mu    sync.Mutex
+	saved []string
+	errs  []error
+
+	// block blocks Save until it is closed if it is not nil.
+	block chan struct{}
+	saves chan struct{}
+}
+
+func newFakeStore(errs ...error) *fakeStore {
+	return &fakeStore{
+		errs:  errs,
+		saves: make(chan struct{}, 100),
+	}
+}
+
+func (s *fakeStore) Save(ctx context.Context, mm map[string]map[string]interface{}) error {
+	defer func() {
+		s.saves <- struct{}{}
+	}()
+
+	if s.block != nil {
+		select {
+		case <-s.block:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if len(s.errs) > 0 {
+		err := s.errs[0]
+		s.errs = s.errs[1:]
+		return err
+	}
+	for key := range mm {
+		s.saved = append(s.saved, key)
+	}
+	return nil
+}
+
+func (s *fakeStore) Get(ctx context.Context, key string) (map[string]interface{}, error) {
+	return nil, nil
+}
+
+func (s *fakeStore) List(ctx context.Context) (map[string]map[string]interface{}, error) {
+	return nil, nil
+}
+
+func (s *fakeStore) History(ctx context.Context, key string, limit int) ([]map[string]interface{}, error) {
+	return nil, nil
+}
+
+func (s *fakeStore) Warnings(ctx context.Context, area string) ([]*AreaWarning, error) {
+	return nil, nil
+}
+
+func (s *fakeStore) Events(ctx context.Context, after string, limit int) ([]*Event, error) {
+	return nil, nil
+}
+
+func (s *fakeStore) keys() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.saved...)
+}
+
+// waitSaves waits for n calls of Save.
+func (s *fakeStore) waitSaves(t *testing.T, n int) {
+	for i := 0; i < n; i++ {
+		select {
+		case <-s.saves:
+		case <-time.After(time.Second):
+			t.Fatalf("store is not written: %d of %d writes", i, n)
+		}
+	}
+}
+
+func reports(key string) map[string]map[string]interface{} {
+	return map[string]map[string]interface{}{
+		key: {"id": key},
+	}
+}
+
+func equalKeys(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+var errUnavailable = errors.New("connection refused")
+
+func TestBufferSaveDoesNotWaitForStore(t *testing.T) {
+	st := newFakeStore()
+	st.block = make(chan struct{})
+
+	b, err := NewBuffer(st, BufferConfig{Size: 10})
+	if err != nil {
+		t.Fatalf("NewBuffer returns error: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go b.Run(ctx)
+
+	// The polls are not blocked while the store is hanging.
+	done := make(chan struct{})
+	go func() {
+		b.Save(context.Background(), reports("a"))
+		b.Save(context.Background(), reports("b"))
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Save waits for the store")
+	}
+
+	close(st.block)
+	st.waitSaves(t, 2)
+
+	if keys := st.keys(); !equalKeys(keys, []string{"a", "b"}) {
+		t.Errorf("written reports are %v, want [a b]", keys)
+	}
+}
+
+func TestBufferWritesInOrderAfterOutage(t *testing.T) {
+	st := newFakeStore(errUnavailable, errUnavailable)
+
+	b, err := NewBuffer(st, BufferConfig{Size: 10, MinBackoff: 10 * time.Millisecond, MaxBackoff: 20 * time.Millisecond})
+	if err != nil {
+		t.Fatalf("NewBuffer returns error: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go b.Run(ctx)
+
+	for _, key := range []string{"a", "b", "c"} {
+		b.Save(context.Background(), reports(key))
+	}
+
+	// a fails twice, and then a, b and c are written in order.
+	st.waitSaves(t, 5)
+
+	if keys := st.keys(); !equalKeys(keys, []string{"a", "b", "c"}) {
+		t.Errorf("written reports are %v, want [a b c]", keys)
+	}
+}
+
+func TestBufferBackoff(t *testing.T) {
+	st := newFakeStore(errUnavailable, errUnavailable, errUnavailable, errUnavailable)
+
+	b, err := NewBuffer(st, BufferConfig{Size: 10, MinBackoff: time.Second, MaxBackoff: 3 * time.Second})
+	if err != nil {
+		t.Fatalf("NewBuffer returns error: %v", err)
+	}
+	b.Save(context.Background(), reports("a"))
+
+	// The interval is doubled from the minimum up to the maximum.
+	for _, want := range []time.Duration{time.Second, 2 * time.Second, 3 * time.Second, 3 * time.Second} {
+		b.flush(context.Background())
+
+		if b.backoff != want {
+			t.Errorf("backoff is %v, want %v", b.backoff, want)
+		}
+		if until := time.Until(b.retryAt); until <= 0 || until > want {
+			t.Errorf("retry is in %v, want in %v", until, want)
+		}
+
+		// The reports are buffered while the store is unavailable.
+		b.Save(context.Background(), reports("b"))
+		b.retryAt = time.Time{}
+	}
+
+	b.flush(context.Background())
+
+	if b.backoff != 0 || !b.retryAt.IsZero() {
+		t.Errorf("backoff is %v after the store is back, want 0", b.backoff)
+	}
+	if keys := st.keys(); len(keys) != 5 || keys[0] != "a" {
+		t.Errorf("written reports are %v, want a and 4 b", keys)
+	}
+	if b.memSize != 0 || len(b.mem) != 0 {
+		t.Errorf("buffer is not empty: %d reports", b.memSize)
+	}
+}
+
+func TestBufferDropsRejectedReports(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		drop bool
+	}{
+		{name: "not leader", err: ErrNotLeader, drop: true},
+		{name: "rejected", err: &WriteError{Errs: []error{redigo.Error("WRONGTYPE Operation against a key holding the wrong kind of value")}}, drop: true},
+		{name: "rejected with cause", err: errors.Wrap(&WriteError{Errs: []error{redigo.Error("WRONGTYPE Operation against a key holding the wrong kind of value")}}, "faild to write reports"), drop: true},
+		{name: "failover", err: &WriteError{Errs: []error{redigo.Error("READONLY You can't write against a read only replica.")}}},
+		{name: "unavailable", err: errUnavailable},
+	}
+
+	for _, tt := range tests {
+		st := newFakeStore(tt.err)
+
+		b, err := NewBuffer(st, BufferConfig{Size: 10, MinBackoff: time.Minute})
+		if err != nil {
+			t.Fatalf("NewBuffer returns error: %v", err)
+		}
+		b.Save(context.Background(), reports("a"))
+		b.Save(context.Background(), reports("b"))
+
+		b.flush(context.Background())
+
+		want := []string{"b"}
+		if !tt.drop {
+			// The reports are kept and retried in order.
+			want = nil
+		}
+		if keys := st.keys(); !equalKeys(keys, want) {
+			t.Errorf("%s: written reports are %v, want %v", tt.name, keys, want)
+		}
+
+		if tt.drop && (b.backoff != 0 || b.memSize != 0) {
+			t.Errorf("%s: backoff is %v and %d reports are buffered, want 0", tt.name, b.backoff, b.memSize)
+		}
+		if !tt.drop && (b.backoff != time.Minute || b.memSize != 2) {
+			t.Errorf("%s: backoff is %v and %d reports are buffered, want %v and 2", tt.name, b.backoff, b.memSize, time.Minute)
+		}
+	}
+}
+
+func TestBufferSpillsInOrder(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gweather-buffer")
+	if err != nil {
+		t.Fatalf("faild to create directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	st := newFakeStore(errUnavailable)
+	cfg := BufferConfig{Size: 1, Dir: dir, DirSize: 2, MinBackoff: time.Minute}
+
+	b, err := NewBuffer(st, cfg)
+	if err != nil {
+		t.Fatalf("NewBuffer returns error: %v", err)
+	}
+
+	b.Save(context.Background(), reports("a"))
+	b.flush(context.Background())
+
+	// The reports exceeding the memory are spilled, and the oldest one on disk is dropped when the directory is full.
+	for _, key := range []string{"b", "c", "d"} {
+		b.Save(context.Background(), reports(key))
+	}
+	if b.memSize != 1 || b.diskSize != 2 {
+		t.Fatalf("buffered reports are %d in memory and %d on disk, want 1 and 2", b.memSize, b.diskSize)
+	}
+
+	// The reports in memory are spilled on closing, and written by the next process.
+	if err := b.Close(); err != nil {
+		t.Fatalf("Close returns error: %v", err)
+	}
+
+	b, err = NewBuffer(st, cfg)
+	if err != nil {
+		t.Fatalf("NewBuffer returns error: %v", err)
+	}
+	b.flush(context.Background())
+
+	if keys := st.keys(); !equalKeys(keys, []string{"a", "c", "d"}) {
+		t.Errorf("written reports are %v, want [a c d]", keys)
+	}
+
+	files, _ := ioutil.ReadDir(dir)
+	if len(files) != 0 || b.diskSize != 0 {
+		t.Errorf("spilled files are left: %d", len(files))
+	}
+}
@@ -0,0 +1,224 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	redigo "github.com/gomodule/redigo/redis"
+	"github.com/pkg/errors"
+
+	"github.com/hlts2/gweather/internal/report"
+)
+
+const (
+	// EventsChannel is the channel where the events of the written reports are published as JSON of Event.
+	EventsChannel = "gweather:events"
+
+	// OutboxKey is the key of the stream where the events of the written reports are appended for the sinks.
+	// The field OutboxField of an entry is JSON of Event.
+	OutboxKey   = "gweather:outbox"
+	OutboxField = "event"
+)
+
+const (
+	// EventReport is the type of the event of a new report.
+	EventReport = "report"
+
+	// EventWarning is the type of the event of a transition of a warning in a new report.
+	EventWarning = "warning"
+)
+
+// ErrInvalidEventID is returned by Events when the event ID is not the ID of an event.
+var ErrInvalidEventID = errors.New("invalid event id")
+
+// outboxPage is the number of the entries read from the outbox at once to replay the events.
+const outboxPage = 100
+
+// Event represents a new report written to the store, or a transition of a warning in it.
+// The events of a report share the ID, which is ordered by the time when the report was updated.
+type Event struct {
+	ID     string `json:"id"`
+	Type   string `json:"type"`
+	Key    string `json:"key"`
+	Title  string `json:"title"`
+	Office string `json:"office"`
+
+	// Report is the report of EventReport.
+	Report map[string]interface{} `json:"report,omitempty"`
+
+	// Warning is the transition of EventWarning.
+	Warning *report.Transition `json:"warning,omitempty"`
+}
+
+// Match returns true if the event matches the filter.
+// The event of a transition matches by its area and warning kind.
+func (e *Event) Match(f *report.Filter) bool {
+	if e.Warning != nil {
+		return f.Match(e.Title, e.Office, []string{e.Warning.Area}, []string{e.Warning.Code})
+	}
+
+	areas, kinds := report.BodyCodes(e.Report["body"])
+	return f.Match(e.Title, e.Office, areas, kinds)
+}
+
+// events returns the events of the report of key which has changed from prev to cur.
+func events(key string, prev, cur map[string]interface{}) []*Event {
+	id := EventID(cur)
+	title, _ := cur["title"].(string)
+	office, _ := cur["name"].(string)
+
+	evs := []*Event{{
+		ID:     id,
+		Type:   EventReport,
+		Key:    key,
+		Title:  title,
+		Office: office,
+		Report: cur,
+	}}
+
+	var body interface{}
+	if prev != nil {
+		body = prev["body"]
+	}
+	for _, t := range report.Transitions(body, cur["body"]) {
+		evs = append(evs, &Event{
+			ID:      id,
+			Type:    EventWarning,
+			Key:     key,
+			Title:   title,
+			Office:  office,
+			Warning: t,
+		})
+	}
+	return evs
+}
+
+// EventID returns the ID of the events of the report, e.g. 1553502481-b0af90d4-23a8-3628-a489-2d40421838d6.
+func EventID(m map[string]interface{}) string {
+	var sec int64
+	if s, ok := m["updated"].(string); ok {
+		if t, err := time.Parse(time.RFC3339, s); err == nil {
+			sec = t.Unix()
+		}
+	}
+
+	id, _ := m["id"].(string)
+	return fmt.Sprintf("%d-%s", sec, report.UUID(id))
+}
+
+// CompareEventID returns -1, 0 or +1 when the event of a is before, the same as or after the event of b.
+// It returns an error if either is not an event ID.
+func CompareEventID(a, b string) (int, error) {
+	as, au, err := parseEventID(a)
+	if err != nil {
+		return 0, err
+	}
+	bs, bu, err := parseEventID(b)
+	if err != nil {
+		return 0, err
+	}
+
+	switch {
+	case as < bs || (as == bs && au < bu):
+		return -1, nil
+	case as == bs && au == bu:
+		return 0, nil
+	default:
+		return 1, nil
+	}
+}
+
+func parseEventID(id string) (int64, string, error) {
+	parts := strings.SplitN(id, "-", 2)
+	if len(parts) != 2 {
+		return 0, "", errors.Wrap(ErrInvalidEventID, id)
+	}
+
+	sec, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil {
+		return 0, "", errors.Wrap(ErrInvalidEventID, id)
+	}
+	return sec, parts[1], nil
+}
+
+// Events returns at most limit latest events after the event of after, which are read from the outbox.
+// The outbox is read from the newest entry page by page until the event of after, so the cost is bounded by limit and the size of the outbox.
+// The latest events are returned if the event of after has been trimmed from the outbox.
+func (s *storeImpl) Events(ctx context.Context, after string, limit int) ([]*Event, error) {
+	if _, _, err := parseEventID(after); err != nil {
+		return nil, err
+	}
+
+	conn, err := s.pool.GetContext(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "faild to get redis connection")
+	}
+	defer conn.Close()
+
+	key := s.prefix + OutboxKey
+
+	// evs are the events in order from newest to oldest.
+	var evs []*Event
+	for end, done := "+", false; !done; {
+		reply, err := redigo.Values(conn.Do("XREVRANGE", key, end, "-", "COUNT", outboxPage))
+		if err != nil {
+			return nil, errors.Wrapf(err, "faild to read stream: %s", key)
+		}
+
+		done = len(reply) < outboxPage
+		for i, v := range reply {
+			id, ev, err := outboxEvent(v)
+			if err != nil {
+				return nil, errors.Wrapf(err, "unexpected reply of stream: %s", key)
+			}
+
+			// The range includes the last entry of the previous page, since the exclusive range is not available in older versions of redis.
+			if i == 0 && end != "+" {
+				continue
+			}
+			end = id
+
+			if ev == nil {
+				continue
+			}
+			if ev.ID == after || (limit > 0 && len(evs) == limit) {
+				done = true
+				break
+			}
+			evs = append(evs, ev)
+		}
+	}
+
+	for i, j := 0, len(evs)-1; i < j; i, j = i+1, j-1 {
+		evs[i], evs[j] = evs[j], evs[i]
+	}
+	return evs, nil
+}
+
+// outboxEvent returns the ID and the event of the entry of the outbox. The event is nil if it is not decoded.
+func outboxEvent(v interface{}) (string, *Event, error) {
+	entry, err := redigo.Values(v, nil)
+	if err != nil || len(entry) != 2 {
+		return "", nil, errors.New("invalid entry")
+	}
+
+	id, err := redigo.String(entry[0], nil)
+	if err != nil {
+		return "", nil, errors.Wrap(err, "invalid entry id")
+	}
+
+	fields, err := redigo.StringMap(entry[1], nil)
+	if err != nil {
+		return id, nil, nil
+	}
+
+	var ev Event
+	if err := json.Unmarshal([]byte(fields[OutboxField]), &ev); err != nil {
+		return id, nil, nil
+	}
+	return id, &ev, nil
+}
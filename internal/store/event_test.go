@@ -0,0 +1,153 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// updatedReport returns the report of the entry n updated at the time, which asserts a warning so that it has two events.
+func updatedReport(n int, updated time.Time) map[string]interface{} {
+	m := warningReport(fmt.Sprintf("urn:uuid:%d", n), "盛岡地方気象台", "発表")
+	m["updated"] = updated.UTC().Format(time.RFC3339)
+	return m
+}
+
+func eventIDs(evs []*Event) []string {
+	ids := make([]string, 0, len(evs))
+	for _, ev := range evs {
+		ids = append(ids, ev.ID+"/"+ev.Type)
+	}
+	return ids
+}
+
+func TestEvents(t *testing.T) {
+	pool, _ := newTestPool(t)
+	st := New(pool, 0, WithOutbox(0))
+
+	base := time.Date(2019, 3, 25, 8, 0, 0, 0, time.UTC)
+
+	// The report of b is updated before the last one of a, but written after it.
+	reports := []struct {
+		key string
+		m   map[string]interface{}
+	}{
+		{key: "a", m: updatedReport(1, base)},
+		{key: "a", m: updatedReport(2, base.Add(2*time.Minute))},
+		{key: "b", m: updatedReport(3, base.Add(time.Minute))},
+	}
+	for _, r := range reports {
+		if err := st.Save(context.Background(), map[string]map[string]interface{}{r.key: r.m}); err != nil {
+			t.Fatalf("Save returns error: %v", err)
+		}
+	}
+
+	first, second, third := EventID(reports[0].m), EventID(reports[1].m), EventID(reports[2].m)
+
+	tests := []struct {
+		name  string
+		after string
+		limit int
+		want  []string
+	}{
+		{
+			name:  "after the first",
+			after: first,
+			want:  []string{second + "/report", third + "/report", third + "/warning"},
+		},
+		{
+			// The events written after the last event are replayed even if their IDs are before it.
+			name:  "after the second",
+			after: second,
+			want:  []string{third + "/report", third + "/warning"},
+		},
+		{
+			name:  "after the last",
+			after: third,
+			want:  []string{},
+		},
+		{
+			name:  "limit",
+			after: first,
+			limit: 2,
+			want:  []string{third + "/report", third + "/warning"},
+		},
+		{
+			// The latest events are replayed when the last event is not in the outbox.
+			name:  "trimmed",
+			after: "0-00000000-0000-0000-0000-000000000000",
+			limit: 3,
+			want:  []string{second + "/report", third + "/report", third + "/warning"},
+		},
+	}
+
+	for _, tt := range tests {
+		evs, err := st.Events(context.Background(), tt.after, tt.limit)
+		if err != nil {
+			t.Fatalf("%s: Events returns error: %v", tt.name, err)
+		}
+		if got := eventIDs(evs); fmt.Sprint(got) != fmt.Sprint(tt.want) {
+			t.Errorf("%s: events are %v, want %v", tt.name, got, tt.want)
+		}
+	}
+
+	if _, err := st.Events(context.Background(), "invalid", 0); errors.Cause(err) != ErrInvalidEventID {
+		t.Errorf("Events of invalid ID returns %v, want %v", err, ErrInvalidEventID)
+	}
+}
+
+func TestEventsPages(t *testing.T) {
+	pool, _ := newTestPool(t)
+	st := New(pool, 0, WithOutbox(0))
+
+	// The events of the reports exceed a page of the outbox.
+	base := time.Date(2019, 3, 25, 8, 0, 0, 0, time.UTC)
+	var ids []string
+	for i := 0; i < outboxPage; i++ {
+		m := updatedReport(i, base.Add(time.Duration(i)*time.Second))
+		if err := st.Save(context.Background(), map[string]map[string]interface{}{"a": m}); err != nil {
+			t.Fatalf("Save returns error: %v", err)
+		}
+		ids = append(ids, EventID(m))
+	}
+
+	evs, err := st.Events(context.Background(), ids[0], 0)
+	if err != nil {
+		t.Fatalf("Events returns error: %v", err)
+	}
+
+	// Each report has the event of itself, and of the issued warning only in the first one.
+	if len(evs) != outboxPage-1 {
+		t.Fatalf("number of events is %d, want %d", len(evs), outboxPage-1)
+	}
+	for i, ev := range evs {
+		if ev.ID != ids[i+1] {
+			t.Fatalf("event %d is %s, want %s", i, ev.ID, ids[i+1])
+		}
+	}
+}
+
+func TestEventsOutboxSize(t *testing.T) {
+	pool, s := newTestPool(t)
+	st := New(pool, 0, WithOutbox(10))
+
+	base := time.Date(2019, 3, 25, 8, 0, 0, 0, time.UTC)
+	for i := 0; i < 100; i++ {
+		m := updatedReport(i, base.Add(time.Duration(i)*time.Second))
+		if err := st.Save(context.Background(), map[string]map[string]interface{}{"a": m}); err != nil {
+			t.Fatalf("Save returns error: %v", err)
+		}
+	}
+
+	// The outbox is trimmed approximately when it is appended.
+	entries, err := s.Stream(OutboxKey)
+	if err != nil {
+		t.Fatalf("faild to read outbox: %v", err)
+	}
+	if len(entries) >= 100 {
+		t.Errorf("length of outbox is %d, want it trimmed", len(entries))
+	}
+}
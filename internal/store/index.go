@@ -0,0 +1,192 @@
+package store
+
+import (
+	redigo "github.com/gomodule/redigo/redis"
+	"github.com/pkg/errors"
+
+	"github.com/hlts2/gweather/internal/report"
+)
+
+const (
+	// AreaIndexPrefix is the prefix of the sets of the keys of the reports of each area code.
+	// e.g) gweather:index:area:030010
+	AreaIndexPrefix = "gweather:index:area:"
+
+	// OfficeIndexPrefix is the prefix of the sets of the keys of the reports of each office.
+	// e.g) gweather:index:office:盛岡地方気象台
+	OfficeIndexPrefix = "gweather:index:office:"
+
+	// KindIndexPrefix is the prefix of the sets of the area codes currently under each warning kind code.
+	// e.g) gweather:index:kind:14
+	KindIndexPrefix = "gweather:index:kind:"
+
+	// ActiveIndexPrefix is the prefix of the sets of the warning kind codes currently active in each area code.
+	// e.g) gweather:index:active:030010
+	ActiveIndexPrefix = "gweather:index:active:"
+
+	// AssertIndexPrefix is the prefix of the sets of the keys of the reports asserting each warning kind code in each area code.
+	// Several reports may assert the same warning of an area, e.g. the reports of the prefecture and of the subdivisions,
+	// so the area and the kind are removed from the kind and active indexes when the last of them lifts it.
+	// e.g) gweather:index:assert:030010:14
+	AssertIndexPrefix = "gweather:index:assert:"
+
+	// IndexMemberSeparator separates the code and the key of the report in the fields of the hashes of areas.
+	IndexMemberSeparator = "|"
+)
+
+// indexEntries represents the members of the indexes of a report.
+type indexEntries struct {
+	areas  map[string]bool
+	office string
+
+	// active is the pairs of an area code and a warning kind code active in the area.
+	active map[[2]string]bool
+}
+
+func newIndexEntries(m map[string]interface{}) *indexEntries {
+	e := &indexEntries{
+		areas:  make(map[string]bool),
+		active: make(map[[2]string]bool),
+	}
+	if m == nil {
+		return e
+	}
+
+	e.office, _ = m["name"].(string)
+
+	areas, _ := report.BodyCodes(m["body"])
+	for _, area := range areas {
+		e.areas[area] = true
+	}
+
+	for _, w := range report.Warnings(m["body"]) {
+		if w.Active() && w.Area != "" {
+			e.active[[2]string{w.Area, w.Code}] = true
+		}
+	}
+	return e
+}
+
+// assertKey returns the key of the set of the reports asserting the warning kind code in the area code.
+func assertKey(prefix, area, kind string) string {
+	return prefix + AssertIndexPrefix + area + ":" + kind
+}
+
+// sendIndex sends the commands to update the indexes of the report of key from prev to cur to p.
+// The keys of the indexes are prepended by prefix. prev or cur is nil when the report is added or removed.
+// The members which remain are added again, so that the indexes lost or written by older versions are repaired.
+// The warnings lifted by the report are removed from the kind and active indexes by sendLifted, since other reports may still assert them.
+func sendIndex(p *pipeline, prefix, key string, prev, cur map[string]interface{}) {
+	olds, news := newIndexEntries(prev), newIndexEntries(cur)
+
+	for area := range olds.areas {
+		if !news.areas[area] {
+			p.send("SREM", prefix+AreaIndexPrefix+area, key)
+		}
+	}
+	if olds.office != "" && olds.office != news.office {
+		p.send("SREM", prefix+OfficeIndexPrefix+olds.office, key)
+	}
+	for pair := range olds.active {
+		if !news.active[pair] {
+			p.send("SREM", assertKey(prefix, pair[0], pair[1]), key)
+		}
+	}
+
+	for area := range news.areas {
+		p.send("SADD", prefix+AreaIndexPrefix+area, key)
+	}
+	if news.office != "" {
+		p.send("SADD", prefix+OfficeIndexPrefix+news.office, key)
+	}
+	for pair := range news.active {
+		p.send("SADD", assertKey(prefix, pair[0], pair[1]), key)
+		p.send("SADD", prefix+KindIndexPrefix+pair[1], pair[0])
+		p.send("SADD", prefix+ActiveIndexPrefix+pair[0], pair[1])
+	}
+}
+
+// warningChanges represents the reports asserting and lifting the warnings in a write, by the pair of an area code and a warning kind code.
+type warningChanges struct {
+	asserted map[[2]string]map[string]bool
+	lifted   map[[2]string]map[string]bool
+}
+
+func newWarningChanges() *warningChanges {
+	return &warningChanges{
+		asserted: make(map[[2]string]map[string]bool),
+		lifted:   make(map[[2]string]map[string]bool),
+	}
+}
+
+// add adds the changes of the warnings of the report of key from prev to cur.
+func (c *warningChanges) add(key string, prev, cur map[string]interface{}) {
+	olds, news := newIndexEntries(prev), newIndexEntries(cur)
+
+	for pair := range olds.active {
+		if !news.active[pair] {
+			if c.lifted[pair] == nil {
+				c.lifted[pair] = make(map[string]bool)
+			}
+			c.lifted[pair][key] = true
+		}
+	}
+	for pair := range news.active {
+		if c.asserted[pair] == nil {
+			c.asserted[pair] = make(map[string]bool)
+		}
+		c.asserted[pair][key] = true
+	}
+}
+
+// unasserted returns the warnings lifted by the changes which no other report asserts, reading the reports asserting them.
+// The sets are watched if watch is true, so that the transaction is aborted when another write changes them meanwhile.
+func (c *warningChanges) unasserted(conn redigo.Conn, prefix string, watch bool) ([][2]string, error) {
+	var pairs [][2]string
+	for pair, keys := range c.lifted {
+		if len(c.asserted[pair]) > 0 {
+			continue
+		}
+
+		key := assertKey(prefix, pair[0], pair[1])
+		if watch {
+			if _, err := conn.Do("WATCH", key); err != nil {
+				return nil, errors.Wrapf(err, "faild to watch: %s", key)
+			}
+		}
+
+		members, err := redigo.Strings(conn.Do("SMEMBERS", key))
+		if err != nil {
+			return nil, errors.Wrapf(err, "faild to get members: %s", key)
+		}
+
+		asserted := false
+		for _, m := range members {
+			if !keys[m] {
+				asserted = true
+				break
+			}
+		}
+		if !asserted {
+			pairs = append(pairs, pair)
+		}
+	}
+	return pairs, nil
+}
+
+// sendLifted sends the commands to remove the warnings which no report asserts from the kind and active indexes to p.
+func sendLifted(p *pipeline, prefix string, pairs [][2]string) {
+	for _, pair := range pairs {
+		p.send("SREM", prefix+KindIndexPrefix+pair[1], pair[0])
+		p.send("SREM", prefix+ActiveIndexPrefix+pair[0], pair[1])
+	}
+}
+
+// sendLegacyIndex sends the commands to remove the members of the kind and active indexes of the report of key written by older versions to p,
+// which are the codes joined with the key of the report.
+func sendLegacyIndex(p *pipeline, prefix, key string, m map[string]interface{}) {
+	for pair := range newIndexEntries(m).active {
+		p.send("SREM", prefix+KindIndexPrefix+pair[1], pair[0]+IndexMemberSeparator+key)
+		p.send("SREM", prefix+ActiveIndexPrefix+pair[0], pair[1]+IndexMemberSeparator+key)
+	}
+}
@@ -0,0 +1,196 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+)
+
+// warningReport returns a report of the entry id asserting the thunderstorm advisory (14) in the area 030010 with the status.
+func warningReport(id, office, status string) map[string]interface{} {
+	return map[string]interface{}{
+		"feed":    testFeedURL,
+		"id":      id,
+		"title":   "気象特別警報・警報・注意報",
+		"name":    office,
+		"updated": "2019-03-25T08:28:01Z",
+		"body": map[string]interface{}{
+			"-type": "気象警報・注意報（一次細分区域等）",
+			"Item": map[string]interface{}{
+				"Kind": map[string]interface{}{"Name": "雷注意報", "Code": "14", "Status": status},
+				"Area": map[string]interface{}{"Name": "内陸", "Code": "030010"},
+			},
+		},
+	}
+}
+
+func members(s *miniredis.Miniredis, key string) []string {
+	if !s.Exists(key) {
+		return nil
+	}
+	ms, _ := s.Members(key)
+	sort.Strings(ms)
+	return ms
+}
+
+func TestSaveWarningIndexes(t *testing.T) {
+	pool, s := newTestPool(t)
+	st := New(pool, 0)
+
+	save := func(key string, m map[string]interface{}) {
+		if err := st.Save(context.Background(), map[string]map[string]interface{}{key: m}); err != nil {
+			t.Fatalf("Save returns error: %v", err)
+		}
+	}
+
+	// The reports of the prefecture and of the subdivision assert the same warning of the area.
+	save("pref", warningReport("urn:uuid:1", "盛岡地方気象台", "発表"))
+	save("sub", warningReport("urn:uuid:2", "盛岡地方気象台", "継続"))
+
+	tests := []struct {
+		name    string
+		key     string
+		report  map[string]interface{}
+		areas   []string
+		kinds   []string
+		asserts []string
+	}{
+		{
+			name:    "asserted by both",
+			areas:   []string{"030010"},
+			kinds:   []string{"14"},
+			asserts: []string{"pref", "sub"},
+		},
+		{
+			name:    "lifted by one",
+			key:     "pref",
+			report:  warningReport("urn:uuid:3", "盛岡地方気象台", "解除"),
+			areas:   []string{"030010"},
+			kinds:   []string{"14"},
+			asserts: []string{"sub"},
+		},
+		{
+			name:   "lifted by all",
+			key:    "sub",
+			report: warningReport("urn:uuid:4", "盛岡地方気象台", "解除"),
+		},
+		{
+			name:    "asserted again",
+			key:     "pref",
+			report:  warningReport("urn:uuid:5", "盛岡地方気象台", "発表"),
+			areas:   []string{"030010"},
+			kinds:   []string{"14"},
+			asserts: []string{"pref"},
+		},
+	}
+
+	for _, tt := range tests {
+		if tt.key != "" {
+			save(tt.key, tt.report)
+		}
+
+		// The indexes are the sets of the bare codes, and the area is under the warning until all the reports asserting it lift it.
+		if got := members(s, KindIndexPrefix+"14"); !reflect.DeepEqual(got, tt.areas) {
+			t.Errorf("%s: areas under 14 are %v, want %v", tt.name, got, tt.areas)
+		}
+		if got := members(s, ActiveIndexPrefix+"030010"); !reflect.DeepEqual(got, tt.kinds) {
+			t.Errorf("%s: warnings active in 030010 are %v, want %v", tt.name, got, tt.kinds)
+		}
+		if got := members(s, AssertIndexPrefix+"030010:14"); !reflect.DeepEqual(got, tt.asserts) {
+			t.Errorf("%s: reports asserting 14 in 030010 are %v, want %v", tt.name, got, tt.asserts)
+		}
+	}
+
+	if got := members(s, AreaIndexPrefix+"030010"); !reflect.DeepEqual(got, []string{"pref", "sub"}) {
+		t.Errorf("reports of 030010 are %v, want [pref sub]", got)
+	}
+	if got := members(s, OfficeIndexPrefix+"盛岡地方気象台"); !reflect.DeepEqual(got, []string{"pref", "sub"}) {
+		t.Errorf("reports of office are %v, want [pref sub]", got)
+	}
+}
+
+func TestSaveWarningIndexesInOneWrite(t *testing.T) {
+	pool, s := newTestPool(t)
+	st := New(pool, 0)
+
+	if err := st.Save(context.Background(), map[string]map[string]interface{}{
+		"pref": warningReport("urn:uuid:1", "盛岡地方気象台", "発表"),
+	}); err != nil {
+		t.Fatalf("Save returns error: %v", err)
+	}
+
+	// The warning lifted by a report and asserted by another in the same write stays active.
+	if err := st.Save(context.Background(), map[string]map[string]interface{}{
+		"pref": warningReport("urn:uuid:2", "盛岡地方気象台", "解除"),
+		"sub":  warningReport("urn:uuid:3", "盛岡地方気象台", "発表"),
+	}); err != nil {
+		t.Fatalf("Save returns error: %v", err)
+	}
+
+	if got := members(s, ActiveIndexPrefix+"030010"); !reflect.DeepEqual(got, []string{"14"}) {
+		t.Errorf("warnings active in 030010 are %v, want [14]", got)
+	}
+	if got := members(s, AssertIndexPrefix+"030010:14"); !reflect.DeepEqual(got, []string{"sub"}) {
+		t.Errorf("reports asserting 14 in 030010 are %v, want [sub]", got)
+	}
+}
+
+func TestSaveWarningIndexesOfExpiredReports(t *testing.T) {
+	pool, s := newTestPool(t)
+	st := New(pool, 0, WithTTL(time.Minute))
+
+	if err := st.Save(context.Background(), map[string]map[string]interface{}{
+		"pref": warningReport("urn:uuid:1", "盛岡地方気象台", "発表"),
+	}); err != nil {
+		t.Fatalf("Save returns error: %v", err)
+	}
+
+	// The expiry is scored in the real time, so the scores are moved back instead of forwarding the clock.
+	s.ZAdd(ExpiryKey, float64(time.Now().Add(-time.Second).UnixNano()/int64(time.Millisecond)), "pref")
+
+	if err := st.Save(context.Background(), map[string]map[string]interface{}{
+		"other": warningReport("urn:uuid:2", "鳥取地方気象台", "解除"),
+	}); err != nil {
+		t.Fatalf("Save returns error: %v", err)
+	}
+
+	for _, key := range []string{KindIndexPrefix + "14", ActiveIndexPrefix + "030010", AssertIndexPrefix + "030010:14"} {
+		if got := members(s, key); len(got) != 0 {
+			t.Errorf("%s is %v after the report expired, want empty", key, got)
+		}
+	}
+}
+
+func TestMigrateWarningIndexes(t *testing.T) {
+	pool, s := newTestPool(t)
+
+	// The older versions joined the codes with the keys of the reports in the kind and active indexes.
+	m := warningReport("urn:uuid:1", "盛岡地方気象台", "発表")
+	b, _ := json.Marshal(m)
+	s.Set("pref", string(b))
+	s.SAdd(KeysKey, "pref")
+	s.SAdd(KindIndexPrefix+"14", "030010"+IndexMemberSeparator+"pref")
+	s.SAdd(ActiveIndexPrefix+"030010", "14"+IndexMemberSeparator+"pref")
+
+	rename := func(key string, m map[string]interface{}) (string, error) {
+		return key, nil
+	}
+	if _, err := Migrate(context.Background(), pool, "", "", rename, false); err != nil {
+		t.Fatalf("Migrate returns error: %v", err)
+	}
+
+	if got := members(s, KindIndexPrefix+"14"); !reflect.DeepEqual(got, []string{"030010"}) {
+		t.Errorf("areas under 14 are %v, want [030010]", got)
+	}
+	if got := members(s, ActiveIndexPrefix+"030010"); !reflect.DeepEqual(got, []string{"14"}) {
+		t.Errorf("warnings active in 030010 are %v, want [14]", got)
+	}
+	if got := members(s, AssertIndexPrefix+"030010:14"); !reflect.DeepEqual(got, []string{"pref"}) {
+		t.Errorf("reports asserting 14 in 030010 are %v, want [pref]", got)
+	}
+}
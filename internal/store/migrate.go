@@ -0,0 +1,259 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+	"strings"
+
+	redigo "github.com/gomodule/redigo/redis"
+	"github.com/pkg/errors"
+
+	"github.com/hlts2/gweather/internal/log"
+	"github.com/hlts2/gweather/internal/redis"
+)
+
+// Rename returns the new key of the report stored by key.
+type Rename func(key string, m map[string]interface{}) (string, error)
+
+// MigrateResult represents the numbers of the reports processed by Migrate.
+type MigrateResult struct {
+	Moved     int
+	Unchanged int
+	Skipped   int
+}
+
+// Migrate moves the reports stored with the prefix from, their history and indexes, to the keys returned by rename with the prefix to.
+// Besides the reports in the set of KeysKey, the reports written as plain keys by the versions before it are found by SCAN,
+// while the keys in Namespace and the other keys (e.g. of other applications) are left.
+// The indexes and the warnings of the areas of the reports which are not moved are rebuilt, removing the members written by older versions.
+// A report is skipped if the new key is used by another report or can't be generated. Nothing is written if dryRun is true.
+// The report and its history are moved atomically, except in Redis Cluster.
+func Migrate(ctx context.Context, pool redis.Pool, from, to string, rename Rename, dryRun bool) (*MigrateResult, error) {
+	conn, err := pool.GetContext(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "faild to get redis connection")
+	}
+	defer conn.Close()
+
+	keys, err := redigo.Strings(conn.Do("SMEMBERS", from+KeysKey))
+	if err != nil {
+		return nil, errors.Wrapf(err, "faild to get members: %s", from+KeysKey)
+	}
+
+	l := log.FromContext(ctx, log.SubsystemStore)
+	atomic := !redis.IsCluster(pool)
+
+	// Redis Cluster was not supported by the versions writing plain keys, and SCAN of a node doesn't cover the others.
+	indexed := len(keys)
+	if atomic {
+		legacy, err := scanLegacy(conn, from, keys)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, legacy...)
+	}
+
+	res := new(MigrateResult)
+	taken := make(map[string]bool)
+
+	for i, key := range keys {
+		legacy := i >= indexed
+
+		b, err := redigo.Bytes(conn.Do("GET", from+key))
+		if _, ok := err.(redigo.Error); ok && legacy {
+			// e.g. WRONGTYPE of a list of another application.
+			continue
+		}
+		if err == redigo.ErrNil {
+			if !legacy {
+				l.With("key", key).Warn("Skip the key without report")
+				res.Skipped++
+			}
+			continue
+		}
+		if err != nil {
+			return res, errors.Wrapf(err, "faild to get: %s", from+key)
+		}
+
+		var m map[string]interface{}
+		if err := json.Unmarshal(b, &m); err != nil || (legacy && !isLegacyReport(key, m)) {
+			if legacy {
+				l.With("key", key).Debug("Skip the key which is not a report")
+				continue
+			}
+			l.With("key", key).Warnf("Skip the report which can't be decoded: %v", err)
+			res.Skipped++
+			continue
+		}
+
+		newKey, err := rename(key, m)
+		if err != nil {
+			l.With("key", key).Warnf("Skip the report whose key can't be generated: %v", err)
+			res.Skipped++
+			continue
+		}
+
+		ll := l.With("key", key, "new_key", newKey)
+
+		if from+key == to+newKey {
+			// The indexes are rebuilt so that the reports written by older versions are indexed.
+			if !dryRun {
+				p := &pipeline{
+					conn: conn,
+				}
+				p.send("SADD", to+KeysKey, key)
+				sendLegacyIndex(p, to, key, m)
+				sendLegacyView(p, to, m)
+				sendIndex(p, to, key, nil, m)
+				sendView(p, to, key, nil, m)
+				if _, err := p.exec(); err != nil {
+					return res, errors.Wrapf(err, "faild to index report: %s", key)
+				}
+			}
+			res.Unchanged++
+			continue
+		}
+
+		exists, err := redigo.Bool(conn.Do("EXISTS", to+newKey))
+		if err != nil {
+			return res, errors.Wrapf(err, "faild to check existence: %s", to+newKey)
+		}
+		if exists || taken[newKey] {
+			ll.Warn("Skip the report whose new key is already used")
+			res.Skipped++
+			continue
+		}
+		taken[newKey] = true
+
+		history, err := redigo.Values(conn.Do("LRANGE", from+HistoryKeyPrefix+key, 0, -1))
+		if err != nil {
+			return res, errors.Wrapf(err, "faild to get history: %s", key)
+		}
+
+		// The expiry of the report is kept when it is written with a TTL.
+		expireAt, err := redigo.Int64(conn.Do("ZSCORE", from+ExpiryKey, key))
+		if err != nil && err != redigo.ErrNil {
+			return res, errors.Wrapf(err, "faild to get expiry: %s", key)
+		}
+
+		if dryRun {
+			ll.Infof("Would move the report and its history: %d", len(history))
+			res.Moved++
+			continue
+		}
+
+		// The warnings of the report are removed from the indexes of the prefix from unless other reports assert them.
+		warnings := newWarningChanges()
+		warnings.add(key, m, nil)
+		if from == to {
+			warnings.add(newKey, nil, m)
+		}
+		lifted, err := warnings.unasserted(conn, from, atomic)
+		if err != nil {
+			return res, err
+		}
+
+		p := &pipeline{
+			conn: conn,
+		}
+		if atomic {
+			p.send("MULTI")
+		}
+
+		p.send("SET", to+newKey, b)
+		if expireAt > 0 {
+			p.send("PEXPIREAT", to+newKey, expireAt)
+			p.send("ZADD", to+ExpiryKey, expireAt, newKey)
+			p.send("ZREM", from+ExpiryKey, key)
+		}
+		p.send("SADD", to+KeysKey, newKey)
+		p.send("DEL", to+HistoryKeyPrefix+newKey)
+		if len(history) > 0 {
+			// LRANGE returns the history from newest to oldest, so it is appended in the order.
+			p.send("RPUSH", append([]interface{}{to + HistoryKeyPrefix + newKey}, history...)...)
+		}
+		p.send("DEL", from+key)
+		p.send("DEL", from+HistoryKeyPrefix+key)
+		p.send("SREM", from+KeysKey, key)
+		sendIndex(p, from, key, m, nil)
+		sendLegacyIndex(p, from, key, m)
+		sendLegacyView(p, from, m)
+		sendIndex(p, to, newKey, nil, m)
+		sendLifted(p, from, lifted)
+		sendView(p, from, key, m, nil)
+		sendView(p, to, newKey, nil, m)
+
+		if atomic {
+			p.send("EXEC")
+		}
+
+		if _, err := p.exec(); err != nil {
+			return res, errors.Wrapf(err, "faild to move report: %s", key)
+		}
+
+		ll.Infof("Moved the report and its history: %d", len(history))
+		res.Moved++
+	}
+
+	return res, nil
+}
+
+// scanLegacy returns the keys with the prefix which are not in indexed nor in Namespace.
+func scanLegacy(conn redigo.Conn, prefix string, indexed []string) ([]string, error) {
+	seen := make(map[string]bool)
+	for _, key := range indexed {
+		seen[key] = true
+	}
+
+	var keys []string
+	cursor := "0"
+	for {
+		vs, err := redigo.Values(conn.Do("SCAN", cursor, "MATCH", escapeGlob(prefix)+"*", "COUNT", 1000))
+		if err != nil {
+			return nil, errors.Wrap(err, "faild to scan keys")
+		}
+
+		var found []string
+		if _, err := redigo.Scan(vs, &cursor, &found); err != nil {
+			return nil, errors.Wrap(err, "faild to scan keys")
+		}
+
+		for _, k := range found {
+			key := strings.TrimPrefix(k, prefix)
+			if seen[key] || strings.HasPrefix(key, Namespace) {
+				continue
+			}
+			seen[key] = true
+			keys = append(keys, key)
+		}
+
+		if cursor == "0" {
+			break
+		}
+	}
+
+	sort.Strings(keys)
+	return keys, nil
+}
+
+// isLegacyReport returns true if m is a report written by the versions before the key template,
+// whose key is the title and the office joined with underscore.
+func isLegacyReport(key string, m map[string]interface{}) bool {
+	title, _ := m["title"].(string)
+	name, _ := m["name"].(string)
+	return title != "" && name != "" && key == title+"_"+name
+}
+
+// escapeGlob escapes the special characters of the pattern of SCAN.
+func escapeGlob(s string) string {
+	var b strings.Builder
+	for _, c := range s {
+		switch c {
+		case '*', '?', '[', ']', '\\':
+			b.WriteByte('\\')
+		}
+		b.WriteRune(c)
+	}
+	return b.String()
+}
@@ -0,0 +1,177 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+
+	"github.com/hlts2/gweather/internal/redis"
+	"github.com/hlts2/gweather/internal/report"
+)
+
+const testFeedURL = "http://www.data.jma.go.jp/developer/xml/feed/extra.xml"
+
+func newTestPool(t *testing.T) (redis.Pool, *miniredis.Miniredis) {
+	s := miniredis.RunT(t)
+
+	pool, err := redis.New("redis://"+s.Addr(), redis.Options{})
+	if err != nil {
+		t.Fatalf("faild to create redis pool: %v", err)
+	}
+	t.Cleanup(func() {
+		pool.Close()
+	})
+	return pool, s
+}
+
+// legacyReport returns a report written by the versions before the key template, without the feed and the entry id.
+func legacyReport(office, area string) map[string]interface{} {
+	return map[string]interface{}{
+		"title":   "気象特別警報・警報・注意報",
+		"name":    office,
+		"updated": "2019-03-25T08:28:01Z",
+		"content": "落雷に注意してください。",
+		"body": map[string]interface{}{
+			"Item": map[string]interface{}{
+				"Kind": map[string]interface{}{"Name": "雷注意報", "Code": "14"},
+				"Area": map[string]interface{}{"Name": "内陸", "Code": area},
+			},
+		},
+	}
+}
+
+// setLegacy writes the keyspace of the versions before the key template, with the keys of another application.
+func setLegacy(t *testing.T, s *miniredis.Miniredis) {
+	for _, m := range []map[string]interface{}{
+		legacyReport("盛岡地方気象台", "030010"),
+		legacyReport("鳥取地方気象台", "310010"),
+	} {
+		b, _ := json.Marshal(m)
+		s.Set(m["title"].(string)+"_"+m["name"].(string), string(b))
+	}
+
+	// The keys which are not reports are left.
+	s.Set("session:1", `{"title": "気象特別警報・警報・注意報", "name": "盛岡地方気象台"}`)
+	s.Set("counter", "1")
+	s.Lpush("queue", "a")
+}
+
+func renameBy(t *testing.T, text string) Rename {
+	tmpl, err := report.NewKeyTemplate(text)
+	if err != nil {
+		t.Fatalf("faild to parse key template: %v", err)
+	}
+
+	return func(key string, m map[string]interface{}) (string, error) {
+		feed, _ := m["feed"].(string)
+		if feed == "" {
+			feed = testFeedURL
+		}
+		f := report.NewKeyFields(feed, m)
+		if err := tmpl.Complete(f); err != nil {
+			return "", err
+		}
+		return tmpl.Key(f)
+	}
+}
+
+func TestMigrateLegacyKeys(t *testing.T) {
+	tests := []struct {
+		name     string
+		to       string
+		template string
+		want     MigrateResult
+		keys     []string
+	}{
+		{
+			name:     "index",
+			template: report.DefaultKeyTemplate,
+			want:     MigrateResult{Unchanged: 2},
+			keys:     []string{"気象特別警報・警報・注意報_盛岡地方気象台", "気象特別警報・警報・注意報_鳥取地方気象台"},
+		},
+		{
+			name:     "prefix and template",
+			to:       "app:",
+			template: "{{.Feed}}:{{ascii .Office}}",
+			want:     MigrateResult{Moved: 2},
+			keys:     []string{"extra:%E7%9B%9B%E5%B2%A1%E5%9C%B0%E6%96%B9%E6%B0%97%E8%B1%A1%E5%8F%B0", "extra:%E9%B3%A5%E5%8F%96%E5%9C%B0%E6%96%B9%E6%B0%97%E8%B1%A1%E5%8F%B0"},
+		},
+		{
+			name:     "template of missing fields",
+			template: "{{.UUID}}",
+			want:     MigrateResult{Skipped: 2},
+		},
+	}
+
+	for _, tt := range tests {
+		pool, s := newTestPool(t)
+		setLegacy(t, s)
+
+		res, err := Migrate(context.Background(), pool, "", tt.to, renameBy(t, tt.template), false)
+		if err != nil {
+			t.Fatalf("%s: Migrate returns error: %v", tt.name, err)
+		}
+		if *res != tt.want {
+			t.Errorf("%s: result is %+v, want %+v", tt.name, *res, tt.want)
+		}
+
+		members, _ := s.Members(tt.to + KeysKey)
+		if len(members) != len(tt.keys) {
+			t.Errorf("%s: indexed reports are %v, want %v", tt.name, members, tt.keys)
+		}
+		for _, key := range tt.keys {
+			if !s.Exists(tt.to + key) {
+				t.Errorf("%s: report is not stored by %s", tt.name, tt.to+key)
+			}
+			if ok, _ := s.SIsMember(tt.to+KeysKey, key); !ok {
+				t.Errorf("%s: %s is not indexed", tt.name, key)
+			}
+		}
+
+		if len(tt.keys) > 0 {
+			// The indexes of the areas are built from the reports.
+			if areas, _ := s.Members(tt.to + AreaIndexPrefix + "030010"); len(areas) != 1 || areas[0] != tt.keys[0] {
+				t.Errorf("%s: reports of area 030010 are %v, want %s", tt.name, areas, tt.keys[0])
+			}
+		}
+
+		if tt.want.Moved > 0 && s.Exists("気象特別警報・警報・注意報_盛岡地方気象台") {
+			t.Errorf("%s: legacy key is left after it is moved", tt.name)
+		}
+
+		for _, key := range []string{"session:1", "counter", "queue"} {
+			if !s.Exists(key) {
+				t.Errorf("%s: %s of another application is removed", tt.name, key)
+			}
+		}
+	}
+}
+
+func TestMigrateIndexedAndLegacyKeys(t *testing.T) {
+	pool, s := newTestPool(t)
+	setLegacy(t, s)
+
+	// A report written by the current version is found by the index, and the legacy one of the same key is not counted twice.
+	m := legacyReport("盛岡地方気象台", "030010")
+	m["feed"], m["id"] = testFeedURL, "urn:uuid:c1af90d4-23a8-3628-a489-2d40421838d7"
+	b, _ := json.Marshal(m)
+	s.Set("気象特別警報・警報・注意報_盛岡地方気象台", string(b))
+	s.SAdd(KeysKey, "気象特別警報・警報・注意報_盛岡地方気象台")
+
+	res, err := Migrate(context.Background(), pool, "", "", renameBy(t, "{{.Feed}}:{{.UUID}}"), true)
+	if err != nil {
+		t.Fatalf("Migrate returns error: %v", err)
+	}
+
+	// The report of Tottori has no entry id, so its key can't be generated.
+	if want := (MigrateResult{Moved: 1, Skipped: 1}); *res != want {
+		t.Errorf("result is %+v, want %+v", *res, want)
+	}
+
+	// Nothing is written by a dry run.
+	if s.Exists("extra:c1af90d4-23a8-3628-a489-2d40421838d7") {
+		t.Error("report is moved by dry run")
+	}
+}
@@ -0,0 +1,159 @@
+package store
+
+import (
+	"fmt"
+	"strings"
+
+	redigo "github.com/gomodule/redigo/redis"
+	"github.com/pkg/errors"
+
+	"github.com/hlts2/gweather/internal/metrics"
+)
+
+// errAborted is returned by exec when the transaction is aborted because a watched key has changed.
+var errAborted = errors.New("transaction aborted")
+
+// temporaryErrors are the prefixes of the errors of redis which may be resolved by retrying.
+var temporaryErrors = []string{
+	"LOADING", "READONLY", "MASTERDOWN", "CLUSTERDOWN", "TRYAGAIN", "MOVED", "ASK", "BUSY", "OOM", "NOAUTH",
+}
+
+// WriteError is returned by Save when redis rejected some of the commands of the writes.
+type WriteError struct {
+	// Errs are the errors of the rejected commands.
+	Errs []error
+}
+
+func (e *WriteError) Error() string {
+	msgs := make([]string, len(e.Errs))
+	for i, err := range e.Errs {
+		msgs[i] = err.Error()
+	}
+	return fmt.Sprintf("rejected %d commands: %s", len(e.Errs), strings.Join(msgs, "; "))
+}
+
+// Temporary returns true if all of the commands may succeed by retrying, e.g. during a failover.
+// The writes which are not temporary (e.g. WRONGTYPE) fail again by retrying.
+func (e *WriteError) Temporary() bool {
+	for _, err := range e.Errs {
+		if !temporary(errors.Cause(err)) {
+			return false
+		}
+	}
+	return true
+}
+
+func (e *WriteError) add(cmd command, err error) {
+	metrics.StoreErrors.WithLabelValues(strings.ToLower(cmd.name)).Inc()
+	e.Errs = append(e.Errs, errors.Wrap(err, cmd.String()))
+}
+
+func temporary(err error) bool {
+	rerr, ok := err.(redigo.Error)
+	if !ok {
+		return true
+	}
+
+	for _, prefix := range temporaryErrors {
+		if strings.HasPrefix(string(rerr), prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+type command struct {
+	name string
+	key  interface{}
+}
+
+func (c command) String() string {
+	if c.key == nil {
+		return c.name
+	}
+	return fmt.Sprintf("%s %s", c.name, c.key)
+}
+
+// pipeline sends commands in a pipeline, and checks the replies of all of them.
+type pipeline struct {
+	conn redigo.Conn
+	cmds []command
+	err  error
+}
+
+func (p *pipeline) send(name string, args ...interface{}) {
+	if p.err != nil {
+		return
+	}
+
+	if err := p.conn.Send(name, args...); err != nil {
+		p.err = errors.Wrapf(err, "faild to send: %s", name)
+		return
+	}
+
+	cmd := command{
+		name: name,
+	}
+	if len(args) > 0 {
+		cmd.key = args[0]
+	}
+	p.cmds = append(p.cmds, cmd)
+}
+
+// exec flushes the commands and receives their replies. It returns the reply of the last command.
+// The replies of the commands in a transaction (MULTI ... EXEC) are checked in the reply of EXEC.
+// The rejected commands are returned as WriteError, and errAborted is returned when the transaction is aborted.
+func (p *pipeline) exec() (interface{}, error) {
+	if p.err != nil {
+		return nil, p.err
+	}
+
+	if err := p.conn.Flush(); err != nil {
+		return nil, errors.Wrap(err, "faild to flush")
+	}
+
+	var (
+		last   interface{}
+		queued []command
+		werr   WriteError
+	)
+	for _, cmd := range p.cmds {
+		reply, err := p.conn.Receive()
+		if err != nil {
+			if _, ok := err.(redigo.Error); !ok {
+				return nil, errors.Wrapf(err, "faild to receive reply: %s", cmd)
+			}
+			werr.add(cmd, err)
+			continue
+		}
+		last = reply
+
+		switch cmd.name {
+		case "MULTI":
+			queued = []command{}
+		case "EXEC":
+			if reply == nil {
+				return nil, errAborted
+			}
+			replies, _ := reply.([]interface{})
+			for i, r := range replies {
+				if rerr, ok := r.(redigo.Error); ok && i < len(queued) {
+					werr.add(queued[i], rerr)
+				}
+			}
+			if len(replies) > 0 {
+				last = replies[len(replies)-1]
+			}
+			queued = nil
+		default:
+			if queued != nil {
+				queued = append(queued, cmd)
+			}
+		}
+	}
+
+	if len(werr.Errs) > 0 {
+		return nil, &werr
+	}
+	return last, nil
+}
@@ -0,0 +1,186 @@
+package store
+
+import (
+	"io"
+	"strings"
+	"testing"
+
+	redigo "github.com/gomodule/redigo/redis"
+	"github.com/pkg/errors"
+)
+
+// fakeConn is redigo.Conn which returns the replies in order by Receive.
+type fakeConn struct {
+	replies []interface{}
+}
+
+func (c *fakeConn) Close() error { return nil }
+func (c *fakeConn) Err() error   { return nil }
+func (c *fakeConn) Flush() error { return nil }
+
+func (c *fakeConn) Do(name string, args ...interface{}) (interface{}, error) {
+	return nil, errors.New("not supported")
+}
+
+func (c *fakeConn) Send(name string, args ...interface{}) error {
+	return nil
+}
+
+func (c *fakeConn) Receive() (interface{}, error) {
+	if len(c.replies) == 0 {
+		return nil, io.EOF
+	}
+	r := c.replies[0]
+	c.replies = c.replies[1:]
+	if err, ok := r.(error); ok {
+		return nil, err
+	}
+	return r, nil
+}
+
+func TestWriteErrorTemporary(t *testing.T) {
+	tests := []struct {
+		name      string
+		errs      []error
+		temporary bool
+	}{
+		{name: "failover", errs: []error{redigo.Error("READONLY You can't write against a read only replica.")}, temporary: true},
+		{name: "loading", errs: []error{errors.Wrap(redigo.Error("LOADING Redis is loading the dataset in memory"), "SET key")}, temporary: true},
+		{name: "connection", errs: []error{io.ErrUnexpectedEOF}, temporary: true},
+		{name: "wrong type", errs: []error{redigo.Error("WRONGTYPE Operation against a key holding the wrong kind of value")}},
+		{
+			name: "partly",
+			errs: []error{
+				redigo.Error("READONLY You can't write against a read only replica."),
+				errors.Wrap(redigo.Error("WRONGTYPE Operation against a key holding the wrong kind of value"), "SADD key"),
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		err := &WriteError{Errs: tt.errs}
+		if got := err.Temporary(); got != tt.temporary {
+			t.Errorf("%s: Temporary returns %v, want %v", tt.name, got, tt.temporary)
+		}
+	}
+}
+
+func TestPipelineExec(t *testing.T) {
+	conn := &fakeConn{
+		replies: []interface{}{
+			"OK",
+			"OK",
+			"QUEUED",
+			"QUEUED",
+			"QUEUED",
+			[]interface{}{"OK", redigo.Error("WRONGTYPE Operation against a key holding the wrong kind of value"), int64(1)},
+		},
+	}
+
+	p := &pipeline{conn: conn}
+	p.send("WATCH", "gweather:keys")
+	p.send("MULTI")
+	p.send("SET", "key", "value")
+	p.send("SADD", "gweather:keys", "key")
+	p.send("LPUSH", "history", "value")
+	p.send("EXEC")
+
+	// The command rejected in the transaction is found by the reply of EXEC.
+	_, err := p.exec()
+
+	werr, ok := err.(*WriteError)
+	if !ok {
+		t.Fatalf("exec returns %v, want WriteError", err)
+	}
+	if len(werr.Errs) != 1 || !strings.HasPrefix(werr.Errs[0].Error(), "SADD gweather:keys: WRONGTYPE") {
+		t.Errorf("rejected commands are %v, want SADD gweather:keys", werr.Errs)
+	}
+	if werr.Temporary() {
+		t.Error("WRONGTYPE is temporary")
+	}
+}
+
+func TestPipelineExecLastReply(t *testing.T) {
+	conn := &fakeConn{
+		replies: []interface{}{"OK", "QUEUED", "QUEUED", []interface{}{"OK", int64(2)}},
+	}
+
+	p := &pipeline{conn: conn}
+	p.send("MULTI")
+	p.send("SET", "key", "value")
+	p.send("SADD", "gweather:keys", "key")
+	p.send("EXEC")
+
+	last, err := p.exec()
+	if err != nil {
+		t.Fatalf("exec returns error: %v", err)
+	}
+	if last != int64(2) {
+		t.Errorf("last reply is %v, want the reply of SADD in the transaction", last)
+	}
+}
+
+func TestPipelineExecRejected(t *testing.T) {
+	// A command rejected on queueing is reported by itself, and EXEC is rejected as well.
+	conn := &fakeConn{
+		replies: []interface{}{
+			"OK",
+			redigo.Error("ERR wrong number of arguments for 'set' command"),
+			redigo.Error("EXECABORT Transaction discarded because of previous errors."),
+		},
+	}
+
+	p := &pipeline{conn: conn}
+	p.send("MULTI")
+	p.send("SET", "key")
+	p.send("EXEC")
+
+	_, err := p.exec()
+
+	werr, ok := err.(*WriteError)
+	if !ok {
+		t.Fatalf("exec returns %v, want WriteError", err)
+	}
+	if len(werr.Errs) != 2 || !strings.HasPrefix(werr.Errs[0].Error(), "SET key: ERR") || !strings.HasPrefix(werr.Errs[1].Error(), "EXEC: EXECABORT") {
+		t.Errorf("rejected commands are %v, want SET key and EXEC", werr.Errs)
+	}
+}
+
+func TestPipelineExecAborted(t *testing.T) {
+	conn := &fakeConn{
+		replies: []interface{}{"OK", "OK", "QUEUED", nil},
+	}
+
+	p := &pipeline{conn: conn}
+	p.send("WATCH", "gweather:keys")
+	p.send("MULTI")
+	p.send("SET", "key", "value")
+	p.send("EXEC")
+
+	if _, err := p.exec(); err != errAborted {
+		t.Errorf("exec returns %v, want errAborted", err)
+	}
+}
+
+func TestPipelineExecConnectionError(t *testing.T) {
+	// A connection error is not WriteError, since the replies of the rest of the commands are lost.
+	conn := &fakeConn{
+		replies: []interface{}{"OK"},
+	}
+
+	p := &pipeline{conn: conn}
+	p.send("MULTI")
+	p.send("SET", "key", "value")
+	p.send("EXEC")
+
+	_, err := p.exec()
+	if err == nil {
+		t.Fatal("exec returns no error")
+	}
+	if _, ok := err.(*WriteError); ok {
+		t.Errorf("exec returns WriteError for connection error: %v", err)
+	}
+	if errors.Cause(err) != io.EOF {
+		t.Errorf("exec returns %v, want EOF", err)
+	}
+}
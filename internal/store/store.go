@@ -0,0 +1,539 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+	"time"
+
+	redigo "github.com/gomodule/redigo/redis"
+	"github.com/pkg/errors"
+	"go.opentelemetry.io/otel/attribute"
+
+	"github.com/hlts2/gweather/internal/log"
+	"github.com/hlts2/gweather/internal/metrics"
+	"github.com/hlts2/gweather/internal/redis"
+	"github.com/hlts2/gweather/internal/report"
+	"github.com/hlts2/gweather/internal/trace"
+)
+
+const (
+	// Namespace is the prefix of the keys written by gweather other than the reports, e.g. the indexes and the history.
+	Namespace = "gweather:"
+
+	// KeysKey is the key of the set of report keys.
+	KeysKey = "gweather:reports"
+
+	// HistoryKeyPrefix is the prefix of the keys of the lists of previous reports.
+	HistoryKeyPrefix = "gweather:history:"
+
+	// GenerationKey is the key of the counter incremented after each write of reports.
+	// Consumers can watch it to read the reports of a write at once.
+	GenerationKey = "gweather:generation"
+
+	// ExpiryKey is the key of the sorted set of the report keys scored by the time when they expire in unix milliseconds.
+	// It is written only with WithTTL, and the expired reports are removed from the indexes by the next write.
+	ExpiryKey = "gweather:expiry"
+)
+
+var (
+	// ErrNotFound is returned when the report does not exist.
+	ErrNotFound = errors.New("report not found")
+
+	// ErrNotLeader is returned by Save when the store is fenced and this replica no longer holds the fencing token.
+	ErrNotLeader = errors.New("not leader")
+)
+
+// abortRetries is the number of the retries of a transaction aborted by a change of the watched fencing token.
+// The token is checked again by the retry, and the writes fail with ErrNotLeader if another replica has taken over.
+const abortRetries = 3
+
+// Store represents an interface to store reports.
+type Store interface {
+	// Save stores reports by their keys. A report is appended to the history of the key when its entry id has changed,
+	// the indexes of areas, offices and warnings and the warnings of each area are updated, and its events are published and notified.
+	// The reports are written atomically and the generation is incremented, except in Redis Cluster
+	// where they are written in a pipeline and the generation is incremented after all of them are written.
+	Save(ctx context.Context, mm map[string]map[string]interface{}) error
+
+	// Get returns the latest report of the key.
+	Get(ctx context.Context, key string) (map[string]interface{}, error)
+
+	// List returns the latest reports of all keys.
+	List(ctx context.Context) (map[string]map[string]interface{}, error)
+
+	// History returns at most limit reports of the key in order from newest to oldest.
+	History(ctx context.Context, key string, limit int) ([]map[string]interface{}, error)
+
+	// Warnings returns the warnings currently active in the area in order of the warning kind code.
+	// A warning kind asserted by several reports is returned once, from the latest report.
+	Warnings(ctx context.Context, area string) ([]*AreaWarning, error)
+
+	// Events returns at most limit latest events after the event ID, which are replayed from OutboxKey.
+	// The events are published to EventsChannel by Save when they are written, and appended to OutboxKey with WithOutbox.
+	Events(ctx context.Context, after string, limit int) ([]*Event, error)
+}
+
+type storeImpl struct {
+	pool         redis.Pool
+	historyLimit int
+	prefix       string
+	fenceKey     string
+	token        func() int64
+	notifiers    []Notifier
+	outbox       bool
+	outboxSize   int
+	ttl          time.Duration
+}
+
+// Notifier is notified of the events of the reports written by Save, e.g. to deliver them to a message broker.
+type Notifier interface {
+	// Notify must not block, since it is called by Save.
+	Notify(ctx context.Context, evs []*Event)
+}
+
+// Option configures the store.
+type Option func(*storeImpl)
+
+// WithPrefix returns an option that prepends prefix to all keys in redis, so that several applications share redis.
+// The keys given to and returned by Store don't contain the prefix.
+func WithPrefix(prefix string) Option {
+	return func(s *storeImpl) {
+		s.prefix = prefix
+	}
+}
+
+// WithFence returns an option that writes reports only while the value of key is the fencing token returned by token.
+// The key is watched during the transaction, so the writes of a replica which has lost the lock are rejected with ErrNotLeader.
+// The key must be changed only when another replica takes over, e.g. leader.TokenKey rather than the lock renewed by the leader.
+// The fence is checked only before the writes in Redis Cluster, where the key belongs to another slot.
+func WithFence(key string, token func() int64) Option {
+	return func(s *storeImpl) {
+		s.fenceKey = key
+		s.token = token
+	}
+}
+
+// WithNotifier returns an option that notifies n of the events of the changed reports after they are written.
+// Unlike the events published to EventsChannel, n is notified only by the replica which writes the reports.
+func WithNotifier(n Notifier) Option {
+	return func(s *storeImpl) {
+		s.notifiers = append(s.notifiers, n)
+	}
+}
+
+// WithOutbox returns an option that appends the events of the changed reports to the stream OutboxKey in the same transaction,
+// so that they are delivered to the sinks even if this replica stops before delivering them, and replayed by Events.
+// The stream is trimmed to about size entries when it is appended if size is positive, or by the reader otherwise, e.g. sink.Dispatcher.
+func WithOutbox(size int) Option {
+	return func(s *storeImpl) {
+		s.outbox = true
+		s.outboxSize = size
+	}
+}
+
+// WithTTL returns an option that expires the reports which have not been written for ttl, e.g. after they are dropped from the feed.
+// The expired reports are removed from the set of the keys, the indexes and the warnings of the areas by the next Save, and their history is kept.
+func WithTTL(ttl time.Duration) Option {
+	return func(s *storeImpl) {
+		s.ttl = ttl
+	}
+}
+
+// New returns Store implementation which stores reports in redis.
+// At most historyLimit reports are kept in the history of each key.
+func New(pool redis.Pool, historyLimit int, opts ...Option) Store {
+	s := &storeImpl{
+		pool:         pool,
+		historyLimit: historyLimit,
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+func (s *storeImpl) Save(ctx context.Context, mm map[string]map[string]interface{}) (err error) {
+	if len(mm) == 0 {
+		return nil
+	}
+
+	ctx, span := trace.Start(ctx, "store.Save", attribute.Int("reports", len(mm)))
+
+	start := time.Now()
+	defer func() {
+		metrics.StoreWriteDuration.Observe(time.Since(start).Seconds())
+		if err != nil {
+			metrics.StoreErrors.WithLabelValues("save").Inc()
+		}
+		trace.End(span, err)
+	}()
+
+	conn, err := s.pool.GetContext(ctx)
+	if err != nil {
+		return errors.Wrap(err, "faild to get redis connection")
+	}
+	defer conn.Close()
+
+	for i := 0; ; i++ {
+		err = s.save(ctx, conn, mm)
+		if err != errAborted {
+			return err
+		}
+		if i == abortRetries {
+			return errors.Wrap(err, "faild to write reports")
+		}
+		log.FromContext(ctx, log.SubsystemStore).Debug("Transaction is aborted, retry")
+	}
+}
+
+// save writes the reports in a transaction. It returns errAborted when the transaction is aborted by a change of the watched fencing token,
+// and the writes are retried by Save so that the token is checked again.
+func (s *storeImpl) save(ctx context.Context, conn redigo.Conn, mm map[string]map[string]interface{}) error {
+	l := log.FromContext(ctx, log.SubsystemStore)
+
+	// The keys of a transaction must belong to the same slot in Redis Cluster.
+	atomic := !redis.IsCluster(s.pool)
+
+	if s.token != nil {
+		if err := s.fence(conn, atomic); err != nil {
+			return err
+		}
+	}
+
+	// expired are the last reports of the expired keys, which are removed from the indexes unless they are written again.
+	var expired map[string]map[string]interface{}
+	if s.ttl > 0 {
+		var err error
+		if expired, err = s.expired(conn); err != nil {
+			return err
+		}
+	}
+
+	keys := make([]string, 0, len(mm))
+	args := make([]interface{}, 0, len(mm))
+	for key := range mm {
+		keys = append(keys, key)
+		args = append(args, s.prefix+key)
+	}
+
+	bs, err := redigo.ByteSlices(conn.Do("MGET", args...))
+	if err != nil {
+		return errors.Wrap(err, "faild to get previous reports")
+	}
+
+	// prevs are the previous reports of the keys, and warnings are the changes of the warnings of the changed and expired reports.
+	prevs := make(map[string]map[string]interface{}, len(keys))
+	warnings := newWarningChanges()
+	for i, key := range keys {
+		prev := decode(bs[i])
+		if last, ok := expired[key]; ok {
+			// The report has expired before it is written again, so it is compared with the last one in the history.
+			if prev == nil {
+				prev = last
+			}
+			delete(expired, key)
+		}
+		prevs[key] = prev
+
+		if changed(prev, mm[key]) {
+			warnings.add(key, prev, mm[key])
+		}
+	}
+	for key, last := range expired {
+		warnings.add(key, last, nil)
+	}
+
+	lifted, err := warnings.unasserted(conn, s.prefix, atomic)
+	if err != nil {
+		return err
+	}
+
+	p := &pipeline{
+		conn: conn,
+	}
+	if atomic {
+		p.send("MULTI")
+	}
+
+	// evs are the events of the changed reports.
+	var evs []*Event
+
+	for _, key := range keys {
+		val := mm[key]
+
+		b, err := json.Marshal(val)
+		if err != nil {
+			return errors.Wrapf(err, "faild to marshal report: %s", key)
+		}
+
+		// e.g) key: 気象特別警報・警報・注意報_鳥取地方気象台
+		if s.ttl > 0 {
+			p.send("SET", s.prefix+key, b, "PX", int64(s.ttl/time.Millisecond))
+			p.send("ZADD", s.prefix+ExpiryKey, time.Now().Add(s.ttl).UnixNano()/int64(time.Millisecond), key)
+		} else {
+			p.send("SET", s.prefix+key, b)
+		}
+		p.send("SADD", s.prefix+KeysKey, key)
+
+		prev := prevs[key]
+		if !changed(prev, val) {
+			continue
+		}
+
+		// The indexes are updated only when the report has changed, since it is updated by a new entry.
+		sendIndex(p, s.prefix, key, prev, val)
+		sendView(p, s.prefix, key, prev, val)
+
+		id, _ := val["id"].(string)
+		l.With("key", key, "entry_uuid", report.UUID(id)).Debug("Append report to history")
+
+		p.send("LPUSH", s.prefix+HistoryKeyPrefix+key, b)
+		if s.historyLimit > 0 {
+			p.send("LTRIM", s.prefix+HistoryKeyPrefix+key, 0, s.historyLimit-1)
+		}
+
+		// The events are published in the transaction, so they are not published when it is aborted.
+		for _, ev := range events(key, prev, val) {
+			eb, err := json.Marshal(ev)
+			if err != nil {
+				return errors.Wrapf(err, "faild to marshal event: %s", key)
+			}
+			p.send("PUBLISH", s.prefix+EventsChannel, eb)
+			if s.outbox && s.outboxSize > 0 {
+				p.send("XADD", s.prefix+OutboxKey, "MAXLEN", "~", s.outboxSize, "*", OutboxField, eb)
+			} else if s.outbox {
+				p.send("XADD", s.prefix+OutboxKey, "*", OutboxField, eb)
+			}
+			evs = append(evs, ev)
+		}
+	}
+
+	for key, last := range expired {
+		p.send("DEL", s.prefix+key)
+		p.send("SREM", s.prefix+KeysKey, key)
+		p.send("ZREM", s.prefix+ExpiryKey, key)
+		sendIndex(p, s.prefix, key, last, nil)
+		sendView(p, s.prefix, key, last, nil)
+	}
+	sendLifted(p, s.prefix, lifted)
+	if atomic {
+		p.send("INCR", s.prefix+GenerationKey)
+		p.send("EXEC")
+	}
+
+	reply, err := p.exec()
+	if err == errAborted {
+		return err
+	}
+	if err != nil {
+		return errors.Wrap(err, "faild to write reports")
+	}
+
+	if len(expired) > 0 {
+		l.Infof("Remove expired reports: %d", len(expired))
+	}
+
+	// The reports have been written, even if the generation can't be incremented in Redis Cluster.
+	if len(evs) > 0 {
+		for _, n := range s.notifiers {
+			n.Notify(ctx, evs)
+		}
+	}
+
+	if !atomic {
+		reply, err = conn.Do("INCR", s.prefix+GenerationKey)
+		if err != nil {
+			metrics.StoreErrors.WithLabelValues("incr").Inc()
+			return errors.Wrapf(err, "faild to increment: %s", s.prefix+GenerationKey)
+		}
+	}
+
+	gen, _ := redigo.Int64(reply, nil)
+	metrics.StoreGeneration.Set(float64(gen))
+
+	l.With("generation", gen).Debugf("Saved reports: %d", len(mm))
+	return nil
+}
+
+// fence checks that the fencing token is held by this replica.
+// In atomic mode, the key is watched until EXEC, so that the transaction is aborted when another replica takes over.
+func (s *storeImpl) fence(conn redigo.Conn, atomic bool) error {
+	token := s.token()
+	if token == 0 {
+		return ErrNotLeader
+	}
+
+	if atomic {
+		if _, err := conn.Do("WATCH", s.prefix+s.fenceKey); err != nil {
+			return errors.Wrapf(err, "faild to watch: %s", s.prefix+s.fenceKey)
+		}
+	}
+
+	cur, err := redigo.Int64(conn.Do("GET", s.prefix+s.fenceKey))
+	if err != nil && err != redigo.ErrNil {
+		return errors.Wrapf(err, "faild to get fencing token: %s", s.prefix+s.fenceKey)
+	}
+	if cur != token {
+		// The connection unwatches the key when it is returned to the pool.
+		return ErrNotLeader
+	}
+	return nil
+}
+
+// expired returns the last reports in the histories of the expired keys. The report is nil if the history is empty.
+func (s *storeImpl) expired(conn redigo.Conn) (map[string]map[string]interface{}, error) {
+	now := time.Now().UnixNano() / int64(time.Millisecond)
+	keys, err := redigo.Strings(conn.Do("ZRANGEBYSCORE", s.prefix+ExpiryKey, "-inf", now))
+	if err != nil {
+		return nil, errors.Wrapf(err, "faild to get expired reports: %s", s.prefix+ExpiryKey)
+	}
+
+	mm := make(map[string]map[string]interface{}, len(keys))
+	for _, key := range keys {
+		b, err := redigo.Bytes(conn.Do("LINDEX", s.prefix+HistoryKeyPrefix+key, 0))
+		if err != nil && err != redigo.ErrNil {
+			return nil, errors.Wrapf(err, "faild to get history: %s", key)
+		}
+		mm[key] = decode(b)
+	}
+	return mm, nil
+}
+
+// changed returns true if the entry id of the report differs from the previous one.
+func changed(prev, val map[string]interface{}) bool {
+	return prev == nil || prev["id"] != val["id"]
+}
+
+// decode returns the report of b. It returns nil if b is nil or invalid.
+func decode(b []byte) map[string]interface{} {
+	if b == nil {
+		return nil
+	}
+
+	var m map[string]interface{}
+	if err := json.Unmarshal(b, &m); err != nil {
+		return nil
+	}
+	return m
+}
+
+func (s *storeImpl) Get(ctx context.Context, key string) (map[string]interface{}, error) {
+	conn, err := s.pool.GetContext(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "faild to get redis connection")
+	}
+	defer conn.Close()
+
+	b, err := redigo.Bytes(conn.Do("GET", s.prefix+key))
+	if err == redigo.ErrNil {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "faild to get: %s", key)
+	}
+
+	m := make(map[string]interface{})
+	if err := json.Unmarshal(b, &m); err != nil {
+		return nil, errors.Wrapf(err, "faild to unmarshal report: %s", key)
+	}
+	return m, nil
+}
+
+func (s *storeImpl) List(ctx context.Context) (map[string]map[string]interface{}, error) {
+	conn, err := s.pool.GetContext(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "faild to get redis connection")
+	}
+	defer conn.Close()
+
+	keys, err := redigo.Strings(conn.Do("SMEMBERS", s.prefix+KeysKey))
+	if err != nil {
+		return nil, errors.Wrapf(err, "faild to get members: %s", s.prefix+KeysKey)
+	}
+
+	mm := make(map[string]map[string]interface{}, len(keys))
+	if len(keys) == 0 {
+		return mm, nil
+	}
+
+	args := make([]interface{}, len(keys))
+	for i, key := range keys {
+		args[i] = s.prefix + key
+	}
+
+	vals, err := redigo.ByteSlices(conn.Do("MGET", args...))
+	if err != nil {
+		return nil, errors.Wrap(err, "faild to get reports")
+	}
+
+	for i, b := range vals {
+		if b == nil {
+			continue
+		}
+
+		m := make(map[string]interface{})
+		if err := json.Unmarshal(b, &m); err != nil {
+			return nil, errors.Wrapf(err, "faild to unmarshal report: %s", keys[i])
+		}
+		mm[keys[i]] = m
+	}
+	return mm, nil
+}
+
+func (s *storeImpl) History(ctx context.Context, key string, limit int) ([]map[string]interface{}, error) {
+	conn, err := s.pool.GetContext(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "faild to get redis connection")
+	}
+	defer conn.Close()
+
+	vals, err := redigo.ByteSlices(conn.Do("LRANGE", s.prefix+HistoryKeyPrefix+key, 0, limit-1))
+	if err != nil {
+		return nil, errors.Wrapf(err, "faild to get history: %s", key)
+	}
+
+	ms := make([]map[string]interface{}, 0, len(vals))
+	for _, b := range vals {
+		m := make(map[string]interface{})
+		if err := json.Unmarshal(b, &m); err != nil {
+			return nil, errors.Wrapf(err, "faild to unmarshal report: %s", key)
+		}
+		ms = append(ms, m)
+	}
+	return ms, nil
+}
+
+func (s *storeImpl) Warnings(ctx context.Context, area string) ([]*AreaWarning, error) {
+	conn, err := s.pool.GetContext(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "faild to get redis connection")
+	}
+	defer conn.Close()
+
+	vals, err := redigo.StringMap(conn.Do("HGETALL", s.prefix+AreaKeyPrefix+area))
+	if err != nil {
+		return nil, errors.Wrapf(err, "faild to get warnings: %s", area)
+	}
+
+	// Several reports may assert a warning kind in the area, e.g. the reports of the prefecture and of the subdivisions,
+	// and the latest one is returned.
+	byCode := make(map[string]*AreaWarning, len(vals))
+	for field, v := range vals {
+		w := new(AreaWarning)
+		if err := json.Unmarshal([]byte(v), w); err != nil {
+			return nil, errors.Wrapf(err, "faild to unmarshal warning: %s", field)
+		}
+		if cur, ok := byCode[w.Code]; !ok || w.Issued > cur.Issued || (w.Issued == cur.Issued && w.Key < cur.Key) {
+			byCode[w.Code] = w
+		}
+	}
+
+	ws := make([]*AreaWarning, 0, len(byCode))
+	for _, w := range byCode {
+		ws = append(ws, w)
+	}
+
+	sort.Slice(ws, func(i, j int) bool { return ws[i].Code < ws[j].Code })
+	return ws, nil
+}
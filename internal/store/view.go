@@ -0,0 +1,118 @@
+package store
+
+import (
+	"encoding/json"
+
+	"github.com/hlts2/gweather/internal/report"
+)
+
+// AreaKeyPrefix is the prefix of the hashes of the warnings currently active in each area code.
+// The field is the warning kind code and the key of the report asserting it, e.g. 14|気象特別警報・警報・注意報_盛岡地方気象台,
+// and the value is AreaWarning as JSON, so that the reports of an area update only their own warnings.
+// e.g) gweather:area:030010
+const AreaKeyPrefix = "gweather:area:"
+
+// AreaWarning represents a warning kind currently active in an area.
+type AreaWarning struct {
+	Area     string `json:"area"`
+	AreaName string `json:"area_name"`
+
+	// Type is the type of the items of the area, e.g. 気象警報・注意報（一次細分区域等）.
+	Type string `json:"type"`
+
+	Code   string   `json:"code"`
+	Name   string   `json:"name"`
+	Status string   `json:"status"`
+	Notes  []string `json:"notes,omitempty"`
+
+	// Issued is the time when the report was updated.
+	Issued string `json:"issued"`
+
+	// Key is the key of the report.
+	Key string `json:"key"`
+}
+
+// areaWarnings returns the active warnings of the report by area code.
+// The areas where all warnings are lifted have an empty map.
+func areaWarnings(key string, m map[string]interface{}) map[string]map[string]*AreaWarning {
+	areas := make(map[string]map[string]*AreaWarning)
+	if m == nil {
+		return areas
+	}
+
+	issued, _ := m["updated"].(string)
+
+	for _, w := range report.Warnings(m["body"]) {
+		if w.Area == "" {
+			continue
+		}
+
+		kinds, ok := areas[w.Area]
+		if !ok {
+			kinds = make(map[string]*AreaWarning)
+			areas[w.Area] = kinds
+		}
+
+		if !w.Active() {
+			continue
+		}
+		kinds[w.Code] = &AreaWarning{
+			Area:     w.Area,
+			AreaName: w.AreaName,
+			Type:     w.Type,
+			Code:     w.Code,
+			Name:     w.Name,
+			Status:   w.Status,
+			Notes:    w.Notes,
+			Issued:   issued,
+			Key:      key,
+		}
+	}
+	return areas
+}
+
+// sendView sends the commands to update the hashes of the areas of the report of key from prev to cur to p.
+// The fields of the report in an area are replaced by the warnings of cur, since the latest report describes all its warnings of the area.
+// The fields of the other reports are kept.
+func sendView(p *pipeline, prefix, key string, prev, cur map[string]interface{}) {
+	olds, news := areaWarnings(key, prev), areaWarnings(key, cur)
+
+	for area, kinds := range olds {
+		args := []interface{}{prefix + AreaKeyPrefix + area}
+		for code := range kinds {
+			if _, ok := news[area][code]; !ok {
+				args = append(args, code+IndexMemberSeparator+key)
+			}
+		}
+		if len(args) > 1 {
+			p.send("HDEL", args...)
+		}
+	}
+
+	for area, kinds := range news {
+		if len(kinds) == 0 {
+			continue
+		}
+
+		args := []interface{}{prefix + AreaKeyPrefix + area}
+		for code, w := range kinds {
+			b, _ := json.Marshal(w)
+			args = append(args, code+IndexMemberSeparator+key, b)
+		}
+		p.send("HSET", args...)
+	}
+}
+
+// sendLegacyView sends the commands to remove the fields of the hashes of the areas of the report written by older versions to p,
+// which are the bare warning kind codes without the key of the report.
+func sendLegacyView(p *pipeline, prefix string, m map[string]interface{}) {
+	for area, kinds := range areaWarnings("", m) {
+		args := []interface{}{prefix + AreaKeyPrefix + area}
+		for code := range kinds {
+			args = append(args, code)
+		}
+		if len(args) > 1 {
+			p.send("HDEL", args...)
+		}
+	}
+}
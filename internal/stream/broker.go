@@ -0,0 +1,303 @@
+package stream
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"time"
+
+	redigo "github.com/gomodule/redigo/redis"
+	"github.com/pkg/errors"
+
+	"github.com/hlts2/gweather/internal/log"
+	"github.com/hlts2/gweather/internal/metrics"
+	"github.com/hlts2/gweather/internal/redis"
+	"github.com/hlts2/gweather/internal/report"
+	"github.com/hlts2/gweather/internal/store"
+)
+
+const (
+	// bufferSize is the number of the events waiting for a slow subscription before it is dropped.
+	bufferSize = 256
+
+	// pingInterval is the interval of the heartbeats to keep the idle connections open.
+	pingInterval = 30 * time.Second
+
+	// maxReplay is the maximum number of the events replayed from the outbox on resuming.
+	maxReplay = 1000
+
+	minRetry = time.Second
+	maxRetry = 30 * time.Second
+)
+
+// ErrDropped is returned by Subscription.Send when the subscription is dropped because the client can't keep up with the events.
+var ErrDropped = errors.New("too slow to receive events")
+
+// Broker subscribes to the events published by the store, and fans them out to the subscriptions.
+// Every replica receives the events, so the clients can connect to any of them.
+type Broker struct {
+	mu      sync.Mutex
+	pool    redis.Pool
+	channel string
+	subs    map[*Subscription]struct{}
+	reset   chan struct{}
+}
+
+// NewBroker returns Broker which subscribes to the events of the store with prefix by pool.
+func NewBroker(pool redis.Pool, prefix string) *Broker {
+	return &Broker{
+		pool:    pool,
+		channel: prefix + store.EventsChannel,
+		subs:    make(map[*Subscription]struct{}),
+		reset:   make(chan struct{}, 1),
+	}
+}
+
+// Reset replaces the pool and the prefix when the configuration is reloaded, and subscribes again.
+func (b *Broker) Reset(pool redis.Pool, prefix string) {
+	b.mu.Lock()
+	b.pool, b.channel = pool, prefix+store.EventsChannel
+	b.mu.Unlock()
+
+	select {
+	case b.reset <- struct{}{}:
+	default:
+	}
+}
+
+// Subscription receives the events matching its filter.
+type Subscription struct {
+	broker *Broker
+	filter *report.Filter
+	c      chan *store.Event
+	closed bool
+}
+
+// Subscribe returns Subscription of the events matching f.
+func (b *Broker) Subscribe(f *report.Filter) *Subscription {
+	s := &Subscription{
+		broker: b,
+		filter: f,
+		c:      make(chan *store.Event, bufferSize),
+	}
+
+	b.mu.Lock()
+	b.subs[s] = struct{}{}
+	b.mu.Unlock()
+	return s
+}
+
+// Resume subscribes to the events matching f, and returns the events after the event of last replayed from st.
+// The subscription starts before the replay, so that no event is missed between them. Nothing is replayed if last is empty.
+func (b *Broker) Resume(ctx context.Context, st store.Store, f *report.Filter, last string) (*Subscription, []*store.Event, error) {
+	sub := b.Subscribe(f)
+	if last == "" {
+		return sub, nil, nil
+	}
+
+	evs, err := st.Events(ctx, last, maxReplay)
+	if err != nil {
+		sub.Close()
+		return nil, nil, err
+	}
+
+	replay := make([]*store.Event, 0, len(evs))
+	for _, ev := range evs {
+		if ev.Match(f) {
+			replay = append(replay, ev)
+		}
+	}
+	return sub, replay, nil
+}
+
+// C returns the channel which receives the events.
+// The channel is closed when the subscription can't keep up with the events, and the client should resume from the last event.
+func (s *Subscription) C() <-chan *store.Event {
+	return s.c
+}
+
+// Close stops receiving the events.
+func (s *Subscription) Close() {
+	s.broker.mu.Lock()
+	s.close()
+	s.broker.mu.Unlock()
+}
+
+// Send sends the replayed events and then the events of the subscription until ctx is canceled.
+// The events of the subscription which have been replayed are not sent again. The others are sent even if their IDs are before the replayed ones,
+// since the events are not always published in order of the IDs, e.g. when a report updated earlier is written later.
+// ping is called at the interval of the heartbeats if it is not nil. ErrDropped is returned when the subscription is dropped.
+func (s *Subscription) Send(ctx context.Context, replay []*store.Event, send func(*store.Event) error, ping func() error) error {
+	replayed := make(map[string]bool, len(replay))
+	for _, ev := range replay {
+		if err := send(ev); err != nil {
+			return err
+		}
+		replayed[ev.ID] = true
+	}
+
+	t := time.NewTicker(pingInterval)
+	defer t.Stop()
+
+	for {
+		select {
+		case ev, ok := <-s.c:
+			if !ok {
+				return ErrDropped
+			}
+			if replayed[ev.ID] {
+				// The event has been published while it was replayed.
+				delete(replayed, ev.ID)
+				continue
+			}
+			if err := send(ev); err != nil {
+				return err
+			}
+		case <-t.C:
+			if ping == nil {
+				continue
+			}
+			if err := ping(); err != nil {
+				return err
+			}
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
+
+// close must be called with the lock of the broker held.
+func (s *Subscription) close() {
+	if s.closed {
+		return
+	}
+	delete(s.broker.subs, s)
+	close(s.c)
+	s.closed = true
+}
+
+func (b *Broker) publish(ev *store.Event) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for s := range b.subs {
+		if !ev.Match(s.filter) {
+			continue
+		}
+
+		select {
+		case s.c <- ev:
+		default:
+			metrics.StreamDropped.Inc()
+			s.close()
+		}
+	}
+}
+
+// Run subscribes to the events until ctx is canceled.
+// The events are subscribed again with backoff when the connection is lost.
+func (b *Broker) Run(ctx context.Context) {
+	l := log.New(log.SubsystemNotifier)
+	retry := minRetry
+
+	for {
+		err := b.subscribe(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+		if err == nil {
+			// Reset is called.
+			retry = minRetry
+			continue
+		}
+
+		l.Warnf("faild to subscribe events, retry in %v: %v", retry, err)
+
+		t := time.NewTimer(retry)
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return
+		case <-b.reset:
+			t.Stop()
+			retry = minRetry
+			continue
+		case <-t.C:
+		}
+
+		if retry *= 2; retry > maxRetry {
+			retry = maxRetry
+		}
+	}
+}
+
+// subscribe receives the events until ctx is canceled, Reset is called or the connection fails.
+// It returns nil when Reset is called.
+func (b *Broker) subscribe(ctx context.Context) error {
+	l := log.New(log.SubsystemNotifier)
+
+	b.mu.Lock()
+	pool, channel := b.pool, b.channel
+	b.mu.Unlock()
+
+	conn, err := redis.Dedicated(ctx, pool, channel)
+	if err != nil {
+		return errors.Wrap(err, "faild to get redis connection")
+	}
+
+	psc := redigo.PubSubConn{Conn: conn}
+	defer psc.Close()
+
+	if err := psc.Subscribe(channel); err != nil {
+		return errors.Wrapf(err, "faild to subscribe: %s", channel)
+	}
+
+	// The connection is pinged to detect that it is lost, since no event may be published for a while.
+	stop, done := make(chan struct{}), make(chan struct{})
+	go func() {
+		defer close(done)
+
+		t := time.NewTicker(pingInterval)
+		defer t.Stop()
+
+		for {
+			select {
+			case <-t.C:
+				psc.Ping("")
+			case <-b.reset:
+				psc.Unsubscribe()
+				return
+			case <-ctx.Done():
+				psc.Close()
+				return
+			case <-stop:
+				return
+			}
+		}
+	}()
+	defer func() {
+		close(stop)
+		<-done
+	}()
+
+	for {
+		switch v := psc.ReceiveWithTimeout(2 * pingInterval).(type) {
+		case redigo.Message:
+			ev := new(store.Event)
+			if err := json.Unmarshal(v.Data, ev); err != nil {
+				l.Warnf("Ignore invalid event: %v", err)
+				continue
+			}
+			b.publish(ev)
+		case redigo.Subscription:
+			switch {
+			case v.Count == 0:
+				return nil
+			case v.Kind == "subscribe":
+				l.With("channel", channel).Info("Subscribed to events")
+			}
+		case error:
+			return errors.Wrap(v, "faild to receive event")
+		}
+	}
+}
@@ -0,0 +1,260 @@
+package stream
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/pkg/errors"
+
+	"github.com/hlts2/gweather/internal/log"
+	"github.com/hlts2/gweather/internal/metrics"
+	"github.com/hlts2/gweather/internal/report"
+	"github.com/hlts2/gweather/internal/store"
+)
+
+const (
+	// EventsPath is the path of the stream of Server-Sent Events.
+	EventsPath = "/events"
+
+	// WebSocketPath is the path of the stream of WebSocket.
+	WebSocketPath = "/ws"
+
+	// writeTimeout is the timeout of sending a message to a WebSocket client.
+	writeTimeout = 10 * time.Second
+)
+
+// Handler streams the events matching the query parameters over Server-Sent Events at EventsPath and WebSocket at WebSocketPath.
+// The events are filtered by area, title, office and kind, each of which accepts comma separated values,
+// and a client resumes after the event of Last-Event-ID header or last_event_id parameter by replaying the outbox.
+type Handler struct {
+	broker   *Broker
+	store    store.Store
+	origins  []string
+	upgrader websocket.Upgrader
+
+	once sync.Once
+	done chan struct{}
+}
+
+// NewHandler returns Handler which streams the events of broker and replays the events of st.
+// The browsers of origins are allowed to connect, and only the same origin is allowed if it is empty. "*" allows any origin.
+func NewHandler(broker *Broker, st store.Store, origins []string) *Handler {
+	h := &Handler{
+		broker:  broker,
+		store:   st,
+		origins: origins,
+		done:    make(chan struct{}),
+	}
+	if len(origins) > 0 {
+		h.upgrader.CheckOrigin = func(r *http.Request) bool {
+			return h.allowed(r.Header.Get("Origin"))
+		}
+	}
+	return h
+}
+
+// Close ends the streams, since the server doesn't wait for them on shutdown.
+func (h *Handler) Close() {
+	h.once.Do(func() {
+		close(h.done)
+	})
+}
+
+// ServeHTTP serves the stream of the path.
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.URL.Path {
+	case EventsPath:
+		h.serveEvents(w, r)
+	case WebSocketPath:
+		h.serveWebSocket(w, r)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (h *Handler) serveEvents(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming is not supported", http.StatusInternalServerError)
+		return
+	}
+
+	last := r.Header.Get("Last-Event-ID")
+	if last == "" {
+		last = r.URL.Query().Get("last_event_id")
+	}
+
+	sub, replay, err := h.broker.Resume(r.Context(), h.store, filter(r.URL.Query()), last)
+	if err != nil {
+		h.error(w, err)
+		return
+	}
+	defer sub.Close()
+
+	ctx, cancel := h.context(r.Context())
+	defer cancel()
+
+	metrics.StreamClients.WithLabelValues(metrics.ProtocolSSE).Inc()
+	defer metrics.StreamClients.WithLabelValues(metrics.ProtocolSSE).Dec()
+
+	if origin := r.Header.Get("Origin"); origin != "" && len(h.origins) > 0 && h.allowed(origin) {
+		w.Header().Set("Access-Control-Allow-Origin", origin)
+		w.Header().Set("Vary", "Origin")
+	}
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	send := func(ev *store.Event) error {
+		b, err := json.Marshal(ev)
+		if err != nil {
+			return errors.Wrap(err, "faild to marshal event")
+		}
+		if _, err := fmt.Fprintf(w, "id: %s\nevent: %s\ndata: %s\n\n", ev.ID, ev.Type, b); err != nil {
+			return err
+		}
+		flusher.Flush()
+		return nil
+	}
+
+	ping := func() error {
+		if _, err := fmt.Fprint(w, ": ping\n\n"); err != nil {
+			return err
+		}
+		flusher.Flush()
+		return nil
+	}
+
+	if err := sub.Send(ctx, replay, send, ping); err != nil {
+		log.New(log.SubsystemNotifier).Debugf("End stream: %v", err)
+	}
+}
+
+func (h *Handler) serveWebSocket(w http.ResponseWriter, r *http.Request) {
+	last := r.URL.Query().Get("last_event_id")
+
+	// The errors are answered before the upgrade.
+	sub, replay, err := h.broker.Resume(r.Context(), h.store, filter(r.URL.Query()), last)
+	if err != nil {
+		h.error(w, err)
+		return
+	}
+	defer sub.Close()
+
+	conn, err := h.upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		// The upgrader has answered the error.
+		return
+	}
+	defer conn.Close()
+
+	metrics.StreamClients.WithLabelValues(metrics.ProtocolWebSocket).Inc()
+	defer metrics.StreamClients.WithLabelValues(metrics.ProtocolWebSocket).Dec()
+
+	ctx, cancel := h.context(context.Background())
+	defer cancel()
+
+	// The messages from the client are discarded, and the stream ends when the connection is closed or the pongs stop.
+	conn.SetReadLimit(512)
+	conn.SetReadDeadline(time.Now().Add(2 * pingInterval))
+	conn.SetPongHandler(func(string) error {
+		return conn.SetReadDeadline(time.Now().Add(2 * pingInterval))
+	})
+	go func() {
+		defer cancel()
+		for {
+			if _, _, err := conn.NextReader(); err != nil {
+				return
+			}
+		}
+	}()
+
+	send := func(ev *store.Event) error {
+		conn.SetWriteDeadline(time.Now().Add(writeTimeout))
+		return conn.WriteJSON(ev)
+	}
+
+	ping := func() error {
+		return conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(writeTimeout))
+	}
+
+	err = sub.Send(ctx, replay, send, ping)
+	switch err {
+	case nil:
+		conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseGoingAway, ""), time.Now().Add(writeTimeout))
+	case ErrDropped:
+		conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseTryAgainLater, err.Error()), time.Now().Add(writeTimeout))
+	}
+	if err != nil {
+		log.New(log.SubsystemNotifier).Debugf("End stream: %v", err)
+	}
+}
+
+// context returns the context of the stream, which is canceled when parent is canceled or the handler is closed.
+func (h *Handler) context(parent context.Context) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(parent)
+	go func() {
+		select {
+		case <-h.done:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	return ctx, cancel
+}
+
+func (h *Handler) error(w http.ResponseWriter, err error) {
+	if errors.Cause(err) == store.ErrInvalidEventID {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	log.New(log.SubsystemNotifier).Errorf("faild to replay events: %v", err)
+	http.Error(w, http.StatusText(http.StatusServiceUnavailable), http.StatusServiceUnavailable)
+}
+
+func (h *Handler) allowed(origin string) bool {
+	// The clients other than browsers don't send Origin.
+	if origin == "" {
+		return true
+	}
+
+	for _, o := range h.origins {
+		if o == "*" || strings.EqualFold(o, origin) {
+			return true
+		}
+	}
+	return false
+}
+
+// filter returns the filter of the query parameters, e.g. ?area=310011,310012&title=気象特別警報・警報・注意報.
+func filter(q url.Values) *report.Filter {
+	return &report.Filter{
+		Titles:  values(q["title"]),
+		Offices: values(q["office"]),
+		Areas:   values(q["area"]),
+		Kinds:   values(q["kind"]),
+	}
+}
+
+// values returns the comma separated values of the parameters.
+func values(params []string) []string {
+	var vs []string
+	for _, p := range params {
+		for _, v := range strings.Split(p, ",") {
+			if v = strings.TrimSpace(v); v != "" {
+				vs = append(vs, v)
+			}
+		}
+	}
+	return vs
+}
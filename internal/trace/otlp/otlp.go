@@ -0,0 +1,92 @@
+package otlp
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+const (
+	// ExporterGRPC exports spans by OTLP over gRPC.
+	ExporterGRPC = "otlpgrpc"
+
+	// ExporterHTTP exports spans by OTLP over HTTP.
+	ExporterHTTP = "otlphttp"
+)
+
+// Config represents the configuration of the exporter.
+type Config struct {
+	// Exporter is ExporterGRPC or ExporterHTTP. Tracing is disabled when it is empty.
+	Exporter string
+
+	// Endpoint is host and port of the collector. The default of the exporter is used when it is empty.
+	Endpoint string
+
+	// Insecure disables TLS of the connection to the collector.
+	Insecure bool
+
+	// SampleRatio is the ratio of the traced ticks.
+	SampleRatio float64
+
+	// Version is the version of the service.
+	Version string
+}
+
+// Setup sets up the global tracer provider exporting spans to the collector.
+// The returned function flushes the remaining spans and shuts down the exporter.
+func Setup(ctx context.Context, cfg Config) (func(context.Context) error, error) {
+	if cfg.Exporter == "" {
+		return func(context.Context) error { return nil }, nil
+	}
+
+	exp, err := newExporter(ctx, cfg)
+	if err != nil {
+		return nil, errors.Wrap(err, "faild to create exporter")
+	}
+
+	tp := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exp),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(cfg.SampleRatio))),
+		sdktrace.WithResource(resource.NewSchemaless(
+			attribute.String("service.name", "gweather"),
+			attribute.String("service.version", cfg.Version),
+		)),
+	)
+	otel.SetTracerProvider(tp)
+
+	return tp.Shutdown, nil
+}
+
+func newExporter(ctx context.Context, cfg Config) (*otlptrace.Exporter, error) {
+	switch cfg.Exporter {
+	case ExporterGRPC:
+		var opts []otlptracegrpc.Option
+		if cfg.Endpoint != "" {
+			opts = append(opts, otlptracegrpc.WithEndpoint(cfg.Endpoint))
+		}
+		if cfg.Insecure {
+			opts = append(opts, otlptracegrpc.WithInsecure())
+		}
+		return otlptracegrpc.New(ctx, opts...)
+
+	case ExporterHTTP:
+		var opts []otlptracehttp.Option
+		if cfg.Endpoint != "" {
+			opts = append(opts, otlptracehttp.WithEndpoint(cfg.Endpoint))
+		}
+		if cfg.Insecure {
+			opts = append(opts, otlptracehttp.WithInsecure())
+		}
+		return otlptracehttp.New(ctx, opts...)
+
+	default:
+		return nil, errors.Errorf("unknown exporter: %s", cfg.Exporter)
+	}
+}
@@ -0,0 +1,31 @@
+package trace
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// TracerName is the name of the tracer of gweather.
+const TracerName = "github.com/hlts2/gweather"
+
+// Span is the span of an operation.
+type Span = trace.Span
+
+// Start starts a span of the operation as a child of the span in ctx.
+// It uses the global tracer provider, so the span is dropped until an exporter is set up.
+func Start(ctx context.Context, name string, attrs ...attribute.KeyValue) (context.Context, Span) {
+	return otel.Tracer(TracerName).Start(ctx, name, trace.WithAttributes(attrs...))
+}
+
+// End ends the span, and records err as the status of the span if it is not nil.
+func End(span Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
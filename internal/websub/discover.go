@@ -0,0 +1,80 @@
+package websub
+
+import (
+	"context"
+	"encoding/xml"
+	"io"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// linkHeader matches a link of the Link header, e.g. <http://alert-hub.appspot.com/>; rel="hub".
+var linkHeader = regexp.MustCompile(`<([^>]*)>\s*;\s*rel="?([^";,]*)"?`)
+
+// atomFeed represents the links of an Atom feed.
+// e.g) <link rel="hub" href="http://alert-hub.appspot.com/" />
+type atomFeed struct {
+	Links []struct {
+		Rel  string `xml:"rel,attr"`
+		Href string `xml:"href,attr"`
+	} `xml:"link"`
+}
+
+// Discover returns the hub and the topic URL of the feed of url.
+// The links of the Link headers take precedence over the links of the feed, and the topic is url without a self link.
+func Discover(ctx context.Context, client *http.Client, url string) (hub, topic string, err error) {
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return "", "", errors.Wrapf(err, "faild to create request, URL: %s", url)
+	}
+
+	resp, err := client.Do(req.WithContext(ctx))
+	if err != nil {
+		return "", "", errors.Wrapf(err, "faild to get response, URL: %s", url)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", "", errors.Errorf("unexpected status code: %d, URL: %s", resp.StatusCode, url)
+	}
+
+	for _, h := range resp.Header["Link"] {
+		for _, m := range linkHeader.FindAllStringSubmatch(h, -1) {
+			for _, rel := range strings.Fields(m[2]) {
+				switch {
+				case rel == "hub" && hub == "":
+					hub = m[1]
+				case rel == "self" && topic == "":
+					topic = m[1]
+				}
+			}
+		}
+	}
+
+	if hub == "" || topic == "" {
+		var f atomFeed
+		if err := xml.NewDecoder(io.LimitReader(resp.Body, maxBodySize)).Decode(&f); err != nil {
+			return "", "", errors.Wrapf(err, "faild to decode feed, URL: %s", url)
+		}
+
+		for _, l := range f.Links {
+			switch {
+			case l.Rel == "hub" && hub == "":
+				hub = l.Href
+			case l.Rel == "self" && topic == "":
+				topic = l.Href
+			}
+		}
+	}
+
+	if hub == "" {
+		return "", "", errors.Errorf("hub is not advertised, URL: %s", url)
+	}
+	if topic == "" {
+		topic = url
+	}
+	return hub, topic, nil
+}
@@ -0,0 +1,364 @@
+package websub
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"hash"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/hlts2/gweather/internal/log"
+	"github.com/hlts2/gweather/internal/metrics"
+)
+
+const (
+	// Path is the path of the callbacks. The callback of a feed is Path followed by the ID of the feed.
+	Path = "/websub/"
+
+	// maxBodySize is the maximum size of a delivered feed.
+	maxBodySize = 10 << 20
+
+	// verifyTimeout is the timeout of waiting for the verification of intent by the hub.
+	verifyTimeout = time.Minute
+
+	// defaultLease is the interval of renewals when the hub doesn't tell the lease.
+	defaultLease = 24 * time.Hour
+
+	minRetry = time.Minute
+	maxRetry = 30 * time.Minute
+)
+
+// signatures are the hash functions of X-Hub-Signature by method.
+var signatures = map[string]func() hash.Hash{
+	"sha1":   sha1.New,
+	"sha256": sha256.New,
+	"sha384": sha512.New384,
+	"sha512": sha512.New,
+}
+
+// Config represents the configuration of Subscriber.
+type Config struct {
+	// Callback is the public URL routed to Path of the server.
+	Callback string
+
+	// Hub is the URL of the hub. The hub advertised by the feed is used if it is empty.
+	Hub string
+
+	// Secret is the secret of the signatures of the deliveries. A random secret is used if it is empty.
+	Secret string
+
+	// Lease is the lease requested to the hub. The hub decides it if it is zero.
+	Lease time.Duration
+
+	// Client is used to discover the hubs and to subscribe.
+	Client *http.Client
+}
+
+// Delivery represents a feed document delivered by the hub.
+type Delivery struct {
+	Feed string
+	Data []byte
+}
+
+type subscription struct {
+	feed   string
+	secret string
+
+	// topic and mode are the topic and the mode waiting for the verification of intent.
+	topic    string
+	mode     string
+	verified chan time.Duration
+}
+
+// Subscriber subscribes to the feeds at their hubs as a WebSub subscriber, and receives the deliveries at the callbacks.
+type Subscriber struct {
+	mu   sync.Mutex
+	cfg  Config
+	subs map[string]*subscription
+	c    chan *Delivery
+}
+
+// New returns Subscriber of feeds.
+func New(feeds []string, cfg Config) (*Subscriber, error) {
+	if cfg.Client == nil {
+		cfg.Client = http.DefaultClient
+	}
+
+	s := &Subscriber{
+		cfg:  cfg,
+		subs: make(map[string]*subscription),
+		c:    make(chan *Delivery, 16),
+	}
+
+	for _, feed := range feeds {
+		secret := cfg.Secret
+		if secret == "" {
+			b := make([]byte, 32)
+			if _, err := rand.Read(b); err != nil {
+				return nil, errors.Wrap(err, "faild to generate secret")
+			}
+			secret = hex.EncodeToString(b)
+		}
+
+		s.subs[id(feed)] = &subscription{
+			feed:     feed,
+			secret:   secret,
+			verified: make(chan time.Duration, 1),
+		}
+	}
+	return s, nil
+}
+
+// id returns the ID of the callback of the feed.
+func id(feed string) string {
+	h := sha256.Sum256([]byte(feed))
+	return hex.EncodeToString(h[:8])
+}
+
+// C returns the channel which receives the deliveries with valid signatures.
+func (s *Subscriber) C() <-chan *Delivery {
+	return s.c
+}
+
+// Run subscribes to the feeds and renews the subscriptions before their leases expire until ctx is canceled.
+// A failed subscription is retried with backoff, while the feeds are polled as usual.
+func (s *Subscriber) Run(ctx context.Context) {
+	var wg sync.WaitGroup
+	for cb, sub := range s.subs {
+		wg.Add(1)
+		go func(cb string, sub *subscription) {
+			defer wg.Done()
+			s.run(ctx, cb, sub)
+		}(cb, sub)
+	}
+	wg.Wait()
+}
+
+func (s *Subscriber) run(ctx context.Context, cb string, sub *subscription) {
+	l := log.New(log.SubsystemFetcher).With("feed", sub.feed)
+	retry := minRetry
+
+	for {
+		wait := retry
+		lease, err := s.subscribe(ctx, cb, sub)
+		if err != nil {
+			metrics.WebSubSubscribed.WithLabelValues(sub.feed).Set(0)
+			l.Warnf("faild to subscribe, retry in %v: %v", retry, err)
+
+			if retry *= 2; retry > maxRetry {
+				retry = maxRetry
+			}
+		} else {
+			metrics.WebSubSubscribed.WithLabelValues(sub.feed).Set(1)
+			l.With("lease", lease).Info("Subscribed to hub")
+
+			// The subscription is renewed before the lease expires.
+			retry, wait = minRetry, lease*9/10
+		}
+
+		t := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return
+		case <-t.C:
+		}
+	}
+}
+
+// subscribe requests the subscription to the hub, and returns the lease after the hub verifies the intent.
+func (s *Subscriber) subscribe(ctx context.Context, cb string, sub *subscription) (time.Duration, error) {
+	hub, topic, err := Discover(ctx, s.cfg.Client, sub.feed)
+	if err != nil && s.cfg.Hub == "" {
+		return 0, errors.Wrap(err, "faild to discover hub")
+	}
+	if s.cfg.Hub != "" {
+		hub = s.cfg.Hub
+		if topic == "" {
+			topic = sub.feed
+		}
+	}
+
+	s.mu.Lock()
+	sub.topic, sub.mode = topic, "subscribe"
+	s.mu.Unlock()
+
+	// The verification which arrived after the timeout of the previous request is discarded.
+	select {
+	case <-sub.verified:
+	default:
+	}
+
+	form := url.Values{
+		"hub.mode":     {"subscribe"},
+		"hub.topic":    {topic},
+		"hub.callback": {strings.TrimSuffix(s.cfg.Callback, "/") + "/" + cb},
+		"hub.secret":   {sub.secret},
+	}
+	if s.cfg.Lease > 0 {
+		form.Set("hub.lease_seconds", strconv.Itoa(int(s.cfg.Lease/time.Second)))
+	}
+
+	req, err := http.NewRequest(http.MethodPost, hub, strings.NewReader(form.Encode()))
+	if err != nil {
+		return 0, errors.Wrapf(err, "faild to create request, URL: %s", hub)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := s.cfg.Client.Do(req.WithContext(ctx))
+	if err != nil {
+		return 0, errors.Wrapf(err, "faild to get response, URL: %s", hub)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusAccepted && resp.StatusCode != http.StatusNoContent {
+		b, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 1024))
+		return 0, errors.Errorf("unexpected status code: %d, URL: %s, body: %s", resp.StatusCode, hub, strings.TrimSpace(string(b)))
+	}
+
+	t := time.NewTimer(verifyTimeout)
+	defer t.Stop()
+
+	select {
+	case lease := <-sub.verified:
+		return lease, nil
+	case <-t.C:
+		return 0, errors.Errorf("hub did not verify intent in %v, URL: %s", verifyTimeout, hub)
+	case <-ctx.Done():
+		return 0, ctx.Err()
+	}
+}
+
+// ServeHTTP verifies the intent of the hub by GET, and receives the deliveries by POST at the callbacks.
+func (s *Subscriber) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	sub, ok := s.subs[path.Base(r.URL.Path)]
+	s.mu.Unlock()
+
+	if !ok {
+		// The hub removes the subscription of the callback which is gone.
+		http.Error(w, "unknown subscription", http.StatusGone)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		s.verify(w, r, sub)
+	case http.MethodPost:
+		s.receive(w, r, sub)
+	default:
+		w.Header().Set("Allow", "GET, POST")
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+	}
+}
+
+func (s *Subscriber) verify(w http.ResponseWriter, r *http.Request, sub *subscription) {
+	l := log.New(log.SubsystemFetcher).With("feed", sub.feed)
+	q := r.URL.Query()
+
+	s.mu.Lock()
+	topic, mode := sub.topic, sub.mode
+	s.mu.Unlock()
+
+	switch m := q.Get("hub.mode"); {
+	case m == "denied":
+		l.Warnf("Hub denied subscription: %s", q.Get("hub.reason"))
+		metrics.WebSubSubscribed.WithLabelValues(sub.feed).Set(0)
+		w.WriteHeader(http.StatusOK)
+		return
+	case m == "" || m != mode:
+		http.Error(w, "unexpected mode", http.StatusNotFound)
+		return
+	}
+
+	if q.Get("hub.topic") != topic {
+		http.Error(w, "unexpected topic", http.StatusNotFound)
+		return
+	}
+
+	lease := defaultLease
+	if sec, err := strconv.Atoi(q.Get("hub.lease_seconds")); err == nil && sec > 0 {
+		lease = time.Duration(sec) * time.Second
+	}
+
+	select {
+	case sub.verified <- lease:
+	default:
+	}
+
+	l.Debug("Verified intent of subscription")
+	w.Header().Set("Content-Type", "text/plain")
+	w.Write([]byte(q.Get("hub.challenge")))
+}
+
+func (s *Subscriber) receive(w http.ResponseWriter, r *http.Request, sub *subscription) {
+	l := log.New(log.SubsystemFetcher).With("feed", sub.feed)
+
+	data, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, maxBodySize))
+	if err != nil {
+		http.Error(w, "faild to read body", http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	// The deliveries with invalid signatures are acknowledged but ignored, as WebSub requires.
+	if err := validSignature(r.Header.Get("X-Hub-Signature"), sub.secret, data); err != nil {
+		l.Warnf("Ignore delivery: %v", err)
+		metrics.WebSubDeliveries.WithLabelValues(sub.feed, metrics.ResultInvalid).Inc()
+		w.WriteHeader(http.StatusAccepted)
+		return
+	}
+
+	select {
+	case s.c <- &Delivery{Feed: sub.feed, Data: data}:
+		metrics.WebSubDeliveries.WithLabelValues(sub.feed, metrics.ResultAccepted).Inc()
+		l.Debug("Received delivery")
+	default:
+		// The entries are fetched by the next poll.
+		metrics.WebSubDeliveries.WithLabelValues(sub.feed, metrics.ResultDropped).Inc()
+		l.Warn("Too many deliveries, drop delivery")
+	}
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// validSignature returns an error if sig is not the HMAC of data with secret, e.g. sha256=<hex>.
+func validSignature(sig, secret string, data []byte) error {
+	if sig == "" {
+		return errors.New("no signature")
+	}
+
+	method := strings.SplitN(sig, "=", 2)
+	if len(method) != 2 {
+		return errors.Errorf("invalid signature: %s", sig)
+	}
+
+	h, ok := signatures[method[0]]
+	if !ok {
+		return errors.Errorf("unsupported signature method: %s", method[0])
+	}
+
+	want, err := hex.DecodeString(method[1])
+	if err != nil {
+		return errors.Errorf("invalid signature: %s", sig)
+	}
+
+	mac := hmac.New(h, []byte(secret))
+	mac.Write(data)
+	if !hmac.Equal(mac.Sum(nil), want) {
+		return errors.New("signature mismatch")
+	}
+	return nil
+}
@@ -0,0 +1,172 @@
+package websub
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"hash"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testFeed = "http://www.data.jma.go.jp/developer/xml/feed/extra.xml"
+
+func sign(method string, h func() hash.Hash, secret string, data []byte) string {
+	mac := hmac.New(h, []byte(secret))
+	mac.Write(data)
+	return method + "=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func TestValidSignature(t *testing.T) {
+	data := []byte("<feed></feed>")
+
+	tests := []struct {
+		name  string
+		sig   string
+		valid bool
+	}{
+		{name: "sha1", sig: sign("sha1", sha1.New, "secret", data), valid: true},
+		{name: "sha256", sig: sign("sha256", sha256.New, "secret", data), valid: true},
+		{name: "no signature", sig: ""},
+		{name: "no method", sig: hex.EncodeToString([]byte("signature"))},
+		{name: "unsupported method", sig: "md5=00"},
+		{name: "not hex", sig: "sha256=signature"},
+		{name: "other secret", sig: sign("sha256", sha256.New, "other", data)},
+		{name: "method mismatch", sig: "sha1=" + strings.SplitN(sign("sha256", sha256.New, "secret", data), "=", 2)[1]},
+	}
+
+	for _, tt := range tests {
+		err := validSignature(tt.sig, "secret", data)
+		if tt.valid && err != nil {
+			t.Errorf("%s: signature is invalid: %v", tt.name, err)
+		}
+		if !tt.valid && err == nil {
+			t.Errorf("%s: signature is valid", tt.name)
+		}
+	}
+}
+
+func newTestSubscriber(t *testing.T) (*Subscriber, *subscription) {
+	s, err := New([]string{testFeed}, Config{
+		Callback: "http://gweather.example.com" + Path,
+		Secret:   "secret",
+	})
+	if err != nil {
+		t.Fatalf("New returns error: %v", err)
+	}
+
+	sub := s.subs[id(testFeed)]
+	sub.topic, sub.mode = testFeed, "subscribe"
+	return s, sub
+}
+
+func verifyRequest(cb string, q url.Values) *http.Request {
+	return httptest.NewRequest(http.MethodGet, Path+cb+"?"+q.Encode(), nil)
+}
+
+func TestVerifyIntent(t *testing.T) {
+	s, sub := newTestSubscriber(t)
+	cb := id(testFeed)
+
+	tests := []struct {
+		name   string
+		cb     string
+		mode   string
+		topic  string
+		status int
+	}{
+		{name: "unknown callback", cb: id("http://example.com/other.xml"), mode: "subscribe", topic: testFeed, status: http.StatusGone},
+		{name: "unexpected mode", cb: cb, mode: "unsubscribe", topic: testFeed, status: http.StatusNotFound},
+		{name: "unexpected topic", cb: cb, mode: "subscribe", topic: "http://example.com/other.xml", status: http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		s.ServeHTTP(w, verifyRequest(tt.cb, url.Values{
+			"hub.mode":      {tt.mode},
+			"hub.topic":     {tt.topic},
+			"hub.challenge": {"challenge"},
+		}))
+
+		if w.Code != tt.status {
+			t.Errorf("%s: status code is %d, want %d", tt.name, w.Code, tt.status)
+		}
+		if w.Body.String() == "challenge" {
+			t.Errorf("%s: challenge is echoed", tt.name)
+		}
+		select {
+		case <-sub.verified:
+			t.Errorf("%s: subscription is verified", tt.name)
+		default:
+		}
+	}
+
+	// The intent is verified by echoing the challenge, and the lease is passed to the subscription.
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, verifyRequest(cb, url.Values{
+		"hub.mode":          {"subscribe"},
+		"hub.topic":         {testFeed},
+		"hub.challenge":     {"challenge"},
+		"hub.lease_seconds": {"3600"},
+	}))
+
+	if w.Code != http.StatusOK || w.Body.String() != "challenge" {
+		t.Fatalf("status code is %d and body is %q, want %d and challenge", w.Code, w.Body.String(), http.StatusOK)
+	}
+	select {
+	case lease := <-sub.verified:
+		if lease != time.Hour {
+			t.Errorf("lease is %v, want %v", lease, time.Hour)
+		}
+	default:
+		t.Error("subscription is not verified")
+	}
+}
+
+func TestReceive(t *testing.T) {
+	s, _ := newTestSubscriber(t)
+	data := []byte("<feed></feed>")
+
+	tests := []struct {
+		name      string
+		sig       string
+		delivered bool
+	}{
+		{name: "valid signature", sig: sign("sha256", sha256.New, "secret", data), delivered: true},
+		{name: "invalid signature", sig: sign("sha256", sha256.New, "other", data)},
+		{name: "no signature", sig: ""},
+	}
+
+	for _, tt := range tests {
+		r := httptest.NewRequest(http.MethodPost, Path+id(testFeed), strings.NewReader(string(data)))
+		if tt.sig != "" {
+			r.Header.Set("X-Hub-Signature", tt.sig)
+		}
+		w := httptest.NewRecorder()
+		s.ServeHTTP(w, r)
+
+		// The deliveries are acknowledged even if the signatures are invalid.
+		if w.Code != http.StatusAccepted {
+			t.Errorf("%s: status code is %d, want %d", tt.name, w.Code, http.StatusAccepted)
+		}
+
+		select {
+		case d := <-s.C():
+			if !tt.delivered {
+				t.Errorf("%s: delivery is not ignored", tt.name)
+			}
+			if d.Feed != testFeed || string(d.Data) != string(data) {
+				t.Errorf("%s: delivery is %s %q, want %s %q", tt.name, d.Feed, d.Data, testFeed, data)
+			}
+		default:
+			if tt.delivered {
+				t.Errorf("%s: delivery is not received", tt.name)
+			}
+		}
+	}
+}